@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/export"
+	"github.com/idefinity/nps-api/internal/importer"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// exportProgress is how often, in rows, export logs its progress.
+const exportProgress = 10000
+
+// runExport writes the file itself rather than a result, so -o does not
+// apply. Progress and the row count go to the log on stderr.
+func runExport(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatFlag := fs.String("format", "csv", "csv, ndjson or parquet")
+	columnsFlag := fs.String("columns", "", "comma-separated columns; default all")
+	outPath := fs.String("out", "", "output file; default stdout")
+	ff := addFilterFlags(fs, "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	format, ok := export.ParseFormat(*formatFlag)
+	if !ok {
+		return fmt.Errorf("-format must be csv, ndjson or parquet")
+	}
+	cols, err := export.ParseColumns(*columnsFlag)
+	if err != nil {
+		return err
+	}
+	f, err := ff.filter()
+	if err != nil {
+		return err
+	}
+	keyring, err := e.keyring()
+	if err != nil {
+		return err
+	}
+
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}})
+	cur, err := database.Collection("feedback").Find(ctx, f.FeedbackFilter(), opts)
+	if err != nil {
+		return fmt.Errorf("failed to query feedback: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var file *os.File
+	var w io.Writer = os.Stdout
+	if *outPath != "" {
+		if file, err = os.Create(*outPath); err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	out, err := export.NewWriter(format, w, cols)
+	if err != nil {
+		return err
+	}
+	written := 0
+	rows, err := export.Copy(ctx, cur, out, keyring, exportProgress, func() {
+		written += exportProgress
+		slog.Info("exporting", "rows", written)
+	})
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	slog.Info("feedback exported", "format", format, "rows", rows)
+	return nil
+}
+
+type importResult struct {
+	importer.Report
+}
+
+func (r importResult) table() ([]string, [][]string) {
+	f := fields{
+		{"batch", r.Batch},
+		{"dry_run", formatBool(r.DryRun)},
+		{"rows", strconv.Itoa(r.Rows)},
+		{"imported", strconv.Itoa(r.Imported)},
+		{"duplicates", strconv.Itoa(r.Duplicates)},
+		{"invalid", strconv.Itoa(r.Invalid)},
+	}
+	for _, re := range r.Errors {
+		f = append(f, [2]string{"row " + strconv.Itoa(re.Row), re.Error})
+	}
+	if r.ErrorsTruncated {
+		f = append(f, [2]string{"errors_truncated", "yes"})
+	}
+	return f.table()
+}
+
+func runImport(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	mappingPath := fs.String("mapping", "", "path to the JSON mapping file (required)")
+	dryRun := fs.Bool("dry-run", false, "validate and count rows without writing")
+	batch := fs.String("batch", "", "import_batch tag; generated when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *mappingPath == "" || fs.NArg() != 1 {
+		return fmt.Errorf("usage: nps-admin import -mapping FILE [-dry-run] [-batch ID] DATA")
+	}
+	path := fs.Arg(0)
+
+	m, err := importer.LoadMapping(*mappingPath)
+	if err != nil {
+		return err
+	}
+	format := m.Format
+	if format == "" {
+		if format, err = importer.DetectFormat(path); err != nil {
+			return err
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Imported comments get the same redaction and encryption as live ones.
+	protect, err := e.protect()
+	if err != nil {
+		return err
+	}
+
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+	im := importer.New(database.Collection("feedback"), database.Collection(stats.Collection), protect)
+	report, err := im.Run(ctx, f, m, importer.Options{Format: format, Batch: *batch, DryRun: *dryRun})
+	if printErr := e.out.print(importResult{report}); printErr != nil && err == nil {
+		err = printErr
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// feedbackResult is a feedback document with its sealed fields decrypted.
+type feedbackResult struct {
+	model.Feedback
+	CommentOriginal string `json:"comment_original,omitempty"`
+	// Deleted is set by feedback delete.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+func (r feedbackResult) table() ([]string, [][]string) {
+	f := fields{
+		{"id", r.ID.Hex()},
+		{"schema_version", r.SchemaVersion},
+		{"app", r.App},
+		{"app_version", r.AppVersion},
+		{"platform", r.Platform},
+		{"timestamp", r.Timestamp},
+		{"nps_rating", strconv.Itoa(r.NPSRating)},
+		{"nps_category", r.NPSCategory},
+		{"timezone", r.Timezone},
+		{"comment", r.Comment},
+		{"comment_original", r.CommentOriginal},
+		{"redactions", strings.Join(r.Redactions, ", ")},
+		{"received_at", formatTime(r.ReceivedAt)},
+		{"install_id", r.InstallID},
+		{"locale", r.Locale},
+		{"quarantine", formatBool(r.Quarantine)},
+		{"spam_reasons", strings.Join(r.SpamReasons, ", ")},
+		{"import_batch", r.ImportBatch},
+	}
+	if r.SurveyID != "" {
+		f = append(f, [2]string{"survey", fmt.Sprintf("%s v%d", r.SurveyID, r.SurveyVersion)})
+		for _, a := range r.Answers {
+			f = append(f, [2]string{"answer." + a.QuestionID, answerText(a)})
+		}
+	}
+	if r.Deleted {
+		f = append(f, [2]string{"deleted", "yes"})
+	}
+	return f.table()
+}
+
+// answerText formats an answer's value for the table output.
+func answerText(a model.Answer) string {
+	switch {
+	case a.Rating != nil:
+		return strconv.Itoa(*a.Rating)
+	case len(a.Choices) > 0:
+		return strings.Join(a.Choices, ", ")
+	default:
+		return a.Text
+	}
+}
+
+// reveal decrypts fb's sealed fields. Fields that fail to decrypt are left
+// empty and the error is returned alongside the rest of the document.
+func reveal(keyring *fieldcrypt.Keyring, fb model.Feedback) (feedbackResult, error) {
+	out := feedbackResult{Feedback: fb}
+	if keyring == nil {
+		if fb.CommentEnc != nil || fb.CommentOriginal != nil {
+			slog.Warn("document has encrypted fields but ENCRYPTION_KEYRING_FILE is not set", "id", fb.ID.Hex())
+		}
+		return out, nil
+	}
+	if err := fieldcrypt.DecryptFeedback(keyring, &out.Feedback); err != nil {
+		return out, err
+	}
+	original, err := fieldcrypt.OpenOriginal(keyring, &fb)
+	if err != nil {
+		return out, err
+	}
+	out.CommentOriginal = original
+	return out, nil
+}
+
+func runFeedback(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: nps-admin feedback get ID | delete -yes ID")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("feedback "+action, flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "confirm deletion (delete only)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: nps-admin feedback get ID | delete -yes ID")
+	}
+	id, err := bson.ObjectIDFromHex(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid feedback ID %q", fs.Arg(0))
+	}
+	if action != "get" && action != "delete" {
+		return fmt.Errorf("unknown feedback action %q: use get or delete", action)
+	}
+	if action == "delete" && !*yes {
+		return fmt.Errorf("refusing to delete without -yes; check the document with feedback get first")
+	}
+
+	keyring, err := e.keyring()
+	if err != nil {
+		return err
+	}
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+	coll := database.Collection("feedback")
+	filter := bson.D{{Key: "_id", Value: id}}
+
+	var fb model.Feedback
+	if action == "get" {
+		err = coll.FindOne(ctx, filter).Decode(&fb)
+	} else {
+		err = coll.FindOneAndDelete(ctx, filter).Decode(&fb)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("feedback %s not found", id.Hex())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s feedback: %w", action, err)
+	}
+
+	if action == "delete" && !fb.Quarantine {
+		// Quarantined documents were never counted.
+		if err := stats.Forget(ctx, database.Collection(stats.Collection), &fb); err != nil {
+			slog.Error("feedback deleted but the daily rollup was not updated; run rebuild-stats", "id", id.Hex(), "error", err)
+		}
+	}
+
+	res, err := reveal(keyring, fb)
+	if err != nil {
+		slog.Warn("failed to decrypt feedback", "id", id.Hex(), "error", err)
+	}
+	res.Deleted = action == "delete"
+	return e.out.print(res)
+}
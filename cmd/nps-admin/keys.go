@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+)
+
+func runKeys(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: nps-admin keys generate [-id ID] | list | rekey [-dry-run]")
+	}
+	switch args[0] {
+	case "generate":
+		return runKeysGenerate(e, args[1:])
+	case "list":
+		return runKeysList(ctx, e, args[1:])
+	case "rekey":
+		return runKeysRekey(ctx, e, args[1:])
+	default:
+		return fmt.Errorf("unknown keys action %q: use generate, list or rekey", args[0])
+	}
+}
+
+type generatedKey struct {
+	ID   string `json:"id"`
+	Line string `json:"line"`
+}
+
+func (k generatedKey) table() ([]string, [][]string) {
+	return []string{"KEYRING LINE"}, [][]string{{k.Line}}
+}
+
+// runKeysGenerate prints a new keyring line. It does not touch the keyring
+// file: append the line, restart the server, then run keys rekey.
+func runKeysGenerate(e *env, args []string) error {
+	fs := flag.NewFlagSet("keys generate", flag.ContinueOnError)
+	id := fs.String("id", "", "key ID; default k<number of keys + 1>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	keyring, err := e.keyring()
+	if err != nil {
+		return err
+	}
+
+	if *id == "" {
+		n := 0
+		if keyring != nil {
+			n = len(keyring.KeyIDs())
+		}
+		*id = "k" + strconv.Itoa(n+1)
+	}
+	if keyring != nil && slices.Contains(keyring.KeyIDs(), *id) {
+		return fmt.Errorf("key %q is already in the keyring", *id)
+	}
+	key, err := fieldcrypt.GenerateKey()
+	if err != nil {
+		return err
+	}
+	return e.out.print(generatedKey{ID: *id, Line: *id + ":" + key})
+}
+
+// keyUsage counts the stored values sealed under one key.
+type keyUsage struct {
+	ID        string `json:"id"`
+	Active    bool   `json:"active"`
+	InKeyring bool   `json:"in_keyring"`
+	Comments  int64  `json:"comments"`
+	Originals int64  `json:"originals"`
+	Answers   int64  `json:"answers"`
+}
+
+type keyList struct {
+	Keys              []keyUsage `json:"keys"`
+	PlaintextComments int64      `json:"plaintext_comments"`
+}
+
+func (l keyList) table() ([]string, [][]string) {
+	rows := make([][]string, 0, len(l.Keys)+1)
+	for _, k := range l.Keys {
+		rows = append(rows, []string{
+			k.ID, formatBool(k.Active), formatBool(k.InKeyring),
+			strconv.FormatInt(k.Comments, 10), strconv.FormatInt(k.Originals, 10),
+			strconv.FormatInt(k.Answers, 10),
+		})
+	}
+	rows = append(rows, []string{"(plaintext)", "", "", strconv.FormatInt(l.PlaintextComments, 10), "", ""})
+	return []string{"KEY", "ACTIVE", "IN KEYRING", "COMMENTS", "ORIGINALS", "ANSWERS"}, rows
+}
+
+// runKeysList shows every key in the keyring or in use by stored documents.
+// Keys in use but missing from the keyring cannot be decrypted; keys in the
+// keyring with no documents left can be retired.
+func runKeysList(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("keys list", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	keyring, err := e.keyring()
+	if err != nil {
+		return err
+	}
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+	coll := database.Collection("feedback")
+
+	usage := map[string]*keyUsage{}
+	get := func(id string) *keyUsage {
+		if usage[id] == nil {
+			usage[id] = &keyUsage{ID: id}
+		}
+		return usage[id]
+	}
+	if keyring != nil {
+		for _, id := range keyring.KeyIDs() {
+			k := get(id)
+			k.InKeyring = true
+			k.Active = id == keyring.ActiveKeyID()
+		}
+	}
+
+	comments, err := countByKey(ctx, coll, "", "comment_enc")
+	if err != nil {
+		return err
+	}
+	for id, n := range comments {
+		get(id).Comments = n
+	}
+	originals, err := countByKey(ctx, coll, "", "comment_original")
+	if err != nil {
+		return err
+	}
+	for id, n := range originals {
+		get(id).Originals = n
+	}
+	answers, err := countByKey(ctx, coll, "answers", "answers.text_enc")
+	if err != nil {
+		return err
+	}
+	for id, n := range answers {
+		get(id).Answers = n
+	}
+
+	var list keyList
+	list.PlaintextComments, err = coll.CountDocuments(ctx, bson.D{
+		{Key: "comment", Value: bson.D{{Key: "$exists", Value: true}, {Key: "$ne", Value: ""}}},
+		{Key: "comment_enc", Value: bson.D{{Key: "$exists", Value: false}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to count plaintext comments: %w", err)
+	}
+	list.Keys = make([]keyUsage, 0, len(usage))
+	for _, k := range usage {
+		list.Keys = append(list.Keys, *k)
+	}
+	slices.SortFunc(list.Keys, func(a, b keyUsage) int { return strings.Compare(a.ID, b.ID) })
+	return e.out.print(list)
+}
+
+// countByKey counts the sealed values of field under each key ID. When the
+// field lives in the elements of array, every element is counted, not every
+// document.
+func countByKey(ctx context.Context, coll *mongo.Collection, array, field string) (map[string]int64, error) {
+	match := bson.D{{Key: "$match", Value: bson.D{{Key: field, Value: bson.D{{Key: "$exists", Value: true}}}}}}
+	pipeline := mongo.Pipeline{match}
+	if array != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$unwind", Value: "$" + array}}, match)
+	}
+	cur, err := coll.Aggregate(ctx, append(pipeline, bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: "$" + field + ".key_id"},
+		{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+	}}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count %s keys: %w", field, err)
+	}
+	var groups []struct {
+		ID    string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err := cur.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to count %s keys: %w", field, err)
+	}
+	counts := make(map[string]int64, len(groups))
+	for _, g := range groups {
+		counts[g.ID] = g.Count
+	}
+	return counts, nil
+}
+
+type rekeyResult struct {
+	fieldcrypt.RekeyResult
+}
+
+func (r rekeyResult) table() ([]string, [][]string) {
+	return fields{
+		{"scanned", strconv.Itoa(r.Scanned)},
+		{"rekeyed", strconv.Itoa(r.Rekeyed)},
+		{"failed", strconv.Itoa(r.Failed)},
+	}.table()
+}
+
+func runKeysRekey(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("keys rekey", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "count documents that need re-encryption without writing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	keyring, err := e.requireKeyring()
+	if err != nil {
+		return err
+	}
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := fieldcrypt.Rekey(ctx, database.Collection("feedback"), keyring, *dryRun)
+	if err != nil {
+		return err
+	}
+	return e.out.print(rekeyResult{res})
+}
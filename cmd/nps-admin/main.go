@@ -0,0 +1,211 @@
+// Command nps-admin runs operational tasks against the database the server
+// is configured for: score and trend reports, exports and imports, key
+// management, retention, migrations, weekly digests and single-document
+// lookups. It reads the same environment variables as the server and prints
+// results to stdout as a table or, with -o json, as JSON.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/config"
+	"github.com/idefinity/nps-api/internal/db"
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/handler"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/redact"
+)
+
+// command is one nps-admin subcommand.
+type command struct {
+	usage   string
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"score": {
+		usage:   "score [filters]",
+		summary: "print the NPS breakdown",
+		run:     runScore,
+	},
+	"trend": {
+		usage:   "trend [-by day|week|month] [filters]",
+		summary: "print the NPS per day, week or month",
+		run:     runTrend,
+	},
+	"digest": {
+		usage:   "digest [-before YYYY-MM-DD] [-app APP] [-to LIST] [-dry-run [-html]]",
+		summary: "email the weekly NPS digest now, or print it",
+		run:     runDigest,
+	},
+	"export": {
+		usage:   "export [-format csv|ndjson|parquet] [-columns LIST] [-out FILE] [filters]",
+		summary: "write feedback to a file or stdout",
+		run:     runExport,
+	},
+	"import": {
+		usage:   "import -mapping FILE [-dry-run] [-batch ID] DATA",
+		summary: "import historical feedback from a CSV or JSON file",
+		run:     runImport,
+	},
+	"keys": {
+		usage:   "keys generate [-id ID] | list | rekey [-dry-run]",
+		summary: "generate keyring keys, list key usage, re-encrypt comments",
+		run:     runKeys,
+	},
+	"purge": {
+		usage:   "purge [-dry-run]",
+		summary: "apply RETENTION_RULES once",
+		run:     runPurge,
+	},
+	"migrate": {
+		usage:   "migrate up | down [-steps N] | status",
+		summary: "apply, revert or list schema migrations",
+		run:     runMigrate,
+	},
+	"rebuild-stats": {
+		usage:   "rebuild-stats [-from YYYY-MM-DD]",
+		summary: "regenerate the feedback_daily rollup from raw feedback",
+		run:     runRebuildStats,
+	},
+	"backfill-category": {
+		usage:   "backfill-category [-dry-run]",
+		summary: "correct nps_category values that do not match nps_rating",
+		run:     runBackfillCategory,
+	},
+	"feedback": {
+		usage:   "feedback get ID | delete -yes ID",
+		summary: "show or delete one feedback document",
+		run:     runFeedback,
+	},
+}
+
+func main() {
+	flag.Usage = usage
+	output := flag.String("o", "table", "output format: table or json")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "-o must be table or json\n")
+		os.Exit(2)
+	}
+
+	e := &env{cfg: config.Load(), out: printer{w: os.Stdout, json: *output == "json"}}
+	defer e.close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, e, flag.Args()[1:]); err != nil {
+		slog.Error("command failed", "command", name, "error", err)
+		e.close()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: nps-admin [-o table|json] command [flags]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for n := range commands {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	for _, n := range names {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", n, commands[n].summary)
+		fmt.Fprintf(os.Stderr, "  %-18s   nps-admin %s\n", "", commands[n].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nfilters: -app, -app-version, -platform, -locale, -from YYYY-MM-DD, -to YYYY-MM-DD (inclusive)\n")
+}
+
+// env holds what commands share: configuration, the output printer and a
+// database connection opened on first use.
+type env struct {
+	cfg      *config.Config
+	out      printer
+	database *db.Database
+}
+
+func (e *env) db(ctx context.Context) (*db.Database, error) {
+	if e.database != nil {
+		return e.database, nil
+	}
+	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	database, err := db.Connect(connectCtx, e.cfg.MongoURI, e.cfg.MongoDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB connection failed: %w", err)
+	}
+	e.database = database
+	return database, nil
+}
+
+func (e *env) close() {
+	if e.database != nil {
+		e.database.Close(context.Background())
+		e.database = nil
+	}
+}
+
+// keyring loads the configured keyring, or returns nil when
+// ENCRYPTION_KEYRING_FILE is unset.
+func (e *env) keyring() (*fieldcrypt.Keyring, error) {
+	if e.cfg.EncryptionKeyringFile == "" {
+		return nil, nil
+	}
+	return fieldcrypt.LoadKeyring(e.cfg.EncryptionKeyringFile, e.cfg.EncryptionActiveKeyID)
+}
+
+func (e *env) requireKeyring() (*fieldcrypt.Keyring, error) {
+	if e.cfg.EncryptionKeyringFile == "" {
+		return nil, fmt.Errorf("ENCRYPTION_KEYRING_FILE is not set")
+	}
+	return e.keyring()
+}
+
+// protect returns the redaction and encryption step live submissions go
+// through, configured like the server's.
+func (e *env) protect() (func(fb *model.Feedback) error, error) {
+	rules, err := redact.ParseBuiltins(e.cfg.RedactRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDACT_RULES: %w", err)
+	}
+	redactor, err := redact.New(rules, e.cfg.RedactCustomRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDACT_CUSTOM_RULES: %w", err)
+	}
+	if len(redactor.Rules()) == 0 {
+		redactor = nil
+	}
+	keyring, err := e.keyring()
+	if err != nil {
+		return nil, err
+	}
+	if e.cfg.RedactKeepOriginal && keyring == nil {
+		return nil, fmt.Errorf("REDACT_KEEP_ORIGINAL requires ENCRYPTION_KEYRING_FILE")
+	}
+	return handler.NewFeedbackHandler(handler.Deps{
+		Redactor:     redactor,
+		KeepOriginal: e.cfg.RedactKeepOriginal,
+		Keyring:      keyring,
+	}).Protect, nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/idefinity/nps-api/internal/db"
+	"github.com/idefinity/nps-api/internal/retention"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+type purgeResult struct {
+	retention.Report
+}
+
+func (r purgeResult) table() ([]string, [][]string) {
+	rows := make([][]string, len(r.Rules))
+	for i, rule := range r.Rules {
+		rows[i] = []string{
+			rule.App, rule.Target, rule.MaxAge, formatTime(rule.Cutoff),
+			strconv.FormatInt(rule.Matched, 10), formatBool(rule.ByTTL),
+		}
+	}
+	return []string{"APP", "TARGET", "MAX AGE", "CUTOFF", "MATCHED", "BY TTL"}, rows
+}
+
+func runPurge(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be purged without modifying anything")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rules, err := retention.ParseRules(e.cfg.RetentionRules)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("RETENTION_RULES is not set")
+	}
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	purger := retention.New(database.Collection("feedback"), rules, e.cfg.RetentionUseTTL)
+	if !*dryRun {
+		if err := purger.EnsureTTL(ctx); err != nil {
+			return err
+		}
+	}
+	report, err := purger.Run(ctx, time.Now().UTC(), *dryRun)
+	if err != nil {
+		return err
+	}
+	return e.out.print(purgeResult{report})
+}
+
+type migrationsResult []db.MigrationStatus
+
+func (m migrationsResult) table() ([]string, [][]string) {
+	rows := make([][]string, len(m))
+	for i, s := range m {
+		applied := ""
+		if s.AppliedAt != nil {
+			applied = formatTime(*s.AppliedAt)
+		}
+		rows[i] = []string{strconv.Itoa(s.Version), s.Name, applied}
+	}
+	return []string{"VERSION", "NAME", "APPLIED AT"}, rows
+}
+
+func runMigrate(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: nps-admin migrate up | down [-steps N] | status")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+	steps := fs.Int("steps", 1, "number of migrations to revert (down only)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	migrator := db.NewMigrator(database)
+	var res []db.MigrationStatus
+	switch action {
+	case "up":
+		res, err = migrator.Up(ctx)
+	case "down":
+		if *steps < 1 {
+			return fmt.Errorf("-steps must be at least 1")
+		}
+		res, err = migrator.Down(ctx, *steps)
+	case "status":
+		res, err = migrator.Status(ctx)
+	default:
+		return fmt.Errorf("unknown migrate action %q: use up, down or status", action)
+	}
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		res = []db.MigrationStatus{}
+	}
+	return e.out.print(migrationsResult(res))
+}
+
+type rebuildResult struct {
+	stats.RebuildResult
+}
+
+func (r rebuildResult) table() ([]string, [][]string) {
+	from := "all"
+	if r.From != nil {
+		from = r.From.Format(time.DateOnly)
+	}
+	return fields{
+		{"from", from},
+		{"documents", strconv.FormatInt(r.Documents, 10)},
+		{"rollups", strconv.Itoa(r.Rollups)},
+	}.table()
+}
+
+func runRebuildStats(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("rebuild-stats", flag.ContinueOnError)
+	fromFlag := fs.String("from", "", "only rebuild days from this date (YYYY-MM-DD); default all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var from time.Time
+	if *fromFlag != "" {
+		var err error
+		if from, err = time.Parse(time.DateOnly, *fromFlag); err != nil {
+			return fmt.Errorf("invalid -from date %q", *fromFlag)
+		}
+	}
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := stats.Rebuild(ctx, database.Collection("feedback"), database.Collection(stats.Collection), from)
+	if err != nil {
+		return err
+	}
+	return e.out.print(rebuildResult{res})
+}
+
+// categoryRanges are the rating ranges of each NPS category, matching
+// model.CategoryForRating.
+var categoryRanges = []struct {
+	category string
+	min, max int
+}{
+	{"promoter", 9, 10},
+	{"passive", 7, 8},
+	{"detractor", 1, 6},
+}
+
+// backfillFilter matches documents in a rating range whose stored category
+// is anything else, including missing.
+func backfillFilter(category string, min, max int) bson.D {
+	return bson.D{
+		{Key: "nps_rating", Value: bson.D{{Key: "$gte", Value: min}, {Key: "$lte", Value: max}}},
+		{Key: "nps_category", Value: bson.D{{Key: "$ne", Value: category}}},
+	}
+}
+
+type backfillResult struct {
+	DryRun bool `json:"dry_run"`
+	// Fixed counts corrected documents per category they were moved to.
+	Fixed   map[string]int64     `json:"fixed"`
+	Rebuild *stats.RebuildResult `json:"rebuild,omitempty"`
+}
+
+func (r backfillResult) table() ([]string, [][]string) {
+	f := fields{{"dry_run", formatBool(r.DryRun)}}
+	for _, cr := range categoryRanges {
+		f = append(f, [2]string{"fixed " + cr.category, strconv.FormatInt(r.Fixed[cr.category], 10)})
+	}
+	if r.Rebuild != nil {
+		f = append(f, [2]string{"rollups rebuilt", strconv.Itoa(r.Rebuild.Rollups)})
+	}
+	return f.table()
+}
+
+// runBackfillCategory rewrites nps_category from nps_rating wherever the two
+// disagree, as older clients and imports sometimes sent the wrong category.
+// The rollup counts categories as stored, so it is rebuilt afterwards.
+func runBackfillCategory(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("backfill-category", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "count mismatched documents without writing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+	coll := database.Collection("feedback")
+
+	res := backfillResult{DryRun: *dryRun, Fixed: map[string]int64{}}
+	var total int64
+	for _, cr := range categoryRanges {
+		filter := backfillFilter(cr.category, cr.min, cr.max)
+		var n int64
+		if *dryRun {
+			n, err = coll.CountDocuments(ctx, filter)
+		} else {
+			var ur *mongo.UpdateResult
+			ur, err = coll.UpdateMany(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "nps_category", Value: cr.category}}}})
+			if ur != nil {
+				n = ur.ModifiedCount
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to backfill %s: %w", cr.category, err)
+		}
+		res.Fixed[cr.category] = n
+		total += n
+	}
+
+	if total > 0 && !*dryRun {
+		rebuild, err := stats.Rebuild(ctx, coll, database.Collection(stats.Collection), time.Time{})
+		if err != nil {
+			return err
+		}
+		res.Rebuild = &rebuild
+	}
+	return e.out.print(res)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// tabular is implemented by results that can be shown as a table. Results
+// that are not tabular are always printed as JSON.
+type tabular interface {
+	table() (header []string, rows [][]string)
+}
+
+// printer writes command results as aligned tables or indented JSON.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func (p printer) print(v any) error {
+	t, ok := v.(tabular)
+	if p.json || !ok {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	header, rows := t.table()
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, c := range row {
+			cells[i] = cell(c)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// cell flattens whitespace that would break table alignment, such as
+// newlines in comments.
+func cell(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// fields is a two-column FIELD/VALUE table built from name, value pairs.
+type fields [][2]string
+
+func (f fields) table() ([]string, [][]string) {
+	rows := make([][]string, len(f))
+	for i, kv := range f {
+		rows[i] = kv[:]
+	}
+	return []string{"FIELD", "VALUE"}, rows
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
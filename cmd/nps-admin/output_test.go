@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+func TestPrinter_Table(t *testing.T) {
+	var buf bytes.Buffer
+	p := printer{w: &buf}
+	res := trendResult{{
+		Start:   time.Date(2026, 3, 30, 0, 0, 0, 0, time.UTC),
+		Summary: stats.Summary{Total: 4, Promoters: 2, Passives: 1, Detractors: 1, NPS: 25},
+	}}
+	if err := p.print(res); err != nil {
+		t.Fatal(err)
+	}
+	want := "PERIOD      TOTAL  PROMOTERS  PASSIVES  DETRACTORS  NPS\n" +
+		"2026-03-30  4      2          1         1           25.0\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestPrinter_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	p := printer{w: &buf, json: true}
+	if err := p.print(scoreResult{stats.Summary{Total: 1, Source: stats.SourceRollup}}); err != nil {
+		t.Fatal(err)
+	}
+	// The wrapper must not change the JSON shape of the embedded result.
+	if !strings.Contains(buf.String(), `"total": 1`) || !strings.Contains(buf.String(), `"source": "rollup"`) {
+		t.Errorf("unexpected JSON %s", buf.String())
+	}
+}
+
+func TestCell_FlattensWhitespace(t *testing.T) {
+	if got := cell("great\napp\tthanks "); got != "great app thanks" {
+		t.Errorf("got %q", got)
+	}
+	if got := cell(""); got != "-" {
+		t.Errorf("empty cell = %q, want -", got)
+	}
+}
+
+func TestFilterFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	ff := addFilterFlags(fs, "")
+	if err := fs.Parse([]string{"-app", "idefinity", "-from", "2026-03-01", "-to", "2026-03-31"}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := ff.filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.App != "idefinity" || !f.To.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected filter %+v", f)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	ff = addFilterFlags(fs, "")
+	fs.Parse([]string{"-from", "2026-03-02", "-to", "2026-03-01"})
+	if _, err := ff.filter(); err == nil {
+		t.Error("expected an error for -from after -to")
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/digest"
+	"github.com/idefinity/nps-api/internal/i18n"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// filterFlags registers the filters shared by score, trend and export.
+type filterFlags struct {
+	app, appVersion, platform, locale, from, to *string
+}
+
+func addFilterFlags(fs *flag.FlagSet, defaultFrom string) filterFlags {
+	return filterFlags{
+		app:        fs.String("app", "", "only this app"),
+		appVersion: fs.String("app-version", "", "only this app version"),
+		platform:   fs.String("platform", "", "only this platform"),
+		locale:     fs.String("locale", "", "only this language, including its regional variants"),
+		from:       fs.String("from", defaultFrom, "first UTC day, YYYY-MM-DD"),
+		to:         fs.String("to", "", "last UTC day, YYYY-MM-DD (inclusive)"),
+	}
+}
+
+// filter builds a day-aligned stats filter, so reports without -locale are
+// answered from the daily rollup.
+func (ff filterFlags) filter() (stats.Filter, error) {
+	f := stats.Filter{App: *ff.app, AppVersion: *ff.appVersion, Platform: *ff.platform, Locale: i18n.Normalize(*ff.locale)}
+	if f.Locale != "" && !i18n.ValidTag(f.Locale) {
+		return f, fmt.Errorf("invalid -locale %q", *ff.locale)
+	}
+	var err error
+	if *ff.from != "" {
+		if f.From, err = time.Parse(time.DateOnly, *ff.from); err != nil {
+			return f, fmt.Errorf("invalid -from date %q", *ff.from)
+		}
+	}
+	if *ff.to != "" {
+		if f.To, err = time.Parse(time.DateOnly, *ff.to); err != nil {
+			return f, fmt.Errorf("invalid -to date %q", *ff.to)
+		}
+		f.To = f.To.AddDate(0, 0, 1)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return f, fmt.Errorf("-from must not be after -to")
+	}
+	return f, nil
+}
+
+type scoreResult struct {
+	stats.Summary
+}
+
+func (s scoreResult) table() ([]string, [][]string) {
+	f := fields{
+		{"total", strconv.FormatInt(s.Total, 10)},
+		{"promoters", strconv.FormatInt(s.Promoters, 10)},
+		{"passives", strconv.FormatInt(s.Passives, 10)},
+		{"detractors", strconv.FormatInt(s.Detractors, 10)},
+		{"nps", strconv.FormatFloat(s.NPS, 'f', 1, 64)},
+		{"source", s.Source},
+	}
+	for r := 0; r <= 10; r++ {
+		key := strconv.Itoa(r)
+		f = append(f, [2]string{"rating " + key, strconv.FormatInt(s.Ratings[key], 10)})
+	}
+	return f.table()
+}
+
+func runScore(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("score", flag.ContinueOnError)
+	ff := addFilterFlags(fs, "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := ff.filter()
+	if err != nil {
+		return err
+	}
+
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+	reader := stats.NewReader(database.Collection("feedback"), database.Collection(stats.Collection))
+	summary, err := reader.Summary(ctx, f)
+	if err != nil {
+		return err
+	}
+	return e.out.print(scoreResult{summary})
+}
+
+type trendResult []stats.TrendPoint
+
+func (t trendResult) table() ([]string, [][]string) {
+	rows := make([][]string, len(t))
+	for i, p := range t {
+		rows[i] = []string{
+			p.Start.Format(time.DateOnly),
+			strconv.FormatInt(p.Total, 10),
+			strconv.FormatInt(p.Promoters, 10),
+			strconv.FormatInt(p.Passives, 10),
+			strconv.FormatInt(p.Detractors, 10),
+			strconv.FormatFloat(p.NPS, 'f', 1, 64),
+		}
+	}
+	return []string{"PERIOD", "TOTAL", "PROMOTERS", "PASSIVES", "DETRACTORS", "NPS"}, rows
+}
+
+func runTrend(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("trend", flag.ContinueOnError)
+	by := fs.String("by", stats.PeriodWeek, "period: day, week or month")
+	ff := addFilterFlags(fs, time.Now().UTC().AddDate(0, 0, -90).Format(time.DateOnly))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := ff.filter()
+	if err != nil {
+		return err
+	}
+
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+	reader := stats.NewReader(database.Collection("feedback"), database.Collection(stats.Collection))
+	points, err := reader.Trend(ctx, f, *by)
+	if err != nil {
+		return err
+	}
+	return e.out.print(trendResult(points))
+}
+
+type digestResult []digest.Message
+
+func (d digestResult) table() ([]string, [][]string) {
+	rows := make([][]string, len(d))
+	for i, m := range d {
+		rows[i] = []string{strings.Join(m.To, ", "), m.Subject}
+	}
+	return []string{"TO", "SUBJECT"}, rows
+}
+
+// runDigest sends the weekly digest now, to DIGEST_RECIPIENTS or to -to. It
+// ignores what the server's scheduler has already sent.
+func runDigest(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("digest", flag.ContinueOnError)
+	before := fs.String("before", time.Now().UTC().Format(time.DateOnly), "the digest covers the seven UTC days before this one, YYYY-MM-DD")
+	app := fs.String("app", "", "only this app")
+	to := fs.String("to", "", "comma-separated addresses instead of DIGEST_RECIPIENTS")
+	dryRun := fs.Bool("dry-run", false, "print the messages instead of sending them")
+	html := fs.Bool("html", false, "with -dry-run, print the HTML part instead of the text part")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	day, err := time.Parse(time.DateOnly, *before)
+	if err != nil {
+		return fmt.Errorf("invalid -before date %q", *before)
+	}
+
+	recipients := e.cfg.DigestRecipients
+	if *to != "" {
+		recipients = map[string][]string{digest.AllApps: strings.Split(*to, ",")}
+	}
+	if *app != "" {
+		addrs := slices.Concat(recipients[*app], recipients[digest.AllApps])
+		recipients = map[string][]string{*app: slices.Compact(slices.Sorted(slices.Values(addrs)))}
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("DIGEST_RECIPIENTS is not set; pass -to")
+	}
+	if err := digest.ValidateRecipients(recipients); err != nil {
+		return err
+	}
+
+	var mailer *digest.Mailer
+	if !*dryRun {
+		if mailer, err = digest.NewMailer(digest.SMTPConfig{
+			Host:     e.cfg.SMTPHost,
+			Port:     e.cfg.SMTPPort,
+			Username: e.cfg.SMTPUsername,
+			Password: e.cfg.SMTPPassword,
+			From:     e.cfg.SMTPFrom,
+			StartTLS: e.cfg.SMTPStartTLS,
+		}); err != nil {
+			return fmt.Errorf("invalid SMTP settings: %w", err)
+		}
+	}
+
+	database, err := e.db(ctx)
+	if err != nil {
+		return err
+	}
+	keyring, err := e.keyring()
+	if err != nil {
+		return err
+	}
+	src := digest.NewMongoSource(database.Collection("feedback"), database.Collection(stats.Collection), keyring)
+	msgs, err := digest.Compose(ctx, src, recipients, digest.WeekBefore(day))
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		for _, m := range msgs {
+			body := m.Text
+			if *html {
+				body = m.HTML
+			}
+			fmt.Fprintf(e.out.w, "To: %s\nSubject: %s\n\n%s\n", strings.Join(m.To, ", "), m.Subject, body)
+		}
+		return nil
+	}
+	for i, m := range msgs {
+		if err := mailer.Send(ctx, m); err != nil {
+			return fmt.Errorf("sent %d of %d digests, %s failed: %w", i, len(msgs), m.To[0], err)
+		}
+	}
+	return e.out.print(digestResult(msgs))
+}
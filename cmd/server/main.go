@@ -6,15 +6,27 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
 	"github.com/getsentry/sentry-go"
+	"github.com/idefinity/nps-api/internal/anomaly"
 	"github.com/idefinity/nps-api/internal/config"
 	"github.com/idefinity/nps-api/internal/db"
+	"github.com/idefinity/nps-api/internal/digest"
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
 	"github.com/idefinity/nps-api/internal/handler"
 	"github.com/idefinity/nps-api/internal/middleware"
 	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/privacy"
+	"github.com/idefinity/nps-api/internal/redact"
+	"github.com/idefinity/nps-api/internal/retention"
+	"github.com/idefinity/nps-api/internal/slack"
+	"github.com/idefinity/nps-api/internal/spam"
+	"github.com/idefinity/nps-api/internal/stats"
+	"github.com/idefinity/nps-api/internal/stream"
+	"github.com/idefinity/nps-api/internal/webhook"
 )
 
 func main() {
@@ -27,21 +39,92 @@ func main() {
 	database, cleanup := connectMongo(cfg)
 	defer cleanup()
 
-	mux := handler.RegisterRoutes(database)
+	if cfg.MigrateOnBoot {
+		migrate(database)
+	}
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	purger := newPurger(cfg, database)
+	if purger != nil {
+		startPurger(bgCtx, cfg, purger)
+	}
+
+	keyring := loadKeyring(cfg)
+	if cfg.RedactKeepOriginal && keyring == nil {
+		slog.Error("REDACT_KEEP_ORIGINAL requires ENCRYPTION_KEYRING_FILE")
+		os.Exit(1)
+	}
+
+	webhooks := newWebhooks(bgCtx, cfg, database, keyring)
+	startDigest(bgCtx, cfg, database, keyring)
+	startAnomalyEngine(bgCtx, cfg, database)
+	hub := newStreamHub(bgCtx, cfg, database, keyring)
+	corsMW, webOrigins := newCORSMiddleware(cfg)
+
+	mux := handler.RegisterRoutes(handler.Deps{
+		DB:           database,
+		Spam:         newSpamDetector(cfg),
+		TrustProxy:   cfg.TrustProxy,
+		Redactor:     newRedactor(cfg),
+		KeepOriginal: cfg.RedactKeepOriginal,
+		Keyring:      keyring,
+		InstallIDs:   newInstallIDHasher(cfg),
+		Retention:    purger,
+		Webhooks:     webhooks,
+		Alerts:       newSlackAlerter(bgCtx, cfg),
+
+		Stream:            hub,
+		StreamFromChanges: cfg.StreamSource == streamSourceChanges,
+
+		WebWidget:  cfg.WebWidgetEnabled,
+		WebOrigins: webOrigins,
+		WebApps:    cfg.WebApps,
+	})
+
+	// Read-scope keys, which admin keys include, reveal comment text, so they
+	// must never be the client keys that ship in the desktop apps.
+	readKeys := slices.Concat(cfg.ReadAPIKeys, cfg.AdminAPIKeys)
+	if slices.ContainsFunc(readKeys, func(k string) bool { return slices.Contains(cfg.APIKeys, k) }) {
+		slog.Error("a key in READ_API_KEYS or ADMIN_API_KEYS is also in API_KEYS")
+		os.Exit(1)
+	}
+	// The stats and comment endpoints feed the dashboard and are closed to
+	// client keys.
+	readMW := middleware.ReadScope(readKeys, []string{"/nps/api/v1/stats", "/nps/api/v1/comments"})
+	if len(readKeys) == 0 {
+		slog.Info("READ_API_KEYS and ADMIN_API_KEYS not set, stats, comments and dashboard disabled")
+	}
 
 	authMW := middleware.APIKey(cfg.APIKeys, []string{"/nps/api/"})
 	if len(cfg.APIKeys) > 0 {
+		// Read-scope holders use the read endpoints under /nps/api/ too.
+		authMW = middleware.APIKey(slices.Concat(cfg.APIKeys, readKeys), []string{"/nps/api/"})
 		slog.Info("X-API-Key auth enabled", "keys_configured", len(cfg.APIKeys))
 	}
 
+	adminMW := middleware.AdminKey(cfg.AdminAPIKeys, []string{"/nps/admin/"})
+	if len(cfg.AdminAPIKeys) == 0 {
+		slog.Info("ADMIN_API_KEYS not set, admin routes disabled")
+	}
+
+	signMW := newSignatureMiddleware(cfg)
+
 	srv := &http.Server{
 		Addr:         ":" + cfg.Port,
-		Handler:      middleware.Logging(authMW(mux)),
+		Handler:      middleware.Logging(corsMW(signMW(authMW(adminMW(readMW(mux)))))),
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
 
+	if hub != nil {
+		// Shutdown does not wait for hijacked or streaming responses to
+		// finish on their own; closing the hub ends them.
+		srv.RegisterOnShutdown(hub.Close)
+	}
+
 	go awaitShutdown(srv)
 
 	slog.Info("server starting", "port", cfg.Port, "prefix", "/nps")
@@ -68,6 +151,364 @@ func initSentry(cfg *config.Config) {
 	slog.Info("Sentry initialized", "environment", cfg.SentryEnv)
 }
 
+func newSpamDetector(cfg *config.Config) *spam.Detector {
+	if !cfg.SpamDetection {
+		slog.Info("spam detection disabled")
+		return nil
+	}
+	return spam.New(spam.Config{
+		BurstWindow:     cfg.SpamBurstWindow,
+		MaxPerIP:        cfg.SpamMaxPerIP,
+		MaxPerInstall:   cfg.SpamMaxPerInstall,
+		Keywords:        cfg.SpamKeywords,
+		QuarantineScore: cfg.SpamQuarantineScore,
+	})
+}
+
+// newRedactor builds the comment redactor. Misconfiguration is fatal:
+// silently storing unredacted comments is worse than refusing to start.
+func newRedactor(cfg *config.Config) *redact.Redactor {
+	rules, err := redact.ParseBuiltins(cfg.RedactRules)
+	if err != nil {
+		slog.Error("invalid REDACT_RULES", "error", err)
+		os.Exit(1)
+	}
+	redactor, err := redact.New(rules, cfg.RedactCustomRules)
+	if err != nil {
+		slog.Error("invalid REDACT_CUSTOM_RULES", "error", err)
+		os.Exit(1)
+	}
+	if len(redactor.Rules()) == 0 {
+		slog.Info("comment redaction disabled")
+		return nil
+	}
+	slog.Info("comment redaction enabled", "rules", redactor.Rules(), "keep_original", cfg.RedactKeepOriginal)
+	return redactor
+}
+
+// loadKeyring loads the field encryption keyring, or returns nil when
+// ENCRYPTION_KEYRING_FILE is unset. A configured but unreadable keyring is
+// fatal so comments are never stored in plaintext by accident.
+func loadKeyring(cfg *config.Config) *fieldcrypt.Keyring {
+	if cfg.EncryptionKeyringFile == "" {
+		return nil
+	}
+	keyring, err := fieldcrypt.LoadKeyring(cfg.EncryptionKeyringFile, cfg.EncryptionActiveKeyID)
+	if err != nil {
+		slog.Error("failed to load encryption keyring", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("comment encryption enabled", "active_key", keyring.ActiveKeyID(), "keys", len(keyring.KeyIDs()))
+	return keyring
+}
+
+// newInstallIDHasher returns nil when INSTALL_ID_SALT is unset, in which case
+// submitted install IDs are discarded rather than stored raw.
+func newInstallIDHasher(cfg *config.Config) *privacy.InstallIDHasher {
+	if cfg.InstallIDSalt == "" {
+		slog.Warn("INSTALL_ID_SALT not set, install IDs will be discarded and erasure requests cannot be served")
+		return nil
+	}
+	h, err := privacy.NewInstallIDHasher(cfg.InstallIDSalt)
+	if err != nil {
+		slog.Error("invalid INSTALL_ID_SALT", "error", err)
+		os.Exit(1)
+	}
+	return h
+}
+
+// migrate applies pending schema migrations before the server starts
+// listening. A failed migration is fatal: serving against a half-migrated
+// schema is worse than not serving.
+func migrate(database *db.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	applied, err := db.NewMigrator(database).Up(ctx)
+	if err != nil {
+		slog.Error("schema migration failed", "error", err)
+		os.Exit(1)
+	}
+	if len(applied) > 0 {
+		slog.Info("schema migrations applied", "count", len(applied), "version", applied[len(applied)-1].Version)
+	}
+}
+
+// newPurger returns nil when RETENTION_RULES is empty. Invalid rules are
+// fatal so that a typo never silently disables retention.
+func newPurger(cfg *config.Config, database *db.Database) *retention.Purger {
+	rules, err := retention.ParseRules(cfg.RetentionRules)
+	if err != nil {
+		slog.Error("invalid RETENTION_RULES", "error", err)
+		os.Exit(1)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return retention.New(database.Collection("feedback"), rules, cfg.RetentionUseTTL)
+}
+
+// startPurger syncs the TTL index with the rules and starts the periodic
+// purge job.
+func startPurger(ctx context.Context, cfg *config.Config, purger *retention.Purger) {
+	ttlCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := purger.EnsureTTL(ttlCtx); err != nil {
+		slog.Error("failed to sync retention TTL index", "error", err)
+	}
+
+	slog.Info("retention purge enabled", "rules", len(purger.Rules()), "interval", cfg.RetentionInterval)
+	go purger.Start(ctx, cfg.RetentionInterval)
+}
+
+// webhookCacheTTL is how long the notifier caches subscriptions; changes
+// made through another replica take effect within it.
+const webhookCacheTTL = time.Minute
+
+// newWebhooks returns nil when WEBHOOKS_ENABLED is false. Otherwise it starts
+// the dispatcher that sends queued deliveries and returns the notifier that
+// queues them.
+func newWebhooks(ctx context.Context, cfg *config.Config, database *db.Database, keyring *fieldcrypt.Keyring) *webhook.Notifier {
+	if !cfg.WebhooksEnabled {
+		slog.Info("webhooks disabled")
+		return nil
+	}
+	subs := webhook.NewMongoSubscriptions(database.Collection(webhook.SubscriptionCollection))
+	deliveries := webhook.NewMongoDeliveries(database.Collection(webhook.DeliveryCollection))
+	notifier := webhook.NewNotifier(subs, deliveries, webhookCacheTTL)
+
+	dispatcher := webhook.NewDispatcher(subs, deliveries,
+		webhook.MongoFeedback(database.Collection("feedback"), keyring),
+		webhook.DispatcherConfig{
+			Timeout:     cfg.WebhookTimeout,
+			MaxAttempts: cfg.WebhookMaxAttempts,
+		})
+	slog.Info("webhooks enabled", "max_attempts", cfg.WebhookMaxAttempts, "poll_interval", cfg.WebhookPollInterval)
+	go dispatcher.Start(ctx, cfg.WebhookPollInterval, notifier.Wake())
+	return notifier
+}
+
+// slackFlushInterval is how often held Slack alerts are checked; it bounds
+// how far past its batch window an alert is posted.
+const slackFlushInterval = 5 * time.Second
+
+// newSlackAlerter returns nil when SLACK_ROUTES is empty. Invalid routes or
+// quiet hours are fatal so that a typo never silently mutes the alerts.
+func newSlackAlerter(ctx context.Context, cfg *config.Config) *slack.Alerter {
+	if len(cfg.SlackRoutes) == 0 {
+		return nil
+	}
+	if err := slack.ValidateRoutes(cfg.SlackRoutes); err != nil {
+		slog.Error("invalid SLACK_ROUTES", "error", err)
+		os.Exit(1)
+	}
+	loc, err := time.LoadLocation(cfg.SlackTimezone)
+	if err != nil {
+		slog.Error("invalid SLACK_TIMEZONE", "error", err)
+		os.Exit(1)
+	}
+	quiet, err := slack.ParseQuietHours(cfg.SlackQuietHours, loc)
+	if err != nil {
+		slog.Error("invalid SLACK_QUIET_HOURS", "error", err)
+		os.Exit(1)
+	}
+
+	alerter := slack.New(slack.Config{
+		Routes:      cfg.SlackRoutes,
+		QuietHours:  quiet,
+		BatchWindow: cfg.SlackBatchWindow,
+	})
+	slog.Info("slack alerts enabled", "routes", len(cfg.SlackRoutes), "quiet_hours", cfg.SlackQuietHours,
+		"batch_window", cfg.SlackBatchWindow)
+	go alerter.Start(ctx, slackFlushInterval)
+	return alerter
+}
+
+// digestCheckInterval is how often the digest scheduler checks for a due
+// digest; it bounds how late after DIGEST_SCHEDULE a digest goes out.
+const digestCheckInterval = 5 * time.Minute
+
+// startDigest starts the weekly digest scheduler unless DIGEST_RECIPIENTS is
+// empty. Invalid recipients, schedule or SMTP settings are fatal so that a
+// typo never silently stops the digest.
+func startDigest(ctx context.Context, cfg *config.Config, database *db.Database, keyring *fieldcrypt.Keyring) {
+	if len(cfg.DigestRecipients) == 0 {
+		return
+	}
+	if err := digest.ValidateRecipients(cfg.DigestRecipients); err != nil {
+		slog.Error("invalid DIGEST_RECIPIENTS", "error", err)
+		os.Exit(1)
+	}
+	loc, err := time.LoadLocation(cfg.DigestTimezone)
+	if err != nil {
+		slog.Error("invalid DIGEST_TIMEZONE", "error", err)
+		os.Exit(1)
+	}
+	schedule, err := digest.ParseSchedule(cfg.DigestSchedule, loc)
+	if err != nil {
+		slog.Error("invalid DIGEST_SCHEDULE", "error", err)
+		os.Exit(1)
+	}
+	mailer, err := newMailer(cfg)
+	if err != nil {
+		slog.Error("invalid SMTP settings", "error", err)
+		os.Exit(1)
+	}
+
+	scheduler := digest.NewScheduler(
+		digest.NewMongoSource(database.Collection("feedback"), database.Collection(stats.Collection), keyring),
+		mailer,
+		digest.NewMongoRuns(database.Collection(digest.RunCollection)),
+		schedule, cfg.DigestRecipients)
+	slog.Info("weekly digest enabled", "schedule", cfg.DigestSchedule, "timezone", cfg.DigestTimezone,
+		"apps", len(cfg.DigestRecipients), "smtp_host", cfg.SMTPHost)
+	go scheduler.Start(ctx, digestCheckInterval)
+}
+
+func newMailer(cfg *config.Config) (*digest.Mailer, error) {
+	if !cfg.SMTPStartTLS {
+		slog.Warn("SMTP_STARTTLS is off, digests are sent unencrypted")
+	}
+	return digest.NewMailer(digest.SMTPConfig{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+		StartTLS: cfg.SMTPStartTLS,
+	})
+}
+
+// startAnomalyEngine starts evaluating the anomaly rules unless
+// ANOMALY_RULES_FILE is unset. An unreadable or invalid rules file is fatal
+// so that a typo never silently disables alerting.
+func startAnomalyEngine(ctx context.Context, cfg *config.Config, database *db.Database) {
+	if cfg.AnomalyRulesFile == "" {
+		return
+	}
+	rules, err := anomaly.LoadConfig(cfg.AnomalyRulesFile)
+	if err != nil {
+		slog.Error("invalid ANOMALY_RULES_FILE", "error", err)
+		os.Exit(1)
+	}
+	for name, ch := range rules.Channels {
+		if ch.Type == anomaly.ChannelSentry && cfg.SentryDSN == "" {
+			slog.Error("anomaly channel needs SENTRY_DSN", "channel", name)
+			os.Exit(1)
+		}
+	}
+
+	engine := anomaly.New(rules,
+		stats.NewReader(database.Collection("feedback"), database.Collection(stats.Collection)),
+		anomaly.NewMongoStates(database.Collection(anomaly.StateCollection)),
+		nil)
+	slog.Info("anomaly alerts enabled", "rules", len(rules.Rules), "interval", cfg.AnomalyInterval)
+	go engine.Start(ctx, cfg.AnomalyInterval)
+}
+
+// STREAM_SOURCE values.
+const (
+	streamSourceLocal   = "local"
+	streamSourceChanges = "changestream"
+)
+
+// newStreamHub returns the hub behind the live feedback stream, or nil when
+// STREAM_SOURCE is empty. With changestream the hub is fed from a MongoDB
+// change stream, so that every replica streams every submission.
+func newStreamHub(ctx context.Context, cfg *config.Config, database *db.Database, keyring *fieldcrypt.Keyring) *stream.Hub {
+	switch cfg.StreamSource {
+	case "":
+		return nil
+	case streamSourceLocal, streamSourceChanges:
+	default:
+		slog.Error("invalid STREAM_SOURCE", "value", cfg.StreamSource)
+		os.Exit(1)
+	}
+	hub := stream.NewHub(cfg.StreamMaxClients, stream.DefaultBuffer)
+	if cfg.StreamSource == streamSourceChanges {
+		go stream.Watch(ctx, database.Collection("feedback"), keyring, hub)
+	}
+	slog.Info("live feedback stream enabled", "source", cfg.StreamSource, "max_clients", cfg.StreamMaxClients)
+	return hub
+}
+
+// webPrefix is where the website widget is served.
+const webPrefix = "/nps/web/"
+
+// newCORSMiddleware builds the CORS policies from CORS_POLICIES_FILE, adding
+// one for the website widget from WEB_ALLOWED_ORIGINS unless the file covers
+// /nps/web/ itself. It also returns the origins allowed to frame the widget's
+// form. An unreadable file, an invalid policy or an enabled widget without
+// WEB_APPS is fatal.
+func newCORSMiddleware(cfg *config.Config) (func(http.Handler) http.Handler, []string) {
+	var policies []middleware.CORSPolicy
+	if cfg.CORSPoliciesFile != "" {
+		var err error
+		policies, err = middleware.LoadCORSPolicies(cfg.CORSPoliciesFile)
+		if err != nil {
+			slog.Error("failed to load CORS_POLICIES_FILE", "error", err)
+			os.Exit(1)
+		}
+	}
+	i := slices.IndexFunc(policies, func(p middleware.CORSPolicy) bool { return p.Prefix == webPrefix })
+	if i < 0 && len(cfg.WebOrigins) > 0 {
+		policies = append(policies, middleware.CORSPolicy{
+			Prefix:  webPrefix,
+			Origins: cfg.WebOrigins,
+			Methods: []string{http.MethodGet, http.MethodPost},
+			Headers: []string{"Accept-Language", "Content-Type", "Idempotency-Key"},
+		})
+		i = len(policies) - 1
+	}
+
+	mw, err := middleware.CORS(policies)
+	if err != nil {
+		slog.Error("invalid CORS configuration", "error", err)
+		os.Exit(1)
+	}
+	for _, p := range policies {
+		slog.Info("CORS policy enabled", "prefix", p.Prefix, "origins", p.Origins, "credentials", p.Credentials)
+	}
+
+	var webOrigins []string
+	if i >= 0 {
+		webOrigins = policies[i].Origins
+	}
+	if cfg.WebWidgetEnabled {
+		if len(cfg.WebApps) == 0 {
+			slog.Error("WEB_WIDGET_ENABLED requires WEB_APPS")
+			os.Exit(1)
+		}
+		slog.Info("web widget enabled", "allowed_origins", webOrigins, "apps", cfg.WebApps)
+	}
+	return mw, webOrigins
+}
+
+// newSignatureMiddleware verifies request signatures per SIGNATURE_MODE. An
+// unknown mode, or signing without SIGNING_SECRETS, is fatal rather than
+// leaving the API unsigned.
+func newSignatureMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	mode, ok := middleware.ParseSignatureMode(cfg.SignatureMode)
+	if !ok {
+		slog.Error("invalid SIGNATURE_MODE", "value", cfg.SignatureMode)
+		os.Exit(1)
+	}
+	if mode != middleware.SignatureOff {
+		if len(cfg.SigningSecrets) == 0 {
+			slog.Error("SIGNATURE_MODE requires SIGNING_SECRETS", "mode", mode)
+			os.Exit(1)
+		}
+		slog.Info("request signing enabled", "mode", mode, "keys_configured", len(cfg.SigningSecrets), "max_skew", cfg.SignatureMaxSkew)
+	}
+
+	return middleware.Signature(middleware.SignatureConfig{
+		Secrets:         cfg.SigningSecrets,
+		Mode:            mode,
+		MaxSkew:         cfg.SignatureMaxSkew,
+		RequirePrefixes: []string{"/nps/api/"},
+	})
+}
+
 func connectMongo(cfg *config.Config) (*db.Database, func()) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
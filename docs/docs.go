@@ -0,0 +1,11 @@
+// Package docs embeds the API documents in this directory, the OpenAPI
+// description and the feedback JSON schemas it refers to, so the server can
+// serve them.
+package docs
+
+import "embed"
+
+// FS holds openapi.json and the feedback-v*.json schemas.
+//
+//go:embed *.json
+var FS embed.FS
@@ -0,0 +1,221 @@
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/slack"
+	"github.com/idefinity/nps-api/internal/stats"
+	"github.com/idefinity/nps-api/internal/webhook"
+)
+
+// fakeSource answers from functions so tests can move the numbers between
+// runs.
+type fakeSource struct {
+	summary   func(f stats.Filter) stats.Summary
+	breakdown func(f stats.Filter, by string) []stats.Group
+}
+
+func (s *fakeSource) Summary(_ context.Context, f stats.Filter) (stats.Summary, error) {
+	return s.summary(f), nil
+}
+
+func (s *fakeSource) Breakdown(_ context.Context, f stats.Filter, by string) ([]stats.Group, error) {
+	return s.breakdown(f, by), nil
+}
+
+// recorder is an HTTP endpoint that keeps the requests it gets.
+type recorder struct {
+	mu       sync.Mutex
+	bodies   [][]byte
+	requests []*http.Request
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.bodies = append(rec.bodies, body)
+	rec.requests = append(rec.requests, r)
+}
+
+func (rec *recorder) count() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.bodies)
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`{
+		"channels": {"ops": {"type": "slack", "url": "https://hooks.slack.com/services/T0/B0/X"}},
+		"rules": [{"name": "drop", "type": "nps_drop", "app": "*", "threshold": 10, "min_responses": 20, "channels": ["ops"]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := cfg.Rules[0]
+	if r.WindowDays != 7 || r.BaselineDays != 28 || r.Recover != 7.5 || time.Duration(r.Cooldown) != DefaultCooldown {
+		t.Errorf("unexpected defaults %+v", r)
+	}
+
+	bad := map[string]string{
+		"unknown channel": `{"rules": [{"name": "x", "type": "nps_drop", "app": "a", "threshold": 10, "min_responses": 1, "channels": ["ops"]}]}`,
+		"recover above":   `{"channels": {"s": {"type": "sentry"}}, "rules": [{"name": "x", "type": "nps_drop", "app": "a", "threshold": 10, "recover": 12, "min_responses": 1, "channels": ["s"]}]}`,
+		"share over 100":  `{"channels": {"s": {"type": "sentry"}}, "rules": [{"name": "x", "type": "detractor_share", "app": "a", "threshold": 120, "min_responses": 1, "channels": ["s"]}]}`,
+		"bad cooldown":    `{"channels": {"s": {"type": "sentry"}}, "rules": [{"name": "x", "type": "nps_drop", "app": "a", "threshold": 10, "min_responses": 1, "cooldown": "soon", "channels": ["s"]}]}`,
+		"relative url":    `{"channels": {"s": {"type": "webhook", "url": "/hook"}}}`,
+		"unknown type":    `{"channels": {"s": {"type": "sentry"}}, "rules": [{"name": "x", "type": "nps_rise", "app": "a", "threshold": 10, "min_responses": 1, "channels": ["s"]}]}`,
+	}
+	for name, doc := range bad {
+		if _, err := ParseConfig([]byte(doc)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestEngine_NPSDropHysteresisAndCooldown(t *testing.T) {
+	slackRec, hookRec := &recorder{}, &recorder{}
+	slackSrv, hookSrv := httptest.NewServer(slackRec), httptest.NewServer(hookRec)
+	defer slackSrv.Close()
+	defer hookSrv.Close()
+
+	cfg, err := ParseConfig([]byte(`{
+		"channels": {
+			"ops": {"type": "slack", "url": "` + slackSrv.URL + `"},
+			"pager": {"type": "webhook", "url": "` + hookSrv.URL + `", "secret": "s3cret"}
+		},
+		"rules": [{"name": "idefinity-drop", "type": "nps_drop", "app": "idefinity",
+			"threshold": 10, "recover": 5, "min_responses": 20, "cooldown": "12h", "channels": ["ops", "pager"]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	current := 20.0
+	src := &fakeSource{summary: func(f stats.Filter) stats.Summary {
+		// The 7-day window ends with the current UTC day.
+		if f.To.Equal(stats.Day(now).AddDate(0, 0, 1)) && f.To.Sub(f.From) == 7*24*time.Hour {
+			return stats.Summary{Total: 40, NPS: current}
+		}
+		if f.To.Sub(f.From) == 28*24*time.Hour {
+			return stats.Summary{Total: 200, NPS: 35}
+		}
+		t.Fatalf("unexpected filter %+v", f)
+		return stats.Summary{}
+	}}
+	e := New(cfg, src, NewMemoryStates(), nil)
+	e.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	run := func(nps float64) []Alert {
+		t.Helper()
+		current = nps
+		alerts, err := e.RunOnce(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Hour)
+		return alerts
+	}
+
+	if a := run(20); len(a) != 1 || a[0].Status != StatusFiring || a[0].Value != 15 {
+		t.Fatalf("expected a drop of 15 to fire, got %+v", a)
+	}
+	if a := run(26); len(a) != 0 {
+		t.Fatalf("expected no alert between recover and threshold, got %+v", a)
+	}
+	if a := run(31); len(a) != 1 || a[0].Status != StatusResolved {
+		t.Fatalf("expected a drop of 4 to recover, got %+v", a)
+	}
+	if a := run(20); len(a) != 0 {
+		t.Fatalf("expected a new episode within the cooldown to be suppressed, got %+v", a)
+	}
+	if a := run(31); len(a) != 0 {
+		t.Fatalf("expected the recovery of a suppressed episode to be silent, got %+v", a)
+	}
+	now = now.Add(12 * time.Hour)
+	if a := run(20); len(a) != 1 || a[0].Status != StatusFiring {
+		t.Fatalf("expected an alert after the cooldown, got %+v", a)
+	}
+
+	if slackRec.count() != 3 || hookRec.count() != 3 {
+		t.Fatalf("expected 3 notifications per channel, got %d and %d", slackRec.count(), hookRec.count())
+	}
+	var msg slack.Message
+	json.Unmarshal(slackRec.bodies[0], &msg)
+	if msg.Blocks[0].Text.Text != "NPS alert: idefinity-drop" ||
+		!strings.Contains(msg.Blocks[1].Text.Text, "7-day NPS for idefinity is 20.0, a drop of 15.0 points against the 28 days before (35.0)") {
+		t.Errorf("unexpected slack message %+v", msg)
+	}
+
+	req, body := hookRec.requests[1], hookRec.bodies[1]
+	if req.Header.Get(webhook.HeaderEvent) != "anomaly.resolved" ||
+		!webhook.Verify("s3cret", req.Header.Get(webhook.HeaderTimestamp), body, req.Header.Get(webhook.HeaderSignature)) {
+		t.Errorf("expected a signed anomaly.resolved request, got headers %v", req.Header)
+	}
+	var payload WebhookPayload
+	json.Unmarshal(body, &payload)
+	if payload.Alert.App != "idefinity" || payload.Alert.Responses != 40 || payload.Alert.Recover != 5 {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestEngine_DetractorShareForNewVersions(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`{
+		"channels": {"s": {"type": "sentry"}},
+		"rules": [{"name": "new-version", "type": "detractor_share", "app": "*", "threshold": 40, "min_responses": 50, "channels": ["s"]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := func(version string, total, detractors int64) stats.Group {
+		return stats.Group{Value: version, Summary: stats.Summary{Total: total, Detractors: detractors}}
+	}
+	src := &fakeSource{breakdown: func(f stats.Filter, by string) []stats.Group {
+		switch {
+		case by == stats.ByApp:
+			return []stats.Group{{Value: "idefinity"}, {Value: "devtool"}}
+		case f.App == "idefinity" && f.From.IsZero():
+			return []stats.Group{group("1.3.2", 900, 100)}
+		case f.App == "idefinity":
+			return []stats.Group{group("1.3.2", 100, 80), group("1.4.0", 60, 30), group("1.4.1", 20, 20)}
+		case f.App == "devtool" && !f.From.IsZero():
+			return []stats.Group{group("0.9.0", 50, 10)}
+		}
+		return nil
+	}}
+
+	states := NewMemoryStates()
+	e := New(cfg, src, states, nil)
+	e.notifiers = map[string]Notifier{"s": notifierFunc(func(context.Context, Alert) error { return nil })}
+	alerts, err := e.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].AppVersion != "1.4.0" || alerts[0].Value != 50 {
+		t.Fatalf("expected only the new, large enough version to fire, got %+v", alerts)
+	}
+	if alerts[0].Message != "50.0% of 60 responses for idefinity 1.4.0 are detractors" {
+		t.Errorf("unexpected message %q", alerts[0].Message)
+	}
+
+	// A second replica sharing the state store does not alert again.
+	replica := New(cfg, src, states, nil)
+	replica.notifiers = e.notifiers
+	if alerts, _ := replica.RunOnce(context.Background()); len(alerts) != 0 {
+		t.Errorf("expected no duplicate alert, got %+v", alerts)
+	}
+}
+
+// notifierFunc adapts a function to Notifier.
+type notifierFunc func(ctx context.Context, a Alert) error
+
+func (f notifierFunc) Notify(ctx context.Context, a Alert) error { return f(ctx, a) }
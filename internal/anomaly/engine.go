@@ -0,0 +1,268 @@
+package anomaly
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// metrics are published under "anomaly" on the expvar endpoint.
+var metrics = expvar.NewMap("anomaly")
+
+// DefaultTimeout bounds each Slack or webhook notification.
+const DefaultTimeout = 10 * time.Second
+
+// Source supplies the numbers rules are evaluated on. *stats.Reader
+// implements it.
+type Source interface {
+	Summary(ctx context.Context, f stats.Filter) (stats.Summary, error)
+	Breakdown(ctx context.Context, f stats.Filter, by string) ([]stats.Group, error)
+}
+
+// Engine evaluates rules and sends alerts when one starts or stops firing.
+type Engine struct {
+	rules     []Rule
+	src       Source
+	states    States
+	notifiers map[string]Notifier
+	now       func() time.Time
+}
+
+// New creates an Engine for a validated Config. client sends Slack and
+// webhook notifications; nil means one with DefaultTimeout.
+func New(cfg *Config, src Source, states States, client *http.Client) *Engine {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	notifiers := make(map[string]Notifier, len(cfg.Channels))
+	for name, ch := range cfg.Channels {
+		notifiers[name] = NewNotifier(ch, client)
+	}
+	return &Engine{rules: cfg.Rules, src: src, states: states, notifiers: notifiers, now: time.Now}
+}
+
+// Start evaluates the rules every interval until ctx is cancelled.
+func (e *Engine) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := e.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("anomaly evaluation failed", "error", err)
+			metrics.Add("errors", 1)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce evaluates every rule and returns the alerts it sent. A rule that
+// fails to evaluate does not stop the others; the first error is returned.
+func (e *Engine) RunOnce(ctx context.Context) ([]Alert, error) {
+	now := e.now()
+	var alerts []Alert
+	var firstErr error
+	for _, r := range e.rules {
+		obs, err := e.observe(ctx, r, now)
+		if err == nil {
+			for _, o := range obs {
+				var a *Alert
+				if a, err = e.step(ctx, r, o, now); err != nil {
+					break
+				}
+				if a != nil {
+					e.send(ctx, r, *a)
+					alerts = append(alerts, *a)
+				}
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("rule %s: %w", r.Name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	metrics.Add("runs", 1)
+	return alerts, firstErr
+}
+
+// observation is a rule's value for one subject.
+type observation struct {
+	app, version string
+	value        float64
+	responses    int64
+	message      string
+}
+
+func (o observation) key(r Rule) string {
+	if o.version != "" {
+		return r.Name + "/" + o.app + "/" + o.version
+	}
+	return r.Name + "/" + o.app
+}
+
+// observe computes the rule's value for each app or new version with enough
+// responses. Periods end with the current UTC day, so they are answered
+// from the daily rollup.
+func (e *Engine) observe(ctx context.Context, r Rule, now time.Time) ([]observation, error) {
+	to := stats.Day(now).AddDate(0, 0, 1)
+	switch r.Type {
+	case TypeNPSDrop:
+		split := to.AddDate(0, 0, -r.WindowDays)
+		from := split.AddDate(0, 0, -r.BaselineDays)
+		apps, err := e.apps(ctx, r, from, to)
+		if err != nil {
+			return nil, err
+		}
+		var obs []observation
+		for _, app := range apps {
+			cur, err := e.src.Summary(ctx, stats.Filter{App: app, From: split, To: to})
+			if err != nil {
+				return nil, err
+			}
+			base, err := e.src.Summary(ctx, stats.Filter{App: app, From: from, To: split})
+			if err != nil {
+				return nil, err
+			}
+			if cur.Total < r.MinResponses || base.Total < r.MinResponses {
+				continue
+			}
+			drop := round1(base.NPS - cur.NPS)
+			obs = append(obs, observation{
+				app: app, value: drop, responses: cur.Total,
+				message: fmt.Sprintf("%d-day NPS for %s is %.1f, a drop of %.1f points against the %d days before (%.1f)",
+					r.WindowDays, app, cur.NPS, drop, r.BaselineDays, base.NPS),
+			})
+		}
+		return obs, nil
+
+	case TypeDetractorShare:
+		since := to.AddDate(0, 0, -r.NewWithinDays)
+		apps, err := e.apps(ctx, r, since, to)
+		if err != nil {
+			return nil, err
+		}
+		var obs []observation
+		for _, app := range apps {
+			recent, err := e.src.Breakdown(ctx, stats.Filter{App: app, From: since, To: to}, stats.ByAppVersion)
+			if err != nil {
+				return nil, err
+			}
+			older, err := e.src.Breakdown(ctx, stats.Filter{App: app, To: since}, stats.ByAppVersion)
+			if err != nil {
+				return nil, err
+			}
+			seen := map[string]bool{}
+			for _, g := range older {
+				seen[g.Value] = true
+			}
+			for _, g := range recent {
+				if seen[g.Value] || g.Total < r.MinResponses {
+					continue
+				}
+				share := round1(float64(g.Detractors) / float64(g.Total) * 100)
+				obs = append(obs, observation{
+					app: app, version: g.Value, value: share, responses: g.Total,
+					message: fmt.Sprintf("%.1f%% of %d responses for %s %s are detractors",
+						share, g.Total, app, g.Value),
+				})
+			}
+		}
+		return obs, nil
+	}
+	return nil, fmt.Errorf("unknown rule type %q", r.Type)
+}
+
+// apps returns the rule's app, or for AllApps every app with feedback in
+// [from, to).
+func (e *Engine) apps(ctx context.Context, r Rule, from, to time.Time) ([]string, error) {
+	if r.App != AllApps {
+		return []string{r.App}, nil
+	}
+	groups, err := e.src.Breakdown(ctx, stats.Filter{From: from, To: to}, stats.ByApp)
+	if err != nil {
+		return nil, err
+	}
+	apps := make([]string, len(groups))
+	for i, g := range groups {
+		apps[i] = g.Value
+	}
+	return apps, nil
+}
+
+// step moves the subject's state on and returns the alert to send, if any.
+// A rule fires above Threshold and recovers below Recover; in between the
+// state is kept. A firing episode starting within the cooldown of the last
+// notification is recorded but not notified, and neither is its recovery.
+func (e *Engine) step(ctx context.Context, r Rule, o observation, now time.Time) (*Alert, error) {
+	st, err := e.states.Get(ctx, o.key(r))
+	if err != nil {
+		return nil, err
+	}
+
+	next, status := st, ""
+	switch {
+	case !st.Firing && o.value > r.Threshold:
+		next.Firing, next.Since, next.Notified = true, now, false
+		if now.Sub(st.AlertedAt) >= time.Duration(r.Cooldown) {
+			next.Notified, next.AlertedAt, status = true, now, StatusFiring
+		} else {
+			metrics.Add("suppressed", 1)
+		}
+	case st.Firing && o.value < r.Recover:
+		next.Firing, next.Since, next.Notified = false, now, false
+		if st.Notified {
+			status = StatusResolved
+		}
+	default:
+		return nil, nil
+	}
+	next.Value = o.value
+	next.Version++
+
+	// Only the replica that stores the transition notifies it.
+	ok, err := e.states.Put(ctx, next)
+	if err != nil || !ok || status == "" {
+		return nil, err
+	}
+	return &Alert{
+		Rule:       r.Name,
+		Type:       r.Type,
+		Status:     status,
+		App:        o.app,
+		AppVersion: o.version,
+		Value:      o.value,
+		Threshold:  r.Threshold,
+		Recover:    r.Recover,
+		Responses:  o.responses,
+		Message:    o.message,
+		At:         now,
+	}, nil
+}
+
+// send notifies every channel of the rule. Failures are logged; the state
+// has already moved on, so a notification is not retried.
+func (e *Engine) send(ctx context.Context, r Rule, a Alert) {
+	slog.Warn("anomaly alert", "status", a.Status, "rule", a.Rule, "app", a.App, "app_version", a.AppVersion, "value", a.Value)
+	for _, name := range r.Channels {
+		if err := e.notifiers[name].Notify(ctx, a); err != nil {
+			slog.Error("failed to send anomaly alert", "rule", a.Rule, "channel", name, "error", err)
+			metrics.Add("failed", 1)
+			continue
+		}
+		metrics.Add("sent", 1)
+	}
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
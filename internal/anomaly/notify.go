@@ -0,0 +1,170 @@
+package anomaly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/idefinity/nps-api/internal/slack"
+	"github.com/idefinity/nps-api/internal/webhook"
+)
+
+// Alert statuses.
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Alert is a rule starting or stopping to fire for an app or app version.
+type Alert struct {
+	Rule       string  `json:"rule"`
+	Type       string  `json:"type"`
+	Status     string  `json:"status"`
+	App        string  `json:"app"`
+	AppVersion string  `json:"app_version,omitempty"`
+	Value      float64 `json:"value"`
+	Threshold  float64 `json:"threshold"`
+	Recover    float64 `json:"recover"`
+	// Responses is the number of responses the value is based on.
+	Responses int64     `json:"responses"`
+	Message   string    `json:"message"`
+	At        time.Time `json:"at"`
+}
+
+// subject names the app, or the app and version, the alert is about.
+func (a Alert) subject() string {
+	if a.AppVersion != "" {
+		return a.App + " " + a.AppVersion
+	}
+	return a.App
+}
+
+// Notifier sends alerts to one channel.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// NewNotifier returns the notifier for ch. Requests use client.
+func NewNotifier(ch Channel, client *http.Client) Notifier {
+	switch ch.Type {
+	case ChannelSlack:
+		return &slackNotifier{url: ch.URL, client: client}
+	case ChannelWebhook:
+		return &webhookNotifier{url: ch.URL, secret: ch.Secret, client: client}
+	default:
+		return sentryNotifier{}
+	}
+}
+
+type slackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, a Alert) error {
+	return slack.Post(ctx, n.client, n.url, FormatSlack(a))
+}
+
+// FormatSlack renders an alert as a Slack message.
+func FormatSlack(a Alert) slack.Message {
+	title := "NPS alert: " + a.Rule
+	if a.Status == StatusResolved {
+		title = "Resolved: " + a.Rule
+	}
+	mrkdwn := func(s string) slack.Text { return slack.Text{Type: "mrkdwn", Text: s} }
+	fields := []slack.Text{mrkdwn("*App*\n" + slack.Escape(a.App))}
+	if a.AppVersion != "" {
+		fields = append(fields, mrkdwn("*Version*\n"+slack.Escape(a.AppVersion)))
+	}
+	fields = append(fields,
+		mrkdwn(fmt.Sprintf("*Value*\n%.1f", a.Value)),
+		mrkdwn(fmt.Sprintf("*Threshold*\n%.1f (recovers below %.1f)", a.Threshold, a.Recover)),
+	)
+	text := mrkdwn(slack.Escape(a.Message))
+	return slack.Message{
+		Text: title + ": " + slack.Escape(a.Message),
+		Blocks: []slack.Block{
+			{Type: "header", Text: &slack.Text{Type: "plain_text", Text: title}},
+			{Type: "section", Text: &text},
+			{Type: "section", Fields: fields},
+			{Type: "context", Elements: []slack.Text{mrkdwn(fmt.Sprintf("%s rule · %d responses · %s",
+				a.Type, a.Responses, a.At.UTC().Format(time.RFC3339)))}},
+		},
+	}
+}
+
+// WebhookPayload is the JSON body a webhook channel receives.
+type WebhookPayload struct {
+	Event string `json:"event"`
+	Alert Alert  `json:"alert"`
+}
+
+type webhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// Notify posts the alert with the event anomaly.firing or anomaly.resolved,
+// signed like webhook deliveries when the channel has a secret.
+func (n *webhookNotifier) Notify(ctx context.Context, a Alert) error {
+	event := "anomaly." + a.Status
+	body, err := json.Marshal(WebhookPayload{Event: event, Alert: a})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nps-api-anomaly")
+	req.Header.Set(webhook.HeaderEvent, event)
+	req.Header.Set(webhook.HeaderTimestamp, ts)
+	if n.secret != "" {
+		req.Header.Set(webhook.HeaderSignature, webhook.Sign(n.secret, ts, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %d: %s", resp.StatusCode, bytes.TrimSpace(excerpt))
+	}
+	return nil
+}
+
+// sentryNotifier captures alerts as Sentry messages on the global hub, one
+// issue per rule and subject.
+type sentryNotifier struct{}
+
+func (sentryNotifier) Notify(_ context.Context, a Alert) error {
+	hub := sentry.CurrentHub().Clone()
+	if hub.Client() == nil {
+		return errors.New("Sentry is not configured")
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.LevelWarning)
+		if a.Status == StatusResolved {
+			scope.SetLevel(sentry.LevelInfo)
+		}
+		scope.SetTags(map[string]string{"anomaly.rule": a.Rule, "anomaly.status": a.Status, "app": a.App})
+		if a.AppVersion != "" {
+			scope.SetTag("app_version", a.AppVersion)
+		}
+		scope.SetFingerprint([]string{"anomaly", a.Rule, a.subject()})
+		hub.CaptureMessage(a.Message)
+	})
+	return nil
+}
@@ -0,0 +1,210 @@
+// Package anomaly evaluates alert rules over the NPS numbers on a schedule,
+// such as a drop of the 7-day NPS against the previous 28 days or a high
+// detractor share for a new app version, and notifies Slack, a webhook or
+// Sentry when a rule starts or stops firing. Rules have a recovery threshold
+// below the firing one, so a value hovering around the threshold does not
+// flap, and a cooldown between notifications.
+package anomaly
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+)
+
+// Rule types.
+const (
+	// TypeNPSDrop compares the NPS of the last WindowDays with the
+	// BaselineDays before them; its value is the drop in points.
+	TypeNPSDrop = "nps_drop"
+	// TypeDetractorShare watches each app version first seen within the
+	// last NewWithinDays; its value is the detractor share in percent.
+	TypeDetractorShare = "detractor_share"
+)
+
+// Channel types.
+const (
+	ChannelSlack   = "slack"
+	ChannelWebhook = "webhook"
+	ChannelSentry  = "sentry"
+)
+
+// AllApps as a rule's app evaluates the rule for every app with feedback.
+const AllApps = "*"
+
+// DefaultCooldown is the cooldown of rules that do not set one.
+const DefaultCooldown = 6 * time.Hour
+
+// Duration is a time.Duration written as a Go duration string in JSON, such
+// as "6h".
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"6h\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Rule is one alert rule. It fires when its value exceeds Threshold and
+// recovers when the value falls below Recover.
+type Rule struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	App  string `json:"app"`
+
+	// WindowDays and BaselineDays size the nps_drop periods; they default
+	// to 7 and 28.
+	WindowDays   int `json:"window_days,omitempty"`
+	BaselineDays int `json:"baseline_days,omitempty"`
+	// NewWithinDays is how long after its first response a version counts
+	// as new for detractor_share; it defaults to 14.
+	NewWithinDays int `json:"new_within_days,omitempty"`
+
+	Threshold float64 `json:"threshold"`
+	// Recover defaults to three quarters of Threshold.
+	Recover float64 `json:"recover,omitempty"`
+	// MinResponses is how many responses each compared period needs before
+	// the rule is evaluated at all.
+	MinResponses int64 `json:"min_responses"`
+	// Cooldown is the minimum time between two firing notifications for
+	// the same app or version; it defaults to DefaultCooldown.
+	Cooldown Duration `json:"cooldown,omitempty"`
+	Channels []string `json:"channels"`
+}
+
+// Channel is a destination for alerts.
+type Channel struct {
+	Type string `json:"type"`
+	// URL is the Slack incoming webhook or the webhook endpoint.
+	URL string `json:"url,omitempty"`
+	// Secret signs webhook requests like webhook deliveries; optional.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Config is the rules file: named channels and the rules that use them.
+type Config struct {
+	Channels map[string]Channel `json:"channels"`
+	Rules    []Rule             `json:"rules"`
+}
+
+// LoadConfig reads and validates a rules file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig parses and validates a rules file and fills in defaults.
+func ParseConfig(data []byte) (*Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid rules file: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	for name, ch := range c.Channels {
+		switch ch.Type {
+		case ChannelSlack, ChannelWebhook:
+			u, err := url.Parse(ch.URL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("channel %s: url must be an absolute http or https URL", name)
+			}
+		case ChannelSentry:
+		default:
+			return fmt.Errorf("channel %s: type must be %s, %s or %s", name, ChannelSlack, ChannelWebhook, ChannelSentry)
+		}
+	}
+
+	var names []string
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Name == "" {
+			return fmt.Errorf("rule %d: name is required", i+1)
+		}
+		if slices.Contains(names, r.Name) {
+			return fmt.Errorf("rule %s: duplicate name", r.Name)
+		}
+		names = append(names, r.Name)
+		if err := r.normalize(); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		for _, ch := range r.Channels {
+			if _, ok := c.Channels[ch]; !ok {
+				return fmt.Errorf("rule %s: unknown channel %q", r.Name, ch)
+			}
+		}
+	}
+	return nil
+}
+
+// normalize validates r and fills in its defaults.
+func (r *Rule) normalize() error {
+	if r.App == "" {
+		return errors.New("app is required")
+	}
+	switch r.Type {
+	case TypeNPSDrop:
+		r.WindowDays = cmp.Or(r.WindowDays, 7)
+		r.BaselineDays = cmp.Or(r.BaselineDays, 28)
+		if r.WindowDays < 0 || r.BaselineDays < 0 {
+			return errors.New("window_days and baseline_days must be positive")
+		}
+	case TypeDetractorShare:
+		r.NewWithinDays = cmp.Or(r.NewWithinDays, 14)
+		if r.NewWithinDays < 0 {
+			return errors.New("new_within_days must be positive")
+		}
+		if r.Threshold > 100 {
+			return errors.New("threshold is a percentage and must be at most 100")
+		}
+	default:
+		return fmt.Errorf("type must be %s or %s", TypeNPSDrop, TypeDetractorShare)
+	}
+	if r.Threshold <= 0 {
+		return errors.New("threshold must be positive")
+	}
+	if r.Recover == 0 {
+		r.Recover = r.Threshold * 3 / 4
+	}
+	if r.Recover < 0 || r.Recover >= r.Threshold {
+		return errors.New("recover must be below threshold")
+	}
+	if r.MinResponses < 1 {
+		return errors.New("min_responses must be at least 1")
+	}
+	if r.Cooldown < 0 {
+		return errors.New("cooldown must not be negative")
+	}
+	if r.Cooldown == 0 {
+		r.Cooldown = Duration(DefaultCooldown)
+	}
+	if len(r.Channels) == 0 {
+		return errors.New("at least one channel is required")
+	}
+	return nil
+}
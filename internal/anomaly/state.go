@@ -0,0 +1,116 @@
+package anomaly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// StateCollection holds one State per rule and app or version.
+const StateCollection = "anomaly_state"
+
+// State is what the engine remembers about one subject of a rule: an app,
+// or an app version for detractor_share.
+type State struct {
+	Key    string `bson:"_id"`
+	Firing bool   `bson:"firing"`
+	// Notified is whether the current firing episode was notified, so that
+	// its recovery is notified too. An episode that starts within the
+	// cooldown is neither.
+	Notified bool      `bson:"notified"`
+	Value    float64   `bson:"value"`
+	Since    time.Time `bson:"since"`
+	// AlertedAt is when a firing notification was last sent.
+	AlertedAt time.Time `bson:"alerted_at,omitempty"`
+	// Version increments on every change so that replicas evaluating the
+	// same rule agree on who sends a notification.
+	Version int64 `bson:"version"`
+}
+
+// States stores rule states.
+type States interface {
+	// Get returns the state for key, or a zero State with Key set.
+	Get(ctx context.Context, key string) (State, error)
+	// Put stores s if the stored version is s.Version-1, and reports
+	// whether it did; false means another replica changed it first.
+	Put(ctx context.Context, s State) (bool, error)
+}
+
+// MongoStates implements States on the anomaly_state collection.
+type MongoStates struct {
+	coll *mongo.Collection
+}
+
+// NewMongoStates creates a MongoStates.
+func NewMongoStates(coll *mongo.Collection) *MongoStates {
+	return &MongoStates{coll: coll}
+}
+
+// Get implements States.
+func (m *MongoStates) Get(ctx context.Context, key string) (State, error) {
+	var s State
+	err := m.coll.FindOne(ctx, bson.D{{Key: "_id", Value: key}}).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return State{Key: key}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("failed to load anomaly state: %w", err)
+	}
+	return s, nil
+}
+
+// Put implements States.
+func (m *MongoStates) Put(ctx context.Context, s State) (bool, error) {
+	if s.Version == 1 {
+		_, err := m.coll.InsertOne(ctx, s)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to store anomaly state: %w", err)
+		}
+		return true, nil
+	}
+	res, err := m.coll.ReplaceOne(ctx, bson.D{{Key: "_id", Value: s.Key}, {Key: "version", Value: s.Version - 1}}, s)
+	if err != nil {
+		return false, fmt.Errorf("failed to store anomaly state: %w", err)
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// MemoryStates implements States in memory, for tests.
+type MemoryStates struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+// NewMemoryStates creates an empty MemoryStates.
+func NewMemoryStates() *MemoryStates {
+	return &MemoryStates{states: map[string]State{}}
+}
+
+// Get implements States.
+func (m *MemoryStates) Get(_ context.Context, key string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.states[key]; ok {
+		return s, nil
+	}
+	return State{Key: key}, nil
+}
+
+// Put implements States.
+func (m *MemoryStates) Put(_ context.Context, s State) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.states[s.Key].Version != s.Version-1 {
+		return false, nil
+	}
+	m.states[s.Key] = s
+	return true, nil
+}
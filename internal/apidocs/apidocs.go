@@ -0,0 +1,152 @@
+// Package apidocs serves the OpenAPI description of the API and a viewer for
+// it. The description is docs/openapi.json, which refers to the feedback
+// JSON schemas next to it by file name so it stays usable from the
+// repository; the served copy has those schemas inlined. Like the dashboard,
+// the viewer is embedded and loads nothing from outside the server.
+package apidocs
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/idefinity/nps-api/docs"
+)
+
+//go:embed static
+var static embed.FS
+
+// contentSecurityPolicy matches the dashboard's: the viewer renders text
+// from the description and may not load anything from elsewhere.
+const contentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; " +
+	"img-src 'self' data:; connect-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// Spec returns the bundled OpenAPI description.
+var Spec = sync.OnceValue(func() []byte {
+	spec, err := Bundle(docs.FS)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+})
+
+// Bundle reads openapi.json from fsys and replaces each component schema
+// that refers to another file, such as {"$ref": "feedback-v1.json"}, with
+// that file's schema. References inside the schema are rewritten to point
+// into the component, and its $schema and $id are dropped so they resolve
+// against the description.
+func Bundle(fsys fs.FS) ([]byte, error) {
+	data, err := fs.ReadFile(fsys, "openapi.json")
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("openapi.json: %w", err)
+	}
+	components, _ := doc["components"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+	for name, s := range schemas {
+		file, ok := externalRef(s)
+		if !ok {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+		var schema map[string]any
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		delete(schema, "$schema")
+		delete(schema, "$id")
+		rewriteRefs(schema, "#/components/schemas/"+name)
+		schemas[name] = schema
+	}
+	if ref := findExternalRef(doc); ref != "" {
+		return nil, fmt.Errorf("openapi.json: reference %q is not a component schema", ref)
+	}
+	return json.Marshal(doc)
+}
+
+// externalRef returns the file a schema consisting only of a $ref to
+// another document refers to.
+func externalRef(v any) (string, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return "", false
+	}
+	ref, ok := m["$ref"].(string)
+	return ref, ok && !strings.HasPrefix(ref, "#")
+}
+
+// rewriteRefs prefixes every local reference in v with base.
+func rewriteRefs(v any, base string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if ref, ok := e.(string); ok && k == "$ref" && strings.HasPrefix(ref, "#/") {
+				v[k] = base + ref[1:]
+				continue
+			}
+			rewriteRefs(e, base)
+		}
+	case []any:
+		for _, e := range v {
+			rewriteRefs(e, base)
+		}
+	}
+}
+
+// findExternalRef returns a reference to another document left in v, or "".
+func findExternalRef(v any) string {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if ref, ok := e.(string); ok && k == "$ref" && !strings.HasPrefix(ref, "#") {
+				return ref
+			}
+			if ref := findExternalRef(e); ref != "" {
+				return ref
+			}
+		}
+	case []any:
+		for _, e := range v {
+			if ref := findExternalRef(e); ref != "" {
+				return ref
+			}
+		}
+	}
+	return ""
+}
+
+// SpecHandler serves the bundled description.
+func SpecHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write(Spec())
+	})
+}
+
+// Handler serves the viewer. It expects the path below its mount point, so
+// mount it with http.StripPrefix, one level below /nps/openapi.json.
+func Handler() http.Handler {
+	root, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	files := http.FileServerFS(root)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Cache-Control", "no-cache")
+		files.ServeHTTP(w, r)
+	})
+}
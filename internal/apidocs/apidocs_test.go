@@ -0,0 +1,121 @@
+package apidocs
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSpec(t *testing.T) {
+	var doc map[string]any
+	if err := json.Unmarshal(Spec(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("openapi = %v", doc["openapi"])
+	}
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	v1, _ := schemas["FeedbackV1"].(map[string]any)
+	if _, ok := v1["properties"].(map[string]any)["nps_rating"]; !ok {
+		t.Fatalf("FeedbackV1 is not the inlined schema: %v", v1)
+	}
+	if _, ok := v1["$id"]; ok {
+		t.Error("FeedbackV1 kept its $id")
+	}
+
+	// Every reference must resolve within the document.
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, e := range v {
+				if ref, ok := e.(string); ok && k == "$ref" {
+					if resolve(doc, ref) == nil {
+						t.Errorf("unresolved reference %s", ref)
+					}
+					continue
+				}
+				walk(e)
+			}
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(doc)
+}
+
+func resolve(doc map[string]any, ref string) any {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var v any = doc
+	for _, p := range strings.Split(ref[2:], "/") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[strings.NewReplacer("~1", "/", "~0", "~").Replace(p)]
+	}
+	return v
+}
+
+func TestBundle_RejectsStrayExternalReferences(t *testing.T) {
+	fsys := fstest.MapFS{
+		"openapi.json": {Data: []byte(`{"openapi": "3.1.0", "paths": {"/x": {"get": {"responses": {"200": {
+			"description": "ok", "content": {"application/json": {"schema": {"$ref": "feedback-v1.json"}}}}}}}}}`)},
+		"feedback-v1.json": {Data: []byte(`{"type": "object"}`)},
+	}
+	if _, err := Bundle(fsys); err == nil {
+		t.Error("expected an error for a reference outside components.schemas")
+	}
+}
+
+// TestNoExternalAssets keeps the viewer usable in air-gapped installs.
+func TestNoExternalAssets(t *testing.T) {
+	external := regexp.MustCompile(`(?i)(src|href)\s*=\s*["']?(https?:)?//|@import|url\(\s*["']?(https?:)?//|fetch\(\s*["']https?:`)
+	err := fs.WalkDir(static, "static", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(static, path)
+		if err != nil {
+			return err
+		}
+		if m := external.Find(data); m != nil {
+			t.Errorf("%s references an external asset: %s", path, m)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler()
+	for path, contentType := range map[string]string{
+		"/":          "text/html; charset=utf-8",
+		"/app.js":    "text/javascript; charset=utf-8",
+		"/style.css": "text/css; charset=utf-8",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != contentType {
+			t.Errorf("%s: got %d %q", path, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	SpecHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nps/openapi.json", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" || !json.Valid(w.Body.Bytes()) {
+		t.Errorf("spec: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
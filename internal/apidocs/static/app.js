@@ -0,0 +1,241 @@
+// The API reference viewer. It renders ../openapi.json, which is served next
+// to it, with nothing but the DOM, so it works offline. Text from the
+// description is only ever set as text, never as HTML.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+const methods = ["get", "put", "post", "delete", "options", "head", "patch"];
+
+let spec = {};
+
+function el(tag, attrs, ...children) {
+  const e = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs || {})) e.setAttribute(k, v);
+  for (const c of children) {
+    if (c !== undefined && c !== null && c !== "") e.append(c);
+  }
+  return e;
+}
+
+// inline renders `code` spans of a description line.
+function inline(text) {
+  const out = [];
+  String(text).split("`").forEach((part, i) => {
+    if (part) out.push(i % 2 ? el("code", {}, part) : part);
+  });
+  return out;
+}
+
+// markdown renders the small subset descriptions use: paragraphs, "- "
+// lists and `code`.
+function markdown(text) {
+  const box = el("div", { class: "md" });
+  if (!text) return box;
+  for (const block of String(text).split(/\n{2,}/)) {
+    const lines = block.split("\n");
+    if (lines.every((l) => l.startsWith("- "))) {
+      box.append(el("ul", {}, ...lines.map((l) => el("li", {}, ...inline(l.slice(2))))));
+    } else {
+      box.append(el("p", {}, ...inline(lines.join(" "))));
+    }
+  }
+  return box;
+}
+
+// resolve follows a local reference such as #/components/schemas/Error.
+function resolve(ref) {
+  return ref
+    .slice(2)
+    .split("/")
+    .map((p) => p.replace(/~1/g, "/").replace(/~0/g, "~"))
+    .reduce((o, k) => (o ? o[k] : undefined), spec);
+}
+
+function deref(obj) {
+  return obj && obj.$ref ? resolve(obj.$ref) || {} : obj || {};
+}
+
+function schemaName(ref) {
+  const m = /^#\/components\/schemas\/([^/]+)$/.exec(ref || "");
+  return m ? m[1] : "";
+}
+
+// typeLabel describes a schema in one line, linking named schemas.
+function typeLabel(s) {
+  if (!s) return "any";
+  const name = schemaName(s.$ref);
+  if (name) return el("a", { href: "#schema-" + name }, name);
+  if (s.$ref) return typeLabel(resolve(s.$ref));
+  for (const key of ["oneOf", "anyOf", "allOf"]) {
+    if (s[key]) {
+      const span = el("span");
+      s[key].forEach((sub, i) => {
+        if (i) span.append(key === "allOf" ? " & " : " | ");
+        span.append(typeLabel(sub));
+      });
+      return span;
+    }
+  }
+  if (s.type === "array") {
+    return el("span", {}, "array of ", typeLabel(s.items));
+  }
+  let t = Array.isArray(s.type) ? s.type.join(" | ") : s.type || "any";
+  if (s.format) t += " (" + s.format + ")";
+  if (s.const !== undefined) t += " = " + JSON.stringify(s.const);
+  if (s.enum) t += ": " + s.enum.map((v) => JSON.stringify(v)).join(", ");
+  if (s.minimum !== undefined || s.maximum !== undefined) {
+    t += " [" + (s.minimum ?? "") + "–" + (s.maximum ?? "") + "]";
+  }
+  if (s.pattern) t += " matching " + s.pattern;
+  return t;
+}
+
+// schemaTable lists an object schema's properties; other schemas get their
+// one-line description.
+function schemaTable(s, depth) {
+  s = s || {};
+  const name = schemaName(s.$ref);
+  if (name && depth > 0) return el("p", {}, typeLabel(s));
+  const schema = deref(s);
+  if (schema.allOf) {
+    return el("div", {}, ...schema.allOf.map((sub) => schemaTable(sub, depth + 1)));
+  }
+  if (schema.type !== "object" || !schema.properties) {
+    return el("p", {}, typeLabel(name ? schema : s));
+  }
+  const required = new Set(schema.required || []);
+  const rows = Object.entries(schema.properties).map(([prop, ps]) =>
+    el(
+      "tr",
+      {},
+      el("td", {}, el("code", {}, prop), required.has(prop) ? el("span", { class: "req" }, " required") : ""),
+      el("td", {}, typeLabel(ps)),
+      el("td", {}, markdown(deref(ps).description || ps.description)),
+    ),
+  );
+  return el(
+    "table",
+    {},
+    el("thead", {}, el("tr", {}, el("th", {}, "Field"), el("th", {}, "Type"), el("th", {}, "Description"))),
+    el("tbody", {}, ...rows),
+  );
+}
+
+function content(c) {
+  const box = el("div");
+  for (const [type, media] of Object.entries(c || {})) {
+    box.append(el("p", { class: "media" }, el("code", {}, type)), schemaTable(media.schema, 0));
+  }
+  return box;
+}
+
+function parameters(params) {
+  if (!params.length) return "";
+  const rows = params.map((p) => {
+    p = deref(p);
+    return el(
+      "tr",
+      {},
+      el("td", {}, el("code", {}, p.name), p.required ? el("span", { class: "req" }, " required") : ""),
+      el("td", {}, p.in),
+      el("td", {}, typeLabel(p.schema)),
+      el("td", {}, markdown(p.description)),
+    );
+  });
+  return el(
+    "div",
+    {},
+    el("h4", {}, "Parameters"),
+    el(
+      "table",
+      {},
+      el("thead", {}, el("tr", {}, el("th", {}, "Name"), el("th", {}, "In"), el("th", {}, "Type"), el("th", {}, "Description"))),
+      el("tbody", {}, ...rows),
+    ),
+  );
+}
+
+function security(op) {
+  const reqs = op.security || spec.security || [];
+  if (!reqs.length) return "No authentication";
+  return reqs.map((r) => Object.keys(r).map((k) => (spec.components.securitySchemes[k] || {}).name + " (" + k + ")").join(" + ")).join(" or ");
+}
+
+function operation(path, method, op) {
+  const id = op.operationId || method + path;
+  const box = el("section", { class: "op", id: "op-" + id });
+  box.append(
+    el("h3", {}, el("span", { class: "method " + method }, method.toUpperCase()), " ", el("code", {}, path)),
+    el("p", { class: "summary" }, op.summary || ""),
+    markdown(op.description),
+    el("p", { class: "auth" }, "Authentication: " + security(op)),
+    parameters(op.parameters || []),
+  );
+  if (op.requestBody) {
+    const body = deref(op.requestBody);
+    box.append(el("h4", {}, "Request body"), markdown(body.description), content(body.content));
+  }
+  box.append(el("h4", {}, "Responses"));
+  for (const [code, r] of Object.entries(op.responses || {})) {
+    const resp = deref(r);
+    box.append(el("div", { class: "response" }, el("p", {}, el("strong", {}, code), " ", ...inline(resp.description || "")), content(resp.content)));
+  }
+  return box;
+}
+
+function render() {
+  const info = spec.info || {};
+  document.title = (info.title || "API") + " reference";
+  $("title").textContent = document.title;
+  $("intro").append(el("p", { class: "version" }, "Version " + (info.version || "")), markdown(info.description));
+
+  const tags = (spec.tags || []).map((t) => t.name);
+  const byTag = new Map(tags.map((t) => [t, []]));
+  for (const [path, item] of Object.entries(spec.paths || {})) {
+    for (const m of methods) {
+      if (!item[m]) continue;
+      const tag = (item[m].tags || ["Other"])[0];
+      if (!byTag.has(tag)) byTag.set(tag, []);
+      byTag.get(tag).push([path, m, item[m]]);
+    }
+  }
+
+  for (const [tag, ops] of byTag) {
+    if (!ops.length) continue;
+    const list = el("ul");
+    const group = el("section", { class: "tag" }, el("h2", { id: "tag-" + tag }, tag));
+    const meta = (spec.tags || []).find((t) => t.name === tag);
+    if (meta) group.append(markdown(meta.description));
+    for (const [path, m, op] of ops) {
+      const node = operation(path, m, op);
+      group.append(node);
+      list.append(el("li", {}, el("a", { href: "#" + node.id }, el("span", { class: "method " + m }, m.toUpperCase()), " " + path)));
+    }
+    $("operations").append(group);
+    $("nav").append(el("h3", {}, el("a", { href: "#tag-" + tag }, tag)), list);
+  }
+
+  const schemas = Object.entries((spec.components || {}).schemas || {});
+  $("schemas-heading").hidden = !schemas.length;
+  for (const [name, s] of schemas) {
+    $("schemas").append(el("section", { class: "schema", id: "schema-" + name }, el("h3", {}, name), markdown(s.description), schemaTable(s, 0)));
+  }
+  if (location.hash) {
+    const target = document.getElementById(decodeURIComponent(location.hash.slice(1)));
+    if (target) target.scrollIntoView();
+  }
+}
+
+fetch(new URL("../openapi.json", location.href), { cache: "no-cache" })
+  .then((resp) => {
+    if (!resp.ok) throw new Error(resp.status + " " + resp.statusText);
+    return resp.json();
+  })
+  .then((doc) => {
+    spec = doc;
+    render();
+  })
+  .catch((err) => {
+    $("error").textContent = "Could not load the API description: " + err.message;
+    $("error").hidden = false;
+  });
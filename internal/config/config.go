@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds application configuration loaded from environment variables.
@@ -15,6 +17,66 @@ type Config struct {
 	SentryTraceRate  float64
 	AllowedPlatforms []string
 	APIKeys          []string
+	SigningSecrets   map[string]string
+	SignatureMode    string
+	SignatureMaxSkew time.Duration
+	AdminAPIKeys     []string
+	ReadAPIKeys      []string
+	TrustProxy       bool
+
+	SpamDetection       bool
+	SpamBurstWindow     time.Duration
+	SpamMaxPerIP        int
+	SpamMaxPerInstall   int
+	SpamKeywords        []string
+	SpamQuarantineScore int
+
+	RedactRules        []string
+	RedactCustomRules  map[string]string
+	RedactKeepOriginal bool
+
+	EncryptionKeyringFile string
+	EncryptionActiveKeyID string
+
+	InstallIDSalt string
+
+	RetentionRules    string
+	RetentionInterval time.Duration
+	RetentionUseTTL   bool
+
+	WebhooksEnabled     bool
+	WebhookMaxAttempts  int
+	WebhookTimeout      time.Duration
+	WebhookPollInterval time.Duration
+
+	SlackRoutes      map[string]string
+	SlackQuietHours  string
+	SlackTimezone    string
+	SlackBatchWindow time.Duration
+
+	DigestRecipients map[string][]string
+	DigestSchedule   string
+	DigestTimezone   string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	SMTPFrom         string
+	SMTPStartTLS     bool
+
+	AnomalyRulesFile string
+	AnomalyInterval  time.Duration
+
+	StreamSource     string
+	StreamMaxClients int
+
+	WebWidgetEnabled bool
+	WebOrigins       []string
+	WebApps          []string
+
+	CORSPoliciesFile string
+
+	MigrateOnBoot bool
 }
 
 // Load reads configuration from environment variables with sensible defaults.
@@ -28,6 +90,66 @@ func Load() *Config {
 		SentryTraceRate:  1.0,
 		AllowedPlatforms: getEnvCSV("ALLOWED_PLATFORMS", []string{"macOS", "Windows"}),
 		APIKeys:          getEnvCSV("API_KEYS", nil),
+		SigningSecrets:   getEnvPairs("SIGNING_SECRETS"),
+		SignatureMode:    getEnv("SIGNATURE_MODE", "off"),
+		SignatureMaxSkew: getEnvDuration("SIGNATURE_MAX_SKEW", 5*time.Minute),
+		AdminAPIKeys:     getEnvCSV("ADMIN_API_KEYS", nil),
+		ReadAPIKeys:      getEnvCSV("READ_API_KEYS", nil),
+		TrustProxy:       getEnvBool("TRUST_PROXY_HEADERS", false),
+
+		SpamDetection:       getEnvBool("SPAM_DETECTION", true),
+		SpamBurstWindow:     getEnvDuration("SPAM_BURST_WINDOW", 10*time.Minute),
+		SpamMaxPerIP:        getEnvInt("SPAM_MAX_PER_IP", 10),
+		SpamMaxPerInstall:   getEnvInt("SPAM_MAX_PER_INSTALL", 3),
+		SpamKeywords:        getEnvCSV("SPAM_KEYWORDS", nil),
+		SpamQuarantineScore: getEnvInt("SPAM_QUARANTINE_SCORE", 50),
+
+		RedactRules:        getEnvCSV("REDACT_RULES", []string{"email", "iban", "card", "ip", "phone"}),
+		RedactCustomRules:  getEnvNamedPatterns("REDACT_CUSTOM_RULES"),
+		RedactKeepOriginal: getEnvBool("REDACT_KEEP_ORIGINAL", false),
+
+		EncryptionKeyringFile: getEnv("ENCRYPTION_KEYRING_FILE", ""),
+		EncryptionActiveKeyID: getEnv("ENCRYPTION_ACTIVE_KEY_ID", ""),
+
+		InstallIDSalt: getEnv("INSTALL_ID_SALT", ""),
+
+		RetentionRules:    getEnv("RETENTION_RULES", ""),
+		RetentionInterval: getEnvDuration("RETENTION_INTERVAL", 24*time.Hour),
+		RetentionUseTTL:   getEnvBool("RETENTION_USE_TTL", true),
+
+		WebhooksEnabled:     getEnvBool("WEBHOOKS_ENABLED", true),
+		WebhookMaxAttempts:  getEnvInt("WEBHOOK_MAX_ATTEMPTS", 10),
+		WebhookTimeout:      getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookPollInterval: getEnvDuration("WEBHOOK_POLL_INTERVAL", 30*time.Second),
+
+		SlackRoutes:      getEnvPairs("SLACK_ROUTES"),
+		SlackQuietHours:  getEnv("SLACK_QUIET_HOURS", ""),
+		SlackTimezone:    getEnv("SLACK_TIMEZONE", "UTC"),
+		SlackBatchWindow: getEnvDuration("SLACK_BATCH_WINDOW", 20*time.Second),
+
+		DigestRecipients: getEnvNamedLists("DIGEST_RECIPIENTS"),
+		DigestSchedule:   getEnv("DIGEST_SCHEDULE", "mon 08:00"),
+		DigestTimezone:   getEnv("DIGEST_TIMEZONE", "UTC"),
+		SMTPHost:         getEnv("SMTP_HOST", ""),
+		SMTPPort:         getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:         getEnv("SMTP_FROM", ""),
+		SMTPStartTLS:     getEnvBool("SMTP_STARTTLS", true),
+
+		AnomalyRulesFile: getEnv("ANOMALY_RULES_FILE", ""),
+		AnomalyInterval:  getEnvDuration("ANOMALY_INTERVAL", 15*time.Minute),
+
+		StreamSource:     getEnv("STREAM_SOURCE", ""),
+		StreamMaxClients: getEnvInt("STREAM_MAX_CLIENTS", 100),
+
+		WebWidgetEnabled: getEnvBool("WEB_WIDGET_ENABLED", false),
+		WebOrigins:       getEnvCSV("WEB_ALLOWED_ORIGINS", nil),
+		WebApps:          getEnvCSV("WEB_APPS", nil),
+
+		CORSPoliciesFile: getEnv("CORS_POLICIES_FILE", ""),
+
+		MigrateOnBoot: getEnvBool("MIGRATE_ON_BOOT", true),
 	}
 }
 
@@ -55,3 +177,88 @@ func getEnvCSV(key string, fallback []string) []string {
 	}
 	return out
 }
+
+// getEnvPairs parses a comma-separated list of "name:value" pairs. Only the
+// first colon separates name from value, so values may themselves contain
+// colons. Entries without a name or value are skipped.
+func getEnvPairs(key string) map[string]string {
+	out := map[string]string{}
+	for _, p := range getEnvCSV(key, nil) {
+		name, value, ok := strings.Cut(p, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			continue
+		}
+		out[name] = value
+	}
+	return out
+}
+
+// getEnvNamedPatterns parses a semicolon-separated list of "name=regex"
+// entries. Semicolons are used instead of commas because regular expressions
+// commonly contain commas in repetition counts such as {2,4}.
+func getEnvNamedPatterns(key string) map[string]string {
+	out := map[string]string{}
+	for _, p := range strings.Split(os.Getenv(key), ";") {
+		name, pattern, ok := strings.Cut(p, "=")
+		name, pattern = strings.TrimSpace(name), strings.TrimSpace(pattern)
+		if !ok || name == "" || pattern == "" {
+			continue
+		}
+		out[name] = pattern
+	}
+	return out
+}
+
+// getEnvNamedLists parses a semicolon-separated list of "name=a,b" entries
+// into each name's comma-separated values. Entries without a name or values
+// are skipped.
+func getEnvNamedLists(key string) map[string][]string {
+	out := map[string][]string{}
+	for name, list := range getEnvNamedPatterns(key) {
+		var values []string
+		for _, v := range strings.Split(list, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) > 0 {
+			out[name] = values
+		}
+	}
+	return out
+}
+
+// getEnvInt parses a positive integer. Unparseable or non-positive values
+// fall back to the default.
+func getEnvInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return n
+}
+
+// getEnvBool parses a boolean such as "true", "0" or "false". Unset or
+// unparseable values fall back to the default.
+func getEnvBool(key string, fallback bool) bool {
+	b, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+// getEnvDuration parses a Go duration string (e.g. "90s", "5m"). Unparseable
+// or non-positive values fall back to the default.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestLoad_Defaults(t *testing.T) {
@@ -78,3 +79,106 @@ func TestLoad_FromEnv(t *testing.T) {
 		t.Errorf("expected database testdb, got %s", cfg.MongoDatabase)
 	}
 }
+
+func TestLoad_SigningConfig(t *testing.T) {
+	os.Setenv("SIGNING_SECRETS", "desktop:abc:def, mobile:xyz ,broken, :nokey")
+	os.Setenv("SIGNATURE_MODE", "required")
+	os.Setenv("SIGNATURE_MAX_SKEW", "90s")
+	defer func() {
+		os.Unsetenv("SIGNING_SECRETS")
+		os.Unsetenv("SIGNATURE_MODE")
+		os.Unsetenv("SIGNATURE_MAX_SKEW")
+	}()
+
+	cfg := Load()
+
+	if len(cfg.SigningSecrets) != 2 {
+		t.Fatalf("expected 2 signing secrets, got %v", cfg.SigningSecrets)
+	}
+	if cfg.SigningSecrets["desktop"] != "abc:def" {
+		t.Errorf("expected secret to keep embedded colon, got %q", cfg.SigningSecrets["desktop"])
+	}
+	if cfg.SigningSecrets["mobile"] != "xyz" {
+		t.Errorf("expected mobile secret xyz, got %q", cfg.SigningSecrets["mobile"])
+	}
+	if cfg.SignatureMode != "required" {
+		t.Errorf("expected mode required, got %s", cfg.SignatureMode)
+	}
+	if cfg.SignatureMaxSkew != 90*time.Second {
+		t.Errorf("expected skew 90s, got %s", cfg.SignatureMaxSkew)
+	}
+}
+
+func TestLoad_InvalidDurationFallsBack(t *testing.T) {
+	os.Setenv("SIGNATURE_MAX_SKEW", "soon")
+	defer os.Unsetenv("SIGNATURE_MAX_SKEW")
+
+	if cfg := Load(); cfg.SignatureMaxSkew != 5*time.Minute {
+		t.Errorf("expected default skew 5m, got %s", cfg.SignatureMaxSkew)
+	}
+}
+
+func TestLoad_RedactionConfig(t *testing.T) {
+	os.Setenv("REDACT_RULES", "email,card")
+	os.Setenv("REDACT_CUSTOM_RULES", `license=IDF-[A-Z0-9]{4,8}; ticket = #\d+ ;broken`)
+	defer func() {
+		os.Unsetenv("REDACT_RULES")
+		os.Unsetenv("REDACT_CUSTOM_RULES")
+	}()
+
+	cfg := Load()
+
+	if len(cfg.RedactRules) != 2 || cfg.RedactRules[0] != "email" || cfg.RedactRules[1] != "card" {
+		t.Errorf("expected rules [email card], got %v", cfg.RedactRules)
+	}
+	if len(cfg.RedactCustomRules) != 2 {
+		t.Fatalf("expected 2 custom rules, got %v", cfg.RedactCustomRules)
+	}
+	if cfg.RedactCustomRules["license"] != "IDF-[A-Z0-9]{4,8}" {
+		t.Errorf("expected regex with comma preserved, got %q", cfg.RedactCustomRules["license"])
+	}
+	if cfg.RedactCustomRules["ticket"] != `#\d+` {
+		t.Errorf("expected trimmed ticket rule, got %q", cfg.RedactCustomRules["ticket"])
+	}
+}
+
+func TestLoad_RetentionDefaults(t *testing.T) {
+	os.Unsetenv("RETENTION_RULES")
+	os.Unsetenv("RETENTION_INTERVAL")
+	os.Unsetenv("RETENTION_USE_TTL")
+
+	cfg := Load()
+
+	if cfg.RetentionRules != "" {
+		t.Errorf("expected no retention rules by default, got %q", cfg.RetentionRules)
+	}
+	if cfg.RetentionInterval != 24*time.Hour {
+		t.Errorf("expected daily retention interval, got %s", cfg.RetentionInterval)
+	}
+	if !cfg.RetentionUseTTL {
+		t.Error("expected TTL indexes to be used by default")
+	}
+}
+
+func TestLoad_MigrateOnBoot(t *testing.T) {
+	os.Unsetenv("MIGRATE_ON_BOOT")
+	if !Load().MigrateOnBoot {
+		t.Error("expected migrations to run on boot by default")
+	}
+
+	os.Setenv("MIGRATE_ON_BOOT", "false")
+	defer os.Unsetenv("MIGRATE_ON_BOOT")
+	if Load().MigrateOnBoot {
+		t.Error("expected MIGRATE_ON_BOOT=false to disable boot migrations")
+	}
+}
+
+func TestLoad_DigestRecipients(t *testing.T) {
+	os.Setenv("DIGEST_RECIPIENTS", "idefinity=pm@example.com, cto@example.com; *=ops@example.com;empty=")
+	defer os.Unsetenv("DIGEST_RECIPIENTS")
+
+	got := Load().DigestRecipients
+	if len(got) != 2 || len(got["idefinity"]) != 2 || got["idefinity"][1] != "cto@example.com" || got["*"][0] != "ops@example.com" {
+		t.Errorf("unexpected recipients %v", got)
+	}
+}
@@ -0,0 +1,41 @@
+// Package dashboard serves the read-only NPS dashboard: static HTML,
+// JavaScript and CSS embedded in the binary, with no external assets so it
+// works in air-gapped installs. The page holds no data itself; it reads
+// everything from the stats and comment APIs with the X-API-Key the viewer
+// enters, so it is exactly as protected as those APIs, which need the read
+// scope.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// contentSecurityPolicy keeps the page to its own assets and API calls, so
+// neither a stray external reference nor markup in a comment can load
+// anything from elsewhere.
+const contentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; " +
+	"img-src 'self' data:; connect-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// Handler serves the dashboard. It expects the path below its mount point,
+// so mount it with http.StripPrefix.
+func Handler() http.Handler {
+	root, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	files := http.FileServerFS(root)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		// Assets change with the binary and carry no version in their
+		// names, so browsers must revalidate.
+		w.Header().Set("Cache-Control", "no-cache")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,260 @@
+// The NPS dashboard. Everything it shows comes from the read API under
+// /nps/api/v1, called with the read or admin key the viewer enters; the
+// client keys built into the apps are refused. No external scripts or styles
+// are used, so it works offline.
+"use strict";
+
+const keyStorage = "nps-api-key";
+const svgNS = "http://www.w3.org/2000/svg";
+
+const $ = (id) => document.getElementById(id);
+
+let apiKey = sessionStorage.getItem(keyStorage) || "";
+let nextComments = "";
+
+class Unauthorized extends Error {}
+
+// api fetches a read endpoint relative to the dashboard, /nps/api/v1/<path>.
+async function api(path, params) {
+  const url = new URL("../api/v1/" + path, location.href);
+  for (const [k, v] of Object.entries(params)) {
+    if (v !== "" && v !== undefined) url.searchParams.set(k, v);
+  }
+  const headers = { Accept: "application/json" };
+  if (apiKey) headers["X-API-Key"] = apiKey;
+  const resp = await fetch(url, { headers, cache: "no-store" });
+  if (resp.status === 401 || resp.status === 403) throw new Unauthorized("unauthorized");
+  const body = await resp.json().catch(() => ({}));
+  if (!resp.ok) throw new Error(body.error || resp.status + " " + resp.statusText);
+  return body;
+}
+
+// isoDate formats a date as YYYY-MM-DD in UTC, which the API reads as a
+// whole UTC day.
+function isoDate(d) {
+  return d.toISOString().slice(0, 10);
+}
+
+// filters returns the API filters chosen in the header. to is inclusive.
+function filters() {
+  const form = $("filters");
+  const days = Number(form.range.value);
+  const to = new Date();
+  const from = new Date(to.getTime() - (days - 1) * 864e5);
+  return {
+    app: form.app.value,
+    platform: form.platform.value,
+    from: isoDate(from),
+    to: isoDate(to),
+  };
+}
+
+function trendPeriod() {
+  const days = Number($("filters").range.value);
+  return days <= 30 ? "day" : days <= 90 ? "week" : "month";
+}
+
+function formatNPS(s) {
+  return s.total ? (s.nps > 0 ? "+" : "") + s.nps.toFixed(1) : "–";
+}
+
+function npsClass(nps) {
+  return nps >= 30 ? "promoter" : nps >= 0 ? "passive" : "detractor";
+}
+
+function svg(name, attrs, text) {
+  const el = document.createElementNS(svgNS, name);
+  for (const [k, v] of Object.entries(attrs)) el.setAttribute(k, v);
+  if (text !== undefined) el.textContent = text;
+  return el;
+}
+
+function showError(err) {
+  const el = $("error");
+  el.textContent = err ? "Could not load the dashboard: " + err.message : "";
+  el.hidden = !err;
+}
+
+// fillOptions keeps the current choice of a select while replacing the
+// values after its first "all" option.
+function fillOptions(select, values) {
+  const current = select.value;
+  while (select.options.length > 1) select.remove(1);
+  for (const v of values) select.add(new Option(v, v));
+  if (current && !values.includes(current)) select.add(new Option(current, current));
+  select.value = current;
+}
+
+function renderScore(s) {
+  $("gauge-value").textContent = formatNPS(s);
+  $("total").textContent = s.total;
+  $("promoters").textContent = s.promoters;
+  $("passives").textContent = s.passives;
+  $("detractors").textContent = s.detractors;
+
+  // The arc runs from -100 on the left to +100 on the right.
+  const angle = Math.PI * (1 - (s.nps + 100) / 200);
+  const x = 100 + 80 * Math.cos(angle);
+  const y = 100 - 80 * Math.sin(angle);
+  const arc = $("gauge-arc");
+  arc.setAttribute("d", s.total ? `M 20 100 A 80 80 0 0 1 ${x.toFixed(2)} ${y.toFixed(2)}` : "M 20 100");
+  arc.setAttribute("class", "value " + npsClass(s.nps));
+}
+
+function renderTrend(points, period) {
+  const chart = $("trend");
+  chart.replaceChildren();
+  $("trend-period").textContent = "per " + period;
+  $("trend-empty").hidden = points.length > 0;
+  if (!points.length) return;
+
+  const width = 600, height = 220, left = 34, right = 8, top = 8, bottom = 24;
+  const plotW = width - left - right, plotH = height - top - bottom;
+  const y = (nps) => top + plotH * (1 - (nps + 100) / 200);
+  const step = plotW / points.length;
+  const x = (i) => left + step * (i + 0.5);
+  const maxTotal = Math.max(...points.map((p) => p.total));
+
+  for (const v of [-100, -50, 0, 50, 100]) {
+    chart.append(svg("line", { x1: left, x2: width - right, y1: y(v), y2: y(v), class: v === 0 ? "zero" : "grid" }));
+    chart.append(svg("text", { x: left - 4, y: y(v) + 3, "text-anchor": "end" }, String(v)));
+  }
+  // Response counts as faint bars behind the NPS line.
+  points.forEach((p, i) => {
+    const h = (p.total / maxTotal) * plotH * 0.5;
+    const bar = svg("rect", { x: x(i) - step * 0.35, width: step * 0.7, y: top + plotH - h, height: h, class: "bar" });
+    bar.append(svg("title", {}, `${p.start.slice(0, 10)}: ${p.total} responses`));
+    chart.append(bar);
+  });
+  chart.append(svg("polyline", {
+    class: "line",
+    points: points.map((p, i) => `${x(i).toFixed(1)},${y(p.nps).toFixed(1)}`).join(" "),
+  }));
+  points.forEach((p, i) => {
+    const dot = svg("circle", { cx: x(i), cy: y(p.nps), r: 3 });
+    dot.append(svg("title", {}, `${p.start.slice(0, 10)}: NPS ${formatNPS(p)} (${p.total} responses)`));
+    chart.append(dot);
+  });
+  const label = (i, anchor) =>
+    chart.append(svg("text", { x: x(i), y: height - 6, "text-anchor": anchor }, points[i].start.slice(0, 10)));
+  label(0, points.length > 1 ? "start" : "middle");
+  if (points.length > 1) label(points.length - 1, "end");
+}
+
+function renderBreakdown(table, groups) {
+  const body = table.tBodies[0];
+  body.replaceChildren();
+  const max = Math.max(1, ...groups.map((g) => g.total));
+  for (const g of groups) {
+    const row = body.insertRow();
+    row.insertCell().textContent = g.value || "(none)";
+    const total = row.insertCell();
+    const bar = document.createElement("span");
+    bar.className = "bar";
+    bar.style.width = Math.max(2, (g.total / max) * 80) + "px";
+    total.append(bar, String(g.total));
+    row.insertCell().textContent = formatNPS(g);
+  }
+  if (!groups.length) {
+    const cell = body.insertRow().insertCell();
+    cell.colSpan = 3;
+    cell.className = "empty";
+    cell.textContent = "No feedback in this period.";
+  }
+}
+
+// renderComments appends a page of comments. Comments are user input and are
+// only ever set as text.
+function renderComments(page, append) {
+  const list = $("comments");
+  if (!append) list.replaceChildren();
+  for (const c of page.items) {
+    const item = document.createElement("li");
+    item.className = c.nps_category;
+    const meta = document.createElement("div");
+    meta.className = "meta";
+    const rating = document.createElement("span");
+    rating.className = "rating";
+    rating.textContent = c.nps_rating;
+    const when = new Date(c.received_at).toLocaleString();
+    meta.append(rating, [c.app + " " + c.app_version, c.platform, c.locale, when].filter(Boolean).join(" · "));
+    const text = document.createElement("p");
+    text.textContent = c.comment;
+    item.append(meta, text);
+    list.append(item);
+  }
+  nextComments = page.next;
+  $("more").hidden = !nextComments;
+  $("comments-empty").hidden = list.children.length > 0 || !!nextComments;
+}
+
+async function loadComments(append) {
+  const search = $("comment-search");
+  const params = { ...filters(), q: search.q.value, nps_category: search.nps_category.value, limit: 25 };
+  if (append) params.before = nextComments;
+  renderComments(await api("comments", params), append);
+}
+
+async function load() {
+  const f = filters();
+  const period = trendPeriod();
+  const [summary, trend, versions, platforms, apps] = await Promise.all([
+    api("stats", f),
+    api("stats/trend", { ...f, period }),
+    api("stats/breakdown", { ...f, by: "app_version" }),
+    api("stats/breakdown", { ...f, by: "platform" }),
+    api("stats/breakdown", { from: f.from, to: f.to, by: "app" }),
+  ]);
+  renderScore(summary);
+  renderTrend(trend.items, period);
+  renderBreakdown($("by-version"), versions.items);
+  renderBreakdown($("by-platform"), platforms.items);
+  fillOptions($("filters").app, apps.items.map((g) => g.value));
+  if (!f.platform) fillOptions($("filters").platform, platforms.items.map((g) => g.value));
+  await loadComments(false);
+}
+
+// run loads the dashboard, asking for a key when the API refuses the current
+// one.
+async function run(task) {
+  try {
+    await task();
+    showError(null);
+  } catch (err) {
+    if (err instanceof Unauthorized) {
+      askForKey(apiKey ? "That key was not accepted. Use a read or admin key." : "");
+      return;
+    }
+    showError(err);
+  }
+}
+
+function askForKey(message) {
+  const error = $("login-error");
+  error.textContent = message;
+  error.hidden = !message;
+  $("login").showModal();
+}
+
+$("login-form").addEventListener("submit", () => {
+  apiKey = $("login-form").key.value.trim();
+  sessionStorage.setItem(keyStorage, apiKey);
+  $("signout").hidden = false;
+  run(load);
+});
+
+$("signout").hidden = !apiKey;
+$("signout").addEventListener("click", () => {
+  sessionStorage.removeItem(keyStorage);
+  apiKey = "";
+  location.reload();
+});
+
+$("filters").addEventListener("change", () => run(load));
+$("comment-search").addEventListener("submit", (e) => {
+  e.preventDefault();
+  run(() => loadComments(false));
+});
+$("more").addEventListener("click", () => run(() => loadComments(true)));
+
+run(load);
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Migration is one versioned schema change. Up and Down must be safe to run
+// again after a partial failure: a migration is only recorded as applied
+// once Up returns successfully.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// MigrationStatus describes one known migration and whether it has run.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+const (
+	migrationsCollection = "schema_migrations"
+	lockCollection       = "schema_migrations_lock"
+	lockID               = "migrations"
+)
+
+// ErrLockTimeout is returned when another process holds the migration lock
+// for longer than the Migrator's wait time.
+var ErrLockTimeout = errors.New("timed out waiting for migration lock")
+
+// Migrator applies Migrations in version order. Applied versions are recorded
+// in the schema_migrations collection, and a lock document with an expiry
+// keeps replicas that boot at the same time from racing each other.
+type Migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+	owner      string
+
+	// LockTTL is how long a held lock stays valid; a crashed holder's lock
+	// is taken over once it expires.
+	LockTTL time.Duration
+	// LockWait is how long to wait for another holder before giving up.
+	LockWait time.Duration
+}
+
+// NewMigrator creates a migrator for the database's registered Migrations.
+func NewMigrator(d *Database) *Migrator {
+	return newMigrator(d.database, Migrations)
+}
+
+func newMigrator(db *mongo.Database, migrations []Migration) *Migrator {
+	host, _ := os.Hostname()
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		owner:      host + ":" + strconv.Itoa(os.Getpid()) + ":" + bson.NewObjectID().Hex(),
+		LockTTL:    5 * time.Minute,
+		LockWait:   2 * time.Minute,
+	}
+}
+
+// validateMigrations checks that versions are positive, unique and listed in
+// ascending order, and that every migration can be applied and reverted.
+func validateMigrations(ms []Migration) error {
+	for i, m := range ms {
+		if m.Version <= 0 {
+			return fmt.Errorf("migration %q has non-positive version %d", m.Name, m.Version)
+		}
+		if m.Up == nil || m.Down == nil {
+			return fmt.Errorf("migration %d (%s) must define Up and Down", m.Version, m.Name)
+		}
+		if i > 0 && m.Version <= ms[i-1].Version {
+			return fmt.Errorf("migration %d (%s) is out of order", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// pending returns the migrations not in applied, in ascending order.
+func pending(ms []Migration, applied map[int]bool) []Migration {
+	var out []Migration
+	for _, m := range ms {
+		if !applied[m.Version] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// toRevert returns up to steps applied migrations, newest first.
+func toRevert(ms []Migration, applied map[int]bool, steps int) []Migration {
+	var out []Migration
+	for i := len(ms) - 1; i >= 0 && len(out) < steps; i-- {
+		if applied[ms[i].Version] {
+			out = append(out, ms[i])
+		}
+	}
+	return out
+}
+
+// Up applies every pending migration and returns the ones it ran.
+func (m *Migrator) Up(ctx context.Context) ([]MigrationStatus, error) {
+	if err := validateMigrations(m.migrations); err != nil {
+		return nil, err
+	}
+	release, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []MigrationStatus
+	for _, mig := range pending(m.migrations, appliedSet(applied)) {
+		slog.Info("applying migration", "version", mig.Version, "name", mig.Name)
+		if err := mig.Up(ctx, m.db); err != nil {
+			return ran, fmt.Errorf("migration %d (%s) failed: %w", mig.Version, mig.Name, err)
+		}
+		now := time.Now().UTC()
+		_, err := m.db.Collection(migrationsCollection).InsertOne(ctx, appliedMigration{
+			Version: mig.Version, Name: mig.Name, AppliedAt: now,
+		})
+		if err != nil {
+			return ran, fmt.Errorf("failed to record migration %d: %w", mig.Version, err)
+		}
+		ran = append(ran, MigrationStatus{Version: mig.Version, Name: mig.Name, AppliedAt: &now})
+	}
+	return ran, nil
+}
+
+// Down reverts the newest steps applied migrations and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]MigrationStatus, error) {
+	if err := validateMigrations(m.migrations); err != nil {
+		return nil, err
+	}
+	release, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []MigrationStatus
+	for _, mig := range toRevert(m.migrations, appliedSet(applied), steps) {
+		slog.Info("reverting migration", "version", mig.Version, "name", mig.Name)
+		if err := mig.Down(ctx, m.db); err != nil {
+			return reverted, fmt.Errorf("reverting migration %d (%s) failed: %w", mig.Version, mig.Name, err)
+		}
+		if _, err := m.db.Collection(migrationsCollection).DeleteOne(ctx, bson.D{{Key: "_id", Value: mig.Version}}); err != nil {
+			return reverted, fmt.Errorf("failed to unrecord migration %d: %w", mig.Version, err)
+		}
+		reverted = append(reverted, MigrationStatus{Version: mig.Version, Name: mig.Name})
+	}
+	return reverted, nil
+}
+
+// Status lists every known migration with its applied time, if any.
+// Versions recorded in the database but unknown to this binary (for example
+// after a rollback to an older release) are listed too.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]appliedMigration, len(applied))
+	for _, a := range applied {
+		byVersion[a.Version] = a
+	}
+
+	var out []MigrationStatus
+	for _, mig := range m.migrations {
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if a, ok := byVersion[mig.Version]; ok {
+			s.AppliedAt = &a.AppliedAt
+			delete(byVersion, mig.Version)
+		}
+		out = append(out, s)
+	}
+	for _, a := range byVersion {
+		out = append(out, MigrationStatus{Version: a.Version, Name: a.Name + " (unknown to this build)", AppliedAt: &a.AppliedAt})
+	}
+	slices.SortFunc(out, func(a, b MigrationStatus) int { return a.Version - b.Version })
+	return out, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) ([]appliedMigration, error) {
+	cur, err := m.db.Collection(migrationsCollection).Find(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	var out []appliedMigration
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	return out, nil
+}
+
+func appliedSet(applied []appliedMigration) map[int]bool {
+	set := make(map[int]bool, len(applied))
+	for _, a := range applied {
+		set[a.Version] = true
+	}
+	return set
+}
+
+// lock acquires the migration lock, waiting up to LockWait for another
+// holder, and returns a function that releases it.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	coll := m.db.Collection(lockCollection)
+	deadline := time.Now().Add(m.LockWait)
+
+	for {
+		now := time.Now().UTC()
+		err := coll.FindOneAndUpdate(ctx,
+			bson.D{
+				{Key: "_id", Value: lockID},
+				{Key: "$or", Value: bson.A{
+					bson.D{{Key: "expires_at", Value: bson.D{{Key: "$lt", Value: now}}}},
+					bson.D{{Key: "owner", Value: m.owner}},
+				}},
+			},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "owner", Value: m.owner},
+				{Key: "acquired_at", Value: now},
+				{Key: "expires_at", Value: now.Add(m.LockTTL)},
+			}}},
+			options.FindOneAndUpdate().SetUpsert(true),
+		).Err()
+
+		// With upsert, a lock held by someone else makes the filter miss
+		// and the insert collide on _id.
+		if err == nil || errors.Is(err, mongo.ErrNoDocuments) {
+			return func() {
+				_, err := coll.DeleteOne(context.Background(), bson.D{{Key: "_id", Value: lockID}, {Key: "owner", Value: m.owner}})
+				if err != nil {
+					slog.Error("failed to release migration lock", "error", err)
+				}
+			}, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+
+		slog.Info("waiting for migration lock held by another process")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
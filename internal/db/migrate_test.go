@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func noop(context.Context, *mongo.Database) error { return nil }
+
+func TestMigrations_AreValid(t *testing.T) {
+	if err := validateMigrations(Migrations); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateMigrations(t *testing.T) {
+	tests := map[string][]Migration{
+		"zero version": {{Version: 0, Name: "a", Up: noop, Down: noop}},
+		"missing down": {{Version: 1, Name: "a", Up: noop}},
+		"duplicate":    {{Version: 1, Name: "a", Up: noop, Down: noop}, {Version: 1, Name: "b", Up: noop, Down: noop}},
+		"out of order": {{Version: 2, Name: "a", Up: noop, Down: noop}, {Version: 1, Name: "b", Up: noop, Down: noop}},
+	}
+	for name, ms := range tests {
+		if err := validateMigrations(ms); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestPendingAndToRevert(t *testing.T) {
+	ms := []Migration{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 5}}
+	applied := map[int]bool{1: true, 3: true}
+
+	got := pending(ms, applied)
+	if len(got) != 2 || got[0].Version != 2 || got[1].Version != 5 {
+		t.Errorf("expected pending 2 and 5, got %v", got)
+	}
+
+	got = toRevert(ms, applied, 1)
+	if len(got) != 1 || got[0].Version != 3 {
+		t.Errorf("expected to revert 3, got %v", got)
+	}
+	if got = toRevert(ms, applied, 10); len(got) != 2 || got[1].Version != 1 {
+		t.Errorf("expected to revert 3 then 1, got %v", got)
+	}
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Migrations is the ordered list of schema changes. Append new migrations
+// with the next version number; never renumber or edit one that has shipped.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "feedback_query_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("feedback"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "received_at", Value: -1}},
+					Options: options.Index().SetName("received_at"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "app", Value: 1}, {Key: "received_at", Value: -1}},
+					Options: options.Index().SetName("app_received_at"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "platform", Value: 1}, {Key: "received_at", Value: -1}},
+					Options: options.Index().SetName("platform_received_at"),
+				},
+			)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("feedback"), "received_at", "app_received_at", "platform_received_at")
+		},
+	},
+	{
+		// Only quarantined documents carry the flag, so a partial index keeps
+		// the quarantine listing cheap without indexing the whole collection.
+		Version: 2,
+		Name:    "feedback_quarantine_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("feedback"), mongo.IndexModel{
+				Keys: bson.D{{Key: "received_at", Value: -1}},
+				Options: options.Index().
+					SetName("quarantined_received_at").
+					SetPartialFilterExpression(bson.D{{Key: "quarantine", Value: true}}),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("feedback"), "quarantined_received_at")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "feedback_install_id_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("feedback"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "install_id", Value: 1}},
+				Options: options.Index().SetName("install_id").SetSparse(true),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("feedback"), "install_id")
+		},
+	},
+	{
+		// The erasure audit trail is evidence for data subject requests, so
+		// reject records missing the fields an auditor needs.
+		Version: 4,
+		Name:    "erasure_audit_validator",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			validator := bson.D{{Key: "$jsonSchema", Value: bson.D{
+				{Key: "bsonType", Value: "object"},
+				{Key: "required", Value: bson.A{"install_id_hash", "mode", "documents", "actor", "at"}},
+				{Key: "properties", Value: bson.D{
+					{Key: "install_id_hash", Value: bson.D{{Key: "bsonType", Value: "string"}}},
+					{Key: "mode", Value: bson.D{{Key: "enum", Value: bson.A{"delete", "anonymize"}}}},
+					{Key: "at", Value: bson.D{{Key: "bsonType", Value: "date"}}},
+				}},
+			}}}
+			if err := setValidator(ctx, db, "erasure_audit", validator); err != nil {
+				return err
+			}
+			return createIndexes(ctx, db.Collection("erasure_audit"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "install_id_hash", Value: 1}, {Key: "at", Value: -1}},
+				Options: options.Index().SetName("install_id_hash_at"),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndexes(ctx, db.Collection("erasure_audit"), "install_id_hash_at"); err != nil {
+				return err
+			}
+			return setValidator(ctx, db, "erasure_audit", bson.D{})
+		},
+	},
+	{
+		// Rollup upserts rely on the key being unique.
+		Version: 5,
+		Name:    "feedback_daily_key_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("feedback_daily"), mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "day", Value: 1},
+					{Key: "app", Value: 1},
+					{Key: "app_version", Value: 1},
+					{Key: "platform", Value: 1},
+				},
+				Options: options.Index().SetName("day_app_version_platform").SetUnique(true),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("feedback_daily"), "day_app_version_platform")
+		},
+	},
+	{
+		// Imports upsert on import_key, so it must be unique; live
+		// submissions have none and are left out of the index.
+		Version: 6,
+		Name:    "feedback_import_key_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("feedback"), mongo.IndexModel{
+				Keys: bson.D{{Key: "import_key", Value: 1}},
+				Options: options.Index().
+					SetName("import_key").
+					SetUnique(true).
+					SetPartialFilterExpression(bson.D{{Key: "import_key", Value: bson.D{{Key: "$exists", Value: true}}}}),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("feedback"), "import_key")
+		},
+	},
+	{
+		// Retried submissions are deduplicated by this index; requests
+		// without an Idempotency-Key are left out of it.
+		Version: 7,
+		Name:    "feedback_idempotency_key_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("feedback"), mongo.IndexModel{
+				Keys: bson.D{{Key: "idempotency_key", Value: 1}},
+				Options: options.Index().
+					SetName("idempotency_key").
+					SetUnique(true).
+					SetPartialFilterExpression(bson.D{{Key: "idempotency_key", Value: bson.D{{Key: "$exists", Value: true}}}}),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("feedback"), "idempotency_key")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "survey_rules_app_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("survey_rules"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "app", Value: 1}, {Key: "priority", Value: -1}},
+				Options: options.Index().SetName("app_priority"),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("survey_rules"), "app_priority")
+		},
+	},
+	{
+		// Publishing numbers versions from the latest one; the unique index
+		// makes a concurrent publish of the same survey retry instead of
+		// storing two definitions under one version.
+		Version: 9,
+		Name:    "survey_definitions_version_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("survey_definitions"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "survey_id", Value: 1}, {Key: "version", Value: -1}},
+				Options: options.Index().SetName("survey_id_version").SetUnique(true),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("survey_definitions"), "survey_id_version")
+		},
+	},
+	{
+		// Answer tallies select one survey's submissions; only schema 1.2
+		// documents carry a survey ID.
+		Version: 10,
+		Name:    "feedback_survey_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("feedback"), mongo.IndexModel{
+				Keys: bson.D{{Key: "survey_id", Value: 1}, {Key: "received_at", Value: -1}},
+				Options: options.Index().
+					SetName("survey_id_received_at").
+					SetPartialFilterExpression(bson.D{{Key: "survey_id", Value: bson.D{{Key: "$exists", Value: true}}}}),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("feedback"), "survey_id_received_at")
+		},
+	},
+	{
+		// Dispatchers claim due deliveries by status and next attempt; the
+		// delivery log lists a subscription's deliveries newest first.
+		// Delivered entries expire after 30 days, dead letters stay until
+		// redelivered.
+		Version: 11,
+		Name:    "webhook_deliveries_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("webhook_deliveries"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+					Options: options.Index().SetName("status_next_attempt_at"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "_id", Value: -1}},
+					Options: options.Index().SetName("subscription_id"),
+				},
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "delivered_at", Value: 1}},
+					Options: options.Index().SetName("delivered_ttl").SetExpireAfterSeconds(30 * 24 * 60 * 60),
+				},
+			)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("webhook_deliveries"),
+				"status_next_attempt_at", "subscription_id", "delivered_ttl")
+		},
+	},
+	{
+		// A digest claim only matters until the next week's digest, so
+		// claims expire after 30 days.
+		Version: 12,
+		Name:    "digest_runs_ttl",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("digest_runs"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "claimed_at", Value: 1}},
+				Options: options.Index().SetName("claimed_ttl").SetExpireAfterSeconds(30 * 24 * 60 * 60),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndexes(ctx, db.Collection("digest_runs"), "claimed_ttl")
+		},
+	},
+}
+
+func createIndexes(ctx context.Context, coll *mongo.Collection, models ...mongo.IndexModel) error {
+	if _, err := coll.Indexes().CreateMany(ctx, models); err != nil {
+		return fmt.Errorf("failed to create indexes on %s: %w", coll.Name(), err)
+	}
+	return nil
+}
+
+func dropIndexes(ctx context.Context, coll *mongo.Collection, names ...string) error {
+	for _, name := range names {
+		if err := coll.Indexes().DropOne(ctx, name); err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to drop index %s on %s: %w", name, coll.Name(), err)
+		}
+	}
+	return nil
+}
+
+// setValidator applies a validator to the collection, creating it first if
+// it does not exist yet.
+func setValidator(ctx context.Context, db *mongo.Database, coll string, validator bson.D) error {
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: coll},
+		{Key: "validator", Value: validator},
+	}).Err()
+	if err == nil {
+		return nil
+	}
+	if !isNotFound(err) {
+		return fmt.Errorf("failed to set validator on %s: %w", coll, err)
+	}
+	if err := db.CreateCollection(ctx, coll, options.CreateCollection().SetValidator(validator)); err != nil {
+		return fmt.Errorf("failed to create %s: %w", coll, err)
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var ce mongo.CommandError
+	if errors.As(err, &ce) {
+		// 27: IndexNotFound, 26: NamespaceNotFound (collection not created yet).
+		return ce.Code == 27 || ce.Code == 26
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
@@ -44,3 +45,10 @@ func (d *Database) Collection(name string) *mongo.Collection {
 func (d *Database) Close(ctx context.Context) error {
 	return d.client.Disconnect(ctx)
 }
+
+// ExcludeQuarantined returns filter extended with a clause that hides
+// feedback quarantined by spam scoring. Read and stats queries should apply it
+// unless the caller explicitly asks for quarantined documents.
+func ExcludeQuarantined(filter bson.D) bson.D {
+	return append(filter, bson.E{Key: "quarantine", Value: bson.D{{Key: "$ne", Value: true}}})
+}
@@ -0,0 +1,268 @@
+// Package digest emails a weekly NPS summary to the people responsible for
+// each app: the score and its change against the previous week, a breakdown
+// by version and the newest detractor comments. Each recipient gets one
+// message covering their apps, with an HTML and a plain-text part, sent over
+// SMTP by the Scheduler or on demand by nps-admin.
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// MaxComments is how many detractor comments a digest shows per app.
+const MaxComments = 5
+
+// AllApps as a recipients key covers every app with feedback in the period.
+const AllApps = "*"
+
+// Period is a digest's time range; From is inclusive and To exclusive.
+type Period struct {
+	From time.Time
+	To   time.Time
+}
+
+// WeekBefore returns the seven UTC days before the day t falls on.
+func WeekBefore(t time.Time) Period {
+	to := stats.Day(t)
+	return Period{From: to.AddDate(0, 0, -7), To: to}
+}
+
+// previous returns the period of the same length right before p.
+func (p Period) previous() Period {
+	return Period{From: p.From.Add(-p.To.Sub(p.From)), To: p.From}
+}
+
+func (p Period) filter(app string) stats.Filter {
+	return stats.Filter{App: app, From: p.From, To: p.To}
+}
+
+// Comment is a detractor comment shown in a digest, redacted like every
+// stored comment.
+type Comment struct {
+	Rating     int
+	AppVersion string
+	Platform   string
+	Text       string
+	ReceivedAt time.Time
+}
+
+// AppReport is the digest section for one app.
+type AppReport struct {
+	App      string
+	Current  stats.Summary
+	Previous stats.Summary
+	Versions []stats.Group
+	Comments []Comment
+}
+
+// Delta returns the change in NPS against the previous period, or false when
+// either period had no feedback.
+func (a AppReport) Delta() (float64, bool) {
+	if a.Current.Total == 0 || a.Previous.Total == 0 {
+		return 0, false
+	}
+	return math.Round((a.Current.NPS-a.Previous.NPS)*10) / 10, true
+}
+
+// Report is the content of one digest message.
+type Report struct {
+	Period Period
+	Apps   []AppReport
+}
+
+// Source supplies the numbers and comments a digest shows. *MongoSource is
+// the production implementation.
+type Source interface {
+	Summary(ctx context.Context, f stats.Filter) (stats.Summary, error)
+	Breakdown(ctx context.Context, f stats.Filter, by string) ([]stats.Group, error)
+	// Detractors returns the newest non-quarantined detractor comments for
+	// app in p, newest first.
+	Detractors(ctx context.Context, app string, p Period, limit int) ([]Comment, error)
+}
+
+// MongoSource reads summaries from the daily rollup and comments from the
+// feedback collection, decrypting them with the keyring when one is set.
+type MongoSource struct {
+	*stats.Reader
+	feedback *mongo.Collection
+	keyring  *fieldcrypt.Keyring
+}
+
+// NewMongoSource creates a Source over the feedback and rollup collections.
+func NewMongoSource(feedback, daily *mongo.Collection, keyring *fieldcrypt.Keyring) *MongoSource {
+	return &MongoSource{Reader: stats.NewReader(feedback, daily), feedback: feedback, keyring: keyring}
+}
+
+// Detractors implements Source.
+func (s *MongoSource) Detractors(ctx context.Context, app string, p Period, limit int) ([]Comment, error) {
+	filter := append(p.filter(app).FeedbackFilter(),
+		bson.E{Key: "nps_category", Value: "detractor"},
+		bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "comment", Value: bson.D{{Key: "$gt", Value: ""}}}},
+			bson.D{{Key: "comment_enc", Value: bson.D{{Key: "$exists", Value: true}}}},
+		}},
+	)
+	cur, err := s.feedback.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "received_at", Value: -1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query detractors: %w", err)
+	}
+	var docs []model.Feedback
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to query detractors: %w", err)
+	}
+
+	comments := make([]Comment, 0, len(docs))
+	for i := range docs {
+		fb := &docs[i]
+		if s.keyring != nil {
+			if err := fieldcrypt.DecryptComment(s.keyring, fb); err != nil {
+				return nil, fmt.Errorf("failed to decrypt feedback %s: %w", fb.ID.Hex(), err)
+			}
+		}
+		comments = append(comments, Comment{
+			Rating:     fb.NPSRating,
+			AppVersion: fb.AppVersion,
+			Platform:   fb.Platform,
+			Text:       fb.Comment,
+			ReceivedAt: fb.ReceivedAt,
+		})
+	}
+	return comments, nil
+}
+
+// BuildApp computes the digest section for app in p.
+func BuildApp(ctx context.Context, src Source, app string, p Period) (AppReport, error) {
+	r := AppReport{App: app}
+	var err error
+	if r.Current, err = src.Summary(ctx, p.filter(app)); err != nil {
+		return AppReport{}, err
+	}
+	if r.Previous, err = src.Summary(ctx, p.previous().filter(app)); err != nil {
+		return AppReport{}, err
+	}
+	if r.Versions, err = src.Breakdown(ctx, p.filter(app), stats.ByAppVersion); err != nil {
+		return AppReport{}, err
+	}
+	if r.Comments, err = src.Detractors(ctx, app, p, MaxComments); err != nil {
+		return AppReport{}, err
+	}
+	return r, nil
+}
+
+// Mailboxes inverts recipients, which maps an app or AllApps to addresses,
+// into the apps each address gets, sorted. AllApps is expanded to the apps
+// that had feedback in p.
+func Mailboxes(ctx context.Context, src Source, recipients map[string][]string, p Period) (map[string][]string, error) {
+	var active []string
+	if len(recipients[AllApps]) > 0 {
+		groups, err := src.Breakdown(ctx, p.filter(""), stats.ByApp)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			active = append(active, g.Value)
+		}
+	}
+
+	boxes := map[string][]string{}
+	for app, addrs := range recipients {
+		apps := []string{app}
+		if app == AllApps {
+			apps = active
+		}
+		for _, addr := range addrs {
+			for _, a := range apps {
+				if !slices.Contains(boxes[addr], a) {
+					boxes[addr] = append(boxes[addr], a)
+				}
+			}
+		}
+	}
+	for addr, apps := range boxes {
+		if len(apps) == 0 {
+			delete(boxes, addr)
+			continue
+		}
+		slices.Sort(apps)
+	}
+	return boxes, nil
+}
+
+// Compose builds and renders one message per recipient for p. Each app is
+// queried once however many recipients it has.
+func Compose(ctx context.Context, src Source, recipients map[string][]string, p Period) ([]Message, error) {
+	boxes, err := Mailboxes(ctx, src, recipients, p)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := map[string]AppReport{}
+	var msgs []Message
+	for _, addr := range slices.Sorted(maps.Keys(boxes)) {
+		report := Report{Period: p}
+		for _, app := range boxes[addr] {
+			section, ok := sections[app]
+			if !ok {
+				if section, err = BuildApp(ctx, src, app, p); err != nil {
+					return nil, fmt.Errorf("app %s: %w", app, err)
+				}
+				sections[app] = section
+			}
+			report.Apps = append(report.Apps, section)
+		}
+		msg, err := Render(report)
+		if err != nil {
+			return nil, err
+		}
+		msg.To = []string{addr}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// ValidateRecipients checks that every entry names an app and only plain
+// addresses.
+func ValidateRecipients(recipients map[string][]string) error {
+	for app, addrs := range recipients {
+		if app == "" {
+			return errors.New("recipients without app")
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("app %s has no recipients", app)
+		}
+		for _, addr := range addrs {
+			if err := validAddress(addr); err != nil {
+				return fmt.Errorf("app %s: %w", app, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validAddress accepts a bare addr-spec such as ops@example.com; display
+// names and anything that could inject SMTP commands or headers are
+// rejected.
+func validAddress(addr string) error {
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok || local == "" || domain == "" || strings.ContainsAny(addr, " <>,;:\"\r\n\t") || strings.Contains(domain, "@") {
+		return fmt.Errorf("invalid address %q", addr)
+	}
+	return nil
+}
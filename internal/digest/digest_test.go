@@ -0,0 +1,384 @@
+package digest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// fakeSource serves canned summaries keyed by app and period start.
+type fakeSource struct {
+	summaries map[string]stats.Summary
+	versions  map[string][]stats.Group
+	comments  map[string][]Comment
+	apps      []string
+	queries   int
+}
+
+func key(app string, from time.Time) string { return app + "@" + from.Format(time.DateOnly) }
+
+func (s *fakeSource) Summary(_ context.Context, f stats.Filter) (stats.Summary, error) {
+	s.queries++
+	return s.summaries[key(f.App, f.From)], nil
+}
+
+func (s *fakeSource) Breakdown(_ context.Context, f stats.Filter, by string) ([]stats.Group, error) {
+	if by == stats.ByApp {
+		var groups []stats.Group
+		for _, app := range s.apps {
+			groups = append(groups, stats.Group{Value: app})
+		}
+		return groups, nil
+	}
+	return s.versions[f.App], nil
+}
+
+func (s *fakeSource) Detractors(_ context.Context, app string, _ Period, limit int) ([]Comment, error) {
+	return s.comments[app][:min(limit, len(s.comments[app]))], nil
+}
+
+// week is the digest period for a Monday 2026-03-09 send.
+var week = WeekBefore(time.Date(2026, 3, 9, 8, 0, 0, 0, time.UTC))
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		summaries: map[string]stats.Summary{
+			key("idefinity", week.From):                   {Total: 40, Promoters: 24, Passives: 8, Detractors: 8, NPS: 40},
+			key("idefinity", week.From.AddDate(0, 0, -7)): {Total: 30, Promoters: 15, Passives: 9, Detractors: 6, NPS: 30},
+			key("devtool", week.From):                     {Total: 5, Promoters: 1, Detractors: 2, NPS: -20},
+		},
+		versions: map[string][]stats.Group{
+			"idefinity": {{Value: "1.4.0", Summary: stats.Summary{Total: 30, NPS: 50}}, {Value: "1.3.2", Summary: stats.Summary{Total: 10, NPS: 10}}},
+		},
+		comments: map[string][]Comment{
+			"idefinity": {{Rating: 2, AppVersion: "1.4.0", Platform: "macOS", Text: "Sync <b>breaks</b> & loses data", ReceivedAt: week.From.Add(30 * time.Hour)}},
+		},
+		apps: []string{"devtool", "idefinity"},
+	}
+}
+
+func TestSchedule_Last(t *testing.T) {
+	s, err := ParseSchedule("mon 08:00", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ now, want string }{
+		{"2026-03-09T08:00:00Z", "2026-03-09T08:00:00Z"},
+		{"2026-03-09T07:59:00Z", "2026-03-02T08:00:00Z"},
+		{"2026-03-12T12:00:00Z", "2026-03-09T08:00:00Z"},
+		{"2026-03-15T23:59:00Z", "2026-03-09T08:00:00Z"},
+	}
+	for _, tt := range tests {
+		now, _ := time.Parse(time.RFC3339, tt.now)
+		if got := s.Last(now).Format(time.RFC3339); got != tt.want {
+			t.Errorf("Last(%s) = %s, want %s", tt.now, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"monday", "mon 8", "funday 08:00", "mon 24:00"} {
+		if _, err := ParseSchedule(bad, nil); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestCompose_OneMessagePerRecipient(t *testing.T) {
+	src := newFakeSource()
+	msgs, err := Compose(context.Background(), src, map[string][]string{
+		"idefinity": {"pm@example.com", "cto@example.com"},
+		AllApps:     {"cto@example.com"},
+	}, week)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].To[0] != "cto@example.com" || msgs[1].To[0] != "pm@example.com" {
+		t.Fatalf("expected one message per recipient, got %+v", msgs)
+	}
+	if src.queries != 4 {
+		t.Errorf("expected each app to be queried once, got %d summary queries", src.queries)
+	}
+
+	cto, pm := msgs[0], msgs[1]
+	if cto.Subject != "Weekly NPS for 2 apps, 2 Mar to 8 Mar 2026" {
+		t.Errorf("unexpected subject %q", cto.Subject)
+	}
+	if pm.Subject != "Weekly NPS for idefinity: 40.0 (+10.0)" {
+		t.Errorf("unexpected subject %q", pm.Subject)
+	}
+	for _, want := range []string{
+		"Mon 2 Mar 2026 to Sun 8 Mar 2026",
+		"NPS 40.0 (+10.0 against the week before)",
+		"40 responses: 24 promoters, 8 passives, 8 detractors",
+		"1.4.0        NPS   50.0  30 responses",
+		"2/10 · 1.4.0 · macOS · Tue 3 Mar 2026",
+		"Sync <b>breaks</b> & loses data",
+	} {
+		if !strings.Contains(pm.Text, want) {
+			t.Errorf("expected %q in the text part:\n%s", want, pm.Text)
+		}
+	}
+	if !strings.Contains(pm.HTML, "Sync &lt;b&gt;breaks&lt;/b&gt; &amp; loses data") {
+		t.Errorf("expected an escaped comment in the HTML part:\n%s", pm.HTML)
+	}
+	if !strings.Contains(cto.Text, "== devtool ==\n\nNPS -20.0\n") {
+		t.Errorf("expected no trend without previous feedback:\n%s", cto.Text)
+	}
+}
+
+func TestValidateRecipients(t *testing.T) {
+	if err := ValidateRecipients(map[string][]string{"idefinity": {"pm@example.com"}}); err != nil {
+		t.Error(err)
+	}
+	for _, bad := range []string{"pm", "PM <pm@example.com>", "pm@example.com\r\nBcc: x@example.com"} {
+		if err := ValidateRecipients(map[string][]string{"idefinity": {bad}}); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+// sink is a local SMTP server that offers STARTTLS and AUTH PLAIN and keeps
+// what it receives.
+type sink struct {
+	ln  net.Listener
+	tls *tls.Config
+
+	mu       sync.Mutex
+	tlsUsed  bool
+	auth     string
+	rcpts    []string
+	messages []string
+}
+
+func newSink(t *testing.T) (*sink, *tls.Config) {
+	// httptest's certificate is valid for 127.0.0.1.
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(ts.Close)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &sink{ln: ln, tls: &tls.Config{Certificates: ts.TLS.Certificates}}
+	go s.serve()
+	return s, &tls.Config{RootCAs: ts.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+}
+
+func (s *sink) port() int { return s.ln.Addr().(*net.TCPAddr).Port }
+
+func (s *sink) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(conn)
+	}
+}
+
+func (s *sink) session(conn net.Conn) {
+	defer conn.Close()
+	tc := textproto.NewConn(conn)
+	tc.PrintfLine("220 sink ESMTP")
+	secure := false
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			if secure {
+				tc.PrintfLine("250-sink\r\n250 AUTH PLAIN")
+			} else {
+				tc.PrintfLine("250-sink\r\n250 STARTTLS")
+			}
+		case "STARTTLS":
+			tc.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tls)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			tc = textproto.NewConn(conn)
+			s.mu.Lock()
+			s.tlsUsed = true
+			s.mu.Unlock()
+		case "AUTH":
+			_, cred, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(cred)
+			s.mu.Lock()
+			s.auth = string(decoded)
+			s.mu.Unlock()
+			tc.PrintfLine("235 ok")
+		case "MAIL":
+			tc.PrintfLine("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, arg)
+			s.mu.Unlock()
+			tc.PrintfLine("250 ok")
+		case "DATA":
+			tc.PrintfLine("354 go ahead")
+			data, err := tc.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			tc.PrintfLine("250 queued")
+		case "QUIT":
+			tc.PrintfLine("221 bye")
+			return
+		default:
+			tc.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func TestMailer_SendsToLocalSink(t *testing.T) {
+	s, clientTLS := newSink(t)
+	m, err := NewMailer(SMTPConfig{
+		Host: "127.0.0.1", Port: s.port(),
+		Username: "digest", Password: "secret",
+		From:      "nps@example.com",
+		StartTLS:  true,
+		TLSConfig: clientTLS,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := Compose(context.Background(), newFakeSource(), map[string][]string{"idefinity": {"pm@example.com"}}, week)
+	if err := m.Send(context.Background(), msgs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.tlsUsed || s.auth != "\x00digest\x00secret" {
+		t.Errorf("expected authentication after STARTTLS, tls %v auth %q", s.tlsUsed, s.auth)
+	}
+	if len(s.rcpts) != 1 || s.rcpts[0] != "TO:<pm@example.com>" {
+		t.Errorf("unexpected recipients %v", s.rcpts)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(s.messages[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != msgs[0].Subject {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	_, params, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part) // quoted-printable is decoded by NextPart
+		types = append(types, part.Header.Get("Content-Type"))
+		if !strings.Contains(string(body), "idefinity") {
+			t.Errorf("expected the report in the %s part", part.Header.Get("Content-Type"))
+		}
+	}
+	if len(types) != 2 || types[0] != "text/plain; charset=utf-8" || types[1] != "text/html; charset=utf-8" {
+		t.Errorf("unexpected parts %v", types)
+	}
+}
+
+func TestMailer_RequiresSTARTTLS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("220 plain ESMTP\r\n"))
+		r.ReadString('\n')
+		conn.Write([]byte("250 plain\r\n"))
+		r.ReadString('\n')
+	}()
+
+	m, _ := NewMailer(SMTPConfig{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port, From: "nps@example.com", StartTLS: true})
+	err = m.Send(context.Background(), Message{To: []string{"pm@example.com"}, Subject: "x"})
+	if err == nil || !strings.Contains(err.Error(), "does not offer STARTTLS") {
+		t.Errorf("expected a STARTTLS error, got %v", err)
+	}
+}
+
+// flakySender fails the first failures sends.
+type flakySender struct {
+	failures int
+	sent     []Message
+}
+
+func (f *flakySender) Send(_ context.Context, msg Message) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("451 try again later")
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func TestScheduler_SendsOncePerWeek(t *testing.T) {
+	schedule, _ := ParseSchedule("mon 08:00", time.UTC)
+	sender := &flakySender{failures: 1}
+	s := NewScheduler(newFakeSource(), sender, NewMemoryRuns(), schedule, map[string][]string{
+		"idefinity": {"pm@example.com"},
+		"devtool":   {"dev@example.com"},
+	})
+	now := time.Date(2026, 3, 9, 7, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if n, _ := s.RunOnce(ctx); n != 0 {
+		t.Fatalf("expected last week's digest to be past catch-up, sent %d", n)
+	}
+
+	now = now.Add(time.Hour)
+	if n, err := s.RunOnce(ctx); n != 1 || err != nil {
+		t.Fatalf("expected one send and one failure, sent %d, err %v", n, err)
+	}
+	if n, _ := s.RunOnce(ctx); n != 1 || sender.sent[1].To[0] != "dev@example.com" {
+		t.Fatalf("expected the failed recipient to be retried, sent %d", n)
+	}
+
+	// Another replica sharing the claims sends nothing.
+	replica := NewScheduler(newFakeSource(), sender, s.runs, schedule, s.recipients)
+	replica.now = s.now
+	if n, _ := replica.RunOnce(ctx); n != 0 || len(sender.sent) != 2 {
+		t.Errorf("expected no duplicates, sent %d", n)
+	}
+	if sender.sent[0].Subject != "Weekly NPS for idefinity: 40.0 (+10.0)" {
+		t.Errorf("expected the digest for the week before the send, got %q", sender.sent[0].Subject)
+	}
+}
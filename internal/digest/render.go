@@ -0,0 +1,88 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// CommentLength is how many characters of a comment a digest shows.
+const CommentLength = 500
+
+//go:embed templates
+var templateFS embed.FS
+
+var funcs = map[string]any{
+	"date":    func(t time.Time) string { return t.UTC().Format("Mon 2 Jan 2006") },
+	"nps":     func(v float64) string { return fmt.Sprintf("%.1f", v) },
+	"delta":   formatDelta,
+	"excerpt": func(s string) string { return excerpt(s, CommentLength) },
+	"indent":  func(s string) string { return strings.ReplaceAll(s, "\n", "\n  ") },
+}
+
+var (
+	textTemplate = texttemplate.Must(texttemplate.New("digest.txt").Funcs(funcs).ParseFS(templateFS, "templates/digest.txt"))
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(funcs).ParseFS(templateFS, "templates/digest.html"))
+)
+
+// Last returns the last day p covers.
+func (p Period) Last() time.Time {
+	return p.To.AddDate(0, 0, -1)
+}
+
+// Render returns the message for r, without recipients.
+func Render(r Report) (Message, error) {
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, r); err != nil {
+		return Message{}, fmt.Errorf("failed to render text digest: %w", err)
+	}
+	if err := htmlTemplate.Execute(&html, r); err != nil {
+		return Message{}, fmt.Errorf("failed to render HTML digest: %w", err)
+	}
+	return Message{Subject: subject(r), Text: text.String(), HTML: html.String()}, nil
+}
+
+// subject leads with the score when the digest covers a single app.
+func subject(r Report) string {
+	if len(r.Apps) == 1 {
+		a := r.Apps[0]
+		s := fmt.Sprintf("Weekly NPS for %s: %.1f", a.App, a.Current.NPS)
+		if d := formatDelta(a); d != "" {
+			s += " (" + d + ")"
+		}
+		return s
+	}
+	return fmt.Sprintf("Weekly NPS for %d apps, %s to %s", len(r.Apps),
+		r.Period.From.Format("2 Jan"), r.Period.Last().Format("2 Jan 2006"))
+}
+
+// formatDelta renders the NPS change as +3.5, -2.0 or ±0.0, or "" when
+// there is nothing to compare with.
+func formatDelta(a AppReport) string {
+	d, ok := a.Delta()
+	switch {
+	case !ok:
+		return ""
+	case d > 0:
+		return fmt.Sprintf("+%.1f", d)
+	case d < 0:
+		return fmt.Sprintf("%.1f", d)
+	default:
+		return "±0.0"
+	}
+}
+
+// excerpt shortens s to at most n characters, ending it with an ellipsis
+// when cut.
+func excerpt(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:n-1])) + "…"
+}
@@ -0,0 +1,234 @@
+package digest
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// metrics are published under "digest" on the expvar endpoint.
+var metrics = expvar.NewMap("digest")
+
+// RunCollection records which digests have been sent.
+const RunCollection = "digest_runs"
+
+// CatchUp is how long after its scheduled time a digest is still sent, for
+// example when the server was down at the time.
+const CatchUp = 24 * time.Hour
+
+// Schedule is a weekly send time, such as Monday 08:00 in Location.
+type Schedule struct {
+	Weekday time.Weekday
+	// Minute is minutes after midnight in Location.
+	Minute   int
+	Location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses "mon 08:00": a three-letter weekday and a time of
+// day in loc.
+func ParseSchedule(s string, loc *time.Location) (Schedule, error) {
+	day, clock, ok := strings.Cut(strings.TrimSpace(s), " ")
+	weekday, known := weekdays[strings.ToLower(day)]
+	if !ok || !known {
+		return Schedule{}, fmt.Errorf("schedule %q: expected a weekday and HH:MM, such as mon 08:00", s)
+	}
+	h, m, ok := strings.Cut(strings.TrimSpace(clock), ":")
+	hour, herr := strconv.Atoi(h)
+	minute, merr := strconv.Atoi(m)
+	if !ok || herr != nil || merr != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return Schedule{}, fmt.Errorf("schedule %q: invalid time %q", s, clock)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return Schedule{Weekday: weekday, Minute: hour*60 + minute, Location: loc}, nil
+}
+
+// Last returns the latest scheduled time at or before t.
+func (s Schedule) Last(t time.Time) time.Time {
+	local := t.In(s.Location)
+	back := (int(local.Weekday()) - int(s.Weekday) + 7) % 7
+	day := local.AddDate(0, 0, -back)
+	at := time.Date(day.Year(), day.Month(), day.Day(), s.Minute/60, s.Minute%60, 0, 0, s.Location)
+	if at.After(t) {
+		day = day.AddDate(0, 0, -7)
+		at = time.Date(day.Year(), day.Month(), day.Day(), s.Minute/60, s.Minute%60, 0, 0, s.Location)
+	}
+	return at
+}
+
+// Runs records sent digests so that each is sent once across restarts and
+// replicas.
+type Runs interface {
+	// Claim records key and reports whether it was new.
+	Claim(ctx context.Context, key string, at time.Time) (bool, error)
+	// Release forgets key so that a failed send is tried again.
+	Release(ctx context.Context, key string) error
+}
+
+// MongoRuns implements Runs on the digest_runs collection, whose unique
+// _id makes a claim atomic.
+type MongoRuns struct {
+	coll *mongo.Collection
+}
+
+// NewMongoRuns creates a MongoRuns.
+func NewMongoRuns(coll *mongo.Collection) *MongoRuns {
+	return &MongoRuns{coll: coll}
+}
+
+// Claim implements Runs.
+func (r *MongoRuns) Claim(ctx context.Context, key string, at time.Time) (bool, error) {
+	_, err := r.coll.InsertOne(ctx, bson.D{{Key: "_id", Value: key}, {Key: "claimed_at", Value: at}})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim digest: %w", err)
+	}
+	return true, nil
+}
+
+// Release implements Runs.
+func (r *MongoRuns) Release(ctx context.Context, key string) error {
+	if _, err := r.coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: key}}); err != nil {
+		return fmt.Errorf("failed to release digest: %w", err)
+	}
+	return nil
+}
+
+// MemoryRuns implements Runs in memory, for tests and single instances.
+type MemoryRuns struct {
+	mu     sync.Mutex
+	claims map[string]time.Time
+}
+
+// NewMemoryRuns creates an empty MemoryRuns.
+func NewMemoryRuns() *MemoryRuns {
+	return &MemoryRuns{claims: map[string]time.Time{}}
+}
+
+// Claim implements Runs.
+func (r *MemoryRuns) Claim(_ context.Context, key string, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.claims[key]; ok {
+		return false, nil
+	}
+	r.claims[key] = at
+	return true, nil
+}
+
+// Release implements Runs.
+func (r *MemoryRuns) Release(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.claims, key)
+	return nil
+}
+
+// Scheduler sends the digest for the week before each scheduled time. A
+// digest is claimed per recipient before it is sent, so a replica that
+// crashes mid-send can skip a recipient but never mails one twice.
+type Scheduler struct {
+	src        Source
+	sender     Sender
+	runs       Runs
+	schedule   Schedule
+	recipients map[string][]string
+	now        func() time.Time
+
+	// done is the scheduled time whose digests all went out, so later runs
+	// need not compose them again.
+	done time.Time
+}
+
+// NewScheduler creates a Scheduler. recipients maps an app, or AllApps, to
+// the addresses that get its digest and must have passed
+// ValidateRecipients.
+func NewScheduler(src Source, sender Sender, runs Runs, schedule Schedule, recipients map[string][]string) *Scheduler {
+	return &Scheduler{
+		src:        src,
+		sender:     sender,
+		runs:       runs,
+		schedule:   schedule,
+		recipients: recipients,
+		now:        time.Now,
+	}
+}
+
+// Start checks for a due digest every interval until ctx is cancelled. Runs
+// must not overlap, so Start is the only caller of RunOnce in the server.
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RunOnce(ctx); err != nil {
+			slog.Error("digest run failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce sends the digests for the latest scheduled time that are not yet
+// sent, provided it is less than CatchUp ago, and returns how many it sent.
+// A recipient whose send fails is released and tried again on the next run.
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	now := s.now()
+	at := s.schedule.Last(now)
+	if now.Sub(at) > CatchUp || at.Equal(s.done) {
+		return 0, nil
+	}
+	p := WeekBefore(at)
+
+	msgs, err := Compose(ctx, s.src, s.recipients, p)
+	if err != nil {
+		return 0, err
+	}
+	sent, failed := 0, 0
+	for _, msg := range msgs {
+		key := p.From.Format(time.DateOnly) + "/" + msg.To[0]
+		ok, err := s.runs.Claim(ctx, key, now)
+		if err != nil {
+			return sent, err
+		}
+		if !ok {
+			continue
+		}
+		if err := s.sender.Send(ctx, msg); err != nil {
+			slog.Warn("failed to send digest, will retry", "to", msg.To[0], "error", err)
+			metrics.Add("failed", 1)
+			failed++
+			if err := s.runs.Release(ctx, key); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		metrics.Add("sent", 1)
+		sent++
+	}
+	if failed == 0 {
+		s.done = at
+	}
+	if sent > 0 || failed > 0 {
+		slog.Info("weekly digest sent", "week", p.From.Format(time.DateOnly), "sent", sent, "failed", failed)
+	}
+	return sent, nil
+}
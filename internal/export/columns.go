@@ -0,0 +1,124 @@
+// Package export writes feedback documents as CSV, NDJSON or Parquet. Rows
+// are written one at a time so callers can stream straight from a cursor.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Kind is the value type of a column.
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindInt
+	KindTime
+)
+
+// Column is one exportable field. Value returns nil for an empty optional
+// field, which is written as an empty CSV cell, a JSON null or a Parquet null.
+type Column struct {
+	Name  string
+	Kind  Kind
+	Value func(fb *model.Feedback) any
+}
+
+func stringCol(name string, get func(fb *model.Feedback) string) Column {
+	return Column{Name: name, Kind: KindString, Value: func(fb *model.Feedback) any {
+		if s := get(fb); s != "" {
+			return s
+		}
+		return nil
+	}}
+}
+
+// Columns lists every exportable column in default order. Server-side spam
+// and redaction metadata is not exported, and neither is the pre-redaction
+// original comment.
+var Columns = []Column{
+	stringCol("id", func(fb *model.Feedback) string {
+		if fb.ID.IsZero() {
+			return ""
+		}
+		return fb.ID.Hex()
+	}),
+	stringCol("schema_version", func(fb *model.Feedback) string { return fb.SchemaVersion }),
+	stringCol("app", func(fb *model.Feedback) string { return fb.App }),
+	stringCol("app_version", func(fb *model.Feedback) string { return fb.AppVersion }),
+	stringCol("platform", func(fb *model.Feedback) string { return fb.Platform }),
+	stringCol("timestamp", func(fb *model.Feedback) string { return fb.Timestamp }),
+	{Name: "nps_rating", Kind: KindInt, Value: func(fb *model.Feedback) any { return fb.NPSRating }},
+	stringCol("nps_category", func(fb *model.Feedback) string { return fb.NPSCategory }),
+	stringCol("timezone", func(fb *model.Feedback) string { return fb.Timezone }),
+	stringCol("comment", func(fb *model.Feedback) string { return fb.Comment }),
+	{Name: "received_at", Kind: KindTime, Value: func(fb *model.Feedback) any {
+		if fb.ReceivedAt.IsZero() {
+			return nil
+		}
+		return fb.ReceivedAt.UTC()
+	}},
+	stringCol("install_id", func(fb *model.Feedback) string { return fb.InstallID }),
+	stringCol("survey_id", func(fb *model.Feedback) string { return fb.SurveyID }),
+	{Name: "survey_version", Kind: KindInt, Value: func(fb *model.Feedback) any {
+		if fb.SurveyVersion == 0 {
+			return nil
+		}
+		return fb.SurveyVersion
+	}},
+	// Answers vary per survey, so they are exported as one JSON array.
+	stringCol("answers", func(fb *model.Feedback) string {
+		if len(fb.Answers) == 0 {
+			return ""
+		}
+		b, _ := json.Marshal(fb.Answers)
+		return string(b)
+	}),
+	stringCol("locale", func(fb *model.Feedback) string { return fb.Locale }),
+}
+
+// ParseColumns selects columns from a comma-separated list of names, in the
+// order given. An empty list selects all Columns.
+func ParseColumns(s string) ([]Column, error) {
+	if strings.TrimSpace(s) == "" {
+		return Columns, nil
+	}
+	byName := make(map[string]Column, len(Columns))
+	for _, c := range Columns {
+		byName[c.Name] = c
+	}
+
+	var cols []Column
+	seen := map[string]bool{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		c, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		seen[name] = true
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// text formats a column value for CSV.
+func text(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,56 @@
+package export
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Copy writes every feedback document from cur to out and closes out. With a
+// keyring, comments and free-text answers are decrypted first. onBatch, if
+// set, is called after every batch rows so callers can flush and extend
+// deadlines. It returns the number of rows written; on error the output is
+// incomplete.
+func Copy(ctx context.Context, cur *mongo.Cursor, out Writer, keyring *fieldcrypt.Keyring, batch int, onBatch func()) (int, error) {
+	rows := 0
+	for cur.Next(ctx) {
+		var fb model.Feedback
+		if err := cur.Decode(&fb); err != nil {
+			return rows, fmt.Errorf("failed to decode feedback: %w", err)
+		}
+		if keyring != nil {
+			if err := fieldcrypt.DecryptFeedback(keyring, &fb); err != nil {
+				return rows, fmt.Errorf("failed to decrypt feedback %s: %w", fb.ID.Hex(), err)
+			}
+		}
+		if err := out.Write(&fb); err != nil {
+			return rows, err
+		}
+		rows++
+		if onBatch != nil && rows%batch == 0 {
+			onBatch()
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return rows, fmt.Errorf("export cursor failed: %w", err)
+	}
+	return rows, out.Close()
+}
+
+// WithoutText returns a Writer that removes comments and free-text answers
+// before passing rows to out, for callers without the read scope. Their
+// columns stay in the output, empty.
+func WithoutText(out Writer) Writer {
+	return textless{out}
+}
+
+type textless struct{ Writer }
+
+func (t textless) Write(fb *model.Feedback) error {
+	fb.StripText()
+	return t.Writer.Write(fb)
+}
@@ -0,0 +1,143 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+func sample() *model.Feedback {
+	return &model.Feedback{
+		ID:            bson.NewObjectID(),
+		SchemaVersion: "1.0",
+		App:           "idefinity",
+		AppVersion:    "2.1.0",
+		Platform:      "macOS",
+		Timestamp:     "2026-03-31T10:00:00+03:00",
+		NPSRating:     9,
+		NPSCategory:   "promoter",
+		Comment:       "Great, but \"export\" is slow\non big models",
+		ReceivedAt:    time.Date(2026, 3, 31, 7, 0, 0, 0, time.UTC),
+	}
+}
+
+func writeAll(t *testing.T, f Format, cols []Column, rows ...*model.Feedback) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(f, &buf, cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fb := range rows {
+		if err := w.Write(fb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSV_EscapesComments(t *testing.T) {
+	cols, _ := ParseColumns("nps_rating,comment,timezone")
+	got := string(writeAll(t, CSV, cols, sample()))
+	want := "nps_rating,comment,timezone\r\n9,\"Great, but \"\"export\"\" is slow\r\non big models\",\r\n"
+	if got != want {
+		t.Errorf("unexpected CSV:\n%q\nwant\n%q", got, want)
+	}
+
+	if got := string(writeAll(t, CSV, cols)); got != "nps_rating,comment,timezone\r\n" {
+		t.Errorf("expected header only for empty export, got %q", got)
+	}
+}
+
+func TestNDJSON_KeepsColumnOrderAndNulls(t *testing.T) {
+	cols, _ := ParseColumns("app,timezone,nps_rating,received_at")
+	got := string(writeAll(t, NDJSON, cols, sample(), sample()))
+	line := `{"app":"idefinity","timezone":null,"nps_rating":9,"received_at":"2026-03-31T07:00:00Z"}` + "\n"
+	if got != line+line {
+		t.Errorf("unexpected NDJSON %q", got)
+	}
+}
+
+func TestParquet_FileLayout(t *testing.T) {
+	rows := make([]*model.Feedback, parquetRowGroupSize+5)
+	for i := range rows {
+		rows[i] = sample()
+	}
+	data := writeAll(t, Parquet, Columns, rows...)
+
+	if !bytes.HasPrefix(data, parquetMagic) || !bytes.HasSuffix(data, parquetMagic) {
+		t.Fatal("expected PAR1 magic at both ends")
+	}
+	footerLen := binary.LittleEndian.Uint32(data[len(data)-8:])
+	if int(footerLen) >= len(data)-12 {
+		t.Fatalf("footer length %d out of range", footerLen)
+	}
+	footer := data[len(data)-8-int(footerLen) : len(data)-8]
+	for _, name := range []string{"comment", "received_at", "nps-api"} {
+		if !bytes.Contains(footer, []byte(name)) {
+			t.Errorf("expected %q in footer metadata", name)
+		}
+	}
+
+	empty := writeAll(t, Parquet, Columns)
+	if !bytes.HasPrefix(empty, parquetMagic) || !bytes.HasSuffix(empty, parquetMagic) {
+		t.Error("expected a valid file for an empty export")
+	}
+}
+
+func TestEncodeDefinitionLevels(t *testing.T) {
+	got := encodeDefinitionLevels([]bool{true, false, true, true, false, false, false, false, true})
+	// Two bit-packed groups: header (2<<1)|1, then LSB-first bits.
+	want := []byte{0x05, 0x0D, 0x01}
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected %x, got %x", want, got)
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	all, err := ParseColumns("")
+	if err != nil || len(all) != len(Columns) {
+		t.Errorf("expected all columns by default, got %d, %v", len(all), err)
+	}
+	cols, err := ParseColumns(" comment , app")
+	if err != nil || cols[0].Name != "comment" || cols[1].Name != "app" {
+		t.Errorf("expected requested order, got %v, %v", cols, err)
+	}
+	for _, bad := range []string{"app,app", "app,spam_score", "comment_original"} {
+		if _, err := ParseColumns(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestFormatSelection(t *testing.T) {
+	tests := map[string]Format{
+		"":                                    CSV,
+		"text/html, */*":                      CSV,
+		"application/x-ndjson":                NDJSON,
+		"application/vnd.apache.parquet, */*": Parquet,
+	}
+	for accept, want := range tests {
+		if got := FormatFromAccept(accept); got != want {
+			t.Errorf("Accept %q: expected %s, got %s", accept, want, got)
+		}
+	}
+	if f, ok := ParseFormat(" NDJSON "); !ok || f != NDJSON {
+		t.Errorf("expected ndjson, got %s", f)
+	}
+	if _, ok := ParseFormat("xml"); ok {
+		t.Error("expected xml to be rejected")
+	}
+	if !strings.HasPrefix(CSV.ContentType(), "text/csv") {
+		t.Errorf("unexpected CSV content type %s", CSV.ContentType())
+	}
+}
@@ -0,0 +1,165 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	Parquet Format = "parquet"
+)
+
+var contentTypes = map[Format]string{
+	CSV:     "text/csv; charset=utf-8",
+	NDJSON:  "application/x-ndjson",
+	Parquet: "application/vnd.apache.parquet",
+}
+
+// mediaTypes maps accepted Accept header media types to formats.
+var mediaTypes = map[string]Format{
+	"text/csv":                       CSV,
+	"application/x-ndjson":           NDJSON,
+	"application/ndjson":             NDJSON,
+	"application/vnd.apache.parquet": Parquet,
+	"application/x-parquet":          Parquet,
+}
+
+// ParseFormat parses a ?format= value.
+func ParseFormat(s string) (Format, bool) {
+	f := Format(strings.ToLower(strings.TrimSpace(s)))
+	_, ok := contentTypes[f]
+	return f, ok
+}
+
+// FormatFromAccept returns the first format listed in an Accept header, or
+// CSV when none is. Quality values are ignored; clients wanting a specific
+// format should list only that one or use ?format=.
+func FormatFromAccept(accept string) Format {
+	for _, part := range strings.Split(accept, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if f, ok := mediaTypes[mt]; ok {
+			return f
+		}
+	}
+	return CSV
+}
+
+// ContentType returns the response Content-Type for f.
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// Writer writes feedback rows in one format. Close must be called to flush
+// buffered rows and, for Parquet, write the footer.
+type Writer interface {
+	Write(fb *model.Feedback) error
+	Close() error
+}
+
+// NewWriter returns a Writer for f that emits the given columns to w.
+func NewWriter(f Format, w io.Writer, cols []Column) (Writer, error) {
+	switch f {
+	case CSV:
+		return newCSVWriter(w, cols), nil
+	case NDJSON:
+		return newNDJSONWriter(w, cols), nil
+	case Parquet:
+		return newParquetWriter(w, cols), nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", f)
+	}
+}
+
+// csvWriter writes RFC 4180 CSV: CRLF line endings, and fields containing
+// commas, quotes or line breaks quoted with embedded quotes doubled.
+type csvWriter struct {
+	w       *csv.Writer
+	cols    []Column
+	record  []string
+	started bool
+}
+
+func newCSVWriter(w io.Writer, cols []Column) *csvWriter {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	return &csvWriter{w: cw, cols: cols, record: make([]string, len(cols))}
+}
+
+func (c *csvWriter) Write(fb *model.Feedback) error {
+	if !c.started {
+		c.started = true
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+	for i, col := range c.cols {
+		c.record[i] = text(col.Value(fb))
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) writeHeader() error {
+	for i, col := range c.cols {
+		c.record[i] = col.Name
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	if !c.started {
+		c.started = true
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ndjsonWriter writes one JSON object per line with keys in column order.
+type ndjsonWriter struct {
+	w    *bufio.Writer
+	cols []Column
+}
+
+func newNDJSONWriter(w io.Writer, cols []Column) *ndjsonWriter {
+	return &ndjsonWriter{w: bufio.NewWriter(w), cols: cols}
+}
+
+func (n *ndjsonWriter) Write(fb *model.Feedback) error {
+	n.w.WriteByte('{')
+	for i, col := range n.cols {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(col.Name)
+		val, err := json.Marshal(col.Value(fb))
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", col.Name, err)
+		}
+		n.w.Write(key)
+		n.w.WriteByte(':')
+		n.w.Write(val)
+	}
+	n.w.WriteByte('}')
+	return n.w.WriteByte('\n')
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.w.Flush()
+}
@@ -0,0 +1,252 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Parquet physical types, converted types, encodings and repetition types
+// from parquet.thrift.
+const (
+	pqInt32     = 1
+	pqInt64     = 2
+	pqByteArray = 6
+
+	pqConvertedUTF8            = 0
+	pqConvertedTimestampMillis = 9
+
+	pqEncodingPlain = 0
+	pqEncodingRLE   = 3
+
+	pqOptional = 1
+
+	pqDataPage = 0
+)
+
+// parquetRowGroupSize bounds the rows buffered in memory before a row group
+// is written out.
+const parquetRowGroupSize = 10000
+
+var parquetMagic = []byte("PAR1")
+
+// parquetWriter writes an uncompressed Parquet file with every column
+// optional and PLAIN encoded, one data page per column chunk. Rows are
+// buffered per row group, so memory is bounded by parquetRowGroupSize
+// regardless of the export size.
+type parquetWriter struct {
+	w    io.Writer
+	cols []Column
+
+	offset  int64
+	err     error
+	rows    int
+	total   int64
+	pages   []*pageBuffer
+	written []rowGroupMeta
+}
+
+// pageBuffer accumulates one column's definition levels and values.
+type pageBuffer struct {
+	defined []bool
+	values  []byte
+}
+
+type columnChunkMeta struct {
+	offset            int64
+	size              int64
+	numValues         int64
+	uncompressedBytes int64
+}
+
+type rowGroupMeta struct {
+	rows    int64
+	columns []columnChunkMeta
+}
+
+func newParquetWriter(w io.Writer, cols []Column) *parquetWriter {
+	pw := &parquetWriter{w: w, cols: cols, pages: make([]*pageBuffer, len(cols))}
+	for i := range pw.pages {
+		pw.pages[i] = &pageBuffer{}
+	}
+	return pw
+}
+
+func (p *parquetWriter) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	p.err = err
+}
+
+func (p *parquetWriter) Write(fb *model.Feedback) error {
+	if p.offset == 0 {
+		p.write(parquetMagic)
+	}
+	for i, col := range p.cols {
+		page := p.pages[i]
+		v := col.Value(fb)
+		page.defined = append(page.defined, v != nil)
+		if v == nil {
+			continue
+		}
+		switch col.Kind {
+		case KindString:
+			s := v.(string)
+			page.values = binary.LittleEndian.AppendUint32(page.values, uint32(len(s)))
+			page.values = append(page.values, s...)
+		case KindInt:
+			page.values = binary.LittleEndian.AppendUint32(page.values, uint32(int32(v.(int))))
+		case KindTime:
+			page.values = binary.LittleEndian.AppendUint64(page.values, uint64(v.(time.Time).UnixMilli()))
+		}
+	}
+	p.rows++
+	if p.rows == parquetRowGroupSize {
+		p.flushRowGroup()
+	}
+	return p.err
+}
+
+// flushRowGroup writes the buffered rows as one row group.
+func (p *parquetWriter) flushRowGroup() {
+	if p.rows == 0 {
+		return
+	}
+	rg := rowGroupMeta{rows: int64(p.rows)}
+	for _, page := range p.pages {
+		levels := encodeDefinitionLevels(page.defined)
+		body := make([]byte, 0, 4+len(levels)+len(page.values))
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(levels)))
+		body = append(body, levels...)
+		body = append(body, page.values...)
+
+		var h compact
+		h.beginStruct()
+		h.i32(1, pqDataPage)
+		h.i32(2, int32(len(body)))
+		h.i32(3, int32(len(body)))
+		h.structField(5, func() {
+			h.i32(1, int32(p.rows))
+			h.i32(2, pqEncodingPlain)
+			h.i32(3, pqEncodingRLE)
+			h.i32(4, pqEncodingRLE)
+		})
+		h.endStruct()
+
+		chunk := columnChunkMeta{
+			offset:    p.offset,
+			numValues: int64(p.rows),
+		}
+		p.write(h.buf)
+		p.write(body)
+		chunk.size = p.offset - chunk.offset
+		chunk.uncompressedBytes = chunk.size
+		rg.columns = append(rg.columns, chunk)
+
+		page.defined = page.defined[:0]
+		page.values = page.values[:0]
+	}
+	p.total += rg.rows
+	p.written = append(p.written, rg)
+	p.rows = 0
+}
+
+// Close writes any buffered rows and the file footer.
+func (p *parquetWriter) Close() error {
+	if p.offset == 0 {
+		p.write(parquetMagic)
+	}
+	p.flushRowGroup()
+
+	footer := p.fileMetadata()
+	p.write(footer)
+	p.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	p.write(parquetMagic)
+	if p.err != nil {
+		return fmt.Errorf("failed to write parquet: %w", p.err)
+	}
+	return nil
+}
+
+func (p *parquetWriter) fileMetadata() []byte {
+	var c compact
+	c.beginStruct()
+	c.i32(1, 1) // version
+	c.structList(2, len(p.cols)+1, func(i int) {
+		if i == 0 {
+			c.binary(4, "schema")
+			c.i32(5, int32(len(p.cols)))
+			return
+		}
+		col := p.cols[i-1]
+		physical, converted := parquetType(col.Kind)
+		c.i32(1, physical)
+		c.i32(3, pqOptional)
+		c.binary(4, col.Name)
+		if converted >= 0 {
+			c.i32(6, converted)
+		}
+	})
+	c.i64(3, p.total)
+	c.structList(4, len(p.written), func(i int) {
+		rg := p.written[i]
+		var size int64
+		for _, chunk := range rg.columns {
+			size += chunk.uncompressedBytes
+		}
+		c.structList(1, len(rg.columns), func(j int) {
+			chunk := rg.columns[j]
+			col := p.cols[j]
+			physical, _ := parquetType(col.Kind)
+			c.i64(2, chunk.offset)
+			c.structField(3, func() {
+				c.i32(1, physical)
+				c.i32List(2, pqEncodingPlain, pqEncodingRLE)
+				c.stringList(3, col.Name)
+				c.i32(4, 0) // UNCOMPRESSED
+				c.i64(5, chunk.numValues)
+				c.i64(6, chunk.uncompressedBytes)
+				c.i64(7, chunk.size)
+				c.i64(9, chunk.offset)
+			})
+		})
+		c.i64(2, size)
+		c.i64(3, rg.rows)
+	})
+	c.binary(6, "nps-api")
+	c.endStruct()
+	return c.buf
+}
+
+// parquetType returns the physical and converted type for a column kind;
+// converted is -1 when there is none.
+func parquetType(k Kind) (physical, converted int32) {
+	switch k {
+	case KindInt:
+		return pqInt32, -1
+	case KindTime:
+		return pqInt64, pqConvertedTimestampMillis
+	default:
+		return pqByteArray, pqConvertedUTF8
+	}
+}
+
+// encodeDefinitionLevels encodes 0/1 definition levels with the RLE/bit-packed
+// hybrid encoding at bit width 1, as a single bit-packed run.
+func encodeDefinitionLevels(defined []bool) []byte {
+	groups := (len(defined) + 7) / 8
+	out := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups)
+	for i, d := range defined {
+		if d {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return append(out, packed...)
+}
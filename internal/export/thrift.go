@@ -0,0 +1,108 @@
+package export
+
+import "encoding/binary"
+
+// Thrift compact protocol type IDs, as used by Parquet metadata.
+const (
+	tI32    = 5
+	tI64    = 6
+	tBinary = 8
+	tList   = 9
+	tStruct = 12
+)
+
+// compact is a minimal Thrift compact protocol encoder covering what Parquet
+// file and page headers need: i32, i64, binary, lists and nested structs.
+type compact struct {
+	buf  []byte
+	last []int16 // last field ID per open struct
+}
+
+func (c *compact) varint(v uint64) {
+	c.buf = binary.AppendUvarint(c.buf, v)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func (c *compact) field(id int16, typ byte) {
+	top := len(c.last) - 1
+	delta := id - c.last[top]
+	if delta > 0 && delta <= 15 {
+		c.buf = append(c.buf, byte(delta)<<4|typ)
+	} else {
+		c.buf = append(c.buf, typ)
+		c.varint(zigzag(int64(id)))
+	}
+	c.last[top] = id
+}
+
+func (c *compact) beginStruct() {
+	c.last = append(c.last, 0)
+}
+
+func (c *compact) endStruct() {
+	c.buf = append(c.buf, 0) // STOP
+	c.last = c.last[:len(c.last)-1]
+}
+
+func (c *compact) i32(id int16, v int32) {
+	c.field(id, tI32)
+	c.varint(zigzag(int64(v)))
+}
+
+func (c *compact) i64(id int16, v int64) {
+	c.field(id, tI64)
+	c.varint(zigzag(v))
+}
+
+func (c *compact) binary(id int16, s string) {
+	c.field(id, tBinary)
+	c.varint(uint64(len(s)))
+	c.buf = append(c.buf, s...)
+}
+
+func (c *compact) listHeader(id int16, elem byte, n int) {
+	c.field(id, tList)
+	if n < 15 {
+		c.buf = append(c.buf, byte(n)<<4|elem)
+	} else {
+		c.buf = append(c.buf, 0xF0|elem)
+		c.varint(uint64(n))
+	}
+}
+
+func (c *compact) i32List(id int16, vs ...int32) {
+	c.listHeader(id, tI32, len(vs))
+	for _, v := range vs {
+		c.varint(zigzag(int64(v)))
+	}
+}
+
+func (c *compact) stringList(id int16, vs ...string) {
+	c.listHeader(id, tBinary, len(vs))
+	for _, s := range vs {
+		c.varint(uint64(len(s)))
+		c.buf = append(c.buf, s...)
+	}
+}
+
+// structList writes a list of n structs, calling each to fill in element i
+// between the struct begin and end markers.
+func (c *compact) structList(id int16, n int, each func(i int)) {
+	c.listHeader(id, tStruct, n)
+	for i := range n {
+		c.beginStruct()
+		each(i)
+		c.endStruct()
+	}
+}
+
+// structField writes a nested struct field.
+func (c *compact) structField(id int16, body func()) {
+	c.field(id, tStruct)
+	c.beginStruct()
+	body()
+	c.endStruct()
+}
@@ -0,0 +1,111 @@
+package fieldcrypt
+
+import (
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Field names bound into the associated data of sealed feedback values.
+const (
+	FieldComment         = "comment"
+	FieldCommentOriginal = "comment_original"
+	// FieldAnswer is followed by the question ID of a free-text answer.
+	FieldAnswer = "answers."
+)
+
+// FieldAAD returns the associated data that binds a sealed value to one field
+// of one document.
+func FieldAAD(id bson.ObjectID, field string) []byte {
+	return []byte(id.Hex() + "/" + field)
+}
+
+// EncryptComment moves fb.Comment into fb.CommentEnc. fb.ID must already be
+// assigned. Empty comments are left as they are.
+func EncryptComment(k *Keyring, fb *model.Feedback) error {
+	if fb.Comment == "" {
+		return nil
+	}
+	sealed, err := k.Seal(fb.Comment, FieldAAD(fb.ID, FieldComment))
+	if err != nil {
+		return err
+	}
+	fb.CommentEnc, fb.Comment = sealed, ""
+	return nil
+}
+
+// DecryptComment restores fb.Comment from fb.CommentEnc. Documents stored
+// before encryption was enabled are returned unchanged.
+func DecryptComment(k *Keyring, fb *model.Feedback) error {
+	if fb.CommentEnc == nil {
+		return nil
+	}
+	pt, err := k.Open(fb.CommentEnc, FieldAAD(fb.ID, FieldComment))
+	if err != nil {
+		return err
+	}
+	fb.Comment, fb.CommentEnc = pt, nil
+	return nil
+}
+
+// SealOriginal stores the pre-redaction comment encrypted in
+// fb.CommentOriginal.
+func SealOriginal(k *Keyring, fb *model.Feedback, original string) error {
+	sealed, err := k.Seal(original, FieldAAD(fb.ID, FieldCommentOriginal))
+	if err != nil {
+		return err
+	}
+	fb.CommentOriginal = sealed
+	return nil
+}
+
+// OpenOriginal decrypts the pre-redaction comment, or returns "" if none was
+// kept.
+func OpenOriginal(k *Keyring, fb *model.Feedback) (string, error) {
+	if fb.CommentOriginal == nil {
+		return "", nil
+	}
+	return k.Open(fb.CommentOriginal, FieldAAD(fb.ID, FieldCommentOriginal))
+}
+
+// EncryptFeedback encrypts the comment and the free-text answers of fb.
+func EncryptFeedback(k *Keyring, fb *model.Feedback) error {
+	if err := EncryptComment(k, fb); err != nil {
+		return err
+	}
+	for i := range fb.Answers {
+		a := &fb.Answers[i]
+		if a.Text == "" {
+			continue
+		}
+		sealed, err := k.Seal(a.Text, FieldAAD(fb.ID, FieldAnswer+a.QuestionID))
+		if err != nil {
+			return err
+		}
+		a.TextEnc, a.Text = sealed, ""
+	}
+	return nil
+}
+
+// DecryptFeedback restores the comment and the free-text answers of fb. The
+// answers are copied first, so a shallow copy of fb is left untouched.
+func DecryptFeedback(k *Keyring, fb *model.Feedback) error {
+	if err := DecryptComment(k, fb); err != nil {
+		return err
+	}
+	fb.Answers = slices.Clone(fb.Answers)
+	for i := range fb.Answers {
+		a := &fb.Answers[i]
+		if a.TextEnc == nil {
+			continue
+		}
+		pt, err := k.Open(a.TextEnc, FieldAAD(fb.ID, FieldAnswer+a.QuestionID))
+		if err != nil {
+			return err
+		}
+		a.Text, a.TextEnc = pt, nil
+	}
+	return nil
+}
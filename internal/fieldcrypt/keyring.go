@@ -0,0 +1,221 @@
+// Package fieldcrypt encrypts individual document fields with AES-256-GCM
+// envelope encryption before they are written to MongoDB.
+//
+// Each value is encrypted under its own random data key (DEK). The DEK is
+// wrapped by a key-encryption key (KEK) from a Keyring and stored next to the
+// ciphertext together with the KEK's ID. Rotating the KEK therefore only
+// requires adding a new key to the keyring file; old values stay readable
+// until Rekey moves them to the active key.
+package fieldcrypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// KeySize is the required key length in bytes (AES-256).
+const KeySize = 32
+
+// Keyring holds the KEKs that can unwrap stored data keys and the ID of the
+// one used for new values. It is safe for concurrent use.
+type Keyring struct {
+	keks   map[string]cipher.AEAD
+	active string
+}
+
+// NewKeyring builds a keyring from key ID -> 32-byte KEK. activeID selects
+// the key used for new values.
+func NewKeyring(keys map[string][]byte, activeID string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring has no keys")
+	}
+	k := &Keyring{keks: make(map[string]cipher.AEAD, len(keys)), active: activeID}
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		k.keks[id] = aead
+	}
+	if _, ok := k.keks[activeID]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyring", activeID)
+	}
+	return k, nil
+}
+
+// LoadKeyring reads a keyring file. Each non-blank line that does not start
+// with # holds "key-id:base64-key". If activeID is empty the last key in the
+// file is active, so rotation is a matter of appending a line.
+func LoadKeyring(path, activeID string) (*Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keyring: %w", err)
+	}
+	defer f.Close()
+	return ParseKeyring(f, activeID)
+}
+
+// ParseKeyring reads keyring lines from r; see LoadKeyring for the format.
+func ParseKeyring(r io.Reader, activeID string) (*Keyring, error) {
+	keys := map[string][]byte{}
+	last := ""
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(line, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("keyring line %d: expected key-id:base64-key", n)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("keyring line %d: duplicate key id %q", n, id)
+		}
+		key, err := ParseKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("keyring line %d: %w", n, err)
+		}
+		keys[id] = key
+		last = id
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if activeID == "" {
+		activeID = last
+	}
+	return NewKeyring(keys, activeID)
+}
+
+// ParseKey decodes a base64 (standard or URL alphabet) 32-byte key.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if key, err := enc.DecodeString(s); err == nil {
+			if len(key) != KeySize {
+				return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+			}
+			return key, nil
+		}
+	}
+	return nil, errors.New("encryption key is not valid base64")
+}
+
+// GenerateKey returns a new random key, base64-encoded for a keyring file.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ActiveKeyID returns the ID of the KEK used for new values.
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// KeyIDs returns the IDs of all keys in the keyring, sorted.
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keks))
+	for id := range k.keks {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Seal encrypts plaintext under a fresh data key wrapped by the active KEK.
+// The associated data must be passed unchanged to Open; callers use it to
+// bind a ciphertext to its document and field so it cannot be copied
+// elsewhere.
+func (k *Keyring) Seal(plaintext string, aad []byte) (*model.Sealed, error) {
+	dek := make([]byte, KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, err := seal(k.keks[k.active], dek, []byte(k.active))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := seal(aead, []byte(plaintext), aad)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Sealed{
+		KeyID:      k.active,
+		WrappedKey: wrapped,
+		Ciphertext: ct,
+	}, nil
+}
+
+// Open decrypts v. It fails if v's KEK is not in the keyring or if the
+// associated data differs from the one used to seal it.
+func (k *Keyring) Open(v *model.Sealed, aad []byte) (string, error) {
+	if v == nil {
+		return "", errors.New("no sealed value")
+	}
+	kek, ok := k.keks[v.KeyID]
+	if !ok {
+		return "", fmt.Errorf("key %q is not in the keyring", v.KeyID)
+	}
+	dek, err := open(kek, v.WrappedKey, []byte(v.KeyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	pt, err := open(aead, v.Ciphertext, aad)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt sealed value: %w", err)
+	}
+	return string(pt), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce || ciphertext.
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, data, aad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+}
@@ -0,0 +1,218 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func testKeyring(t *testing.T, active string) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestKeyring_RoundTrip(t *testing.T) {
+	k := testKeyring(t, "k1")
+	aad := FieldAAD(bson.NewObjectID(), FieldComment)
+
+	sealed, err := k.Seal("the export crashes on big models", aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed.KeyID != "k1" {
+		t.Errorf("expected active key k1, got %s", sealed.KeyID)
+	}
+	if bytes.Contains(sealed.Ciphertext, []byte("export")) {
+		t.Error("ciphertext contains plaintext")
+	}
+
+	got, err := k.Open(sealed, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "the export crashes on big models" {
+		t.Errorf("unexpected plaintext %q", got)
+	}
+}
+
+func TestKeyring_OldKeyStillOpensAfterRotation(t *testing.T) {
+	aad := []byte("doc/comment")
+	sealed, _ := testKeyring(t, "k1").Seal("secret", aad)
+
+	rotated := testKeyring(t, "k2")
+	if got, err := rotated.Open(sealed, aad); err != nil || got != "secret" {
+		t.Errorf("expected rotated keyring to open old value, got %q, %v", got, err)
+	}
+}
+
+func TestKeyring_RejectsUnknownKeyOrWrongAAD(t *testing.T) {
+	k := testKeyring(t, "k1")
+	sealed, _ := k.Seal("secret", []byte("a/comment"))
+
+	if _, err := k.Open(sealed, []byte("b/comment")); err == nil {
+		t.Error("expected error opening with different associated data")
+	}
+
+	other, _ := NewKeyring(map[string][]byte{"k3": testKey(3)}, "k3")
+	if _, err := other.Open(sealed, []byte("a/comment")); err == nil {
+		t.Error("expected error opening with a keyring missing the key")
+	}
+
+	sealed.KeyID = "k2"
+	if _, err := k.Open(sealed, []byte("a/comment")); err == nil {
+		t.Error("expected error when key ID is swapped")
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(testKey(1))
+	k2 := base64.StdEncoding.EncodeToString(testKey(2))
+	file := "# rotated 2025-06\n2025-01:" + k1 + "\n\n2025-06:" + k2 + "\n"
+
+	k, err := ParseKeyring(strings.NewReader(file), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.ActiveKeyID() != "2025-06" {
+		t.Errorf("expected last key to be active, got %s", k.ActiveKeyID())
+	}
+	if ids := k.KeyIDs(); len(ids) != 2 || ids[0] != "2025-01" {
+		t.Errorf("unexpected key IDs %v", ids)
+	}
+
+	k, err = ParseKeyring(strings.NewReader(file), "2025-01")
+	if err != nil || k.ActiveKeyID() != "2025-01" {
+		t.Errorf("expected explicit active key, got %v", err)
+	}
+
+	for name, bad := range map[string]string{
+		"missing id":     ":" + k1,
+		"short key":      "a:" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"duplicate":      "a:" + k1 + "\na:" + k2,
+		"empty":          "# nothing\n",
+		"unknown active": "a:" + k1,
+	} {
+		active := ""
+		if name == "unknown active" {
+			active = "b"
+		}
+		if _, err := ParseKeyring(strings.NewReader(bad), active); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	s, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseKey(s); err != nil {
+		t.Errorf("generated key does not parse: %v", err)
+	}
+}
+
+func TestCommentHelpers(t *testing.T) {
+	k := testKeyring(t, "k1")
+	fb := &model.Feedback{ID: bson.NewObjectID(), Comment: "hello"}
+
+	if err := EncryptComment(k, fb); err != nil {
+		t.Fatal(err)
+	}
+	if fb.Comment != "" || fb.CommentEnc == nil {
+		t.Fatalf("expected comment moved to CommentEnc, got %+v", fb)
+	}
+	if err := DecryptComment(k, fb); err != nil {
+		t.Fatal(err)
+	}
+	if fb.Comment != "hello" || fb.CommentEnc != nil {
+		t.Errorf("expected comment restored, got %+v", fb)
+	}
+
+	// A sealed comment must not open as another document's comment.
+	if err := EncryptComment(k, fb); err != nil {
+		t.Fatal(err)
+	}
+	moved := &model.Feedback{ID: bson.NewObjectID(), CommentEnc: fb.CommentEnc}
+	if err := DecryptComment(k, moved); err == nil {
+		t.Error("expected ciphertext copied to another document to fail")
+	}
+}
+
+func TestFeedbackHelpers_Answers(t *testing.T) {
+	k := testKeyring(t, "k1")
+	rating := 4
+	fb := &model.Feedback{ID: bson.NewObjectID(), Answers: []model.Answer{
+		{QuestionID: "ease", Rating: &rating},
+		{QuestionID: "why", Text: "it crashed"},
+	}}
+
+	if err := EncryptFeedback(k, fb); err != nil {
+		t.Fatal(err)
+	}
+	if fb.Answers[0].TextEnc != nil || fb.Answers[1].Text != "" || fb.Answers[1].TextEnc == nil {
+		t.Fatalf("expected only the text answer sealed, got %+v", fb.Answers)
+	}
+
+	stored := *fb
+	if err := DecryptFeedback(k, fb); err != nil {
+		t.Fatal(err)
+	}
+	if fb.Answers[1].Text != "it crashed" {
+		t.Errorf("expected answer restored, got %+v", fb.Answers[1])
+	}
+	if stored.Answers[1].TextEnc == nil {
+		t.Error("decrypting modified the answers of a copy")
+	}
+
+	// The sealed text is bound to its question.
+	stored.Answers[1].QuestionID = "other"
+	if err := DecryptFeedback(k, &stored); err == nil {
+		t.Error("expected ciphertext moved to another question to fail")
+	}
+}
+
+func TestRekeyFeedback(t *testing.T) {
+	old := testKeyring(t, "k1")
+	fb := &model.Feedback{ID: bson.NewObjectID(), Comment: "[EMAIL] me"}
+	if err := SealOriginal(old, fb, "a@b.io me"); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptComment(old, fb); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := testKeyring(t, "k2")
+	set, err := rekeyFeedback(rotated, fb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 2 {
+		t.Fatalf("expected both fields in $set, got %v", set)
+	}
+	if fb.CommentEnc.KeyID != "k2" || fb.CommentOriginal.KeyID != "k2" {
+		t.Errorf("expected fields re-sealed under k2, got %s / %s", fb.CommentEnc.KeyID, fb.CommentOriginal.KeyID)
+	}
+	if got, _ := OpenOriginal(rotated, fb); got != "a@b.io me" {
+		t.Errorf("unexpected original after rekey %q", got)
+	}
+
+	plain := &model.Feedback{ID: bson.NewObjectID(), Comment: "legacy plaintext"}
+	set, err = rekeyFeedback(rotated, plain)
+	if err != nil || len(set) != 1 || set[0].Key != "comment_enc" {
+		t.Errorf("expected plaintext comment to be encrypted, got %v, %v", set, err)
+	}
+}
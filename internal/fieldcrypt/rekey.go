@@ -0,0 +1,113 @@
+package fieldcrypt
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// RekeyResult summarizes a Rekey run.
+type RekeyResult struct {
+	Scanned int `json:"scanned"`
+	Rekeyed int `json:"rekeyed"`
+	Failed  int `json:"failed"`
+}
+
+// Rekey re-encrypts every feedback document whose comment or free-text
+// answers are still stored in plaintext or whose sealed fields use a key
+// other than the keyring's active one. Each value gets a fresh data key.
+// With dryRun set, documents are counted but not written. Documents that
+// cannot be decrypted (for example because their key was removed from the
+// keyring) are logged and counted as failed; the run continues.
+func Rekey(ctx context.Context, coll *mongo.Collection, k *Keyring, dryRun bool) (RekeyResult, error) {
+	active := k.ActiveKeyID()
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "comment", Value: bson.D{{Key: "$exists", Value: true}, {Key: "$ne", Value: ""}}}},
+		bson.D{{Key: "comment_enc.key_id", Value: bson.D{{Key: "$exists", Value: true}, {Key: "$ne", Value: active}}}},
+		bson.D{{Key: "comment_original.key_id", Value: bson.D{{Key: "$exists", Value: true}, {Key: "$ne", Value: active}}}},
+		bson.D{{Key: "answers", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+			{Key: "text", Value: bson.D{{Key: "$exists", Value: true}, {Key: "$ne", Value: ""}}},
+		}}}}},
+		bson.D{{Key: "answers", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+			{Key: "text_enc.key_id", Value: bson.D{{Key: "$exists", Value: true}, {Key: "$ne", Value: active}}},
+		}}}}},
+	}}}
+
+	cur, err := coll.Find(ctx, filter)
+	if err != nil {
+		return RekeyResult{}, fmt.Errorf("failed to query documents to rekey: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var res RekeyResult
+	for cur.Next(ctx) {
+		res.Scanned++
+		var fb model.Feedback
+		if err := cur.Decode(&fb); err != nil {
+			slog.Error("rekey: failed to decode document", "error", err)
+			res.Failed++
+			continue
+		}
+
+		set, err := rekeyFeedback(k, &fb)
+		if err != nil {
+			slog.Error("rekey: failed to re-encrypt document", "id", fb.ID.Hex(), "error", err)
+			res.Failed++
+			continue
+		}
+		if dryRun {
+			res.Rekeyed++
+			continue
+		}
+
+		_, err = coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: fb.ID}}, bson.D{
+			{Key: "$set", Value: set},
+			{Key: "$unset", Value: bson.D{{Key: "comment", Value: ""}}},
+		})
+		if err != nil {
+			slog.Error("rekey: failed to update document", "id", fb.ID.Hex(), "error", err)
+			res.Failed++
+			continue
+		}
+		res.Rekeyed++
+	}
+	if err := cur.Err(); err != nil {
+		return res, fmt.Errorf("rekey cursor failed: %w", err)
+	}
+	return res, nil
+}
+
+// rekeyFeedback decrypts and re-seals the encrypted fields of fb under the
+// active key and returns the $set document for them.
+func rekeyFeedback(k *Keyring, fb *model.Feedback) (bson.D, error) {
+	if err := DecryptFeedback(k, fb); err != nil {
+		return nil, err
+	}
+	original, err := OpenOriginal(k, fb)
+	if err != nil {
+		return nil, err
+	}
+	if err := EncryptFeedback(k, fb); err != nil {
+		return nil, err
+	}
+
+	var set bson.D
+	if fb.CommentEnc != nil {
+		set = append(set, bson.E{Key: "comment_enc", Value: fb.CommentEnc})
+	}
+	if len(fb.Answers) > 0 {
+		set = append(set, bson.E{Key: "answers", Value: fb.Answers})
+	}
+	if fb.CommentOriginal != nil {
+		if err := SealOriginal(k, fb, original); err != nil {
+			return nil, err
+		}
+		set = append(set, bson.E{Key: "comment_original", Value: fb.CommentOriginal})
+	}
+	return set, nil
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/db"
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/privacy"
+	"github.com/idefinity/nps-api/internal/retention"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// AdminHandler serves the operator endpoints under /nps/admin. Routes are
+// protected by middleware.AdminKey.
+type AdminHandler struct {
+	db         *db.Database
+	keyring    *fieldcrypt.Keyring
+	installIDs *privacy.InstallIDHasher
+	retention  *retention.Purger
+	protect    func(fb *model.Feedback) error
+}
+
+// NewAdminHandler creates an admin handler from the given dependencies.
+func NewAdminHandler(deps Deps) *AdminHandler {
+	return &AdminHandler{
+		db:         deps.DB,
+		keyring:    deps.Keyring,
+		installIDs: deps.InstallIDs,
+		retention:  deps.Retention,
+		protect:    NewFeedbackHandler(deps).Protect,
+	}
+}
+
+// adminFeedback is a feedback document as shown to admins, with the comment
+// and, when it was kept, the pre-redaction comment decrypted.
+type adminFeedback struct {
+	model.Feedback
+	CommentOriginal string `json:"comment_original,omitempty"`
+}
+
+// reveal decrypts the sealed fields of fb for an admin response. Decryption
+// failures are logged and leave the field empty rather than failing the whole
+// request, so one document with a retired key does not hide the rest.
+func (h *AdminHandler) reveal(fb model.Feedback) adminFeedback {
+	out := adminFeedback{Feedback: fb}
+	if h.keyring == nil {
+		return out
+	}
+	if err := fieldcrypt.DecryptFeedback(h.keyring, &out.Feedback); err != nil {
+		slog.Error("failed to decrypt feedback", "id", fb.ID.Hex(), "error", err)
+	}
+	original, err := fieldcrypt.OpenOriginal(h.keyring, &fb)
+	if err != nil {
+		slog.Error("failed to decrypt original comment", "id", fb.ID.Hex(), "error", err)
+	}
+	out.CommentOriginal = original
+	return out
+}
+
+// GetFeedback returns a single feedback document by ID with its comment
+// decrypted, including the original comment if redaction kept one.
+func (h *AdminHandler) GetFeedback(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseObjectID(w, r)
+	if !ok {
+		return
+	}
+
+	var fb model.Feedback
+	err := h.db.Collection("feedback").FindOne(r.Context(), bson.D{{Key: "_id", Value: id}}).Decode(&fb)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "feedback not found",
+		})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to load feedback", "id", id.Hex(), "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to load feedback",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.reveal(fb))
+}
+
+// ListQuarantined returns quarantined feedback, newest first. Pass ?limit=N
+// (default 50, max 500).
+func (h *AdminHandler) ListQuarantined(w http.ResponseWriter, r *http.Request) {
+	limit := int64(50)
+	if n, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64); err == nil && n > 0 {
+		limit = min(n, 500)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "received_at", Value: -1}}).
+		SetLimit(limit)
+	cur, err := h.db.Collection("feedback").Find(r.Context(), bson.D{{Key: "quarantine", Value: true}}, opts)
+	if err != nil {
+		slog.Error("failed to list quarantined feedback", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to list quarantined feedback",
+		})
+		return
+	}
+
+	var docs []model.Feedback
+	if err := cur.All(r.Context(), &docs); err != nil {
+		slog.Error("failed to decode quarantined feedback", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to list quarantined feedback",
+		})
+		return
+	}
+
+	items := make([]adminFeedback, 0, len(docs))
+	for _, fb := range docs {
+		items = append(items, h.reveal(fb))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+	})
+}
+
+// ReleaseQuarantined clears the quarantine flag so the document counts in
+// stats again. The spam score and reasons are kept for auditing.
+func (h *AdminHandler) ReleaseQuarantined(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseObjectID(w, r)
+	if !ok {
+		return
+	}
+
+	var fb model.Feedback
+	err := h.db.Collection("feedback").FindOneAndUpdate(r.Context(),
+		bson.D{{Key: "_id", Value: id}, {Key: "quarantine", Value: true}},
+		bson.D{{Key: "$unset", Value: bson.D{{Key: "quarantine", Value: ""}}}},
+	).Decode(&fb)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "quarantined feedback not found",
+		})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to release feedback", "id", id.Hex(), "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to release feedback",
+		})
+		return
+	}
+	if err := stats.Record(r.Context(), h.db.Collection(stats.Collection), &fb); err != nil {
+		slog.Error("failed to update stats rollup", "id", id.Hex(), "error", err)
+	}
+
+	slog.Info("feedback released from quarantine", "id", id.Hex())
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "released",
+	})
+}
+
+// DeleteQuarantined permanently removes a quarantined document. Documents
+// that are not quarantined are left alone and reported as not found.
+func (h *AdminHandler) DeleteQuarantined(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseObjectID(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.db.Collection("feedback").DeleteOne(r.Context(),
+		bson.D{{Key: "_id", Value: id}, {Key: "quarantine", Value: true}},
+	)
+	if err != nil {
+		slog.Error("failed to delete feedback", "id", id.Hex(), "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to delete feedback",
+		})
+		return
+	}
+	if res.DeletedCount == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "quarantined feedback not found",
+		})
+		return
+	}
+
+	slog.Info("quarantined feedback deleted", "id", id.Hex())
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "deleted",
+	})
+}
+
+// RetentionReport runs the retention rules in dry-run mode and returns how
+// many documents each rule would affect right now.
+func (h *AdminHandler) RetentionReport(w http.ResponseWriter, r *http.Request) {
+	if h.retention == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"error": "no retention rules configured",
+		})
+		return
+	}
+
+	report, err := h.retention.Run(r.Context(), time.Now().UTC(), true)
+	if err != nil {
+		slog.Error("retention dry run failed", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "retention dry run failed",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func parseObjectID(w http.ResponseWriter, r *http.Request) (bson.ObjectID, bool) {
+	id, err := bson.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid id",
+		})
+		return bson.ObjectID{}, false
+	}
+	return id, true
+}
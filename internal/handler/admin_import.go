@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/importer"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// maxImportBytes bounds an uploaded import. Larger files should go through
+// the import command, which has no such limit.
+const maxImportBytes = 64 << 20
+
+// importTimeout replaces the server's read and write deadlines for an import
+// upload, which takes longer than a normal request.
+const importTimeout = 10 * time.Minute
+
+// Import loads historical feedback from a multipart upload with two parts,
+// in order: "mapping" (the JSON mapping) and "file" (CSV or JSON, format
+// detected from the file name unless the mapping sets it). Pass ?dry_run=1 to
+// only validate, and ?batch= to choose the import_batch tag.
+func (h *AdminHandler) Import(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(importTimeout))
+	rc.SetWriteDeadline(time.Now().Add(importTimeout))
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "expected a multipart/form-data upload",
+		})
+		return
+	}
+
+	mapping, err := nextPart(mr, "mapping")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	m, err := importer.ParseMapping(mapping)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	file, err := nextPart(mr, "file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	format := m.Format
+	if format == "" {
+		if format, err = importer.DetectFormat(file.FileName()); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	opts := importer.Options{
+		Format: format,
+		Batch:  r.URL.Query().Get("batch"),
+		DryRun: isTruthy(r.URL.Query().Get("dry_run")),
+	}
+	im := importer.New(h.db.Collection("feedback"), h.db.Collection(stats.Collection), h.protect)
+	report, err := im.Run(r.Context(), file, m, opts)
+	if err != nil {
+		// The report still matters on failure: rows before the error may
+		// have been imported.
+		var srcErr *importer.SourceError
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]any{
+				"error":  "upload exceeds 64 MiB; use the import command for larger files",
+				"report": report,
+			})
+		case errors.As(err, &srcErr):
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"error":  err.Error(),
+				"report": report,
+			})
+		default:
+			slog.Error("import failed", "batch", report.Batch, "rows", report.Rows, "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]any{
+				"error":  "import failed",
+				"report": report,
+			})
+		}
+		return
+	}
+
+	slog.Info("feedback imported", "batch", report.Batch, "dry_run", report.DryRun,
+		"rows", report.Rows, "imported", report.Imported, "duplicates", report.Duplicates, "invalid", report.Invalid)
+	writeJSON(w, http.StatusOK, report)
+}
+
+// nextPart returns the next multipart part and checks its form name.
+func nextPart(mr *multipart.Reader, name string) (*multipart.Part, error) {
+	p, err := mr.NextPart()
+	if errors.Is(err, io.EOF) || (err == nil && p.FormName() != name) {
+		return nil, errors.New(`expected parts "mapping" then "file"`)
+	}
+	return p, err
+}
+
+func isTruthy(s string) bool {
+	return s == "1" || s == "true"
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// ExportInstall returns every feedback document stored for an install ID as
+// a JSON download, with comments decrypted. The path carries the raw install
+// ID as the user knows it; it is hashed before lookup. Quarantined documents
+// are included.
+func (h *AdminHandler) ExportInstall(w http.ResponseWriter, r *http.Request) {
+	hash, ok := h.installIDHash(w, r)
+	if !ok {
+		return
+	}
+
+	cur, err := h.db.Collection("feedback").Find(r.Context(), bson.D{{Key: "install_id", Value: hash}})
+	if err != nil {
+		slog.Error("failed to export install feedback", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to export feedback",
+		})
+		return
+	}
+	var docs []model.Feedback
+	if err := cur.All(r.Context(), &docs); err != nil {
+		slog.Error("failed to decode install feedback", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to export feedback",
+		})
+		return
+	}
+
+	items := make([]adminFeedback, 0, len(docs))
+	for _, fb := range docs {
+		items = append(items, h.reveal(fb))
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="nps-export-`+hash[:12]+`.json"`)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"install_id_hash": hash,
+		"exported_at":     time.Now().UTC(),
+		"count":           len(items),
+		"items":           items,
+	})
+}
+
+// EraseInstall deletes (?mode=delete, the default) or anonymizes
+// (?mode=anonymize) every document for an install ID and records the request
+// in the erasure_audit collection. Anonymizing keeps ratings for statistics
+// but removes the install ID, comment, free-text answers and timezone. Pass
+// ?reason= to store a ticket reference with the audit record.
+func (h *AdminHandler) EraseInstall(w http.ResponseWriter, r *http.Request) {
+	hash, ok := h.installIDHash(w, r)
+	if !ok {
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = model.ErasureDelete
+	}
+	if mode != model.ErasureDelete && mode != model.ErasureAnonymize {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "mode must be delete or anonymize",
+		})
+		return
+	}
+
+	now := time.Now().UTC()
+	filter := bson.D{{Key: "install_id", Value: hash}}
+	coll := h.db.Collection("feedback")
+
+	var affected int64
+	if mode == model.ErasureDelete {
+		deleted, err := h.deleteInstall(r.Context(), filter)
+		affected = int64(len(deleted))
+		if err != nil {
+			slog.Error("failed to erase install feedback", "deleted", affected, "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to erase feedback",
+			})
+			return
+		}
+	} else {
+		// A pipeline update, so that $unset also reaches into every answer.
+		res, err := coll.UpdateMany(r.Context(), filter, mongo.Pipeline{
+			{{Key: "$unset", Value: bson.A{
+				"install_id", "comment", "comment_enc", "comment_original",
+				"redactions", "timezone", "answers.text", "answers.text_enc",
+			}}},
+			{{Key: "$set", Value: bson.D{{Key: "anonymized_at", Value: now}}}},
+		})
+		if err != nil {
+			slog.Error("failed to anonymize install feedback", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to erase feedback",
+			})
+			return
+		}
+		affected = res.ModifiedCount
+	}
+
+	record := model.ErasureRecord{
+		InstallIDHash: hash,
+		Mode:          mode,
+		Documents:     affected,
+		Actor:         keyFingerprint(r),
+		Reason:        r.URL.Query().Get("reason"),
+		At:            now,
+	}
+	if _, err := h.db.Collection("erasure_audit").InsertOne(r.Context(), record); err != nil {
+		// The erasure itself succeeded; report it, but make the missing
+		// audit entry loud so it can be recreated by hand.
+		slog.Error("failed to write erasure audit record", "record", record, "error", err)
+	}
+
+	slog.Info("install feedback erased", "mode", mode, "documents", affected, "actor", record.Actor)
+	writeJSON(w, http.StatusOK, record)
+}
+
+// rollupFields are the fields stats.Forget needs from a deleted document.
+var rollupFields = bson.D{
+	{Key: "received_at", Value: 1}, {Key: "app", Value: 1}, {Key: "app_version", Value: 1},
+	{Key: "platform", Value: 1}, {Key: "nps_rating", Value: 1}, {Key: "nps_category", Value: 1},
+	{Key: "quarantine", Value: 1},
+}
+
+// deleteInstall deletes the documents matching filter and removes them from
+// the daily rollup, so rollup-backed stats keep agreeing with the raw data.
+// Documents are deleted one at a time so that exactly the deleted ones are
+// uncounted, even if the install submits while the erasure runs; an install
+// has few documents. It returns the deleted documents.
+func (h *AdminHandler) deleteInstall(ctx context.Context, filter bson.D) ([]*model.Feedback, error) {
+	coll := h.db.Collection("feedback")
+	opts := options.FindOneAndDelete().SetProjection(rollupFields)
+	var deleted, counted []*model.Feedback
+	for {
+		var fb model.Feedback
+		err := coll.FindOneAndDelete(ctx, filter, opts).Decode(&fb)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, &fb)
+		// Quarantined documents were never counted.
+		if !fb.Quarantine {
+			counted = append(counted, &fb)
+		}
+	}
+
+	// The documents are gone either way; the rollup can be rebuilt.
+	if err := stats.ForgetMany(ctx, h.db.Collection(stats.Collection), counted); err != nil {
+		slog.Error("install feedback erased but the daily rollup was not updated; run rebuild-stats", "error", err)
+	}
+	return deleted, nil
+}
+
+func (h *AdminHandler) installIDHash(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.installIDs == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"error": "install ID hashing is not configured",
+		})
+		return "", false
+	}
+	raw := r.PathValue("install_id")
+	if raw == "" || utf8.RuneCountInString(raw) > model.MaxInstallIDLength {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid install_id",
+		})
+		return "", false
+	}
+	return h.installIDs.Hash(raw), true
+}
+
+// keyFingerprint identifies which admin key made a request without storing
+// the key itself.
+func keyFingerprint(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return "anonymous"
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/db"
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/middleware"
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// commentScanLimit caps how many documents one comments request reads.
+// Comments may be encrypted, so a search cannot be left to the database;
+// a search that matches little returns a cursor to continue from instead of
+// reading the whole collection.
+const commentScanLimit = 5000
+
+// CommentHandler serves the comment feed.
+type CommentHandler struct {
+	db      *db.Database
+	keyring *fieldcrypt.Keyring
+}
+
+// NewCommentHandler creates a handler from the given dependencies.
+func NewCommentHandler(deps Deps) *CommentHandler {
+	return &CommentHandler{db: deps.DB, keyring: deps.Keyring}
+}
+
+// comment is a feedback comment as listed by the comment feed.
+type comment struct {
+	ID          string    `json:"id"`
+	App         string    `json:"app"`
+	AppVersion  string    `json:"app_version"`
+	Platform    string    `json:"platform"`
+	Locale      string    `json:"locale,omitempty"`
+	NPSRating   int       `json:"nps_rating"`
+	NPSCategory string    `json:"nps_category"`
+	Comment     string    `json:"comment"`
+	ReceivedAt  time.Time `json:"received_at"`
+}
+
+// List returns feedback with a comment, newest first. It takes the filters
+// of the stats endpoint plus nps_category, and ?q= keeps comments containing
+// the text, ignoring case. ?limit=N (default 50, max 200) caps the page;
+// when more may follow, next is set and is passed back as ?before=.
+// Quarantined feedback is excluded and comments are the redacted ones.
+// Callers need the read scope.
+func (h *CommentHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !middleware.HasReadScope(r.Context()) {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error": "read scope required",
+		})
+		return
+	}
+	q := r.URL.Query()
+	limit := 50
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 {
+		limit = min(n, 200)
+	}
+	f, err := parseFeedbackFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	filter := f.FeedbackFilter()
+	if c := q.Get("nps_category"); c != "" {
+		if c != "promoter" && c != "passive" && c != "detractor" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("invalid nps_category %q", c),
+			})
+			return
+		}
+		filter = append(filter, bson.E{Key: "nps_category", Value: c})
+	}
+	if b := q.Get("before"); b != "" {
+		before, err := bson.ObjectIDFromHex(b)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid before",
+			})
+			return
+		}
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$lt", Value: before}}})
+	}
+	filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+		bson.D{{Key: "comment", Value: bson.D{{Key: "$gt", Value: ""}}}},
+		bson.D{{Key: "comment_enc", Value: bson.D{{Key: "$exists", Value: true}}}},
+	}})
+	search := strings.ToLower(strings.TrimSpace(q.Get("q")))
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(commentScanLimit).
+		SetProjection(bson.D{{Key: "answers", Value: 0}, {Key: "comment_original", Value: 0}})
+	cur, err := h.db.Collection("feedback").Find(r.Context(), filter, opts)
+	if err != nil {
+		slog.Error("failed to list comments", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to list comments",
+		})
+		return
+	}
+	defer cur.Close(r.Context())
+
+	items := []comment{}
+	var last bson.ObjectID
+	scanned := 0
+	for len(items) < limit && cur.Next(r.Context()) {
+		scanned++
+		var fb model.Feedback
+		if err := cur.Decode(&fb); err != nil {
+			slog.Error("failed to decode feedback", "error", err)
+			continue
+		}
+		last = fb.ID
+		if h.keyring != nil {
+			if err := fieldcrypt.DecryptComment(h.keyring, &fb); err != nil {
+				slog.Error("failed to decrypt comment", "id", fb.ID.Hex(), "error", err)
+				continue
+			}
+		}
+		if search != "" && !strings.Contains(strings.ToLower(fb.Comment), search) {
+			continue
+		}
+		items = append(items, comment{
+			ID:          fb.ID.Hex(),
+			App:         fb.App,
+			AppVersion:  fb.AppVersion,
+			Platform:    fb.Platform,
+			Locale:      fb.Locale,
+			NPSRating:   fb.NPSRating,
+			NPSCategory: fb.NPSCategory,
+			Comment:     fb.Comment,
+			ReceivedAt:  fb.ReceivedAt,
+		})
+	}
+	if err := cur.Err(); err != nil {
+		slog.Error("failed to list comments", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to list comments",
+		})
+		return
+	}
+
+	// A full page or a capped scan may have more behind it.
+	next := ""
+	if len(items) == limit || scanned == commentScanLimit {
+		next = last.Hex()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+		"next":  next,
+	})
+}
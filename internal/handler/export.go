@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/db"
+	"github.com/idefinity/nps-api/internal/export"
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/middleware"
+)
+
+// exportBatch is how many rows are written between flushes. Each flush also
+// extends the write deadline, so an export only times out if it stalls.
+const exportBatch = 1000
+
+// exportWriteTimeout is the write deadline granted per batch.
+const exportWriteTimeout = 30 * time.Second
+
+// ExportHandler streams raw feedback exports.
+type ExportHandler struct {
+	db      *db.Database
+	keyring *fieldcrypt.Keyring
+}
+
+// NewExportHandler creates a handler from the given dependencies.
+func NewExportHandler(deps Deps) *ExportHandler {
+	return &ExportHandler{db: deps.DB, keyring: deps.Keyring}
+}
+
+// Export streams feedback as CSV, NDJSON or Parquet, chosen by ?format= or
+// the Accept header (CSV by default). It takes the same filters as the stats
+// endpoint, and ?columns= selects and orders columns. Quarantined feedback is
+// excluded. Callers with the read scope get comments and free-text answers
+// decrypted; others get them left out. Pre-redaction originals are never
+// exported.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	format := export.FormatFromAccept(r.Header.Get("Accept"))
+	if f := r.URL.Query().Get("format"); f != "" {
+		var ok bool
+		if format, ok = export.ParseFormat(f); !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "format must be csv, ndjson or parquet",
+			})
+			return
+		}
+	}
+	cols, err := export.ParseColumns(r.URL.Query().Get("columns"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	filter, err := parseFeedbackFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	out, err := export.NewWriter(format, w, cols)
+	if err != nil {
+		slog.Error("failed to create export writer", "format", format, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to export feedback",
+		})
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}})
+	cur, err := h.db.Collection("feedback").Find(r.Context(), filter.FeedbackFilter(), opts)
+	if err != nil {
+		slog.Error("failed to query feedback for export", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to export feedback",
+		})
+		return
+	}
+	defer cur.Close(r.Context())
+
+	filename := "nps-export-" + time.Now().UTC().Format("20060102-150405") + "." + string(format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// From here on the status is sent; failures can only be logged and the
+	// response cut short, which clients see as a truncated download.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	out, keyring := h.protect(r, out)
+	rows, err := export.Copy(r.Context(), cur, out, keyring, exportBatch, func() {
+		rc.Flush()
+		rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	})
+	if err != nil {
+		slog.Warn("export aborted", "rows", rows, "error", err)
+		return
+	}
+	slog.Info("feedback exported", "format", format, "rows", rows)
+}
+
+// protect returns the writer and keyring to export with: callers with the
+// read scope get the text decrypted, others none of it. Client API keys ship
+// inside the desktop apps, so holding one must not reveal what users wrote.
+func (h *ExportHandler) protect(r *http.Request, out export.Writer) (export.Writer, *fieldcrypt.Keyring) {
+	if middleware.HasReadScope(r.Context()) {
+		return out, h.keyring
+	}
+	return export.WithoutText(out), nil
+}
@@ -1,54 +1,354 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"hash"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
 
-	"github.com/idefinity/nps-api/internal/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/i18n"
 	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/privacy"
+	"github.com/idefinity/nps-api/internal/redact"
+	"github.com/idefinity/nps-api/internal/slack"
+	"github.com/idefinity/nps-api/internal/spam"
+	"github.com/idefinity/nps-api/internal/store"
+	"github.com/idefinity/nps-api/internal/stream"
+	"github.com/idefinity/nps-api/internal/survey"
+	"github.com/idefinity/nps-api/internal/webhook"
 )
 
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// maxHashedRemainder caps how much of a body left unread by the decoder is
+// read to complete its idempotency hash.
+const maxHashedRemainder = 1 << 20
+
 // FeedbackHandler handles NPS feedback submissions.
 type FeedbackHandler struct {
-	db *db.Database
+	store        store.FeedbackStore
+	spam         *spam.Detector
+	trustProxy   bool
+	redactor     *redact.Redactor
+	keepOriginal bool
+	keyring      *fieldcrypt.Keyring
+	installIDs   *privacy.InstallIDHasher
+	surveys      *survey.Catalog
+	webhooks     *webhook.Notifier
+	alerts       *slack.Alerter
+	stream       *stream.Hub
 }
 
-// NewFeedbackHandler creates a handler backed by the given database.
-func NewFeedbackHandler(database *db.Database) *FeedbackHandler {
-	return &FeedbackHandler{db: database}
+// NewFeedbackHandler creates a handler from the given dependencies.
+func NewFeedbackHandler(deps Deps) *FeedbackHandler {
+	st := deps.Store
+	if st == nil && deps.DB != nil {
+		st = store.NewMongo(deps.DB)
+	}
+	var surveys *survey.Catalog
+	if defs := surveyDefinitions(deps); defs != nil {
+		surveys = survey.NewCatalog(defs)
+	}
+	return &FeedbackHandler{
+		store:        st,
+		spam:         deps.Spam,
+		trustProxy:   deps.TrustProxy,
+		redactor:     deps.Redactor,
+		keepOriginal: deps.KeepOriginal && deps.Keyring != nil,
+		keyring:      deps.Keyring,
+		installIDs:   deps.InstallIDs,
+		surveys:      surveys,
+		webhooks:     deps.Webhooks,
+		alerts:       deps.Alerts,
+		stream:       localStream(deps),
+	}
 }
 
-// Submit handles POST requests to store NPS feedback.
+// Submit handles POST requests to store NPS feedback. A client may send an
+// Idempotency-Key header so that retrying after a lost response does not
+// store the submission twice; a replay gets the original 201 response with
+// Idempotent-Replayed: true.
 func (h *FeedbackHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	idem, ok := idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
 	var fb model.Feedback
 	if err := json.NewDecoder(r.Body).Decode(&fb); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{
-			"error": "invalid JSON payload",
-		})
+		writeLocalizedError(w, r, http.StatusBadRequest, "", i18n.NewMessage(i18n.CodeInvalidJSON))
 		return
 	}
 
 	if err := fb.Validate(); err != nil {
-		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
-			"error": err.Error(),
-		})
+		writeValidationError(w, r, err)
+		return
+	}
+	if !h.accept(w, r, &fb, idem) {
 		return
 	}
 
+	// Quarantined submissions get the same response as accepted ones so
+	// that abusers cannot probe the scoring rules.
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"status": "ok",
+	})
+}
+
+// idempotency is a request's Idempotency-Key and the hash of the body it
+// came with.
+type idempotency struct {
+	key  string
+	body hash.Hash
+}
+
+// idempotencyKey returns the request's Idempotency-Key header, or writes a
+// 400 and returns false when it is malformed. With a key, the body is hashed
+// as it is read.
+func idempotencyKey(w http.ResponseWriter, r *http.Request) (idempotency, bool) {
+	key := r.Header.Get("Idempotency-Key")
+	if len(key) > maxIdempotencyKeyLength || strings.ContainsFunc(key, unicode.IsControl) {
+		writeLocalizedError(w, r, http.StatusBadRequest, "",
+			i18n.NewMessage(i18n.CodeInvalidHeader, "Idempotency-Key"))
+		return idempotency{}, false
+	}
+	idem := idempotency{key: key}
+	if key != "" {
+		idem.body = sha256.New()
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, idem.body), r.Body}
+	}
+	return idem, true
+}
+
+// sum reads what the decoder left of r's body and returns the hex-encoded
+// body hash, or "" without a key.
+func (i idempotency) sum(r *http.Request) string {
+	if i.key == "" {
+		return ""
+	}
+	io.Copy(io.Discard, io.LimitReader(r.Body, maxHashedRemainder))
+	return hex.EncodeToString(i.body.Sum(nil))
+}
+
+// accept checks the survey answers of a validated submission, scores,
+// protects and stores it, and notifies the subscribers. A replayed
+// Idempotency-Key stores nothing and sets Idempotent-Replayed; the same key
+// with a different body is refused with 422. On failure it writes the error
+// response and returns false.
+func (h *FeedbackHandler) accept(w http.ResponseWriter, r *http.Request, fb *model.Feedback, idem idempotency) bool {
+	if !h.checkAnswers(w, r, fb) {
+		return false
+	}
+
+	fb.ID = bson.NewObjectID()
 	fb.ReceivedAt = time.Now().UTC()
+	fb.ImportBatch = ""
+	fb.AnonymizedAt = nil
+	fb.IdempotencyKey = idem.key
+	fb.IdempotencyHash = idem.sum(r)
+	h.score(r, fb)
+	h.pseudonymize(fb)
 
-	_, err := h.db.Collection("feedback").InsertOne(r.Context(), fb)
+	// Alerts and the live stream show the redacted comment and answers,
+	// which encryption removes from fb.
+	err := h.redact(fb)
+	plain := *fb
+	plain.Answers = slices.Clone(fb.Answers)
+	if err == nil {
+		err = h.encrypt(fb)
+	}
 	if err != nil {
+		slog.Error("failed to redact or encrypt feedback", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to store feedback",
+		})
+		return false
+	}
+
+	err = h.store.Insert(r.Context(), fb)
+	switch {
+	case errors.Is(err, store.ErrDuplicate):
+		w.Header().Set("Idempotent-Replayed", "true")
+	case errors.Is(err, store.ErrKeyReused):
+		writeLocalizedError(w, r, http.StatusUnprocessableEntity, "",
+			i18n.NewMessage(i18n.CodeIdempotencyKeyReused))
+		return false
+	case err != nil:
 		slog.Error("failed to insert feedback", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{
 			"error": "failed to store feedback",
 		})
+		return false
+	default:
+		h.notify(r, fb, &plain)
+	}
+	return true
+}
+
+// notify queues webhook deliveries, Slack alerts and live stream events for
+// newly stored feedback; plain is fb before encryption. The submission is
+// already stored, so a failure is logged rather than returned to the client.
+func (h *FeedbackHandler) notify(r *http.Request, fb, plain *model.Feedback) {
+	if h.webhooks != nil {
+		if err := h.webhooks.Notify(r.Context(), fb); err != nil {
+			slog.Error("failed to queue webhook deliveries", "id", fb.ID.Hex(), "error", err)
+		}
+	}
+	if h.alerts != nil {
+		h.alerts.Notify(plain)
+	}
+	if h.stream != nil {
+		h.stream.Publish(plain)
+	}
+}
+
+// checkAnswers validates the survey answers of a submission against the
+// survey definition it names.
+func (h *FeedbackHandler) checkAnswers(w http.ResponseWriter, r *http.Request, fb *model.Feedback) bool {
+	err := h.surveys.ValidateAnswers(r.Context(), fb)
+	var verr *model.ValidationError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &verr):
+		writeValidationError(w, r, err)
+	default:
+		slog.Error("failed to load survey definition", "survey_id", fb.SurveyID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to store feedback",
+		})
+	}
+	return false
+}
+
+// score runs spam detection and records the verdict on fb, overwriting any
+// values the client may have sent for the server-owned fields.
+func (h *FeedbackHandler) score(r *http.Request, fb *model.Feedback) {
+	fb.Quarantine, fb.SpamScore, fb.SpamReasons = false, 0, nil
+	if h.spam == nil {
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]string{
-		"status": "ok",
-	})
+	installID := fb.InstallID
+	if installID == "" {
+		installID = r.Header.Get("X-Install-ID")
+	}
+	v := h.spam.Check(fb, spam.Source{
+		IP:        clientIP(r, h.trustProxy),
+		InstallID: installID,
+	}, fb.ReceivedAt)
+
+	fb.Quarantine, fb.SpamScore, fb.SpamReasons = v.Quarantine, v.Score, v.Reasons
+	if v.Quarantine {
+		slog.Warn("feedback quarantined", "app", fb.App, "score", v.Score, "reasons", v.Reasons)
+	}
+}
+
+// pseudonymize replaces the raw install ID with its salted hash, or drops it
+// when no hasher is configured.
+func (h *FeedbackHandler) pseudonymize(fb *model.Feedback) {
+	if h.installIDs == nil {
+		fb.InstallID = ""
+		return
+	}
+	fb.InstallID = h.installIDs.Hash(fb.InstallID)
+}
+
+// Protect redacts the comment and free-text answers and then, with a keyring
+// configured, encrypts them for storage. Anything else that stores feedback,
+// such as the importer, must run documents through it too.
+func (h *FeedbackHandler) Protect(fb *model.Feedback) error {
+	if err := h.redact(fb); err != nil {
+		return err
+	}
+	return h.encrypt(fb)
+}
+
+// encrypt seals the comment and free-text answers when a keyring is
+// configured.
+func (h *FeedbackHandler) encrypt(fb *model.Feedback) error {
+	if h.keyring == nil {
+		return nil
+	}
+	return fieldcrypt.EncryptFeedback(h.keyring, fb)
+}
+
+// redact masks personal data in the comment and free-text answers and
+// records which rules fired. With keepOriginal set and the comment changed,
+// the original comment is kept encrypted alongside it; answers keep no
+// original. Sealed values sent by the client are dropped first.
+func (h *FeedbackHandler) redact(fb *model.Feedback) error {
+	fb.Redactions, fb.CommentOriginal, fb.CommentEnc = nil, nil, nil
+	for i := range fb.Answers {
+		fb.Answers[i].TextEnc = nil
+	}
+	if h.redactor == nil {
+		return nil
+	}
+
+	if fb.Comment != "" {
+		redacted, fired := h.redactor.Redact(fb.Comment)
+		if len(fired) > 0 {
+			if h.keepOriginal {
+				if err := fieldcrypt.SealOriginal(h.keyring, fb, fb.Comment); err != nil {
+					return err
+				}
+			}
+			fb.Comment, fb.Redactions = redacted, fired
+		}
+	}
+
+	for i := range fb.Answers {
+		a := &fb.Answers[i]
+		if a.Text == "" {
+			continue
+		}
+		redacted, fired := h.redactor.Redact(a.Text)
+		a.Text = redacted
+		for _, rule := range fired {
+			if !slices.Contains(fb.Redactions, rule) {
+				fb.Redactions = append(fb.Redactions, rule)
+			}
+		}
+	}
+	return nil
+}
+
+// clientIP returns the caller's address. With trustProxy set it prefers
+// X-Real-IP, which Nginx overwrites, then the right-most X-Forwarded-For
+// entry: Nginx appends the address it saw to whatever the client sent, so
+// the entries before it are the client's to choose.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			i := strings.LastIndex(xff, ",")
+			if ip := strings.TrimSpace(xff[i+1:]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -1,10 +1,36 @@
 package handler
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/idefinity/nps-api/internal/apidocs"
+	"github.com/idefinity/nps-api/internal/export"
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/middleware"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/privacy"
+	"github.com/idefinity/nps-api/internal/redact"
+	"github.com/idefinity/nps-api/internal/slack"
+	"github.com/idefinity/nps-api/internal/store"
+	"github.com/idefinity/nps-api/internal/stream"
+	"github.com/idefinity/nps-api/internal/survey"
+	"github.com/idefinity/nps-api/internal/webhook"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -37,3 +63,893 @@ func TestHealthCheck(t *testing.T) {
 		t.Errorf("expected sentry disabled (no SDK init in test), got %s", resp.Sentry)
 	}
 }
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", nil)
+	req.RemoteAddr = "10.0.0.5:51234"
+	// The first entry is whatever the client sent; the proxy appended the last.
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 198.51.100.2")
+	req.Header.Set("X-Real-IP", "198.51.100.2")
+
+	if got := clientIP(req, false); got != "10.0.0.5" {
+		t.Errorf("expected RemoteAddr host without proxy trust, got %s", got)
+	}
+	if got := clientIP(req, true); got != "198.51.100.2" {
+		t.Errorf("expected X-Real-IP, got %s", got)
+	}
+
+	req.Header.Del("X-Real-IP")
+	if got := clientIP(req, true); got != "198.51.100.2" {
+		t.Errorf("expected the last X-Forwarded-For entry, got %s", got)
+	}
+}
+
+func TestFeedbackHandler_RedactKeepsSealedOriginal(t *testing.T) {
+	redactor, err := redact.New(redact.DefaultRules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := testKeyring(t)
+	h := NewFeedbackHandler(Deps{Redactor: redactor, KeepOriginal: true, Keyring: keyring})
+
+	fb := model.Feedback{ID: bson.NewObjectID(), Comment: "email me: jane@example.com"}
+	if err := h.redact(&fb); err != nil {
+		t.Fatal(err)
+	}
+
+	if fb.Comment != "email me: [EMAIL]" {
+		t.Errorf("expected redacted comment, got %q", fb.Comment)
+	}
+	if len(fb.Redactions) != 1 || fb.Redactions[0] != "email" {
+		t.Errorf("expected redactions [email], got %v", fb.Redactions)
+	}
+	original, err := fieldcrypt.OpenOriginal(keyring, &fb)
+	if err != nil {
+		t.Fatalf("failed to open original: %v", err)
+	}
+	if original != "email me: jane@example.com" {
+		t.Errorf("expected original comment, got %q", original)
+	}
+}
+
+func TestFeedbackHandler_RedactLeavesCleanCommentAlone(t *testing.T) {
+	redactor, _ := redact.New(redact.DefaultRules, nil)
+	h := NewFeedbackHandler(Deps{Redactor: redactor})
+
+	fb := model.Feedback{Comment: "Nice tool", Redactions: []string{"forged"}}
+	if err := h.redact(&fb); err != nil {
+		t.Fatal(err)
+	}
+	if fb.Comment != "Nice tool" || fb.Redactions != nil || fb.CommentOriginal != nil {
+		t.Errorf("expected clean comment untouched, got %+v", fb)
+	}
+}
+
+func TestFeedbackHandler_ProtectEncryptsComment(t *testing.T) {
+	redactor, _ := redact.New(redact.DefaultRules, nil)
+	keyring := testKeyring(t)
+	h := NewFeedbackHandler(Deps{Redactor: redactor, Keyring: keyring})
+
+	fb := model.Feedback{ID: bson.NewObjectID(), Comment: "ping me on 192.168.1.20"}
+	if err := h.Protect(&fb); err != nil {
+		t.Fatal(err)
+	}
+	if fb.Comment != "" || fb.CommentEnc == nil {
+		t.Fatalf("expected comment to be stored encrypted, got %+v", fb)
+	}
+	if fb.CommentOriginal != nil {
+		t.Error("expected no original kept without KeepOriginal")
+	}
+
+	admin := NewAdminHandler(Deps{Keyring: keyring})
+	if got := admin.reveal(fb); got.Comment != "ping me on [IP]" {
+		t.Errorf("expected admin view to decrypt redacted comment, got %q", got.Comment)
+	}
+}
+
+func testKeyring(t *testing.T) *fieldcrypt.Keyring {
+	t.Helper()
+	k, err := fieldcrypt.NewKeyring(map[string][]byte{"test": bytes.Repeat([]byte{1}, fieldcrypt.KeySize)}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestFeedbackHandler_PseudonymizeInstallID(t *testing.T) {
+	hasher, err := privacy.NewInstallIDHasher("test-salt-0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fb := model.Feedback{InstallID: "raw-install"}
+	NewFeedbackHandler(Deps{InstallIDs: hasher}).pseudonymize(&fb)
+	if fb.InstallID != hasher.Hash("raw-install") {
+		t.Errorf("expected hashed install ID, got %q", fb.InstallID)
+	}
+
+	fb = model.Feedback{InstallID: "raw-install"}
+	NewFeedbackHandler(Deps{}).pseudonymize(&fb)
+	if fb.InstallID != "" {
+		t.Errorf("expected install ID to be dropped without a hasher, got %q", fb.InstallID)
+	}
+}
+
+func TestAdminHandler_EraseInstallValidation(t *testing.T) {
+	req := httptest.NewRequest(http.MethodDelete, "/nps/admin/v1/installs/abc/feedback", nil)
+	req.SetPathValue("install_id", "abc")
+	w := httptest.NewRecorder()
+	NewAdminHandler(Deps{}).EraseInstall(w, req)
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 without a hasher, got %d", w.Code)
+	}
+
+	hasher, _ := privacy.NewInstallIDHasher("test-salt-0123456789")
+	req = httptest.NewRequest(http.MethodDelete, "/nps/admin/v1/installs/abc/feedback?mode=shred", nil)
+	req.SetPathValue("install_id", "abc")
+	w = httptest.NewRecorder()
+	NewAdminHandler(Deps{InstallIDs: hasher}).EraseInstall(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown mode, got %d", w.Code)
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := keyFingerprint(req); got != "anonymous" {
+		t.Errorf("expected anonymous, got %s", got)
+	}
+	req.Header.Set("X-API-Key", "admin-secret")
+	got := keyFingerprint(req)
+	if len(got) != len("key:")+8 || got == "key:admin-secret" {
+		t.Errorf("unexpected fingerprint %q", got)
+	}
+}
+
+func TestParseFeedbackFilter(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/nps/api/v1/stats?app=idefinity&from=2026-03-01&to=2026-03-31", nil)
+	f, err := parseFeedbackFilter(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.App != "idefinity" {
+		t.Errorf("expected app filter, got %q", f.App)
+	}
+	if want := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC); !f.To.Equal(want) {
+		t.Errorf("expected date upper bound to include the whole day, got %s", f.To)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/nps/api/v1/stats?from=2026-03-01T12:00:00%2B02:00", nil)
+	if f, err = parseFeedbackFilter(req); err != nil || f.From.Hour() != 10 {
+		t.Errorf("expected RFC 3339 bound converted to UTC, got %s, %v", f.From, err)
+	}
+
+	for _, q := range []string{"from=yesterday", "from=2026-03-02&to=2026-03-01"} {
+		req = httptest.NewRequest(http.MethodGet, "/nps/api/v1/stats?"+q, nil)
+		if _, err := parseFeedbackFilter(req); err == nil {
+			t.Errorf("expected error for %q", q)
+		}
+	}
+}
+
+func TestExport_RejectsBadParameters(t *testing.T) {
+	h := NewExportHandler(Deps{})
+	for _, q := range []string{"format=xml", "columns=app,spam_score", "from=soon"} {
+		req := httptest.NewRequest(http.MethodGet, "/nps/api/v1/export?"+q, nil)
+		w := httptest.NewRecorder()
+		h.Export(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestExport_TextNeedsReadScope(t *testing.T) {
+	keyring := testKeyring(t)
+	h := NewExportHandler(Deps{Keyring: keyring})
+	rating := 4
+	fb := model.Feedback{ID: bson.NewObjectID(), App: "idefinity", NPSRating: 2, Comment: "secret comment",
+		Answers: []model.Answer{{QuestionID: "ease", Rating: &rating}, {QuestionID: "why", Text: "secret answer"}}}
+	if err := fieldcrypt.EncryptFeedback(keyring, &fb); err != nil {
+		t.Fatal(err)
+	}
+	// Without encryption the text is stored in plaintext.
+	plain := model.Feedback{ID: bson.NewObjectID(), App: "idefinity", NPSRating: 9, Comment: "plain comment"}
+
+	run := func(ctx context.Context) string {
+		cur, err := mongo.NewCursorFromDocuments([]any{fb, plain}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		out, _ := export.NewWriter(export.CSV, &buf, export.Columns)
+		req := httptest.NewRequest(http.MethodGet, "/nps/api/v1/export", nil).WithContext(ctx)
+		out, keyring := h.protect(req, out)
+		if _, err := export.Copy(ctx, cur, out, keyring, 10, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	got := run(context.Background())
+	for _, s := range []string{"secret comment", "secret answer", "plain comment"} {
+		if strings.Contains(got, s) {
+			t.Errorf("client-key export contains %q:\n%s", s, got)
+		}
+	}
+	if !strings.Contains(got, `""question_id"":""ease"",""rating"":4`) {
+		t.Errorf("expected ratings of answers to stay in the export:\n%s", got)
+	}
+
+	got = run(middleware.WithReadScope(context.Background()))
+	for _, s := range []string{"secret comment", "secret answer", "plain comment"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("read-scope export lacks %q:\n%s", s, got)
+		}
+	}
+}
+
+func TestDashboardEndpoints_RejectBadParameters(t *testing.T) {
+	mux := RegisterRoutes(Deps{})
+	for _, path := range []string{
+		"/nps/api/v1/stats/trend?period=hour",
+		"/nps/api/v1/stats/trend?locale=fi",
+		"/nps/api/v1/stats/breakdown",
+		"/nps/api/v1/stats/breakdown?by=platform&from=2026-03-01T12:00:00Z",
+		"/nps/api/v1/comments?nps_category=fan",
+		"/nps/api/v1/comments?before=123",
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		mux.ServeHTTP(w, req.WithContext(middleware.WithReadScope(req.Context())))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nps/api/v1/comments", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("comments without the read scope: expected 403, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nps/dashboard/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "NPS dashboard") {
+		t.Fatalf("expected the dashboard page, got %d", w.Code)
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "connect-src 'self'") {
+		t.Errorf("expected a same-origin content security policy, got %q", csp)
+	}
+}
+
+func TestImport_RequiresMultipart(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/nps/admin/v1/import", bytes.NewBufferString(`[]`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	NewAdminHandler(Deps{}).Import(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestSubmit_IdempotencyKey(t *testing.T) {
+	mem := store.NewMemory()
+	h := NewFeedbackHandler(Deps{Store: mem})
+	body := `{"schema_version":"1.0","app":"idefinity","app_version":"1.0","platform":"macOS",` +
+		`"timestamp":"2026-03-01T10:00:00Z","nps_rating":9,"nps_category":"promoter"}`
+
+	submit := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		h.Submit(w, req)
+		return w
+	}
+
+	if w := submit("abc-123"); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first submit: got %d, replayed=%q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if w := submit("abc-123"); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("replay: got %d, replayed=%q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	submit("")
+	submit("")
+	if n := len(mem.Feedback()); n != 3 {
+		t.Errorf("expected 3 stored documents, got %d", n)
+	}
+
+	// Someone else's submission under a used key is refused, not replayed.
+	body = strings.Replace(body, `"nps_rating":9`, `"nps_rating":2`, 1)
+	body = strings.Replace(body, "promoter", "detractor", 1)
+	if w := submit("abc-123"); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "idempotency_key_reused") {
+		t.Errorf("reused key: expected 422 idempotency_key_reused, got %d %s", w.Code, w.Body)
+	}
+	if n := len(mem.Feedback()); n != 3 {
+		t.Errorf("expected the reused key to store nothing, got %d documents", n)
+	}
+
+	if w := submit("bad\nkey"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a control character, got %d", w.Code)
+	}
+}
+
+func TestSubmit_IgnoresServerSetFields(t *testing.T) {
+	mem := store.NewMemory()
+	h := NewFeedbackHandler(Deps{Store: mem})
+	body := `{"schema_version":"1.0","app":"idefinity","app_version":"1.0","platform":"macOS",` +
+		`"timestamp":"2026-03-01T10:00:00Z","nps_rating":9,"nps_category":"promoter","comment":"Nice",` +
+		`"anonymized_at":"2026-01-01T00:00:00Z","import_batch":"legacy","quarantine":true,"spam_score":90}`
+	w := httptest.NewRecorder()
+	h.Submit(w, httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", bytes.NewBufferString(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", w.Code, w.Body)
+	}
+
+	fb := mem.Feedback()[0]
+	if fb.AnonymizedAt != nil || fb.ImportBatch != "" || fb.Quarantine || fb.SpamScore != 0 {
+		t.Errorf("stored client-sent server fields: %+v", fb)
+	}
+}
+
+func TestSubmit_LocalizedErrors(t *testing.T) {
+	h := NewFeedbackHandler(Deps{Store: store.NewMemory()})
+	submit := func(body, acceptLanguage string) (*httptest.ResponseRecorder, map[string]string) {
+		req := httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", bytes.NewBufferString(body))
+		req.Header.Set("Accept-Language", acceptLanguage)
+		w := httptest.NewRecorder()
+		h.Submit(w, req)
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+	const noApp = `{"schema_version":"1.3","app_version":"1.0","platform":"macOS",` +
+		`"timestamp":"2026-03-01T10:00:00Z","nps_rating":9,"nps_category":"promoter","locale":"fi"}`
+
+	w, resp := submit(noApp, "fi-FI, en;q=0.5")
+	if w.Code != http.StatusUnprocessableEntity || resp["error"] != "app on pakollinen" ||
+		resp["code"] != "required" || resp["field"] != "app" || w.Header().Get("Content-Language") != "fi" {
+		t.Errorf("Finnish: got %d %v, Content-Language %q", w.Code, resp, w.Header().Get("Content-Language"))
+	}
+	if _, resp := submit(noApp, "de"); resp["error"] != "app is required" {
+		t.Errorf("unsupported language: expected English, got %v", resp)
+	}
+	if w, resp := submit("{", "sv"); w.Code != http.StatusBadRequest || resp["code"] != "invalid_json" || resp["error"] != "ogiltig JSON-data" {
+		t.Errorf("Swedish invalid JSON: got %d %v", w.Code, resp)
+	}
+}
+
+func TestSurvey_RuleLifecycle(t *testing.T) {
+	mux := RegisterRoutes(Deps{SurveyRules: survey.NewMemory()})
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/nps/api/v1/survey-config?app=idefinity&install_id=abc", "")
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"prompt":false`)) {
+		t.Fatalf("no rules: got %d %s", w.Code, w.Body)
+	}
+
+	w = do(http.MethodPost, "/nps/admin/v1/survey-rules",
+		`{"app":"idefinity","platforms":["macOS"],"enabled":true,"sample_percent":100,"min_days_between_prompts":90,"question":"How likely?"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d %s", w.Code, w.Body)
+	}
+	var rule survey.Rule
+	json.Unmarshal(w.Body.Bytes(), &rule)
+
+	w = do(http.MethodGet, "/nps/api/v1/survey-config?app=idefinity&platform=macOS&install_id=abc", "")
+	var cfg survey.Config
+	json.Unmarshal(w.Body.Bytes(), &cfg)
+	if !cfg.Prompt || cfg.MinDaysBetweenPrompts != 90 || cfg.RuleID != rule.ID.Hex() {
+		t.Errorf("expected the new rule to apply, got %+v", cfg)
+	}
+
+	w = do(http.MethodPut, "/nps/admin/v1/survey-rules/"+rule.ID.Hex(),
+		`{"app":"idefinity","enabled":true,"sample_percent":100,"question":"How likely?","translations":{"sv":{"question":"Hur troligt?"}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("translate: got %d %s", w.Code, w.Body)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/nps/api/v1/survey-config?app=idefinity", nil)
+	req.Header.Set("Accept-Language", "sv-FI, en;q=0.8")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &cfg)
+	if cfg.Question != "Hur troligt?" || cfg.Locale != "sv" || w.Header().Get("Vary") != "Accept-Language" {
+		t.Errorf("expected the Swedish question, got %+v", cfg)
+	}
+	w = do(http.MethodGet, "/nps/api/v1/survey-config?app=idefinity&locale=fi", "")
+	json.Unmarshal(w.Body.Bytes(), &cfg)
+	if cfg.Question != "How likely?" || cfg.Locale != "en" {
+		t.Errorf("expected the English fallback, got %+v", cfg)
+	}
+
+	if w := do(http.MethodPut, "/nps/admin/v1/survey-rules/"+rule.ID.Hex(), `{"app":"idefinity","sample_percent":150,"question":"q"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid update: expected 422, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/nps/admin/v1/survey-rules/"+rule.ID.Hex(), ""); w.Code != http.StatusOK {
+		t.Errorf("delete: expected 200, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/nps/api/v1/survey-config", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("missing app: expected 400, got %d", w.Code)
+	}
+}
+
+func TestSurvey_DefinitionsAndAnswers(t *testing.T) {
+	mem := store.NewMemory()
+	redactor, _ := redact.New(redact.DefaultRules, nil)
+	mux := RegisterRoutes(Deps{Store: mem, SurveyDefinitions: survey.NewMemoryDefinitions(), Redactor: redactor})
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	const definition = `{"id":"onboarding","questions":[` +
+		`{"id":"reason","type":"single_choice","prompt":{"en":"Main reason?","fi":"Tärkein syy?"},"required":true,` +
+		`"choices":[{"id":"price","label":{"en":"Price"}},{"id":"speed","label":{"en":"Speed"}}]},` +
+		`{"id":"why","type":"free_text","prompt":{"en":"Tell us more"}}]}`
+
+	if w := do(http.MethodPost, "/nps/admin/v1/surveys", definition); w.Code != http.StatusCreated {
+		t.Fatalf("publish: got %d %s", w.Code, w.Body)
+	}
+	w := do(http.MethodPost, "/nps/admin/v1/surveys", definition)
+	var d survey.Definition
+	json.Unmarshal(w.Body.Bytes(), &d)
+	if w.Code != http.StatusCreated || d.Version != 2 {
+		t.Fatalf("republish: expected version 2, got %d %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, "/nps/admin/v1/surveys", `{"id":"bad","questions":[{"id":"q","type":"rating","prompt":{"fi":"Vain suomeksi"}}]}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("missing en prompt: expected 422, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/nps/api/v1/surveys/onboarding?version=1", ""); w.Code != http.StatusOK {
+		t.Errorf("get version 1: got %d", w.Code)
+	}
+	w = do(http.MethodGet, "/nps/api/v1/surveys/onboarding?locale=fi", "")
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"prompt":"Tärkein syy?","locale":"fi"`)) ||
+		!bytes.Contains(w.Body.Bytes(), []byte(`"prompt":"Tell us more","locale":"en"`)) {
+		t.Errorf("expected Finnish texts with English fallback, got %s", w.Body)
+	}
+	if w := do(http.MethodGet, "/nps/api/v1/surveys/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown survey: expected 404, got %d", w.Code)
+	}
+
+	submit := func(survey string) int {
+		body := `{"schema_version":"1.2","app":"idefinity","app_version":"1.0","platform":"macOS",` +
+			`"timestamp":"2026-03-01T10:00:00Z","nps_rating":6,"nps_category":"detractor",` + survey + `}`
+		return do(http.MethodPost, "/nps/api/v1/feedback", body).Code
+	}
+	for name, tc := range map[string]struct {
+		survey string
+		want   int
+	}{
+		"valid":            {`"survey_id":"onboarding","survey_version":1,"answers":[{"question_id":"reason","choices":["price"]},{"question_id":"why","text":"mail jane@example.com"}]`, http.StatusCreated},
+		"missing required": {`"survey_id":"onboarding","survey_version":1,"answers":[{"question_id":"why","text":"hi"}]`, http.StatusUnprocessableEntity},
+		"unknown choice":   {`"survey_id":"onboarding","survey_version":2,"answers":[{"question_id":"reason","choices":["colour"]}]`, http.StatusUnprocessableEntity},
+		"two choices":      {`"survey_id":"onboarding","survey_version":2,"answers":[{"question_id":"reason","choices":["price","speed"]}]`, http.StatusUnprocessableEntity},
+		"unknown version":  {`"survey_id":"onboarding","survey_version":3,"answers":[{"question_id":"reason","choices":["price"]}]`, http.StatusUnprocessableEntity},
+	} {
+		if got := submit(tc.survey); got != tc.want {
+			t.Errorf("%s: expected %d, got %d", name, tc.want, got)
+		}
+	}
+
+	docs := mem.Feedback()
+	if len(docs) != 1 {
+		t.Fatalf("expected 1 stored document, got %d", len(docs))
+	}
+	if got := docs[0].Answers[1].Text; got != "mail [EMAIL]" || len(docs[0].Redactions) != 1 {
+		t.Errorf("expected the free-text answer redacted, got %q %v", got, docs[0].Redactions)
+	}
+}
+
+func TestWebhooks_LifecycleAndDelivery(t *testing.T) {
+	w := httptest.NewRecorder()
+	RegisterRoutes(Deps{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nps/admin/v1/webhooks", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("disabled: expected 501, got %d", w.Code)
+	}
+
+	var received []*http.Request
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer endpoint.Close()
+
+	subs, deliveries := webhook.NewMemorySubscriptions(), webhook.NewMemoryDeliveries()
+	notifier := webhook.NewNotifier(subs, deliveries, time.Minute)
+	mux := RegisterRoutes(Deps{Store: store.NewMemory(), Webhooks: notifier})
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/nps/admin/v1/webhooks", `{"url":"not a url"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid url: expected 422, got %d", w.Code)
+	}
+	w = do(http.MethodPost, "/nps/admin/v1/webhooks",
+		`{"name":"crm","url":"`+endpoint.URL+`","enabled":true,"filter":{"categories":["detractor"],"has_comment":true}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d %s", w.Code, w.Body)
+	}
+	var sub webhook.Subscription
+	json.Unmarshal(w.Body.Bytes(), &sub)
+	if !strings.HasPrefix(sub.Secret, "whsec_") {
+		t.Fatalf("expected a generated secret, got %q", sub.Secret)
+	}
+	if w := do(http.MethodGet, "/nps/admin/v1/webhooks", ""); bytes.Contains(w.Body.Bytes(), []byte(sub.Secret)) {
+		t.Error("expected the list to redact secrets")
+	}
+
+	submit := func(rating int, category, comment string) {
+		body := `{"schema_version":"1.0","app":"idefinity","app_version":"1.0","platform":"macOS",` +
+			`"timestamp":"2026-03-01T10:00:00Z","nps_rating":` + strconv.Itoa(rating) +
+			`,"nps_category":"` + category + `","comment":"` + comment + `"}`
+		if w := do(http.MethodPost, "/nps/api/v1/feedback", body); w.Code != http.StatusCreated {
+			t.Fatalf("submit: got %d %s", w.Code, w.Body)
+		}
+	}
+	submit(2, "detractor", "Too slow")
+	submit(10, "promoter", "Love it")
+	submit(3, "detractor", "")
+
+	w = do(http.MethodGet, "/nps/admin/v1/webhook-deliveries?status=pending&subscription_id="+sub.ID.Hex(), "")
+	var log struct {
+		Items []webhook.Delivery `json:"items"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &log)
+	if len(log.Items) != 1 {
+		t.Fatalf("expected 1 queued delivery, got %s", w.Body)
+	}
+
+	// Updating without a secret keeps the current one.
+	w = do(http.MethodPut, "/nps/admin/v1/webhooks/"+sub.ID.Hex(), `{"name":"crm","url":"`+endpoint.URL+`","enabled":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: got %d %s", w.Code, w.Body)
+	}
+	if stored, _ := subs.Get(t.Context(), sub.ID); stored.Secret != sub.Secret || !stored.CreatedAt.Equal(sub.CreatedAt) {
+		t.Errorf("expected the secret and creation time to be kept, got %+v", stored)
+	}
+
+	load := func(context.Context, bson.ObjectID) (*model.Feedback, error) {
+		return &model.Feedback{App: "idefinity", NPSRating: 2, NPSCategory: "detractor"}, nil
+	}
+	dispatcher := webhook.NewDispatcher(subs, deliveries, load, webhook.DispatcherConfig{})
+	if n, err := dispatcher.RunOnce(t.Context()); err != nil || n != 1 || len(received) != 1 {
+		t.Fatalf("dispatch: n=%d err=%v received=%d", n, err, len(received))
+	}
+	if received[0].Header.Get(webhook.HeaderSignature) == "" {
+		t.Error("expected a signed delivery")
+	}
+
+	id := log.Items[0].ID.Hex()
+	if w := do(http.MethodPost, "/nps/admin/v1/webhook-deliveries/"+id+"/redeliver", ""); w.Code != http.StatusAccepted {
+		t.Errorf("redeliver: expected 202, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/nps/admin/v1/webhook-deliveries/"+bson.NewObjectID().Hex()+"/redeliver", ""); w.Code != http.StatusNotFound {
+		t.Errorf("redeliver unknown: expected 404, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/nps/admin/v1/webhook-deliveries?status=lost", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("bad status: expected 400, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/nps/admin/v1/webhooks/"+sub.ID.Hex(), ""); w.Code != http.StatusOK {
+		t.Errorf("delete: expected 200, got %d", w.Code)
+	}
+}
+
+func TestSubmit_SlackAlertShowsRedactedComment(t *testing.T) {
+	var posted []slack.Message
+	standIn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m slack.Message
+		json.NewDecoder(r.Body).Decode(&m)
+		posted = append(posted, m)
+	}))
+	defer standIn.Close()
+
+	redactor, err := redact.New(redact.DefaultRules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts := slack.New(slack.Config{Routes: map[string]string{slack.RouteAll: standIn.URL}, BatchWindow: time.Millisecond})
+	mem := store.NewMemory()
+	h := NewFeedbackHandler(Deps{Store: mem, Redactor: redactor, Keyring: testKeyring(t), Alerts: alerts})
+
+	body := `{"schema_version":"1.0","app":"idefinity","app_version":"1.0","platform":"macOS",` +
+		`"timestamp":"2026-03-01T10:00:00Z","nps_rating":2,"nps_category":"detractor","comment":"Call me at jane@example.com"}`
+	w := httptest.NewRecorder()
+	h.Submit(w, httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", bytes.NewBufferString(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("submit: got %d %s", w.Code, w.Body)
+	}
+	if stored := mem.Feedback()[0]; stored.Comment != "" || stored.CommentEnc == nil {
+		t.Fatalf("expected the stored comment to be encrypted, got %+v", stored)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	alerts.Flush(t.Context())
+	if len(posted) != 1 {
+		t.Fatalf("expected one alert, got %d", len(posted))
+	}
+	if got := posted[0].Blocks[2].Text.Text; got != "> Call me at [EMAIL]" {
+		t.Errorf("expected the redacted comment, got %q", got)
+	}
+}
+
+// replayFunc adapts a function to stream.Replayer.
+type replayFunc func(after bson.ObjectID, f stream.Filter, limit int) []*model.Feedback
+
+func (fn replayFunc) After(_ context.Context, after bson.ObjectID, f stream.Filter, limit int) ([]*model.Feedback, error) {
+	return fn(after, f, limit), nil
+}
+
+func TestStream_LiveAndResumed(t *testing.T) {
+	missed := &model.Feedback{ID: bson.NewObjectID(), App: "idefinity", NPSRating: 9, NPSCategory: "promoter"}
+	var resumedFrom bson.ObjectID
+	replay := replayFunc(func(after bson.ObjectID, _ stream.Filter, _ int) []*model.Feedback {
+		resumedFrom = after
+		return []*model.Feedback{missed}
+	})
+	redactor, err := redact.New(redact.DefaultRules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := stream.NewHub(2, 0)
+	srv := httptest.NewServer(middleware.ReadScope([]string{"reader"}, nil)(RegisterRoutes(Deps{
+		Store: store.NewMemory(), Redactor: redactor, Keyring: testKeyring(t),
+		Stream: hub, StreamReplay: replay,
+	})))
+	defer srv.Close()
+
+	for _, q := range []string{"nps_category=happy", "locale=not_a_locale", "from=2026-01-01"} {
+		resp, err := http.Get(srv.URL + "/nps/api/v1/feedback/stream?" + q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, resp.StatusCode)
+		}
+	}
+
+	// open subscribes with an API key and returns a reader of its events.
+	open := func(key string, last bson.ObjectID) func() map[string]string {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+"/nps/api/v1/feedback/stream?app=idefinity&nps_category=detractor", nil)
+		req.Header.Set("X-API-Key", key)
+		if !last.IsZero() {
+			req.Header.Set("Last-Event-ID", last.Hex())
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("expected an event stream, got %d %q", resp.StatusCode, ct)
+		}
+		events := bufio.NewReader(resp.Body)
+		return func() map[string]string {
+			t.Helper()
+			ev := map[string]string{}
+			for {
+				line, err := events.ReadString('\n')
+				if err != nil {
+					if err == io.EOF && len(ev) == 0 {
+						return nil
+					}
+					t.Fatalf("reading stream: %v", err)
+				}
+				line = strings.TrimSuffix(line, "\n")
+				if line == "" {
+					return ev
+				}
+				k, v, _ := strings.Cut(line, ": ")
+				ev[k] = v
+			}
+		}
+	}
+
+	last := bson.NewObjectID()
+	next := open("reader", last)
+	if ev := next(); ev["retry"] == "" {
+		t.Errorf("expected a retry interval first, got %v", ev)
+	}
+	if ev := next(); ev["id"] != missed.ID.Hex() || resumedFrom != last {
+		t.Errorf("expected the missed feedback replayed after %s, got %v from %s", last.Hex(), ev, resumedFrom.Hex())
+	}
+	// Client keys ship in the desktop apps; they get no comment text.
+	nextClient := open("client", bson.ObjectID{})
+	nextClient()
+
+	submit := func(rating int, category, comment string) {
+		t.Helper()
+		body := `{"schema_version":"1.0","app":"idefinity","app_version":"1.0","platform":"macOS",` +
+			`"timestamp":"2026-03-01T10:00:00Z","nps_rating":` + strconv.Itoa(rating) +
+			`,"nps_category":"` + category + `","comment":"` + comment + `"}`
+		resp, err := http.Post(srv.URL+"/nps/api/v1/feedback", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	submit(10, "promoter", "Great")
+	submit(2, "detractor", "Call me at jane@example.com")
+
+	payload := func(ev map[string]string) webhook.FeedbackPayload {
+		t.Helper()
+		if ev["event"] != "feedback" {
+			t.Fatalf("expected a feedback event, got %v", ev)
+		}
+		var got webhook.FeedbackPayload
+		if err := json.Unmarshal([]byte(ev["data"]), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != ev["id"] || got.NPSCategory != "detractor" {
+			t.Errorf("expected the filtered detractor, got %+v", got)
+		}
+		return got
+	}
+	if got := payload(next()); got.Comment != "Call me at [EMAIL]" {
+		t.Errorf("expected the redacted comment with the read scope, got %q", got.Comment)
+	}
+	if got := payload(nextClient()); got.Comment != "" {
+		t.Errorf("expected no comment for a client key, got %q", got.Comment)
+	}
+
+	hub.Close()
+	if ev := next(); ev != nil {
+		t.Errorf("expected closing the hub to end the stream, got %v", ev)
+	}
+}
+
+func TestWeb_Submit(t *testing.T) {
+	mem := store.NewMemory()
+	mux := RegisterRoutes(Deps{Store: mem, WebWidget: true, WebOrigins: []string{"https://www.example.com"},
+		WebApps: []string{"website"}})
+	post := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/nps/web/v1/feedback", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// The platform and category are the server's, whatever the client sent.
+	w := post("application/json", `{"schema_version":"1.3","app":"website","app_version":"web","platform":"macOS",`+
+		`"timestamp":"2026-03-01T10:00:00Z","nps_rating":6,"nps_category":"promoter","locale":"en_us"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("json: got %d %s", w.Code, w.Body)
+	}
+	w = post("application/x-www-form-urlencoded", "app=website&app_version=web&nps_rating=10&comment=+Great+")
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), "Thank you") {
+		t.Fatalf("form: got %d %s", w.Code, w.Body)
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "frame-ancestors 'self' https://www.example.com") {
+		t.Errorf("form: expected the allowed origins as frame ancestors, got %q", csp)
+	}
+
+	stored := mem.Feedback()
+	if len(stored) != 2 {
+		t.Fatalf("expected 2 stored submissions, got %d", len(stored))
+	}
+	if fb := stored[0]; fb.Platform != model.PlatformWeb || fb.NPSCategory != "detractor" || fb.Locale != "en-US" {
+		t.Errorf("json: expected a Web detractor in en-US, got %+v", fb)
+	}
+	if fb := stored[1]; fb.Platform != model.PlatformWeb || fb.NPSCategory != "promoter" || fb.Comment != "Great" ||
+		fb.SchemaVersion != model.SchemaV1_3 || fb.Timestamp == "" {
+		t.Errorf("form: expected a Web promoter with defaults filled in, got %+v", fb)
+	}
+
+	// The web routes take no key, so they must not open up the desktop apps.
+	for _, body := range []string{
+		`{"schema_version":"1.3","app":"idefinity","app_version":"web","timestamp":"2026-03-01T10:00:00Z","nps_rating":6}`,
+		"app=idefinity&app_version=web&nps_rating=10",
+	} {
+		contentType := "application/json"
+		if !strings.HasPrefix(body, "{") {
+			contentType = "application/x-www-form-urlencoded"
+		}
+		if w := post(contentType, body); w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403 for an app not in WebApps, got %d", contentType, w.Code)
+		}
+	}
+	if n := len(mem.Feedback()); n != 2 {
+		t.Errorf("expected no submissions for other apps, got %d stored", n)
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nps/web/v1/form?app=idefinity", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("form for an app not in WebApps: expected 403, got %d", w.Code)
+	}
+
+	w = post("application/x-www-form-urlencoded", "app=website&app_version=web&comment=Hello")
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "Hello</textarea>") {
+		t.Errorf("form without a rating: expected the form again with the comment kept, got %d %s", w.Code, w.Body)
+	}
+	if w := post("application/json", `{"app":"website","app_version":"web"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("json without a rating: expected 422, got %d %s", w.Code, w.Body)
+	}
+	// The website prompt runs from 0, unlike the app API.
+	if w := post("application/json", `{"app":"website","app_version":"web","nps_rating":0}`); w.Code != http.StatusCreated {
+		t.Errorf("json rating 0: expected 201, got %d %s", w.Code, w.Body)
+	}
+	if stored := mem.Feedback(); len(stored) != 3 || stored[2].NPSRating != 0 || stored[2].NPSCategory != "detractor" {
+		t.Errorf("expected a stored detractor rating 0, got %+v", stored[len(stored)-1])
+	}
+
+	w = httptest.NewRecorder()
+	RegisterRoutes(Deps{Store: mem}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nps/web/v1/widget.js", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("disabled: expected 501, got %d", w.Code)
+	}
+}
+
+// TestOpenAPI_CoversRoutes keeps docs/openapi.json in step with
+// RegisterRoutes: every registered route must be described, and every
+// described operation registered.
+func TestOpenAPI_CoversRoutes(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "routes.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "HandleFunc" && sel.Sel.Name != "Handle") {
+			return true
+		}
+		if id, ok := sel.X.(*ast.Ident); !ok || id.Name != "mux" {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok {
+			t.Errorf("route pattern is not a literal: %v", call.Args[0])
+			return true
+		}
+		pattern, _ := strconv.Unquote(lit.Value)
+		routes[pattern] = true
+		return true
+	})
+	if len(routes) < 30 {
+		t.Fatalf("found only %d routes in routes.go", len(routes))
+	}
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(apidocs.Spec(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	described := map[string]bool{}
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if method == "parameters" || method == "summary" || method == "description" {
+				continue
+			}
+			described[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	for r := range routes {
+		if !described[r] {
+			t.Errorf("route %q is missing from docs/openapi.json", r)
+		}
+	}
+	for d := range described {
+		if !routes[d] {
+			t.Errorf("docs/openapi.json describes %q, which is not registered", d)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// writeLocalizedError writes a client error from the message catalog in the
+// language negotiated from Accept-Language. The stable code goes alongside
+// the text so clients need not parse it; field is omitted when empty.
+func writeLocalizedError(w http.ResponseWriter, r *http.Request, status int, field string, msg i18n.Message) {
+	locale := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	body := map[string]string{
+		"error": msg.In(locale),
+		"code":  msg.Code,
+	}
+	if field != "" {
+		body["field"] = field
+	}
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+	writeJSON(w, status, body)
+}
+
+// writeValidationError writes err as a 422, localized when it is a
+// *model.ValidationError.
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var verr *model.ValidationError
+	if !errors.As(err, &verr) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	writeLocalizedError(w, r, http.StatusUnprocessableEntity, verr.Field, verr.Message)
+}
+
+// requestLocales returns the client's preferred locales: the ?locale= query
+// parameter if given, otherwise the Accept-Language header.
+func requestLocales(r *http.Request) []string {
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		return []string{i18n.Normalize(locale)}
+	}
+	return i18n.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+}
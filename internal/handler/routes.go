@@ -1,18 +1,149 @@
 package handler
 
 import (
+	"expvar"
 	"net/http"
 
+	"github.com/idefinity/nps-api/internal/apidocs"
+	"github.com/idefinity/nps-api/internal/dashboard"
 	"github.com/idefinity/nps-api/internal/db"
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/privacy"
+	"github.com/idefinity/nps-api/internal/redact"
+	"github.com/idefinity/nps-api/internal/retention"
+	"github.com/idefinity/nps-api/internal/slack"
+	"github.com/idefinity/nps-api/internal/spam"
+	"github.com/idefinity/nps-api/internal/store"
+	"github.com/idefinity/nps-api/internal/stream"
+	"github.com/idefinity/nps-api/internal/survey"
+	"github.com/idefinity/nps-api/internal/webhook"
 )
 
+// Deps bundles the collaborators the HTTP handlers are built from. Optional
+// features are disabled when their field is nil.
+type Deps struct {
+	DB *db.Database
+	// Store receives accepted submissions. nil uses DB.
+	Store store.FeedbackStore
+
+	// Spam scores submissions after validation; nil disables scoring.
+	Spam *spam.Detector
+	// TrustProxy makes client IP lookups honor X-Forwarded-For and
+	// X-Real-IP. Enable only behind a proxy that sets them.
+	TrustProxy bool
+
+	// Redactor masks personal data in comments before storage; nil stores
+	// comments verbatim.
+	Redactor *redact.Redactor
+	// KeepOriginal keeps an encrypted copy of each comment that redaction
+	// changed, readable through the admin API only. Requires Keyring.
+	KeepOriginal bool
+
+	// Keyring enables field encryption: comments are stored encrypted and
+	// decrypted on the admin read endpoints and in exports. nil stores them
+	// in plaintext.
+	Keyring *fieldcrypt.Keyring
+
+	// InstallIDs hashes client install IDs before storage. nil drops them,
+	// since storing the raw value would defeat pseudonymization.
+	InstallIDs *privacy.InstallIDHasher
+
+	// SurveyRules stores the rules behind the survey config endpoint. nil
+	// uses DB.
+	SurveyRules survey.Rules
+	// SurveyDefinitions stores the follow-up question sets that schema 1.2
+	// submissions answer. nil uses DB.
+	SurveyDefinitions survey.Definitions
+
+	// Retention serves the retention dry-run report; nil when no retention
+	// rules are configured.
+	Retention *retention.Purger
+
+	// Webhooks queues deliveries of accepted submissions to the webhook
+	// subscriptions and backs the admin webhook endpoints; nil disables
+	// webhooks.
+	Webhooks *webhook.Notifier
+	// Alerts posts detractor alerts to Slack; nil disables them.
+	Alerts *slack.Alerter
+
+	// Stream feeds the live feedback stream; nil disables it.
+	Stream *stream.Hub
+	// StreamFromChanges means Stream is fed by a change stream on the
+	// feedback collection, so submissions are not published to it directly.
+	StreamFromChanges bool
+	// StreamReplay loads the feedback a reconnecting stream client missed.
+	// nil uses DB.
+	StreamReplay stream.Replayer
+
+	// WebWidget enables the website widget, its form fallback and the
+	// browser submission endpoint under /nps/web.
+	WebWidget bool
+	// WebOrigins are the sites allowed to embed the widget; they may also
+	// show the form fallback in a frame.
+	WebOrigins []string
+	// WebApps are the apps browsers may submit feedback for. The web routes
+	// take no API key, so any other app is refused there.
+	WebApps []string
+}
+
 // RegisterRoutes sets up all HTTP routes under the /nps prefix.
-func RegisterRoutes(database *db.Database) *http.ServeMux {
+func RegisterRoutes(deps Deps) *http.ServeMux {
 	mux := http.NewServeMux()
-	feedback := NewFeedbackHandler(database)
+	feedback := NewFeedbackHandler(deps)
+	admin := NewAdminHandler(deps)
+	stats := NewStatsHandler(deps)
+	export := NewExportHandler(deps)
+	surveys := NewSurveyHandler(deps)
+	webhooks := NewWebhookHandler(deps)
+	live := NewStreamHandler(deps)
+	comments := NewCommentHandler(deps)
+	web := NewWebHandler(deps)
 
 	mux.HandleFunc("GET /nps/health", HealthCheck)
 	mux.HandleFunc("POST /nps/api/v1/feedback", feedback.Submit)
+	mux.HandleFunc("GET /nps/api/v1/feedback/stream", live.Stream)
+	mux.HandleFunc("GET /nps/api/v1/stats", stats.Summary)
+	mux.HandleFunc("GET /nps/api/v1/stats/answers", stats.Answers)
+	mux.HandleFunc("GET /nps/api/v1/stats/trend", stats.Trend)
+	mux.HandleFunc("GET /nps/api/v1/stats/breakdown", stats.Breakdown)
+	mux.HandleFunc("GET /nps/api/v1/comments", comments.List)
+	mux.HandleFunc("GET /nps/api/v1/export", export.Export)
+	mux.HandleFunc("GET /nps/api/v1/survey-config", surveys.Config)
+	mux.HandleFunc("GET /nps/api/v1/surveys/{survey_id}", surveys.GetDefinition)
+
+	mux.HandleFunc("GET /nps/web/v1/widget.js", web.Script)
+	mux.HandleFunc("GET /nps/web/v1/form", web.Form)
+	mux.HandleFunc("POST /nps/web/v1/feedback", web.Submit)
+
+	// The dashboard is static; its data comes from the API above.
+	mux.Handle("GET /nps/dashboard/", http.StripPrefix("/nps/dashboard", dashboard.Handler()))
+
+	// The API description and its viewer are public, like the health check.
+	// Every route registered here must be in docs/openapi.json.
+	mux.Handle("GET /nps/openapi.json", apidocs.SpecHandler())
+	mux.Handle("GET /nps/docs/", http.StripPrefix("/nps/docs", apidocs.Handler()))
+
+	mux.HandleFunc("GET /nps/admin/v1/feedback/{id}", admin.GetFeedback)
+	mux.HandleFunc("GET /nps/admin/v1/installs/{install_id}/feedback", admin.ExportInstall)
+	mux.HandleFunc("DELETE /nps/admin/v1/installs/{install_id}/feedback", admin.EraseInstall)
+	mux.HandleFunc("GET /nps/admin/v1/quarantine", admin.ListQuarantined)
+	mux.HandleFunc("POST /nps/admin/v1/quarantine/{id}/release", admin.ReleaseQuarantined)
+	mux.HandleFunc("DELETE /nps/admin/v1/quarantine/{id}", admin.DeleteQuarantined)
+	mux.HandleFunc("GET /nps/admin/v1/retention/report", admin.RetentionReport)
+	mux.HandleFunc("POST /nps/admin/v1/import", admin.Import)
+	mux.HandleFunc("GET /nps/admin/v1/survey-rules", surveys.ListRules)
+	mux.HandleFunc("POST /nps/admin/v1/survey-rules", surveys.CreateRule)
+	mux.HandleFunc("PUT /nps/admin/v1/survey-rules/{id}", surveys.UpdateRule)
+	mux.HandleFunc("DELETE /nps/admin/v1/survey-rules/{id}", surveys.DeleteRule)
+	mux.HandleFunc("GET /nps/admin/v1/surveys", surveys.ListDefinitions)
+	mux.HandleFunc("POST /nps/admin/v1/surveys", surveys.PublishDefinition)
+	mux.HandleFunc("GET /nps/admin/v1/webhooks", webhooks.ListSubscriptions)
+	mux.HandleFunc("POST /nps/admin/v1/webhooks", webhooks.CreateSubscription)
+	mux.HandleFunc("PUT /nps/admin/v1/webhooks/{id}", webhooks.UpdateSubscription)
+	mux.HandleFunc("DELETE /nps/admin/v1/webhooks/{id}", webhooks.DeleteSubscription)
+	mux.HandleFunc("GET /nps/admin/v1/webhook-deliveries", webhooks.ListDeliveries)
+	mux.HandleFunc("POST /nps/admin/v1/webhook-deliveries/{id}/redeliver", webhooks.Redeliver)
+	mux.Handle("GET /nps/admin/v1/metrics", expvar.Handler())
 
 	return mux
 }
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// StatsHandler serves NPS summaries.
+type StatsHandler struct {
+	reader *stats.Reader
+}
+
+// NewStatsHandler creates a handler from the given dependencies.
+func NewStatsHandler(deps Deps) *StatsHandler {
+	var reader *stats.Reader
+	if deps.DB != nil {
+		reader = stats.NewReader(deps.DB.Collection("feedback"), deps.DB.Collection(stats.Collection))
+	}
+	return &StatsHandler{reader: reader}
+}
+
+// Summary returns the NPS breakdown. Optional query parameters: app,
+// app_version, platform, locale, from and to. Dates (2006-01-02) cover whole
+// UTC days with to inclusive; RFC 3339 timestamps are exact with to
+// exclusive.
+// Day-aligned queries without a locale are answered from the daily rollup.
+func (h *StatsHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFeedbackFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	summary, err := h.reader.Summary(r.Context(), f)
+	if err != nil {
+		slog.Error("failed to compute stats", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to compute stats",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// Answers tallies the choice answers to the survey named by ?survey_id=,
+// optionally limited to ?survey_version=. It takes the same filters as
+// Summary and always reads raw feedback.
+func (h *StatsHandler) Answers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	surveyID := q.Get("survey_id")
+	if surveyID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "survey_id is required",
+		})
+		return
+	}
+	version := 0
+	if v := q.Get("survey_version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "survey_version must be a positive integer",
+			})
+			return
+		}
+		version = n
+	}
+	f, err := parseFeedbackFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tally, err := h.reader.Answers(r.Context(), f, surveyID, version)
+	if err != nil {
+		slog.Error("failed to tally survey answers", "survey_id", surveyID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to compute stats",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, tally)
+}
+
+// Trend returns one summary per ?period=day|week|month (default day), oldest
+// first, from the daily rollup. It takes the filters of Summary except
+// locale, and from and to must be dates.
+func (h *StatsHandler) Trend(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = stats.PeriodDay
+	}
+	if period != stats.PeriodDay && period != stats.PeriodWeek && period != stats.PeriodMonth {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "period must be day, week or month",
+		})
+		return
+	}
+	f, err := parseRollupFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	points, err := h.reader.Trend(r.Context(), f, period)
+	if err != nil {
+		slog.Error("failed to compute trend", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to compute stats",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"period": period,
+		"items":  points,
+	})
+}
+
+// Breakdown returns one summary per ?by=app|app_version|platform, largest
+// first, from the daily rollup. It takes the same filters as Trend.
+func (h *StatsHandler) Breakdown(w http.ResponseWriter, r *http.Request) {
+	by := r.URL.Query().Get("by")
+	if by != stats.ByApp && by != stats.ByAppVersion && by != stats.ByPlatform {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "by must be app, app_version or platform",
+		})
+		return
+	}
+	f, err := parseRollupFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	groups, err := h.reader.Breakdown(r.Context(), f, by)
+	if err != nil {
+		slog.Error("failed to compute breakdown", "by", by, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to compute stats",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"by":    by,
+		"items": groups,
+	})
+}
+
+// parseRollupFilter is parseFeedbackFilter for the endpoints answered only
+// from the daily rollup, which has no locale and whole UTC days.
+func parseRollupFilter(r *http.Request) (stats.Filter, error) {
+	f, err := parseFeedbackFilter(r)
+	if err != nil {
+		return f, err
+	}
+	if f.Locale != "" {
+		return f, fmt.Errorf("locale is not supported here")
+	}
+	aligned := func(t time.Time) bool { return t.IsZero() || t.Equal(stats.Day(t)) }
+	if !aligned(f.From) || !aligned(f.To) {
+		return f, fmt.Errorf("from and to must be dates")
+	}
+	return f, nil
+}
+
+func parseFeedbackFilter(r *http.Request) (stats.Filter, error) {
+	q := r.URL.Query()
+	f := stats.Filter{
+		App:        q.Get("app"),
+		AppVersion: q.Get("app_version"),
+		Platform:   q.Get("platform"),
+		Locale:     i18n.Normalize(q.Get("locale")),
+	}
+	if f.Locale != "" && !i18n.ValidTag(f.Locale) {
+		return f, fmt.Errorf("invalid locale %q", q.Get("locale"))
+	}
+
+	var err error
+	if f.From, err = parseStatsTime(q.Get("from"), false); err != nil {
+		return f, fmt.Errorf("invalid from: %w", err)
+	}
+	if f.To, err = parseStatsTime(q.Get("to"), true); err != nil {
+		return f, fmt.Errorf("invalid to: %w", err)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return f, fmt.Errorf("from must be before to")
+	}
+	return f, nil
+}
+
+// parseStatsTime accepts a date or an RFC 3339 timestamp. A date used as the
+// upper bound is moved to the end of that day so the day is included.
+func parseStatsTime(s string, upper bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.Parse(time.DateOnly, s); err == nil {
+		if upper {
+			d = d.AddDate(0, 0, 1)
+		}
+		return d, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("use YYYY-MM-DD or an RFC 3339 timestamp")
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/middleware"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/stream"
+	"github.com/idefinity/nps-api/internal/webhook"
+)
+
+// streamWriteTimeout is the write deadline granted per event. Each write
+// extends it, so a stream outlives the server's WriteTimeout as long as the
+// client keeps reading.
+const streamWriteTimeout = 30 * time.Second
+
+// streamHeartbeat is how often an idle stream sends a comment line, so that
+// proxies do not close it and dead clients are noticed.
+const streamHeartbeat = 15 * time.Second
+
+// streamRetry is the reconnection delay suggested to clients, in
+// milliseconds.
+const streamRetry = 3000
+
+// Resumption replays stored feedback in pages of streamReplayBatch. After
+// streamReplayLimit events the stream ends, and the client reconnects from
+// the last one; this bounds what one connection holds in memory.
+const (
+	streamReplayBatch = 500
+	streamReplayLimit = 10000
+)
+
+// StreamHandler serves the live feedback stream.
+type StreamHandler struct {
+	hub    *stream.Hub
+	replay stream.Replayer
+}
+
+// NewStreamHandler creates a handler from the given dependencies.
+func NewStreamHandler(deps Deps) *StreamHandler {
+	replay := deps.StreamReplay
+	if replay == nil && deps.DB != nil {
+		replay = stream.NewMongoReplayer(deps.DB.Collection("feedback"), deps.Keyring)
+	}
+	return &StreamHandler{hub: deps.Stream, replay: replay}
+}
+
+// localStream returns the hub the submit path publishes to: none when the
+// hub is fed by a change stream, which sees this replica's inserts too.
+func localStream(deps Deps) *stream.Hub {
+	if deps.StreamFromChanges {
+		return nil
+	}
+	return deps.Stream
+}
+
+// Stream sends new feedback as Server-Sent Events named "feedback", with the
+// webhook payload as data and the feedback ID as event ID. Optional query
+// parameters app, app_version, platform, locale and nps_category filter the
+// events. A client reconnecting with Last-Event-ID first gets the stored
+// feedback it missed. Quarantined feedback is never sent, and comments and
+// free-text answers only to callers with the read scope.
+func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if h.hub == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"error": "live stream is disabled",
+		})
+		return
+	}
+	f, err := parseStreamFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	var after bson.ObjectID
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if after, err = bson.ObjectIDFromHex(id); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid Last-Event-ID",
+			})
+			return
+		}
+	}
+
+	// Subscribe before replaying so that nothing inserted in between is
+	// missed; events seen in both are sent once.
+	sub, err := h.hub.Subscribe(f)
+	if err != nil {
+		if errors.Is(err, stream.ErrTooManySubscribers) {
+			w.Header().Set("Retry-After", "30")
+		}
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// From here on the status is sent; a failed write means the client is
+	// gone.
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...any) error {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	// Events are shared with other subscribers, so text is stripped from a
+	// copy.
+	readScope := middleware.HasReadScope(r.Context())
+	send := func(fb *model.Feedback) error {
+		if !readScope {
+			c := *fb
+			c.StripText()
+			fb = &c
+		}
+		data, err := json.Marshal(webhook.NewFeedbackPayload(fb))
+		if err != nil {
+			return err
+		}
+		return write("id: %s\nevent: feedback\ndata: %s\n\n", fb.ID.Hex(), data)
+	}
+
+	if err := write("retry: %d\n\n", streamRetry); err != nil {
+		return
+	}
+	var replayed map[bson.ObjectID]bool
+	if !after.IsZero() && h.replay != nil {
+		replayed = map[bson.ObjectID]bool{}
+		for len(replayed) < streamReplayLimit {
+			page, err := h.replay.After(r.Context(), after, f, streamReplayBatch)
+			if err != nil {
+				slog.Error("failed to replay feedback stream", "error", err)
+				return
+			}
+			for _, fb := range page {
+				if err := send(fb); err != nil {
+					return
+				}
+				replayed[fb.ID] = true
+				after = fb.ID
+			}
+			if len(page) < streamReplayBatch {
+				break
+			}
+		}
+		if len(replayed) >= streamReplayLimit {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case fb, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind, or shutting down.
+				return
+			}
+			if replayed[fb.ID] {
+				continue
+			}
+			if err := send(fb); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := write(": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func parseStreamFilter(r *http.Request) (stream.Filter, error) {
+	sf, err := parseFeedbackFilter(r)
+	if err != nil {
+		return stream.Filter{}, err
+	}
+	if !sf.From.IsZero() || !sf.To.IsZero() {
+		return stream.Filter{}, errors.New("from and to are not supported on the stream")
+	}
+	f := stream.Filter{
+		App:        sf.App,
+		AppVersion: sf.AppVersion,
+		Platform:   sf.Platform,
+		Locale:     sf.Locale,
+		Category:   r.URL.Query().Get("nps_category"),
+	}
+	switch f.Category {
+	case "", "promoter", "passive", "detractor":
+	default:
+		return f, fmt.Errorf("invalid nps_category %q", f.Category)
+	}
+	return f, nil
+}
@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/survey"
+)
+
+// surveyCacheTTL is how long survey rules are cached per app. Rule changes
+// made through another replica reach clients within this time.
+const surveyCacheTTL = time.Minute
+
+// SurveyHandler serves the survey config clients use to decide when to show
+// the NPS prompt and the survey definitions they render, and the admin
+// endpoints that manage both.
+type SurveyHandler struct {
+	service *survey.Service
+	catalog *survey.Catalog
+}
+
+// NewSurveyHandler creates a handler from the given dependencies.
+func NewSurveyHandler(deps Deps) *SurveyHandler {
+	rules := deps.SurveyRules
+	if rules == nil && deps.DB != nil {
+		rules = survey.NewMongo(deps.DB.Collection(survey.Collection))
+	}
+	var service *survey.Service
+	if rules != nil {
+		service = survey.NewService(rules, surveyCacheTTL)
+	}
+	var catalog *survey.Catalog
+	if defs := surveyDefinitions(deps); defs != nil {
+		catalog = survey.NewCatalog(defs)
+	}
+	return &SurveyHandler{service: service, catalog: catalog}
+}
+
+// surveyDefinitions returns the configured definition store, falling back
+// to MongoDB.
+func surveyDefinitions(deps Deps) survey.Definitions {
+	if deps.SurveyDefinitions != nil {
+		return deps.SurveyDefinitions
+	}
+	if deps.DB != nil {
+		return survey.NewMongoDefinitions(deps.DB.Collection(survey.DefinitionCollection))
+	}
+	return nil
+}
+
+// Config tells a client whether to show the prompt and with which texts.
+// app is required; platform and app_version select targeted rules, and the
+// install ID (install_id or the X-Install-ID header) picks the sampling
+// bucket. The texts are in the language asked for by ?locale=, or else by
+// Accept-Language.
+func (h *SurveyHandler) Config(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := survey.Request{
+		App:        q.Get("app"),
+		Platform:   q.Get("platform"),
+		AppVersion: q.Get("app_version"),
+		InstallID:  q.Get("install_id"),
+		Locales:    requestLocales(r),
+	}
+	if req.InstallID == "" {
+		req.InstallID = r.Header.Get("X-Install-ID")
+	}
+	if req.App == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "app is required",
+		})
+		return
+	}
+	if utf8.RuneCountInString(req.InstallID) > model.MaxInstallIDLength {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "install_id is too long",
+		})
+		return
+	}
+
+	cfg, err := h.service.Config(r.Context(), req)
+	if err != nil {
+		slog.Error("failed to load survey rules", "app", req.App, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to load survey config",
+		})
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Add("Vary", "Accept-Language")
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+// ListRules returns all survey rules, or only those for ?app=.
+func (h *SurveyHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.service.Rules().List(r.Context(), r.URL.Query().Get("app"))
+	if err != nil {
+		slog.Error("failed to list survey rules", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to list survey rules",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": rules,
+	})
+}
+
+// CreateRule stores a new survey rule and returns it with its ID.
+func (h *SurveyHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := decodeRule(w, r)
+	if !ok {
+		return
+	}
+	rule.ID = bson.ObjectID{}
+	h.putRule(w, r, &rule, http.StatusCreated)
+}
+
+// UpdateRule replaces the survey rule {id}.
+func (h *SurveyHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseObjectID(w, r)
+	if !ok {
+		return
+	}
+	rule, ok := decodeRule(w, r)
+	if !ok {
+		return
+	}
+	rule.ID = id
+	h.putRule(w, r, &rule, http.StatusOK)
+}
+
+func (h *SurveyHandler) putRule(w http.ResponseWriter, r *http.Request, rule *survey.Rule, status int) {
+	err := h.service.Rules().Put(r.Context(), rule)
+	if errors.Is(err, survey.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "survey rule not found",
+		})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to save survey rule", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to save survey rule",
+		})
+		return
+	}
+	h.service.InvalidateAll()
+	slog.Info("survey rule saved", "id", rule.ID.Hex(), "app", rule.App)
+	writeJSON(w, status, rule)
+}
+
+// DeleteRule removes the survey rule {id}.
+func (h *SurveyHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseObjectID(w, r)
+	if !ok {
+		return
+	}
+	err := h.service.Rules().Delete(r.Context(), id)
+	if errors.Is(err, survey.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "survey rule not found",
+		})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to delete survey rule", "id", id.Hex(), "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to delete survey rule",
+		})
+		return
+	}
+	h.service.InvalidateAll()
+	slog.Info("survey rule deleted", "id", id.Hex())
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "deleted",
+	})
+}
+
+func decodeRule(w http.ResponseWriter, r *http.Request) (survey.Rule, bool) {
+	var rule survey.Rule
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON payload",
+		})
+		return rule, false
+	}
+	if err := rule.Validate(); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return rule, false
+	}
+	return rule, true
+}
+
+// GetDefinition returns the latest version of survey {survey_id}, or the one
+// given by ?version=, with every locale's texts. With ?locale= the texts are
+// resolved to that language instead, falling back to English.
+func (h *SurveyHandler) GetDefinition(w http.ResponseWriter, r *http.Request) {
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "version must be a positive integer",
+			})
+			return
+		}
+		version = n
+	}
+
+	d, err := h.catalog.Get(r.Context(), r.PathValue("survey_id"), version)
+	if errors.Is(err, survey.ErrDefinitionNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "survey not found",
+		})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to load survey definition", "survey_id", r.PathValue("survey_id"), "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to load survey",
+		})
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		writeJSON(w, http.StatusOK, d.Localize([]string{i18n.Normalize(locale)}))
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// ListDefinitions returns the latest version of every survey.
+func (h *SurveyHandler) ListDefinitions(w http.ResponseWriter, r *http.Request) {
+	defs, err := h.catalog.Definitions().List(r.Context())
+	if err != nil {
+		slog.Error("failed to list survey definitions", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to list surveys",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": defs,
+	})
+}
+
+// PublishDefinition stores the posted definition as the next version of its
+// survey and returns it with the assigned version. Earlier versions stay
+// valid for submissions that reference them.
+func (h *SurveyHandler) PublishDefinition(w http.ResponseWriter, r *http.Request) {
+	var d survey.Definition
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&d); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON payload",
+		})
+		return
+	}
+	if err := d.Validate(); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.catalog.Definitions().Publish(r.Context(), &d); err != nil {
+		slog.Error("failed to publish survey definition", "survey_id", d.ID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to publish survey",
+		})
+		return
+	}
+	slog.Info("survey definition published", "survey_id", d.ID, "version", d.Version)
+	writeJSON(w, http.StatusCreated, d)
+}
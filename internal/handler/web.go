@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/widget"
+)
+
+// maxWebBody caps browser submissions, which carry no survey answers.
+const maxWebBody = 16 << 10
+
+// WebHandler serves the website widget, its no-JavaScript form fallback and
+// the browser submission endpoint. These routes sit outside /nps/api, since
+// a key in a public web page would be no secret and a plain form cannot send
+// one; middleware.CORS limits them to the allowed origins instead, and only
+// the apps in apps are accepted.
+type WebHandler struct {
+	feedback *FeedbackHandler
+	enabled  bool
+	origins  []string
+	apps     []string
+}
+
+// NewWebHandler creates a handler from the given dependencies.
+func NewWebHandler(deps Deps) *WebHandler {
+	return &WebHandler{
+		feedback: NewFeedbackHandler(deps),
+		enabled:  deps.WebWidget,
+		origins:  deps.WebOrigins,
+		apps:     deps.WebApps,
+	}
+}
+
+// check writes 501 and returns false when the widget is disabled.
+func (h *WebHandler) check(w http.ResponseWriter) bool {
+	if !h.enabled {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"error": "web widget is disabled",
+		})
+		return false
+	}
+	return true
+}
+
+// checkApp writes 403 and returns false when app may not take feedback from
+// browsers.
+func (h *WebHandler) checkApp(w http.ResponseWriter, app string) bool {
+	if !slices.Contains(h.apps, app) {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error": "app not allowed",
+		})
+		return false
+	}
+	return true
+}
+
+// Script serves the widget script.
+func (h *WebHandler) Script(w http.ResponseWriter, r *http.Request) {
+	if !h.check(w) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "widget.js", time.Time{}, bytes.NewReader(widget.Script()))
+}
+
+// Form serves the fallback form for ?app=, which must be a web app, and
+// optional ?app_version= and ?locale=. Sites link to it or frame it inside
+// <noscript>.
+func (h *WebHandler) Form(w http.ResponseWriter, r *http.Request) {
+	if !h.check(w) {
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("app") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "app is required",
+		})
+		return
+	}
+	if !h.checkApp(w, q.Get("app")) {
+		return
+	}
+	h.renderForm(w, http.StatusOK, widget.Form{
+		App:        q.Get("app"),
+		AppVersion: q.Get("app_version"),
+		Locale:     webLocale(q.Get("locale")),
+	})
+}
+
+// Submit accepts feedback from a browser, as JSON from the widget or as
+// application/x-www-form-urlencoded from the fallback form, for the web apps
+// only. The server sets
+// the platform to Web and derives the category from the rating; the
+// timestamp and schema version default to now and 1.3. JSON requests get
+// the responses of the feedback endpoint; form posts get an HTML page.
+func (h *WebHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	if !h.check(w) {
+		return
+	}
+	idem, ok := idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxWebBody)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isForm := mediaType == "application/x-www-form-urlencoded"
+	// Browsers may rate 0, so a missing rating is told apart by Rating.
+	var body struct {
+		model.Feedback
+		Rating *int `json:"nps_rating"`
+	}
+	fb := &body.Feedback
+	if isForm {
+		if err := r.ParseForm(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid form body",
+			})
+			return
+		}
+		fb.App = r.PostForm.Get("app")
+		fb.AppVersion = r.PostForm.Get("app_version")
+		if n, err := strconv.Atoi(r.PostForm.Get("nps_rating")); err == nil {
+			body.Rating = &n
+		}
+		fb.Comment = strings.TrimSpace(r.PostForm.Get("comment"))
+		fb.Locale = r.PostForm.Get("locale")
+	} else if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeLocalizedError(w, r, http.StatusBadRequest, "", i18n.NewMessage(i18n.CodeInvalidJSON))
+		return
+	}
+	if !h.checkApp(w, fb.App) {
+		return
+	}
+
+	if body.Rating != nil {
+		fb.NPSRating = *body.Rating
+	}
+	fb.Platform = model.PlatformWeb
+	fb.NPSCategory = model.CategoryForRating(fb.NPSRating)
+	fb.Locale = webLocale(fb.Locale)
+	if fb.SchemaVersion == "" {
+		fb.SchemaVersion = model.SchemaV1_3
+	}
+	if fb.Timestamp == "" {
+		fb.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	// The allowlist is for platforms clients claim; Web is set here.
+	var err error
+	if body.Rating == nil {
+		err = model.NewValidationError("nps_rating", i18n.CodeRequired, "nps_rating")
+	} else {
+		err = fb.ValidateWeb()
+	}
+	if err != nil {
+		if !isForm {
+			writeValidationError(w, r, err)
+			return
+		}
+		var verr *model.ValidationError
+		msg := err.Error()
+		if errors.As(err, &verr) {
+			msg = verr.In(i18n.Negotiate(r.Header.Get("Accept-Language")))
+		}
+		h.renderForm(w, http.StatusUnprocessableEntity, widget.Form{
+			App: fb.App, AppVersion: fb.AppVersion, Locale: fb.Locale,
+			Rating: body.Rating, Comment: fb.Comment, Error: msg,
+		})
+		return
+	}
+	if !h.feedback.accept(w, r, fb, idem) {
+		return
+	}
+
+	if !isForm {
+		writeJSON(w, http.StatusCreated, map[string]string{
+			"status": "ok",
+		})
+		return
+	}
+	h.setPageHeaders(w)
+	w.WriteHeader(http.StatusCreated)
+	if err := widget.RenderThanks(w); err != nil {
+		slog.Error("failed to render feedback form", "error", err)
+	}
+}
+
+func (h *WebHandler) renderForm(w http.ResponseWriter, status int, f widget.Form) {
+	f.Action = "feedback"
+	if f.AppVersion == "" {
+		f.AppVersion = "web"
+	}
+	h.setPageHeaders(w)
+	w.WriteHeader(status)
+	if err := widget.RenderForm(w, f); err != nil {
+		slog.Error("failed to render feedback form", "error", err)
+	}
+}
+
+// setPageHeaders lets the form pages be framed by the allowed origins only.
+func (h *WebHandler) setPageHeaders(w http.ResponseWriter) {
+	ancestors := strings.Join(append([]string{"'self'"}, h.origins...), " ")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; "+
+		"form-action 'self'; base-uri 'none'; frame-ancestors "+ancestors)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// webLocale returns a browser's language tag in canonical form, or "" when
+// it is not a valid tag. Browsers send tags such as en-us or x-klingon that
+// the feedback endpoint would reject.
+func webLocale(tag string) string {
+	tag = i18n.Normalize(tag)
+	if !i18n.ValidTag(tag) {
+		return ""
+	}
+	return tag
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/webhook"
+)
+
+// WebhookHandler serves the admin endpoints that manage webhook
+// subscriptions and inspect their deliveries.
+type WebhookHandler struct {
+	notifier *webhook.Notifier
+}
+
+// NewWebhookHandler creates a handler from the given dependencies.
+func NewWebhookHandler(deps Deps) *WebhookHandler {
+	return &WebhookHandler{notifier: deps.Webhooks}
+}
+
+// enabled writes 501 and returns false when webhooks are not configured.
+func (h *WebhookHandler) enabled(w http.ResponseWriter) bool {
+	if h.notifier == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{
+			"error": "webhooks are disabled",
+		})
+		return false
+	}
+	return true
+}
+
+// ListSubscriptions returns all webhook subscriptions without their secrets.
+func (h *WebhookHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+	subs, err := h.notifier.Subscriptions().List(r.Context())
+	if err != nil {
+		slog.Error("failed to list webhook subscriptions", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to list webhook subscriptions",
+		})
+		return
+	}
+	items := make([]webhook.Subscription, len(subs))
+	for i, s := range subs {
+		items[i] = s.Redacted()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+	})
+}
+
+// CreateSubscription stores a new subscription. Without a secret in the
+// request one is generated; the response is the only place it is shown.
+func (h *WebhookHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+	sub, ok := decodeSubscription(w, r)
+	if !ok {
+		return
+	}
+	sub.ID = bson.ObjectID{}
+	if sub.Secret == "" {
+		sub.Secret = webhook.NewSecret()
+	}
+	if !h.putSubscription(w, r, &sub) {
+		return
+	}
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// UpdateSubscription replaces the subscription {id}. An empty secret keeps
+// the current one.
+func (h *WebhookHandler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+	id, ok := parseObjectID(w, r)
+	if !ok {
+		return
+	}
+	sub, ok := decodeSubscription(w, r)
+	if !ok {
+		return
+	}
+	current, err := h.notifier.Subscriptions().Get(r.Context(), id)
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "webhook subscription not found",
+		})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to load webhook subscription", "id", id.Hex(), "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to save webhook subscription",
+		})
+		return
+	}
+	sub.ID, sub.CreatedAt = id, current.CreatedAt
+	if sub.Secret == "" {
+		sub.Secret = current.Secret
+	}
+	if !h.putSubscription(w, r, &sub) {
+		return
+	}
+	writeJSON(w, http.StatusOK, sub.Redacted())
+}
+
+func (h *WebhookHandler) putSubscription(w http.ResponseWriter, r *http.Request, sub *webhook.Subscription) bool {
+	err := h.notifier.Subscriptions().Put(r.Context(), sub)
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "webhook subscription not found",
+		})
+		return false
+	}
+	if err != nil {
+		slog.Error("failed to save webhook subscription", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to save webhook subscription",
+		})
+		return false
+	}
+	h.notifier.InvalidateAll()
+	slog.Info("webhook subscription saved", "id", sub.ID.Hex(), "enabled", sub.Enabled)
+	return true
+}
+
+// DeleteSubscription removes the subscription {id}. Its pending deliveries
+// are dead-lettered when the dispatcher next picks them up.
+func (h *WebhookHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+	id, ok := parseObjectID(w, r)
+	if !ok {
+		return
+	}
+	err := h.notifier.Subscriptions().Delete(r.Context(), id)
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "webhook subscription not found",
+		})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to delete webhook subscription", "id", id.Hex(), "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to delete webhook subscription",
+		})
+		return
+	}
+	h.notifier.InvalidateAll()
+	slog.Info("webhook subscription deleted", "id", id.Hex())
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "deleted",
+	})
+}
+
+// ListDeliveries returns the delivery log, newest first. Filter with
+// ?subscription_id= and ?status= (pending, delivered or dead); pass ?limit=N
+// (default 50, max 500).
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+	params := r.URL.Query()
+	q := webhook.DeliveryQuery{Status: params.Get("status"), Limit: 50}
+	if n, err := strconv.ParseInt(params.Get("limit"), 10, 64); err == nil && n > 0 {
+		q.Limit = min(n, 500)
+	}
+	if raw := params.Get("subscription_id"); raw != "" {
+		id, err := bson.ObjectIDFromHex(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid subscription_id",
+			})
+			return
+		}
+		q.SubscriptionID = id
+	}
+	if q.Status != "" && !slices.Contains([]string{webhook.StatusPending, webhook.StatusDelivered, webhook.StatusDead}, q.Status) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "status must be pending, delivered or dead",
+		})
+		return
+	}
+
+	ds, err := h.notifier.Deliveries().List(r.Context(), q)
+	if err != nil {
+		slog.Error("failed to list webhook deliveries", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to list webhook deliveries",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": ds,
+	})
+}
+
+// Redeliver queues the delivery {id} again with a fresh set of attempts,
+// whatever its state. Use it to replay dead letters once the endpoint is
+// fixed, or to resend a delivered event.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+	id, ok := parseObjectID(w, r)
+	if !ok {
+		return
+	}
+	d, err := h.notifier.Deliveries().Redeliver(r.Context(), id, time.Now().UTC())
+	if errors.Is(err, webhook.ErrDeliveryNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "webhook delivery not found",
+		})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to redeliver webhook delivery", "id", id.Hex(), "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to redeliver webhook delivery",
+		})
+		return
+	}
+	h.notifier.Poke()
+	slog.Info("webhook delivery requeued", "id", id.Hex())
+	writeJSON(w, http.StatusAccepted, d)
+}
+
+func decodeSubscription(w http.ResponseWriter, r *http.Request) (webhook.Subscription, bool) {
+	var sub webhook.Subscription
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sub); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid JSON payload",
+		})
+		return sub, false
+	}
+	if err := sub.Validate(); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+		return sub, false
+	}
+	return sub, true
+}
@@ -0,0 +1,139 @@
+package i18n
+
+import "fmt"
+
+// Message codes. Clients receive them alongside the localized text, so
+// they are part of the API and must not change.
+const (
+	CodeInvalidJSON              = "invalid_json"
+	CodeInvalidHeader            = "invalid_header"
+	CodeUnsupportedSchemaVersion = "unsupported_schema_version"
+	CodeRequiresSchema           = "requires_schema"
+	CodeRequired                 = "required"
+	CodeTooLong                  = "too_long"
+	CodeTooMany                  = "too_many"
+	CodeInvalidValue             = "invalid_value"
+	CodeOutOfRange               = "out_of_range"
+	CodeMinValue                 = "min_value"
+	CodeUnknownSurvey            = "unknown_survey"
+	CodeUnknownQuestion          = "unknown_question"
+	CodeDuplicateAnswer          = "duplicate_answer"
+	CodeQuestionRequired         = "question_required"
+	CodeAnswerNeedsRating        = "answer_needs_rating"
+	CodeAnswerNeedsChoices       = "answer_needs_choices"
+	CodeAnswerNeedsText          = "answer_needs_text"
+	CodeSingleChoice             = "single_choice"
+	CodeRatingRange              = "rating_range"
+	CodeUnknownChoice            = "unknown_choice"
+	CodeDuplicateChoice          = "duplicate_choice"
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+)
+
+// catalog holds the message formats per locale. Every locale must define
+// every code with the same verbs in the same order; catalog_test.go checks
+// this.
+var catalog = map[string]map[string]string{
+	English: {
+		CodeInvalidJSON:              "invalid JSON payload",
+		CodeInvalidHeader:            "invalid %s header",
+		CodeUnsupportedSchemaVersion: "unsupported schema_version: %q",
+		CodeRequiresSchema:           "%s requires schema_version %q",
+		CodeRequired:                 "%s is required",
+		CodeTooLong:                  "%s exceeds %d characters",
+		CodeTooMany:                  "%s exceed %d entries",
+		CodeInvalidValue:             "invalid %s: %q",
+		CodeOutOfRange:               "%s must be between %d and %d",
+		CodeMinValue:                 "%s must be at least %d",
+		CodeUnknownSurvey:            "unknown survey %q version %d",
+		CodeUnknownQuestion:          "unknown question %q",
+		CodeDuplicateAnswer:          "question %q is answered more than once",
+		CodeQuestionRequired:         "question %q is required",
+		CodeAnswerNeedsRating:        "answer to %q must contain only a rating",
+		CodeAnswerNeedsChoices:       "answer to %q must contain only choices",
+		CodeAnswerNeedsText:          "answer to %q must contain only text",
+		CodeSingleChoice:             "answer to %q must contain exactly one choice",
+		CodeRatingRange:              "answer to %q must be between 1 and %d",
+		CodeUnknownChoice:            "answer to %q has unknown choice %q",
+		CodeDuplicateChoice:          "answer to %q repeats choice %q",
+		CodeIdempotencyKeyReused:     "Idempotency-Key was already used for a different request",
+	},
+	Finnish: {
+		CodeInvalidJSON:              "virheellinen JSON-sisältö",
+		CodeInvalidHeader:            "virheellinen %s-otsake",
+		CodeUnsupportedSchemaVersion: "schema_version-arvoa %q ei tueta",
+		CodeRequiresSchema:           "%s vaatii schema_version-arvon %q",
+		CodeRequired:                 "%s on pakollinen",
+		CodeTooLong:                  "%s ylittää %d merkkiä",
+		CodeTooMany:                  "%s: enintään %d kohdetta",
+		CodeInvalidValue:             "virheellinen %s: %q",
+		CodeOutOfRange:               "%s on oltava välillä %d–%d",
+		CodeMinValue:                 "%s on oltava vähintään %d",
+		CodeUnknownSurvey:            "tuntematon kysely %q, versio %d",
+		CodeUnknownQuestion:          "tuntematon kysymys %q",
+		CodeDuplicateAnswer:          "kysymykseen %q on vastattu useammin kuin kerran",
+		CodeQuestionRequired:         "kysymykseen %q on vastattava",
+		CodeAnswerNeedsRating:        "vastauksessa kysymykseen %q saa olla vain arvosana",
+		CodeAnswerNeedsChoices:       "vastauksessa kysymykseen %q saa olla vain vaihtoehtoja",
+		CodeAnswerNeedsText:          "vastauksessa kysymykseen %q saa olla vain tekstiä",
+		CodeSingleChoice:             "vastauksessa kysymykseen %q on oltava täsmälleen yksi vaihtoehto",
+		CodeRatingRange:              "vastauksen kysymykseen %q on oltava välillä 1–%d",
+		CodeUnknownChoice:            "vastauksessa kysymykseen %q on tuntematon vaihtoehto %q",
+		CodeDuplicateChoice:          "vastauksessa kysymykseen %q vaihtoehto %q toistuu",
+		CodeIdempotencyKeyReused:     "Idempotency-Key on jo käytetty toiseen pyyntöön",
+	},
+	Swedish: {
+		CodeInvalidJSON:              "ogiltig JSON-data",
+		CodeInvalidHeader:            "ogiltig %s-header",
+		CodeUnsupportedSchemaVersion: "schema_version %q stöds inte",
+		CodeRequiresSchema:           "%s kräver schema_version %q",
+		CodeRequired:                 "%s är obligatoriskt",
+		CodeTooLong:                  "%s överskrider %d tecken",
+		CodeTooMany:                  "%s: högst %d poster",
+		CodeInvalidValue:             "ogiltigt värde för %s: %q",
+		CodeOutOfRange:               "%s måste vara mellan %d och %d",
+		CodeMinValue:                 "%s måste vara minst %d",
+		CodeUnknownSurvey:            "okänd enkät %q version %d",
+		CodeUnknownQuestion:          "okänd fråga %q",
+		CodeDuplicateAnswer:          "frågan %q besvaras mer än en gång",
+		CodeQuestionRequired:         "frågan %q måste besvaras",
+		CodeAnswerNeedsRating:        "svaret på %q får bara innehålla ett betyg",
+		CodeAnswerNeedsChoices:       "svaret på %q får bara innehålla alternativ",
+		CodeAnswerNeedsText:          "svaret på %q får bara innehålla text",
+		CodeSingleChoice:             "svaret på %q måste innehålla exakt ett alternativ",
+		CodeRatingRange:              "svaret på %q måste vara mellan 1 och %d",
+		CodeUnknownChoice:            "svaret på %q har ett okänt alternativ %q",
+		CodeDuplicateChoice:          "svaret på %q upprepar alternativet %q",
+		CodeIdempotencyKeyReused:     "Idempotency-Key har redan använts för en annan begäran",
+	},
+}
+
+// Message is a catalog message with its arguments, rendered on demand in
+// the reader's locale.
+type Message struct {
+	Code string
+	Args []any
+}
+
+// NewMessage returns the message code with args.
+func NewMessage(code string, args ...any) Message {
+	return Message{Code: code, Args: args}
+}
+
+// In renders m in locale, falling back like Match and finally to the code
+// itself for an unknown code.
+func (m Message) In(locale string) string {
+	for _, tag := range parents(locale) {
+		if format, ok := catalog[tag][m.Code]; ok {
+			return fmt.Sprintf(format, m.Args...)
+		}
+	}
+	if format, ok := catalog[Default][m.Code]; ok {
+		return fmt.Sprintf(format, m.Args...)
+	}
+	return m.Code
+}
+
+// String renders m in Default.
+func (m Message) String() string {
+	return m.In(Default)
+}
@@ -0,0 +1,148 @@
+// Package i18n localizes the texts the service returns to end users:
+// validation messages from a built-in catalog, and locale-keyed texts such as
+// survey prompts. Locales are language tags like fi or sv-FI. A lookup tries
+// the client's preferred tags in order, each followed by its parents (sv-FI,
+// then sv), and ends with Default.
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Catalog locales.
+const (
+	English = "en"
+	Finnish = "fi"
+	Swedish = "sv"
+
+	// Default is the locale used when nothing better matches. Every
+	// catalog message and every localized text must exist in it.
+	Default = English
+)
+
+// Supported lists the locales the message catalog covers.
+var Supported = []string{English, Finnish, Swedish}
+
+// MaxTagLength bounds a language tag.
+const MaxTagLength = 35
+
+var tagPattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// ValidTag reports whether tag is a language tag of the accepted form: a
+// lowercase two- or three-letter language, optionally followed by subtags
+// such as a region (fi, sv-FI, zh-Hant-TW). Stored tags should also be in
+// Normalize's canonical form, since lookups are case-sensitive.
+func ValidTag(tag string) bool {
+	return len(tag) <= MaxTagLength && tagPattern.MatchString(tag)
+}
+
+// Normalize converts a tag to canonical form: an underscore becomes a dash,
+// the language is lowercased, regions uppercased and scripts titlecased, so
+// "SV_fi" becomes "sv-FI". It does not validate.
+func Normalize(tag string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+	for i, p := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(p)
+		case len(p) == 2:
+			parts[i] = strings.ToUpper(p)
+		case len(p) == 4:
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		default:
+			parts[i] = strings.ToLower(p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// parents returns tag and its ancestors: "sv-FI" gives [sv-FI sv].
+func parents(tag string) []string {
+	var chain []string
+	for tag != "" {
+		chain = append(chain, tag)
+		i := strings.LastIndexByte(tag, '-')
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	return chain
+}
+
+// ParseAcceptLanguage returns the tags of an Accept-Language header in
+// order of preference. Wildcards, malformed entries and entries with q=0 are
+// skipped.
+func ParseAcceptLanguage(header string) []string {
+	type pref struct {
+		tag string
+		q   float64
+	}
+	var prefs []pref
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = Normalize(tag)
+		if tag == "*" || !ValidTag(tag) {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if ok && k == "q" {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, pref{tag, q})
+		}
+	}
+	// Stable, so equal weights keep the client's order.
+	slices.SortStableFunc(prefs, func(a, b pref) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+	tags := make([]string, len(prefs))
+	for i, p := range prefs {
+		tags[i] = p.tag
+	}
+	return tags
+}
+
+// Match returns the first of the preferred tags, or one of their parents,
+// for which available reports true. Each preference's chain is tried before
+// the next preference, so "sv-FI, en" prefers sv over en. It returns Default
+// when none matches.
+func Match(prefs []string, available func(tag string) bool) string {
+	for _, p := range prefs {
+		for _, tag := range parents(p) {
+			if available(tag) {
+				return tag
+			}
+		}
+	}
+	return Default
+}
+
+// Negotiate picks the catalog locale for an Accept-Language header.
+func Negotiate(acceptLanguage string) string {
+	return Match(ParseAcceptLanguage(acceptLanguage), func(tag string) bool {
+		return slices.Contains(Supported, tag)
+	})
+}
+
+// Pick returns the text for the preferred locales from texts keyed by
+// locale, following Match, along with the locale it was found under.
+func Pick(texts map[string]string, prefs []string) (text, locale string) {
+	locale = Match(prefs, func(tag string) bool { return texts[tag] != "" })
+	return texts[locale], locale
+}
@@ -0,0 +1,102 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+var verbPattern = regexp.MustCompile(`%[a-z]`)
+
+func TestCatalog_Complete(t *testing.T) {
+	for _, locale := range Supported {
+		if len(catalog[locale]) != len(catalog[Default]) {
+			t.Errorf("%s has %d messages, %s has %d", locale, len(catalog[locale]), Default, len(catalog[Default]))
+		}
+	}
+	for code, format := range catalog[Default] {
+		want := verbPattern.FindAllString(format, -1)
+		for _, locale := range Supported {
+			got, ok := catalog[locale][code]
+			if !ok {
+				t.Errorf("%s is missing %s", locale, code)
+				continue
+			}
+			if verbs := verbPattern.FindAllString(got, -1); !slices.Equal(verbs, want) {
+				t.Errorf("%s %s has verbs %v, want %v", locale, code, verbs, want)
+			}
+		}
+	}
+}
+
+func TestMessage_In(t *testing.T) {
+	m := NewMessage(CodeRequired, "app")
+	for locale, want := range map[string]string{
+		"en":    "app is required",
+		"fi":    "app on pakollinen",
+		"sv-FI": "app är obligatoriskt",
+		"de":    "app is required",
+	} {
+		if got := m.In(locale); got != want {
+			t.Errorf("In(%q) = %q, want %q", locale, got, want)
+		}
+	}
+	if got := NewMessage("no_such_code").In(Finnish); got != "no_such_code" {
+		t.Errorf("unknown code rendered as %q", got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"FI":         "fi",
+		"sv_fi":      "sv-FI",
+		" en-gb ":    "en-GB",
+		"zh-hant-tw": "zh-Hant-TW",
+	} {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	got := ParseAcceptLanguage("en;q=0.5, sv-fi, *;q=0.1, de;q=0, fi;q=0.8, not a tag")
+	want := []string{"sv-FI", "fi", "en"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := ParseAcceptLanguage(""); len(got) != 0 {
+		t.Errorf("empty header gave %v", got)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for header, want := range map[string]string{
+		"sv-FI, en;q=0.5": "sv",
+		"de, fi;q=0.9":    "fi",
+		"de":              "en",
+		"":                "en",
+	} {
+		if got := Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	texts := map[string]string{"en": "Why?", "sv": "Varför?", "fi-FI": "Miksi?"}
+	for _, tc := range []struct {
+		prefs      []string
+		text, from string
+	}{
+		{[]string{"sv-FI"}, "Varför?", "sv"},
+		{[]string{"fi"}, "Why?", "en"},
+		{[]string{"fi-FI", "sv"}, "Miksi?", "fi-FI"},
+		{nil, "Why?", "en"},
+	} {
+		text, from := Pick(texts, tc.prefs)
+		if text != tc.text || from != tc.from {
+			t.Errorf("Pick(%v) = %q, %q; want %q, %q", tc.prefs, text, from, tc.text, tc.from)
+		}
+	}
+}
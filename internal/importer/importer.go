@@ -0,0 +1,333 @@
+package importer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// batchSize is how many rows are written per bulk write.
+const batchSize = 500
+
+// maxReportedErrors caps the per-row errors kept in a Report.
+const maxReportedErrors = 1000
+
+// Options control one import run.
+type Options struct {
+	// Format is csv or json; it overrides the mapping's format.
+	Format string
+	// Batch tags every imported document. A random ID is generated when
+	// empty.
+	Batch string
+	// DryRun validates and counts rows without writing anything.
+	DryRun bool
+}
+
+// RowError reports why a source row was not imported. Row is 1-based and
+// does not count the CSV header.
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Report summarizes an import. With DryRun set, Imported counts the rows that
+// would have been imported.
+type Report struct {
+	Batch           string     `json:"batch"`
+	DryRun          bool       `json:"dry_run"`
+	Rows            int        `json:"rows"`
+	Imported        int        `json:"imported"`
+	Duplicates      int        `json:"duplicates"`
+	Invalid         int        `json:"invalid"`
+	Errors          []RowError `json:"errors,omitempty"`
+	ErrorsTruncated bool       `json:"errors_truncated,omitempty"`
+}
+
+func (r *Report) rowError(row int, err error) {
+	r.Invalid++
+	if len(r.Errors) == maxReportedErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+	r.Errors = append(r.Errors, RowError{Row: row, Error: err.Error()})
+}
+
+// SourceError reports that the source file could not be read, as opposed to
+// a database failure.
+type SourceError struct {
+	Err error
+}
+
+func (e *SourceError) Error() string { return e.Err.Error() }
+
+func (e *SourceError) Unwrap() error { return e.Err }
+
+// Importer writes mapped rows into the feedback collection.
+type Importer struct {
+	feedback *mongo.Collection
+	daily    *mongo.Collection
+	protect  func(fb *model.Feedback) error
+}
+
+// New creates an Importer. protect is applied to every document before it is
+// stored and must redact and encrypt comments the same way live submissions
+// are. Imported rows are counted in the daily stats rollup.
+func New(feedback, daily *mongo.Collection, protect func(fb *model.Feedback) error) *Importer {
+	return &Importer{feedback: feedback, daily: daily, protect: protect}
+}
+
+// NewBatchID returns a batch ID of the form imp-YYYYMMDD-xxxxxxxx.
+func NewBatchID(now time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return "imp-" + now.UTC().Format("20060102") + "-" + hex.EncodeToString(b)
+}
+
+type pendingRow struct {
+	row int
+	fb  *model.Feedback
+}
+
+// Run imports every row from r. Row problems are collected in the report;
+// the returned error is only set when the import could not continue, in
+// which case rows written before the failure stay imported and a re-run
+// skips them.
+func (im *Importer) Run(ctx context.Context, r io.Reader, m *Mapping, opts Options) (Report, error) {
+	report := Report{Batch: opts.Batch, DryRun: opts.DryRun}
+	if report.Batch == "" {
+		report.Batch = NewBatchID(time.Now())
+	}
+	format := opts.Format
+	if format == "" {
+		format = m.Format
+	}
+
+	rows, err := newRowReader(format, r)
+	if err != nil {
+		return report, &SourceError{err}
+	}
+	if h, ok := rows.(interface{ columns() []string }); ok {
+		if err := m.checkHeader(h.columns()); err != nil {
+			return report, &SourceError{err}
+		}
+	}
+
+	seen := map[string]bool{}
+	var pending []pendingRow
+	for {
+		row, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		report.Rows++
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			report.rowError(report.Rows, err)
+			continue
+		}
+		if err != nil {
+			return report, &SourceError{err}
+		}
+
+		fb, err := m.feedback(row)
+		if err != nil {
+			report.rowError(report.Rows, err)
+			continue
+		}
+		if seen[fb.ImportKey] {
+			report.Duplicates++
+			continue
+		}
+		seen[fb.ImportKey] = true
+
+		fb.ImportBatch = report.Batch
+		pending = append(pending, pendingRow{row: report.Rows, fb: fb})
+		if len(pending) == batchSize {
+			if err := im.flush(ctx, pending, &report); err != nil {
+				return report, err
+			}
+			pending = pending[:0]
+		}
+	}
+	if err := im.flush(ctx, pending, &report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// flush writes a batch, or in a dry run counts how many are already stored.
+func (im *Importer) flush(ctx context.Context, batch []pendingRow, report *Report) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if report.DryRun {
+		return im.countExisting(ctx, batch, report)
+	}
+
+	models := make([]mongo.WriteModel, 0, len(batch))
+	for _, p := range batch {
+		if err := im.protect(p.fb); err != nil {
+			return fmt.Errorf("failed to redact or encrypt row %d: %w", p.row, err)
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "import_key", Value: p.fb.ImportKey}}).
+			SetUpdate(bson.D{{Key: "$setOnInsert", Value: p.fb}}).
+			SetUpsert(true))
+	}
+
+	res, err := im.feedback.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	failed := map[int]bool{}
+	if err != nil {
+		var bwe mongo.BulkWriteException
+		if !errors.As(err, &bwe) || bwe.WriteConcernError != nil {
+			return fmt.Errorf("failed to write import batch: %w", err)
+		}
+		for _, we := range bwe.WriteErrors {
+			failed[we.Index] = true
+			if we.Code == 11000 {
+				// A concurrent import of the same rows inserted it first.
+				report.Duplicates++
+			} else {
+				report.rowError(batch[we.Index].row, fmt.Errorf("write failed: %s", we.Message))
+			}
+		}
+	}
+
+	var upserted map[int64]any
+	if res != nil {
+		upserted = res.UpsertedIDs
+	}
+	var inserted []*model.Feedback
+	for i, p := range batch {
+		if failed[i] {
+			continue
+		}
+		if _, ok := upserted[int64(i)]; ok {
+			inserted = append(inserted, p.fb)
+		} else {
+			report.Duplicates++
+		}
+	}
+	report.Imported += len(inserted)
+	return stats.RecordMany(ctx, im.daily, inserted)
+}
+
+func (im *Importer) countExisting(ctx context.Context, batch []pendingRow, report *Report) error {
+	keys := make([]string, 0, len(batch))
+	for _, p := range batch {
+		keys = append(keys, p.fb.ImportKey)
+	}
+	n, err := im.feedback.CountDocuments(ctx, bson.D{{Key: "import_key", Value: bson.D{{Key: "$in", Value: keys}}}})
+	if err != nil {
+		return fmt.Errorf("failed to check for existing rows: %w", err)
+	}
+	report.Duplicates += int(n)
+	report.Imported += len(batch) - int(n)
+	return nil
+}
+
+// checkHeader verifies that every mapped and key column is present.
+func (m *Mapping) checkHeader(header []string) error {
+	var missing []string
+	for col := range m.Columns {
+		if !slices.Contains(header, col) {
+			missing = append(missing, col)
+		}
+	}
+	for _, col := range m.Key {
+		if !slices.Contains(header, col) && !slices.Contains(missing, col) {
+			missing = append(missing, col)
+		}
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return fmt.Errorf("CSV header is missing columns: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// feedback maps one source row to a validated feedback document with its
+// import key set.
+func (m *Mapping) feedback(row map[string]string) (*model.Feedback, error) {
+	values := map[string]string{"schema_version": model.SchemaV1_0}
+	for field, v := range m.Defaults {
+		values[field] = v
+	}
+	for col, field := range m.Columns {
+		if v := strings.TrimSpace(row[col]); v != "" {
+			values[field] = v
+		}
+	}
+
+	fb := &model.Feedback{
+		SchemaVersion: values["schema_version"],
+		App:           values["app"],
+		AppVersion:    values["app_version"],
+		Platform:      values["platform"],
+		NPSCategory:   values["nps_category"],
+		Timezone:      values["timezone"],
+		Comment:       values["comment"],
+		Locale:        i18n.Normalize(values["locale"]),
+	}
+
+	rating, err := strconv.Atoi(values["nps_rating"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid nps_rating %q", values["nps_rating"])
+	}
+	fb.NPSRating = rating
+	if m.DeriveCategory {
+		fb.NPSCategory = model.CategoryForRating(rating)
+	}
+
+	ts, err := time.Parse(m.TimestampLayout, values["timestamp"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q", values["timestamp"])
+	}
+	fb.Timestamp = ts.Format(time.RFC3339)
+	fb.ReceivedAt = ts.UTC()
+
+	if err := fb.Validate(); err != nil {
+		return nil, err
+	}
+
+	fb.ID = bson.NewObjectID()
+	fb.ImportKey = m.importKey(row)
+	return fb, nil
+}
+
+// importKey hashes the row's key columns, or all mapped columns, so the same
+// source row always yields the same key.
+func (m *Mapping) importKey(row map[string]string) string {
+	cols := m.Key
+	if len(cols) == 0 {
+		for col := range m.Columns {
+			cols = append(cols, col)
+		}
+		slices.Sort(cols)
+	}
+
+	h := sha256.New()
+	for _, col := range cols {
+		h.Write([]byte(col))
+		h.Write([]byte{0})
+		h.Write([]byte(strings.TrimSpace(row[col])))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,177 @@
+package importer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testMapping(t *testing.T, js string) *Mapping {
+	t.Helper()
+	m, err := ParseMapping(strings.NewReader(js))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+const legacyMapping = `{
+	"columns": {"Score": "nps_rating", "Submitted": "timestamp", "Feedback": "comment", "Version": "app_version"},
+	"defaults": {"app": "idefinity", "platform": "macOS"},
+	"derive_category": true,
+	"timestamp_layout": "2006-01-02 15:04",
+	"key": ["Response ID"]
+}`
+
+func TestParseMapping_Rejects(t *testing.T) {
+	for name, js := range map[string]string{
+		"unknown field":   `{"columns": {"Score": "nps_rating", "When": "timestamp", "X": "spam_score"}}`,
+		"duplicate field": `{"columns": {"Score": "nps_rating", "Rating": "nps_rating", "When": "timestamp"}}`,
+		"no rating":       `{"columns": {"When": "timestamp"}}`,
+		"bad format":      `{"format": "xlsx", "columns": {"Score": "nps_rating", "When": "timestamp"}}`,
+		"unknown option":  `{"columns": {"Score": "nps_rating", "When": "timestamp"}, "derive": true}`,
+	} {
+		if _, err := ParseMapping(strings.NewReader(js)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestMapping_Feedback(t *testing.T) {
+	m := testMapping(t, legacyMapping)
+	row := map[string]string{
+		"Response ID": "R-1001",
+		"Score":       " 9 ",
+		"Submitted":   "2021-05-04 13:37",
+		"Feedback":    "Love it",
+		"Version":     "1.4.2",
+	}
+
+	fb, err := m.feedback(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fb.NPSRating != 9 || fb.NPSCategory != "promoter" || fb.App != "idefinity" || fb.SchemaVersion != "1.0" {
+		t.Errorf("unexpected mapping %+v", fb)
+	}
+	if want := time.Date(2021, 5, 4, 13, 37, 0, 0, time.UTC); !fb.ReceivedAt.Equal(want) || fb.Timestamp != "2021-05-04T13:37:00Z" {
+		t.Errorf("expected received_at %s, got %s / %s", want, fb.ReceivedAt, fb.Timestamp)
+	}
+
+	again, _ := m.feedback(row)
+	if fb.ImportKey == "" || again.ImportKey != fb.ImportKey {
+		t.Error("expected a stable import key for the same row")
+	}
+	row["Response ID"] = "R-1002"
+	if other, _ := m.feedback(row); other.ImportKey == fb.ImportKey {
+		t.Error("expected a different key for a different response ID")
+	}
+
+	for name, bad := range map[string]map[string]string{
+		"rating out of range": {"Score": "0", "Submitted": "2021-05-04 13:37", "Version": "1"},
+		"bad rating":          {"Score": "nine", "Submitted": "2021-05-04 13:37", "Version": "1"},
+		"bad timestamp":       {"Score": "9", "Submitted": "May 4th", "Version": "1"},
+		"missing version":     {"Score": "9", "Submitted": "2021-05-04 13:37"},
+	} {
+		if _, err := m.feedback(bad); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestCSVRows(t *testing.T) {
+	src := "\ufeffResponse ID,Score\nR-1,9\nR-2\nR-3,\"7\"\n"
+	rows, err := newRowReader(FormatCSV, strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rows.(*csvRows).columns(); got[0] != "Response ID" {
+		t.Errorf("expected BOM stripped from header, got %q", got[0])
+	}
+
+	var got []string
+	var rowErrs int
+	for {
+		row, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var re *rowError
+		if errors.As(err, &re) {
+			rowErrs++
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row["Response ID"]+"="+row["Score"])
+	}
+	if strings.Join(got, ",") != "R-1=9,R-3=7" || rowErrs != 1 {
+		t.Errorf("unexpected rows %v with %d row errors", got, rowErrs)
+	}
+}
+
+func TestJSONRows(t *testing.T) {
+	src := `[{"Score": 9, "Submitted": "2021-05-04 13:37", "Tags": null}, {"Score": {"nested": 1}}, "oops", {"Score": 10}]`
+	rows, err := newRowReader(FormatJSON, strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scores []string
+	var rowErrs int
+	for {
+		row, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var re *rowError
+		if errors.As(err, &re) {
+			rowErrs++
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		scores = append(scores, row["Score"])
+	}
+	if strings.Join(scores, ",") != "9,10" || rowErrs != 2 {
+		t.Errorf("unexpected scores %v with %d row errors", scores, rowErrs)
+	}
+
+	if _, err := newRowReader(FormatJSON, strings.NewReader(`{"Score": 9}`)); err == nil {
+		t.Error("expected error for a non-array document")
+	}
+}
+
+func TestCheckHeader(t *testing.T) {
+	m := testMapping(t, legacyMapping)
+	err := m.checkHeader([]string{"Score", "Submitted", "Feedback"})
+	if err == nil || !strings.Contains(err.Error(), "Response ID, Version") {
+		t.Errorf("expected missing Response ID and Version, got %v", err)
+	}
+	if err := m.checkHeader([]string{"Response ID", "Score", "Submitted", "Feedback", "Version", "Extra"}); err != nil {
+		t.Errorf("expected header to pass, got %v", err)
+	}
+}
+
+func TestReport_CapsErrors(t *testing.T) {
+	var r Report
+	for i := range maxReportedErrors + 5 {
+		r.rowError(i+1, errors.New("bad"))
+	}
+	if r.Invalid != maxReportedErrors+5 || len(r.Errors) != maxReportedErrors || !r.ErrorsTruncated {
+		t.Errorf("unexpected report: invalid=%d errors=%d truncated=%v", r.Invalid, len(r.Errors), r.ErrorsTruncated)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	if f, err := DetectFormat("export-2021.CSV"); err != nil || f != FormatCSV {
+		t.Errorf("expected csv, got %q, %v", f, err)
+	}
+	if _, err := DetectFormat("export.xlsx"); err == nil {
+		t.Error("expected error for xlsx")
+	}
+}
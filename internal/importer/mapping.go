@@ -0,0 +1,123 @@
+// Package importer loads historical feedback from CSV or JSON files exported
+// by other survey tools. A mapping file says which source column feeds which
+// feedback field; every row is validated like a live submission, and rows
+// are keyed by a hash of their source values so re-running an import never
+// duplicates data.
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Source formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Fields that source columns can be mapped to.
+var fields = []string{
+	"schema_version", "app", "app_version", "platform", "timestamp",
+	"nps_rating", "nps_category", "timezone", "comment", "locale",
+}
+
+// Mapping describes how a source file maps onto feedback fields.
+type Mapping struct {
+	// Format is csv or json. When empty it is detected from the file name.
+	Format string `json:"format,omitempty"`
+	// Columns maps source column names (CSV header or JSON object keys) to
+	// feedback fields.
+	Columns map[string]string `json:"columns"`
+	// Defaults fills fields the source does not have, e.g. platform.
+	// schema_version defaults to 1.0.
+	Defaults map[string]string `json:"defaults,omitempty"`
+	// DeriveCategory sets nps_category from nps_rating, ignoring any mapped
+	// category.
+	DeriveCategory bool `json:"derive_category,omitempty"`
+	// TimestampLayout is the Go time layout of the timestamp column, used to
+	// set received_at. Defaults to RFC 3339.
+	TimestampLayout string `json:"timestamp_layout,omitempty"`
+	// Key lists source columns that uniquely identify a response, such as a
+	// response ID; they need not be mapped. When empty, all mapped columns
+	// are used.
+	Key []string `json:"key,omitempty"`
+}
+
+// LoadMapping reads a JSON mapping file.
+func LoadMapping(path string) (*Mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mapping file: %w", err)
+	}
+	defer f.Close()
+	return ParseMapping(f)
+}
+
+// ParseMapping decodes and checks a JSON mapping.
+func ParseMapping(r io.Reader) (*Mapping, error) {
+	var m Mapping
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid mapping: %w", err)
+	}
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *Mapping) check() error {
+	if m.Format != "" && m.Format != FormatCSV && m.Format != FormatJSON {
+		return fmt.Errorf("invalid mapping: format must be %s or %s", FormatCSV, FormatJSON)
+	}
+	if len(m.Columns) == 0 {
+		return fmt.Errorf("invalid mapping: columns is empty")
+	}
+	mapped := map[string]string{}
+	for col, field := range m.Columns {
+		if !slices.Contains(fields, field) {
+			return fmt.Errorf("invalid mapping: column %q maps to unknown field %q", col, field)
+		}
+		if other, ok := mapped[field]; ok {
+			return fmt.Errorf("invalid mapping: columns %q and %q both map to %s", other, col, field)
+		}
+		mapped[field] = col
+	}
+	for field := range m.Defaults {
+		if !slices.Contains(fields, field) {
+			return fmt.Errorf("invalid mapping: default for unknown field %q", field)
+		}
+	}
+	for _, field := range []string{"timestamp", "nps_rating"} {
+		if _, ok := mapped[field]; !ok {
+			return fmt.Errorf("invalid mapping: %s must be mapped", field)
+		}
+	}
+	if slices.Contains(m.Key, "") {
+		return fmt.Errorf("invalid mapping: empty key column")
+	}
+	if m.TimestampLayout == "" {
+		m.TimestampLayout = time.RFC3339
+	}
+	return nil
+}
+
+// DetectFormat returns the format for a file name, from its extension.
+func DetectFormat(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".json":
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("cannot detect format of %q: set format in the mapping", name)
+	}
+}
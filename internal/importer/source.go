@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// rowReader yields source rows as column name to value maps. Next returns
+// io.EOF after the last row. A *rowError is reported for the row and reading
+// continues; any other error aborts the import.
+type rowReader interface {
+	Next() (map[string]string, error)
+}
+
+// rowError is a problem confined to one source row.
+type rowError struct{ err error }
+
+func (e *rowError) Error() string { return e.err.Error() }
+
+func newRowReader(format string, r io.Reader) (rowReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVRows(r)
+	case FormatJSON:
+		return newJSONRows(r)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+type csvRows struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVRows(r io.Reader) (*csvRows, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	// Spreadsheet exports often start with a UTF-8 byte order mark.
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	return &csvRows{r: cr, header: header}, nil
+}
+
+func (c *csvRows) columns() []string {
+	return c.header
+}
+
+func (c *csvRows) Next() (map[string]string, error) {
+	rec, err := c.r.Read()
+	if errors.Is(err, csv.ErrFieldCount) {
+		return nil, &rowError{fmt.Errorf("expected %d fields, got %d", len(c.header), len(rec))}
+	}
+	if err != nil {
+		return nil, err
+	}
+	row := make(map[string]string, len(rec))
+	for i, v := range rec {
+		row[c.header[i]] = v
+	}
+	return row, nil
+}
+
+// jsonRows reads a JSON array of flat objects, one object at a time.
+type jsonRows struct {
+	dec *json.Decoder
+}
+
+func newJSONRows(r io.Reader) (*jsonRows, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return nil, fmt.Errorf("JSON import must be an array of objects")
+	}
+	return &jsonRows{dec: dec}, nil
+}
+
+func (j *jsonRows) Next() (map[string]string, error) {
+	if !j.dec.More() {
+		return nil, io.EOF
+	}
+	var obj map[string]any
+	if err := j.dec.Decode(&obj); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, &rowError{fmt.Errorf("expected an object, got %s", typeErr.Value)}
+		}
+		return nil, fmt.Errorf("failed to read JSON: %w", err)
+	}
+
+	row := make(map[string]string, len(obj))
+	for k, v := range obj {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			row[k] = v
+		case json.Number:
+			row[k] = v.String()
+		case bool:
+			row[k] = fmt.Sprint(v)
+		default:
+			return nil, &rowError{fmt.Errorf("field %q must be a string, number or boolean", k)}
+		}
+	}
+	return row, nil
+}
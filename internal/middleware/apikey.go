@@ -12,20 +12,31 @@ import (
 // open-endpoint behavior so existing deployments do not break on upgrade.
 // Constant-time comparison is used to avoid leaking key contents via timing.
 func APIKey(allowedKeys []string, requirePrefixes []string) func(http.Handler) http.Handler {
-	if len(allowedKeys) == 0 {
+	keys := normalizeKeys(allowedKeys)
+	if len(keys) == 0 {
 		return func(next http.Handler) http.Handler { return next }
 	}
+	return requireKey(keys, requirePrefixes)
+}
+
+// AdminKey is like APIKey but fails closed: if allowedKeys is empty, every
+// request under requirePrefixes is rejected. Admin routes can delete and
+// reveal stored feedback, so they must never be open by default.
+func AdminKey(allowedKeys []string, requirePrefixes []string) func(http.Handler) http.Handler {
+	return requireKey(normalizeKeys(allowedKeys), requirePrefixes)
+}
 
+func normalizeKeys(allowedKeys []string) [][]byte {
 	keys := make([][]byte, 0, len(allowedKeys))
 	for _, k := range allowedKeys {
 		if k = strings.TrimSpace(k); k != "" {
 			keys = append(keys, []byte(k))
 		}
 	}
-	if len(keys) == 0 {
-		return func(next http.Handler) http.Handler { return next }
-	}
+	return keys
+}
 
+func requireKey(keys [][]byte, requirePrefixes []string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if !pathMatchesAny(r.URL.Path, requirePrefixes) {
@@ -41,9 +52,7 @@ func APIKey(allowedKeys []string, requirePrefixes []string) func(http.Handler) h
 				}
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			_, _ = w.Write([]byte(`{"error":"unauthorized"}`))
+			writeError(w, http.StatusUnauthorized, "unauthorized")
 		})
 	}
 }
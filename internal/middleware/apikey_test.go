@@ -88,3 +88,70 @@ func TestAPIKey_BlankKeysIgnored(t *testing.T) {
 		t.Errorf("expected blank-only keys to act as no-op, got %d", w.Code)
 	}
 }
+
+func TestAdminKey_FailsClosedWithoutKeys(t *testing.T) {
+	h := AdminKey(nil, []string{"/nps/admin/"})(okHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/nps/admin/v1/quarantine", nil)
+	req.Header.Set("X-API-Key", "")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 when no admin keys configured, got %d", w.Code)
+	}
+}
+
+func TestAdminKey_AcceptsValidKeyAndSkipsOtherPaths(t *testing.T) {
+	h := AdminKey([]string{"root"}, []string{"/nps/admin/"})(okHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/nps/admin/v1/quarantine", nil)
+	req.Header.Set("X-API-Key", "root")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 with admin key, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected non-admin path to bypass admin auth, got %d", w.Code)
+	}
+}
+
+func TestReadScope(t *testing.T) {
+	var scoped bool
+	h := ReadScope([]string{"reader"}, []string{"/nps/api/v1/comments"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scoped = HasReadScope(r.Context())
+	}))
+	for _, tc := range []struct {
+		path, key  string
+		wantCode   int
+		wantScoped bool
+	}{
+		{"/nps/api/v1/export", "reader", http.StatusOK, true},
+		{"/nps/api/v1/export", "client", http.StatusOK, false},
+		{"/nps/api/v1/comments", "reader", http.StatusOK, true},
+		{"/nps/api/v1/comments", "client", http.StatusForbidden, false},
+		{"/nps/api/v1/comments", "", http.StatusForbidden, false},
+	} {
+		scoped = false
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("X-API-Key", tc.key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.wantCode || scoped != tc.wantScoped {
+			t.Errorf("%s with %q: got %d scoped=%v", tc.path, tc.key, w.Code, scoped)
+		}
+	}
+
+	// Without read keys nothing gets the scope, even with an empty key.
+	h = ReadScope(nil, []string{"/nps/api/v1/comments"})(okHandler())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nps/api/v1/comments", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without read keys, got %d", w.Code)
+	}
+}
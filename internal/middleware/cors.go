@@ -0,0 +1,289 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORS defaults for policy fields left empty.
+var (
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodPost}
+	// DefaultCORSHeaders are the request headers API clients send, including
+	// those of signed requests.
+	DefaultCORSHeaders = []string{
+		"Accept-Language", "Content-Type", "Idempotency-Key", "Last-Event-ID", "X-API-Key",
+		HeaderKeyID, HeaderTimestamp, HeaderNonce, HeaderSignature,
+	}
+	// DefaultCORSExposeHeaders are the response headers scripts may read.
+	DefaultCORSExposeHeaders = []string{"Content-Disposition", "Content-Language", "Idempotent-Replayed", "Retry-After"}
+)
+
+// DefaultCORSMaxAge is how long browsers may cache a preflight, in seconds,
+// when a policy does not say.
+const DefaultCORSMaxAge = 600
+
+// CORSPolicy lets browser pages on other origins call the paths under
+// Prefix.
+type CORSPolicy struct {
+	Prefix string `json:"prefix"`
+	// Origins are exact origins such as https://app.example.com, wildcard
+	// subdomains such as https://*.example.com, which match any subdomain
+	// but not example.com itself, or "*" for any origin.
+	Origins []string `json:"origins"`
+	// Methods, Headers and ExposeHeaders default to DefaultCORSMethods,
+	// DefaultCORSHeaders and DefaultCORSExposeHeaders.
+	Methods       []string `json:"methods,omitempty"`
+	Headers       []string `json:"headers,omitempty"`
+	ExposeHeaders []string `json:"expose_headers,omitempty"`
+	// Credentials lets pages send cookies and HTTP auth. It cannot be
+	// combined with "*".
+	Credentials bool `json:"credentials,omitempty"`
+	// MaxAge is in seconds; 0 means DefaultCORSMaxAge and -1 disables
+	// preflight caching.
+	MaxAge int `json:"max_age,omitempty"`
+}
+
+// LoadCORSPolicies reads a JSON array of policies. They are checked by CORS.
+func LoadCORSPolicies(path string) ([]CORSPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policies []CORSPolicy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("invalid CORS policies: %w", err)
+	}
+	return policies, nil
+}
+
+// CORS returns middleware that applies the policy with the longest prefix
+// matching the request path. Preflight requests are answered directly. A
+// request from an origin the policy does not allow, or a preflight asking
+// for a method or header it does not allow, is logged and rejected with 403
+// rather than passed on without CORS headers, since simple requests such as
+// form posts are never preflighted. Requests without an Origin header,
+// same-origin requests and paths without a policy are passed through.
+func CORS(policies []CORSPolicy) (func(http.Handler) http.Handler, error) {
+	compiled := make([]*corsPolicy, 0, len(policies))
+	for _, p := range policies {
+		c, err := compileCORS(p)
+		if err != nil {
+			return nil, fmt.Errorf("CORS policy %s: %w", p.Prefix, err)
+		}
+		if slices.ContainsFunc(compiled, func(o *corsPolicy) bool { return o.prefix == c.prefix }) {
+			return nil, fmt.Errorf("CORS policy %s: duplicate prefix", p.Prefix)
+		}
+		compiled = append(compiled, c)
+	}
+	slices.SortFunc(compiled, func(a, b *corsPolicy) int { return len(b.prefix) - len(a.prefix) })
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || sameOrigin(r, origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			i := slices.IndexFunc(compiled, func(p *corsPolicy) bool { return strings.HasPrefix(r.URL.Path, p.prefix) })
+			if i < 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			p := compiled[i]
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if reason := p.check(r, origin, preflight); reason != "" {
+				slog.Warn("CORS request rejected", "origin", origin, "method", r.Method, "path", r.URL.Path,
+					"policy", p.prefix, "reason", reason)
+				writeError(w, http.StatusForbidden, reason)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Origin", origin)
+			if p.credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if preflight {
+				h.Set("Access-Control-Allow-Methods", p.methodList)
+				h.Set("Access-Control-Allow-Headers", p.headerList)
+				h.Set("Access-Control-Max-Age", p.maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if p.exposeList != "" {
+				h.Set("Access-Control-Expose-Headers", p.exposeList)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// corsPolicy is a CORSPolicy prepared for matching.
+type corsPolicy struct {
+	prefix      string
+	anyOrigin   bool
+	origins     []string
+	wildcards   []wildcardOrigin
+	methods     []string
+	headers     []string
+	credentials bool
+
+	methodList, headerList, exposeList, maxAge string
+}
+
+// wildcardOrigin matches the subdomains of a host: https://*.example.com
+// has scheme https, suffix .example.com and the default port.
+type wildcardOrigin struct {
+	scheme, suffix, port string
+}
+
+func compileCORS(p CORSPolicy) (*corsPolicy, error) {
+	if !strings.HasPrefix(p.Prefix, "/") {
+		return nil, errors.New("prefix must start with /")
+	}
+	if len(p.Origins) == 0 {
+		return nil, errors.New("at least one origin is required")
+	}
+	c := &corsPolicy{prefix: p.Prefix, credentials: p.Credentials}
+	for _, o := range p.Origins {
+		if o == "*" {
+			if p.Credentials {
+				return nil, errors.New(`origin "*" cannot be combined with credentials`)
+			}
+			c.anyOrigin = true
+			continue
+		}
+		scheme, host, port, err := splitOrigin(o)
+		if err != nil {
+			return nil, fmt.Errorf("origin %q: %w", o, err)
+		}
+		if rest, ok := strings.CutPrefix(host, "*."); ok {
+			if rest == "" || strings.Contains(rest, "*") {
+				return nil, fmt.Errorf("origin %q: a wildcard must be followed by a domain", o)
+			}
+			c.wildcards = append(c.wildcards, wildcardOrigin{scheme: scheme, suffix: "." + rest, port: port})
+			continue
+		}
+		if strings.Contains(host, "*") {
+			return nil, fmt.Errorf("origin %q: a wildcard may only replace the leftmost labels", o)
+		}
+		c.origins = append(c.origins, joinOrigin(scheme, host, port))
+	}
+
+	methods := p.Methods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	for _, m := range methods {
+		c.methods = append(c.methods, strings.ToUpper(strings.TrimSpace(m)))
+	}
+	headers := p.Headers
+	if len(headers) == 0 {
+		headers = DefaultCORSHeaders
+	}
+	for _, h := range headers {
+		c.headers = append(c.headers, http.CanonicalHeaderKey(strings.TrimSpace(h)))
+	}
+	expose := p.ExposeHeaders
+	if expose == nil {
+		expose = DefaultCORSExposeHeaders
+	}
+
+	switch {
+	case p.MaxAge == 0:
+		c.maxAge = strconv.Itoa(DefaultCORSMaxAge)
+	case p.MaxAge < -1:
+		return nil, errors.New("max_age must be positive or -1")
+	default:
+		c.maxAge = strconv.Itoa(p.MaxAge)
+	}
+	c.methodList = strings.Join(c.methods, ", ")
+	c.headerList = strings.Join(c.headers, ", ")
+	c.exposeList = strings.Join(expose, ", ")
+	return c, nil
+}
+
+// check returns why the request is not allowed, or "".
+func (p *corsPolicy) check(r *http.Request, origin string, preflight bool) string {
+	if !p.allowsOrigin(origin) {
+		return "origin not allowed"
+	}
+	method := r.Method
+	if preflight {
+		method = r.Header.Get("Access-Control-Request-Method")
+	}
+	if !slices.Contains(p.methods, method) {
+		return "method not allowed"
+	}
+	if !preflight {
+		return ""
+	}
+	for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if h = strings.TrimSpace(h); h != "" && !slices.Contains(p.headers, http.CanonicalHeaderKey(h)) {
+			return "header " + h + " not allowed"
+		}
+	}
+	return ""
+}
+
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	scheme, host, port, err := splitOrigin(origin)
+	if err != nil {
+		return false
+	}
+	if slices.Contains(p.origins, joinOrigin(scheme, host, port)) {
+		return true
+	}
+	return slices.ContainsFunc(p.wildcards, func(w wildcardOrigin) bool {
+		return w.scheme == scheme && w.port == port && strings.HasSuffix(host, w.suffix) && len(host) > len(w.suffix)
+	})
+}
+
+// splitOrigin parses scheme://host[:port] into lower-case parts, dropping
+// the default port so that https://a.com:443 and https://a.com compare
+// equal.
+func splitOrigin(origin string) (scheme, host, port string, err error) {
+	u, err := url.Parse(strings.ToLower(strings.TrimSuffix(origin, "/")))
+	if err != nil {
+		return "", "", "", err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+		return "", "", "", errors.New("must be scheme://host[:port]")
+	}
+	host, port = u.Hostname(), u.Port()
+	if (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		port = ""
+	}
+	return u.Scheme, host, port, nil
+}
+
+func joinOrigin(scheme, host, port string) string {
+	if port != "" {
+		host += ":" + port
+	}
+	return scheme + "://" + host
+}
+
+// sameOrigin reports whether origin is the host the request was sent to,
+// such as the form page served by this server posting back to it.
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
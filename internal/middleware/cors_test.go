@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	mw, err := CORS([]CORSPolicy{
+		{
+			Prefix:  "/nps/web/",
+			Origins: []string{"https://www.example.com/"},
+			Headers: []string{"Content-Type", "Idempotency-Key"},
+		},
+		{
+			Prefix:      "/nps/api/",
+			Origins:     []string{"https://app.example.com", "https://*.example.org", "http://localhost:3000"},
+			Credentials: true,
+			MaxAge:      60,
+		},
+		{
+			Prefix:  "/nps/api/v1/stats/",
+			Origins: []string{"*"},
+			Methods: []string{"GET"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(okHandler())
+	serve := func(method, path, origin, reqMethod, reqHeaders string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Host = "api.example.com"
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if reqMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", reqMethod)
+		}
+		if reqHeaders != "" {
+			req.Header.Set("Access-Control-Request-Headers", reqHeaders)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodOptions, "/nps/web/v1/feedback", "https://www.example.com", "POST", "content-type,idempotency-key")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://www.example.com" {
+		t.Errorf("preflight: got %d %v", w.Code, w.Header())
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, Idempotency-Key" {
+		t.Errorf("preflight: unexpected allowed headers %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("preflight: expected the default max age, got %q", got)
+	}
+
+	w = serve(http.MethodOptions, "/nps/api/v1/feedback", "https://app.example.com", "POST", "X-API-Key, Idempotency-Key, Content-Type")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		w.Header().Get("Access-Control-Max-Age") != "60" {
+		t.Errorf("API preflight: got %d %v", w.Code, w.Header())
+	}
+	// Signed browser calls need the signature headers by default.
+	w = serve(http.MethodOptions, "/nps/api/v1/feedback", "https://app.example.com", "POST",
+		"content-type, x-nps-key-id, x-nps-timestamp, x-nps-nonce, x-nps-signature")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("signed preflight: got %d %s", w.Code, w.Body)
+	}
+
+	for _, origin := range []string{"https://WWW.example.com", "https://www.example.com:443"} {
+		w = serve(http.MethodPost, "/nps/web/v1/feedback", origin, "", "")
+		if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != origin {
+			t.Errorf("allowed origin %s: got %d %v", origin, w.Code, w.Header())
+		}
+	}
+	w = serve(http.MethodGet, "/nps/api/v1/stats", "https://a.b.example.org", "", "")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("wildcard origin: got %d %v", w.Code, w.Header())
+	}
+	w = serve(http.MethodGet, "/nps/api/v1/stats/trend", "https://anything.test", "", "")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("longest prefix: got %d %v", w.Code, w.Header())
+	}
+
+	for _, c := range []struct {
+		name                                    string
+		method, path, origin, reqMethod, reqHdr string
+		reason                                  string
+	}{
+		{"foreign origin", "POST", "/nps/web/v1/feedback", "https://evil.example", "", "", "origin not allowed"},
+		{"apex of wildcard", "GET", "/nps/api/v1/stats", "https://example.org", "", "", "origin not allowed"},
+		{"wildcard scheme", "GET", "/nps/api/v1/stats", "http://www.example.org", "", "", "origin not allowed"},
+		{"other port", "GET", "/nps/api/v1/stats", "http://localhost:8080", "", "", "origin not allowed"},
+		{"API key on web", "OPTIONS", "/nps/web/v1/feedback", "https://www.example.com", "POST", "X-API-Key", "header X-API-Key not allowed"},
+		{"preflight method", "OPTIONS", "/nps/api/v1/feedback", "https://app.example.com", "DELETE", "", "method not allowed"},
+		{"simple method", "POST", "/nps/api/v1/stats/trend", "https://app.example.com", "", "", "method not allowed"},
+	} {
+		w := serve(c.method, c.path, c.origin, c.reqMethod, c.reqHdr)
+		if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected 403 without CORS headers, got %d %v", c.name, w.Code, w.Header())
+		}
+		if got := decodeError(t, w); got != c.reason {
+			t.Errorf("%s: error = %q, want %q", c.name, got, c.reason)
+		}
+	}
+
+	for _, c := range []struct{ path, origin string }{
+		{"/nps/web/v1/feedback", "https://api.example.com"}, // the form page posting back
+		{"/nps/web/v1/feedback", ""},                        // not a browser
+		{"/nps/health", "https://evil.example"},             // outside the prefixes
+	} {
+		if w := serve(http.MethodPost, c.path, c.origin, "", ""); w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s from %q: expected a plain pass-through, got %d %v", c.path, c.origin, w.Code, w.Header())
+		}
+	}
+}
+
+func TestCORS_InvalidPolicies(t *testing.T) {
+	for name, p := range map[string]CORSPolicy{
+		"no origins":       {Prefix: "/nps/api/"},
+		"relative prefix":  {Prefix: "nps/api/", Origins: []string{"https://a.com"}},
+		"path in origin":   {Prefix: "/nps/api/", Origins: []string{"https://a.com/app"}},
+		"no scheme":        {Prefix: "/nps/api/", Origins: []string{"a.com"}},
+		"inner wildcard":   {Prefix: "/nps/api/", Origins: []string{"https://app.*.com"}},
+		"bare wildcard":    {Prefix: "/nps/api/", Origins: []string{"https://*"}},
+		"any with cookies": {Prefix: "/nps/api/", Origins: []string{"*"}, Credentials: true},
+		"negative max age": {Prefix: "/nps/api/", Origins: []string{"https://a.com"}, MaxAge: -5},
+	} {
+		if _, err := CORS([]CORSPolicy{p}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	dup := CORSPolicy{Prefix: "/nps/api/", Origins: []string{"https://a.com"}}
+	if _, err := CORS([]CORSPolicy{dup, dup}); err == nil {
+		t.Error("duplicate prefix: expected an error")
+	}
+}
+
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error body %q: %v", w.Body.String(), err)
+	}
+	return body.Error
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceCache remembers recently seen nonces for a fixed TTL so that a captured
+// request cannot be replayed inside the signature skew window. Expired entries
+// are swept lazily on insert, so memory is bounded by the request rate times
+// the TTL.
+type NonceCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewNonceCache creates a cache that holds each nonce for ttl.
+func NewNonceCache(ttl time.Duration) *NonceCache {
+	return &NonceCache{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+	}
+}
+
+// Add records nonce as seen at now. It returns false if the nonce was already
+// recorded and has not yet expired.
+func (c *NonceCache) Add(nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) >= c.ttl/2 {
+		for k, exp := range c.seen {
+			if !now.Before(exp) {
+				delete(c.seen, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if exp, ok := c.seen[nonce]; ok && now.Before(exp) {
+		return false
+	}
+	c.seen[nonce] = now.Add(c.ttl)
+	return true
+}
+
+// Len reports the number of nonces currently held, including any expired
+// entries not yet swept.
+func (c *NonceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+)
+
+type readScopeKey struct{}
+
+// ReadScope returns middleware that grants the read scope, which allows
+// reading comments and free-text answers in plaintext, to requests whose
+// X-API-Key is one of readKeys. Requests under requirePrefixes without it are
+// rejected with 403; other requests pass either way, and handlers check
+// HasReadScope before revealing text. Like AdminKey it fails closed: with no
+// read keys, nothing gets the scope. The client keys in API_KEYS ship inside
+// desktop apps and must never be read keys.
+func ReadScope(readKeys []string, requirePrefixes []string) func(http.Handler) http.Handler {
+	keys := normalizeKeys(readKeys)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := []byte(r.Header.Get("X-API-Key"))
+			for _, k := range keys {
+				if subtle.ConstantTimeCompare(provided, k) == 1 {
+					next.ServeHTTP(w, r.WithContext(WithReadScope(r.Context())))
+					return
+				}
+			}
+			if pathMatchesAny(r.URL.Path, requirePrefixes) {
+				writeError(w, http.StatusForbidden, "read scope required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WithReadScope returns ctx with the read scope granted.
+func WithReadScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readScopeKey{}, true)
+}
+
+// HasReadScope reports whether the request context carries the read scope.
+func HasReadScope(ctx context.Context) bool {
+	ok, _ := ctx.Value(readScopeKey{}).(bool)
+	return ok
+}
@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var fixedNow = time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+func signedRequest(t *testing.T, secret, keyID, nonce string, ts time.Time, body string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", strings.NewReader(body))
+	stamp := strconv.FormatInt(ts.Unix(), 10)
+	sig := SignRequest([]byte(secret), http.MethodPost, "/nps/api/v1/feedback", stamp, nonce, []byte(body))
+	req.Header.Set(HeaderKeyID, keyID)
+	req.Header.Set(HeaderTimestamp, stamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, hex.EncodeToString(sig))
+	return req
+}
+
+func signatureMW(mode SignatureMode) func(http.Handler) http.Handler {
+	return Signature(SignatureConfig{
+		Secrets:         map[string]string{"desktop": "s3cret"},
+		Mode:            mode,
+		MaxSkew:         5 * time.Minute,
+		RequirePrefixes: []string{"/nps/api/"},
+		Now:             func() time.Time { return fixedNow },
+	})
+}
+
+func TestSignature_OffIsNoOp(t *testing.T) {
+	h := signatureMW(SignatureOff)(okHandler())
+
+	req := httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 with signing off, got %d", w.Code)
+	}
+}
+
+func TestSignature_AcceptsValidSignature(t *testing.T) {
+	var gotBody string
+	h := signatureMW(SignatureRequired)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	body := `{"nps_rating":9}`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, signedRequest(t, "s3cret", "desktop", "n-1", fixedNow, body))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for valid signature, got %d: %s", w.Code, w.Body.String())
+	}
+	if gotBody != body {
+		t.Errorf("expected body to be readable downstream, got %q", gotBody)
+	}
+}
+
+func TestSignature_RejectsTamperedBody(t *testing.T) {
+	h := signatureMW(SignatureRequired)(okHandler())
+
+	req := signedRequest(t, "s3cret", "desktop", "n-1", fixedNow, `{"nps_rating":9}`)
+	req.Body = io.NopCloser(strings.NewReader(`{"nps_rating":1}`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for tampered body, got %d", w.Code)
+	}
+}
+
+func TestSignature_CoversQuery(t *testing.T) {
+	h := signatureMW(SignatureRequired)(okHandler())
+	sign := func(target string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		stamp := strconv.FormatInt(fixedNow.Unix(), 10)
+		sig := SignRequest([]byte("s3cret"), http.MethodGet, "/nps/api/v1/export?app=idefinity&format=csv", stamp, "n-q", nil)
+		req.Header.Set(HeaderKeyID, "desktop")
+		req.Header.Set(HeaderTimestamp, stamp)
+		req.Header.Set(HeaderNonce, "n-q")
+		req.Header.Set(HeaderSignature, hex.EncodeToString(sig))
+		return req
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, sign("/nps/api/v1/export?app=other&format=csv"))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a changed query, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, sign("/nps/api/v1/export?app=idefinity&format=csv"))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 for the signed query, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestSignature_RejectsWrongSecretAndUnknownKey(t *testing.T) {
+	h := signatureMW(SignatureRequired)(okHandler())
+
+	for name, req := range map[string]*http.Request{
+		"wrong secret": signedRequest(t, "guess", "desktop", "n-1", fixedNow, "{}"),
+		"unknown key":  signedRequest(t, "s3cret", "mobile", "n-2", fixedNow, "{}"),
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestSignature_ClockSkew(t *testing.T) {
+	h := signatureMW(SignatureRequired)(okHandler())
+
+	tests := []struct {
+		name string
+		ts   time.Time
+		want int
+	}{
+		{"within window behind", fixedNow.Add(-4 * time.Minute), http.StatusOK},
+		{"within window ahead", fixedNow.Add(4 * time.Minute), http.StatusOK},
+		{"too old", fixedNow.Add(-6 * time.Minute), http.StatusUnauthorized},
+		{"too far ahead", fixedNow.Add(6 * time.Minute), http.StatusUnauthorized},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, signedRequest(t, "s3cret", "desktop", "skew-"+strconv.Itoa(i), tt.ts, "{}"))
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestSignature_RejectsReplayedNonce(t *testing.T) {
+	h := signatureMW(SignatureRequired)(okHandler())
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, signedRequest(t, "s3cret", "desktop", "once", fixedNow, "{}"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, signedRequest(t, "s3cret", "desktop", "once", fixedNow, "{}"))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected replay to be rejected, got %d", w.Code)
+	}
+}
+
+func TestSignature_UnsignedByMode(t *testing.T) {
+	for mode, want := range map[SignatureMode]int{
+		SignatureOptional: http.StatusOK,
+		SignatureRequired: http.StatusUnauthorized,
+	} {
+		h := signatureMW(mode)(okHandler())
+		req := httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("mode %s: expected %d for unsigned request, got %d", mode, want, w.Code)
+		}
+	}
+}
+
+func TestSignature_SkipsNonMatchingPrefix(t *testing.T) {
+	h := signatureMW(SignatureRequired)(okHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/nps/health", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected health to bypass signing, got %d", w.Code)
+	}
+}
+
+func TestSignature_StacksWithAPIKey(t *testing.T) {
+	h := signatureMW(SignatureOptional)(APIKey([]string{"legacy"}, []string{"/nps/api/"})(okHandler()))
+
+	req := signedRequest(t, "s3cret", "desktop", "stack", fixedNow, "{}")
+	req.Header.Set("X-API-Key", "legacy")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected signed request with key to pass, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", nil)
+	req.Header.Set("X-API-Key", "legacy")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected unsigned request with key to pass in optional mode, got %d", w.Code)
+	}
+}
+
+func TestNonceCache_Expires(t *testing.T) {
+	c := NewNonceCache(time.Minute)
+
+	if !c.Add("a", fixedNow) {
+		t.Fatal("expected first add to succeed")
+	}
+	if c.Add("a", fixedNow.Add(30*time.Second)) {
+		t.Error("expected duplicate within TTL to be rejected")
+	}
+	if !c.Add("a", fixedNow.Add(2*time.Minute)) {
+		t.Error("expected nonce to be reusable after TTL")
+	}
+	if c.Len() != 1 {
+		t.Errorf("expected expired entries to be swept, got %d", c.Len())
+	}
+}
+
+func TestParseSignatureMode(t *testing.T) {
+	if m, ok := ParseSignatureMode(" Required "); !ok || m != SignatureRequired {
+		t.Errorf("expected required, got %q (%v)", m, ok)
+	}
+	if m, ok := ParseSignatureMode("sometimes"); ok || m != SignatureOff {
+		t.Errorf("expected unknown mode to map to off, got %q (%v)", m, ok)
+	}
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Erasure modes for data subject requests.
+const (
+	ErasureDelete    = "delete"
+	ErasureAnonymize = "anonymize"
+)
+
+// ErasureRecord is the audit trail entry written for every data subject
+// erasure. It identifies the subject only by the hashed install ID.
+type ErasureRecord struct {
+	InstallIDHash string    `bson:"install_id_hash" json:"install_id_hash"`
+	Mode          string    `bson:"mode"            json:"mode"`
+	Documents     int64     `bson:"documents"       json:"documents"`
+	Actor         string    `bson:"actor"           json:"actor"`
+	Reason        string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	At            time.Time `bson:"at"              json:"at"`
+}
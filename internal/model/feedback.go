@@ -2,30 +2,108 @@ package model
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/i18n"
 )
 
 // Feedback represents an NPS feedback submission.
 type Feedback struct {
-	ID            bson.ObjectID `bson:"_id,omitempty"      json:"id,omitempty"`
-	SchemaVersion string        `bson:"schema_version"     json:"schema_version"`
-	App           string        `bson:"app"                json:"app"`
-	AppVersion    string        `bson:"app_version"        json:"app_version"`
-	Platform      string        `bson:"platform"           json:"platform"`
-	Timestamp     string        `bson:"timestamp"          json:"timestamp"`
-	NPSRating     int           `bson:"nps_rating"         json:"nps_rating"`
-	NPSCategory   string        `bson:"nps_category"       json:"nps_category"`
-	Timezone      string        `bson:"timezone,omitempty" json:"timezone,omitempty"`
-	Comment       string        `bson:"comment,omitempty"  json:"comment,omitempty"`
-	ReceivedAt    time.Time     `bson:"received_at"        json:"received_at"`
+	ID            bson.ObjectID `bson:"_id,omitempty"          json:"id,omitempty"`
+	SchemaVersion string        `bson:"schema_version"         json:"schema_version"`
+	App           string        `bson:"app"                    json:"app"`
+	AppVersion    string        `bson:"app_version"            json:"app_version"`
+	Platform      string        `bson:"platform"               json:"platform"`
+	Timestamp     string        `bson:"timestamp"              json:"timestamp"`
+	NPSRating     int           `bson:"nps_rating"             json:"nps_rating"`
+	NPSCategory   string        `bson:"nps_category"           json:"nps_category"`
+	Timezone      string        `bson:"timezone,omitempty"     json:"timezone,omitempty"`
+	Comment       string        `bson:"comment,omitempty"      json:"comment,omitempty"`
+	ReceivedAt    time.Time     `bson:"received_at"            json:"received_at"`
+
+	// InstallID is a pseudonymous per-installation identifier (schema 1.1+).
+	// Clients send their raw ID; the server replaces it with a salted hash
+	// before storage so it can find a user's documents without holding the
+	// raw value.
+	InstallID string `bson:"install_id,omitempty" json:"install_id,omitempty"`
+	// AnonymizedAt is set when an erasure request stripped the document of
+	// its install ID and comment but kept the rating.
+	AnonymizedAt *time.Time `bson:"anonymized_at,omitempty" json:"anonymized_at,omitempty"`
+
+	// CommentEnc holds the encrypted comment when field encryption is on;
+	// Comment is then empty in storage and filled in on read.
+	CommentEnc *Sealed `bson:"comment_enc,omitempty" json:"-"`
+
+	// Set server-side by redaction; never trusted from the client.
+	Redactions      []string `bson:"redactions,omitempty"       json:"redactions,omitempty"`
+	CommentOriginal *Sealed  `bson:"comment_original,omitempty" json:"-"`
+
+	// Set server-side by spam scoring; never trusted from the client.
+	Quarantine  bool     `bson:"quarantine,omitempty"   json:"quarantine,omitempty"`
+	SpamScore   int      `bson:"spam_score,omitempty"   json:"spam_score,omitempty"`
+	SpamReasons []string `bson:"spam_reasons,omitempty" json:"spam_reasons,omitempty"`
+
+	// Set by bulk imports: the batch a document came from, and a hash of its
+	// source row that makes re-running an import idempotent.
+	ImportBatch string `bson:"import_batch,omitempty" json:"import_batch,omitempty"`
+	ImportKey   string `bson:"import_key,omitempty"   json:"-"`
+
+	// IdempotencyKey is the client's Idempotency-Key header. A unique index
+	// on it turns retried submissions into no-ops. IdempotencyHash is the
+	// SHA-256 of the request body, so that a different request reusing the
+	// key is refused rather than taken for a retry.
+	IdempotencyKey  string `bson:"idempotency_key,omitempty"  json:"-"`
+	IdempotencyHash string `bson:"idempotency_hash,omitempty" json:"-"`
+
+	// SurveyID and SurveyVersion name the survey definition the answers
+	// respond to (schema 1.2+). The answers are checked against it on
+	// submission.
+	SurveyID      string   `bson:"survey_id,omitempty"      json:"survey_id,omitempty"`
+	SurveyVersion int      `bson:"survey_version,omitempty" json:"survey_version,omitempty"`
+	Answers       []Answer `bson:"answers,omitempty"        json:"answers,omitempty"`
+
+	// Locale is the language the client showed the survey in (schema 1.3+),
+	// a canonical tag such as fi or sv-FI, so comments can be grouped by
+	// language.
+	Locale string `bson:"locale,omitempty" json:"locale,omitempty"`
+}
+
+// Answer is the response to one survey question. Exactly one of Rating,
+// Choices and Text is set, depending on the question type; single-choice
+// answers carry one choice.
+type Answer struct {
+	QuestionID string   `bson:"question_id"       json:"question_id"`
+	Rating     *int     `bson:"rating,omitempty"  json:"rating,omitempty"`
+	Choices    []string `bson:"choices,omitempty" json:"choices,omitempty"`
+	Text       string   `bson:"text,omitempty"    json:"text,omitempty"`
+
+	// TextEnc holds the encrypted free-text answer when field encryption is
+	// on, like Feedback.CommentEnc.
+	TextEnc *Sealed `bson:"text_enc,omitempty" json:"-"`
 }
 
+// Sealed is an envelope-encrypted field value as stored in MongoDB: the
+// ciphertext is encrypted under a per-value data key, which is itself stored
+// wrapped by the key-encryption key named in KeyID.
+type Sealed struct {
+	KeyID      string `bson:"key_id"`
+	WrappedKey []byte `bson:"wrapped_key"`
+	Ciphertext []byte `bson:"ciphertext"`
+}
+
+// PlatformWeb is the platform the server records for submissions from the
+// website widget. It is set by the server and does not need to be in the
+// platform allowlist.
+const PlatformWeb = "Web"
+
 var (
-	platformsMu     sync.RWMutex
+	platformsMu      sync.RWMutex
 	allowedPlatforms = map[string]bool{
 		"macOS":   true,
 		"Windows": true,
@@ -63,31 +141,183 @@ var validCategories = map[string]bool{
 	"promoter":  true,
 }
 
-// Validate checks that all required fields are present and valid.
+// CategoryForRating returns the NPS category for a 0-10 rating: 9-10 are
+// promoters, 7-8 passives and anything lower detractors.
+func CategoryForRating(rating int) string {
+	switch {
+	case rating >= 9:
+		return "promoter"
+	case rating >= 7:
+		return "passive"
+	default:
+		return "detractor"
+	}
+}
+
+// Supported schema versions. 1.1 adds the optional install_id field; 1.2
+// adds survey_id, survey_version and answers; 1.3 adds locale and makes the
+// survey fields optional.
+const (
+	SchemaV1_0 = "1.0"
+	SchemaV1_1 = "1.1"
+	SchemaV1_2 = "1.2"
+	SchemaV1_3 = "1.3"
+)
+
+// schemaVersions lists the supported versions in order; each one accepts
+// every field of the versions before it.
+var schemaVersions = []string{SchemaV1_0, SchemaV1_1, SchemaV1_2, SchemaV1_3}
+
+// SchemaAtLeast reports whether schema version v includes the fields of
+// version min.
+func SchemaAtLeast(v, min string) bool {
+	return slices.Index(schemaVersions, v) >= slices.Index(schemaVersions, min)
+}
+
+// MaxInstallIDLength bounds the raw install_id a client may send. Like the
+// other length limits it counts characters, as the JSON schema does.
+const MaxInstallIDLength = 128
+
+// Limits on survey answers.
+const (
+	MaxAnswers          = 50
+	MaxAnswerTextLength = 2000
+)
+
+// ValidationError reports a field that failed validation. Error renders it
+// in English; handlers render the message in the client's language with In.
+type ValidationError struct {
+	Field string
+	i18n.Message
+}
+
+// NewValidationError returns a validation error for field with the given
+// catalog code and arguments.
+func NewValidationError(field, code string, args ...any) *ValidationError {
+	return &ValidationError{Field: field, Message: i18n.NewMessage(code, args...)}
+}
+
+func (e *ValidationError) Error() string { return e.Message.String() }
+
+// StripText removes the comment and the free-text answers, in plaintext and
+// sealed, for responses to callers without the read scope.
+func (f *Feedback) StripText() {
+	f.Comment, f.CommentEnc, f.CommentOriginal = "", nil, nil
+	if len(f.Answers) > 0 {
+		f.Answers = slices.Clone(f.Answers)
+	}
+	for i := range f.Answers {
+		f.Answers[i].Text, f.Answers[i].TextEnc = "", nil
+	}
+}
+
+// Validate checks that all required fields are present and valid. It
+// returns a *ValidationError.
 func (f *Feedback) Validate() error {
-	if f.SchemaVersion != "1.0" {
-		return fmt.Errorf("unsupported schema_version: %q", f.SchemaVersion)
+	return f.validate(isPlatformAllowed, 1)
+}
+
+// ValidateFields runs the same checks as Validate except the platform
+// allowlist, which is server configuration: the platform only has to be
+// non-empty. Clients use it to reject malformed submissions before sending.
+func (f *Feedback) ValidateFields() error {
+	return f.validate(platformSet, 1)
+}
+
+// ValidateWeb runs the checks of ValidateFields on a website submission.
+// The website prompt offers the full 0-10 scale, while the schemas that
+// apps submit against start at 1.
+func (f *Feedback) ValidateWeb() error {
+	return f.validate(platformSet, 0)
+}
+
+func platformSet(p string) bool { return p != "" }
+
+func (f *Feedback) validate(platformAllowed func(string) bool, minRating int) error {
+	if !slices.Contains(schemaVersions, f.SchemaVersion) {
+		return NewValidationError("schema_version", i18n.CodeUnsupportedSchemaVersion, f.SchemaVersion)
+	}
+	if f.InstallID != "" && !SchemaAtLeast(f.SchemaVersion, SchemaV1_1) {
+		return NewValidationError("install_id", i18n.CodeRequiresSchema, "install_id", SchemaV1_1)
+	}
+	if utf8.RuneCountInString(f.InstallID) > MaxInstallIDLength {
+		return NewValidationError("install_id", i18n.CodeTooLong, "install_id", MaxInstallIDLength)
 	}
 	if f.App == "" {
-		return fmt.Errorf("app is required")
+		return NewValidationError("app", i18n.CodeRequired, "app")
 	}
 	if f.AppVersion == "" {
-		return fmt.Errorf("app_version is required")
+		return NewValidationError("app_version", i18n.CodeRequired, "app_version")
 	}
-	if !isPlatformAllowed(f.Platform) {
-		return fmt.Errorf("invalid platform: %q", f.Platform)
+	if !platformAllowed(f.Platform) {
+		return NewValidationError("platform", i18n.CodeInvalidValue, "platform", f.Platform)
 	}
 	if f.Timestamp == "" {
-		return fmt.Errorf("timestamp is required")
+		return NewValidationError("timestamp", i18n.CodeRequired, "timestamp")
 	}
-	if f.NPSRating < 1 || f.NPSRating > 10 {
-		return fmt.Errorf("nps_rating must be between 1 and 10")
+	if f.NPSRating < minRating || f.NPSRating > 10 {
+		return NewValidationError("nps_rating", i18n.CodeOutOfRange, "nps_rating", minRating, 10)
 	}
 	if !validCategories[f.NPSCategory] {
-		return fmt.Errorf("invalid nps_category: %q", f.NPSCategory)
+		return NewValidationError("nps_category", i18n.CodeInvalidValue, "nps_category", f.NPSCategory)
+	}
+	if utf8.RuneCountInString(f.Comment) > 2000 {
+		return NewValidationError("comment", i18n.CodeTooLong, "comment", 2000)
 	}
-	if len(f.Comment) > 2000 {
-		return fmt.Errorf("comment exceeds 2000 characters")
+	if err := f.validateLocale(); err != nil {
+		return err
+	}
+	return f.validateSurvey()
+}
+
+// validateLocale checks the optional locale, which must be a language tag in
+// canonical form so that grouping by it does not split one language.
+func (f *Feedback) validateLocale() error {
+	if f.Locale == "" {
+		return nil
+	}
+	if !SchemaAtLeast(f.SchemaVersion, SchemaV1_3) {
+		return NewValidationError("locale", i18n.CodeRequiresSchema, "locale", SchemaV1_3)
+	}
+	if !i18n.ValidTag(f.Locale) || i18n.Normalize(f.Locale) != f.Locale {
+		return NewValidationError("locale", i18n.CodeInvalidValue, "locale", f.Locale)
+	}
+	return nil
+}
+
+// validateSurvey checks the shape of the survey fields. Whether the answers
+// fit the referenced definition is checked by the survey package. Schema 1.2
+// submissions always respond to a survey; from 1.3 on the fields are
+// optional.
+func (f *Feedback) validateSurvey() error {
+	hasSurvey := f.SurveyID != "" || f.SurveyVersion != 0 || len(f.Answers) > 0
+	if !SchemaAtLeast(f.SchemaVersion, SchemaV1_2) {
+		if hasSurvey {
+			return NewValidationError("survey_id", i18n.CodeRequiresSchema, "survey_id", SchemaV1_2)
+		}
+		return nil
+	}
+	if !hasSurvey && f.SchemaVersion != SchemaV1_2 {
+		return nil
+	}
+	if f.SurveyID == "" {
+		return NewValidationError("survey_id", i18n.CodeRequired, "survey_id")
+	}
+	if f.SurveyVersion < 1 {
+		return NewValidationError("survey_version", i18n.CodeMinValue, "survey_version", 1)
+	}
+	if len(f.Answers) > MaxAnswers {
+		return NewValidationError("answers", i18n.CodeTooMany, "answers", MaxAnswers)
+	}
+	for i, a := range f.Answers {
+		if a.QuestionID == "" {
+			field := fmt.Sprintf("answers[%d].question_id", i)
+			return NewValidationError(field, i18n.CodeRequired, field)
+		}
+		if utf8.RuneCountInString(a.Text) > MaxAnswerTextLength {
+			field := fmt.Sprintf("answers[%d].text", i)
+			return NewValidationError(field, i18n.CodeTooLong, field, MaxAnswerTextLength)
+		}
 	}
 	return nil
 }
@@ -1,6 +1,12 @@
 package model
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+)
 
 func validFeedback() Feedback {
 	return Feedback{
@@ -29,6 +35,95 @@ func TestValidate_InvalidSchemaVersion(t *testing.T) {
 	}
 }
 
+func TestValidate_SchemaV1_1InstallID(t *testing.T) {
+	fb := validFeedback()
+	fb.SchemaVersion = "1.1"
+	fb.InstallID = "3f2c9a4e-0d1b-4c7e-9a51-1b2d3c4e5f60"
+	if err := fb.Validate(); err != nil {
+		t.Errorf("expected 1.1 with install_id to be valid, got %v", err)
+	}
+
+	fb.InstallID = ""
+	if err := fb.Validate(); err != nil {
+		t.Errorf("expected install_id to be optional in 1.1, got %v", err)
+	}
+
+	fb.InstallID = string(make([]byte, MaxInstallIDLength+1))
+	if err := fb.Validate(); err == nil {
+		t.Error("expected error for oversized install_id")
+	}
+}
+
+func TestValidate_InstallIDRejectedInV1_0(t *testing.T) {
+	fb := validFeedback()
+	fb.InstallID = "abc"
+	if err := fb.Validate(); err == nil {
+		t.Error("expected install_id to require schema 1.1")
+	}
+}
+
+func TestValidate_SchemaV1_2Survey(t *testing.T) {
+	fb := validFeedback()
+	fb.SurveyID, fb.SurveyVersion = "onboarding", 1
+	fb.Answers = []Answer{{QuestionID: "reason", Choices: []string{"price"}}}
+	if err := fb.Validate(); err == nil {
+		t.Error("expected survey fields to require schema 1.2")
+	}
+
+	fb.SchemaVersion = SchemaV1_2
+	if err := fb.Validate(); err != nil {
+		t.Errorf("expected 1.2 with answers to be valid, got %v", err)
+	}
+
+	fb.SurveyVersion = 0
+	if err := fb.Validate(); err == nil {
+		t.Error("expected error for missing survey_version")
+	}
+
+	fb.SurveyVersion = 1
+	fb.Answers = []Answer{{Text: "no question"}}
+	if err := fb.Validate(); err == nil {
+		t.Error("expected error for answer without question_id")
+	}
+}
+
+func TestValidate_SchemaV1_3Locale(t *testing.T) {
+	fb := validFeedback()
+	fb.Locale = "fi"
+	if err := fb.Validate(); err == nil {
+		t.Error("expected locale to require schema 1.3")
+	}
+
+	fb.SchemaVersion = SchemaV1_3
+	if err := fb.Validate(); err != nil {
+		t.Errorf("expected 1.3 with a locale to be valid, got %v", err)
+	}
+	fb.Locale = ""
+	if err := fb.Validate(); err != nil {
+		t.Errorf("expected survey fields and locale to be optional in 1.3, got %v", err)
+	}
+
+	for _, locale := range []string{"sv_FI", "FI", "finnish"} {
+		fb.Locale = locale
+		var verr *ValidationError
+		if err := fb.Validate(); !errors.As(err, &verr) || verr.Field != "locale" || verr.Code != i18n.CodeInvalidValue {
+			t.Errorf("%q: expected an invalid locale error, got %v", locale, err)
+		}
+	}
+}
+
+func TestValidationError_Localized(t *testing.T) {
+	fb := validFeedback()
+	fb.App = ""
+	var verr *ValidationError
+	if err := fb.Validate(); !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if verr.Error() != "app is required" || verr.In(i18n.Swedish) != "app är obligatoriskt" {
+		t.Errorf("unexpected messages %q, %q", verr.Error(), verr.In(i18n.Swedish))
+	}
+}
+
 func TestValidate_InvalidPlatform(t *testing.T) {
 	fb := validFeedback()
 	fb.Platform = "Linux"
@@ -90,6 +185,21 @@ func TestValidate_RatingOutOfRange(t *testing.T) {
 	}
 }
 
+func TestValidateWeb_AcceptsZero(t *testing.T) {
+	fb := validFeedback()
+	fb.NPSRating, fb.NPSCategory = 0, "detractor"
+	if err := fb.ValidateWeb(); err != nil {
+		t.Errorf("expected a web rating of 0 to be valid, got %v", err)
+	}
+	if err := fb.ValidateFields(); err == nil {
+		t.Error("expected apps to be held to 1-10")
+	}
+	fb.NPSRating = -1
+	if err := fb.ValidateWeb(); err == nil {
+		t.Error("expected error for rating -1")
+	}
+}
+
 func TestValidate_InvalidCategory(t *testing.T) {
 	fb := validFeedback()
 	fb.NPSCategory = "unknown"
@@ -104,6 +214,12 @@ func TestValidate_CommentTooLong(t *testing.T) {
 	if err := fb.Validate(); err == nil {
 		t.Error("expected error for comment exceeding 2000 chars")
 	}
+
+	// The limit counts characters, not bytes.
+	fb.Comment = strings.Repeat("ä", 2000)
+	if err := fb.Validate(); err != nil {
+		t.Errorf("expected 2000 two-byte characters to be valid, got %v", err)
+	}
 }
 
 func TestValidate_MissingRequiredFields(t *testing.T) {
@@ -125,3 +241,28 @@ func TestValidate_MissingRequiredFields(t *testing.T) {
 		})
 	}
 }
+
+func TestCategoryForRating(t *testing.T) {
+	for rating, want := range map[int]string{1: "detractor", 6: "detractor", 7: "passive", 8: "passive", 9: "promoter", 10: "promoter"} {
+		if got := CategoryForRating(rating); got != want {
+			t.Errorf("rating %d: expected %s, got %s", rating, want, got)
+		}
+	}
+}
+
+func TestValidateFields_SkipsPlatformAllowlist(t *testing.T) {
+	fb := validFeedback()
+	fb.Platform = "Linux"
+	if err := fb.ValidateFields(); err != nil {
+		t.Errorf("expected any platform to pass, got %v", err)
+	}
+	fb.Platform = ""
+	if err := fb.ValidateFields(); err == nil {
+		t.Error("expected an error for an empty platform")
+	}
+	fb = validFeedback()
+	fb.NPSRating = 0
+	if err := fb.ValidateFields(); err == nil {
+		t.Error("expected an error for an invalid rating")
+	}
+}
@@ -0,0 +1,37 @@
+// Package privacy holds the pseudonymization used to honour data subject
+// requests without storing raw client identifiers.
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// InstallIDHasher turns raw install IDs into stable pseudonyms with a secret
+// salt. The same raw ID always maps to the same hash, so an admin holding the
+// raw ID from a user's request can find that user's documents, while the
+// stored value alone cannot be reversed or correlated across deployments.
+type InstallIDHasher struct {
+	salt []byte
+}
+
+// NewInstallIDHasher creates a hasher from a secret salt. Changing the salt
+// orphans every previously stored install ID.
+func NewInstallIDHasher(salt string) (*InstallIDHasher, error) {
+	if len(salt) < 16 {
+		return nil, errors.New("install ID salt must be at least 16 characters")
+	}
+	return &InstallIDHasher{salt: []byte(salt)}, nil
+}
+
+// Hash returns the hex HMAC-SHA256 of raw. Empty input hashes to "".
+func (h *InstallIDHasher) Hash(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, h.salt)
+	mac.Write([]byte(raw))
+	return hex.EncodeToString(mac.Sum(nil))
+}
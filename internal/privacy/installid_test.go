@@ -0,0 +1,35 @@
+package privacy
+
+import "testing"
+
+func TestInstallIDHasher(t *testing.T) {
+	h, err := NewInstallIDHasher("0123456789abcdef-salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := h.Hash("install-1")
+	if len(a) != 64 {
+		t.Errorf("expected 64 hex chars, got %d", len(a))
+	}
+	if a != h.Hash("install-1") {
+		t.Error("expected hashing to be deterministic")
+	}
+	if a == h.Hash("install-2") {
+		t.Error("expected different IDs to hash differently")
+	}
+	if h.Hash("") != "" {
+		t.Error("expected empty ID to stay empty")
+	}
+
+	other, _ := NewInstallIDHasher("another-secret-salt-value")
+	if a == other.Hash("install-1") {
+		t.Error("expected hash to depend on the salt")
+	}
+}
+
+func TestNewInstallIDHasher_ShortSalt(t *testing.T) {
+	if _, err := NewInstallIDHasher("short"); err == nil {
+		t.Error("expected error for short salt")
+	}
+}
@@ -0,0 +1,229 @@
+// Package redact masks personal data in free-text comments before they are
+// stored. Each rule replaces its matches with a typed placeholder such as
+// [EMAIL] and reports its name when it fires, so the stored document records
+// what was removed without keeping the value.
+package redact
+
+import (
+	"fmt"
+	"maps"
+	"math/big"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Built-in rule names, accepted in the REDACT_RULES list.
+const (
+	RuleEmail = "email"
+	RulePhone = "phone"
+	RuleIBAN  = "iban"
+	RuleCard  = "card"
+	RuleIP    = "ip"
+)
+
+// DefaultRules enables every built-in rule, in the order they are applied.
+// Emails go first so their digits are not picked up by later rules; IBANs and
+// cards run before phone numbers so long digit runs get the more specific
+// placeholder, and IP addresses before phones so dotted quads are not
+// mistaken for numbers.
+var DefaultRules = []string{RuleEmail, RuleIBAN, RuleCard, RuleIP, RulePhone}
+
+// Rule is one redaction pattern. Matches for which Valid returns false are
+// left untouched, which lets cheap regexes be paired with a real check (Luhn
+// for cards, mod-97 for IBANs).
+type Rule struct {
+	Name        string
+	Placeholder string
+	Pattern     *regexp.Regexp
+	Valid       func(match string) bool
+}
+
+// builtins holds the built-in rules by name.
+var builtins = map[string]Rule{
+	RuleEmail: {
+		Name:        RuleEmail,
+		Placeholder: "[EMAIL]",
+		Pattern:     regexp.MustCompile(`(?i)[a-z0-9._%+\-]+@[a-z0-9\-]+(?:\.[a-z0-9\-]+)*\.[a-z]{2,}`),
+	},
+	RuleIBAN: {
+		Name:        RuleIBAN,
+		Placeholder: "[IBAN]",
+		Pattern:     regexp.MustCompile(`(?i)\b[a-z]{2}\d{2}(?: ?[a-z0-9]){11,30}\b`),
+		Valid:       validIBAN,
+	},
+	RuleCard: {
+		Name:        RuleCard,
+		Placeholder: "[CARD]",
+		Pattern:     regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		Valid:       validCard,
+	},
+	RuleIP: {
+		Name:        RuleIP,
+		Placeholder: "[IP]",
+		Pattern:     regexp.MustCompile(`(?i)\b(?:\d{1,3}\.){3}\d{1,3}\b|(?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4}`),
+		Valid:       func(m string) bool { return net.ParseIP(m) != nil },
+	},
+	RulePhone: {
+		Name:        RulePhone,
+		Placeholder: "[PHONE]",
+		Pattern:     regexp.MustCompile(`\+?\(?\d[\d ().\-]{5,}\d`),
+		Valid:       validPhone,
+	},
+}
+
+// Redactor applies an ordered set of rules. It is safe for concurrent use.
+type Redactor struct {
+	rules []Rule
+}
+
+// New builds a Redactor from built-in rule names and custom rules given as
+// name -> regular expression. Custom rules run after the built-ins and use
+// the upper-cased name as placeholder, e.g. "license" -> [LICENSE].
+func New(builtinNames []string, custom map[string]string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, name := range orderedBuiltins(builtinNames) {
+		r.rules = append(r.rules, builtins[name])
+	}
+	for _, name := range slices.Sorted(maps.Keys(custom)) {
+		if _, clash := builtins[name]; clash {
+			return nil, fmt.Errorf("custom redaction rule %q shadows a built-in rule", name)
+		}
+		re, err := regexp.Compile(custom[name])
+		if err != nil {
+			return nil, fmt.Errorf("custom redaction rule %q: %w", name, err)
+		}
+		r.rules = append(r.rules, Rule{
+			Name:        name,
+			Placeholder: "[" + strings.ToUpper(name) + "]",
+			Pattern:     re,
+		})
+	}
+	return r, nil
+}
+
+// ParseBuiltins validates a list of built-in rule names. "none" selects no
+// built-ins.
+func ParseBuiltins(names []string) ([]string, error) {
+	var out []string
+	for _, n := range names {
+		n = strings.ToLower(strings.TrimSpace(n))
+		if n == "none" {
+			return nil, nil
+		}
+		if _, ok := builtins[n]; !ok {
+			return nil, fmt.Errorf("unknown redaction rule %q", n)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// Rules returns the names of the active rules in application order.
+func (r *Redactor) Rules() []string {
+	names := make([]string, len(r.rules))
+	for i, rule := range r.rules {
+		names[i] = rule.Name
+	}
+	return names
+}
+
+// Redact returns s with every rule match replaced by its placeholder, plus the
+// names of the rules that fired, in rule order.
+func (r *Redactor) Redact(s string) (string, []string) {
+	if s == "" {
+		return s, nil
+	}
+	var fired []string
+	for _, rule := range r.rules {
+		hit := false
+		s = rule.Pattern.ReplaceAllStringFunc(s, func(m string) string {
+			if rule.Valid != nil && !rule.Valid(m) {
+				return m
+			}
+			hit = true
+			return rule.Placeholder
+		})
+		if hit {
+			fired = append(fired, rule.Name)
+		}
+	}
+	return s, fired
+}
+
+func orderedBuiltins(names []string) []string {
+	var out []string
+	for _, name := range DefaultRules {
+		if slices.Contains(names, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func digitsOf(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// validCard reports whether s holds 13-19 digits that pass the Luhn check.
+func validCard(s string) bool {
+	d := digitsOf(s)
+	if len(d) < 13 || len(d) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(d) - 1; i >= 0; i-- {
+		n := int(d[i] - '0')
+		if double {
+			if n *= 2; n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validIBAN applies the ISO 13616 mod-97 check.
+func validIBAN(s string) bool {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	var b strings.Builder
+	for _, c := range s[4:] + s[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c >= 'A' && c <= 'Z':
+			fmt.Fprintf(&b, "%d", c-'A'+10)
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(b.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+var datePattern = regexp.MustCompile(`^\d{4}[\-.]\d{1,2}[\-.]\d{1,2}$|^\d{1,2}[\-.]\d{1,2}[\-.]\d{4}$`)
+
+// validPhone accepts 7-15 digits (the E.164 maximum) and rejects shapes that
+// are more likely dates or version numbers.
+func validPhone(s string) bool {
+	if datePattern.MatchString(s) {
+		return false
+	}
+	if n := len(digitsOf(s)); n < 7 || n > 15 {
+		return false
+	}
+	return !strings.Contains(s, ".") || strings.HasPrefix(s, "+")
+}
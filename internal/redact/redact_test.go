@@ -0,0 +1,95 @@
+package redact
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRedact_Builtins(t *testing.T) {
+	r, err := New(DefaultRules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		in    string
+		want  string
+		fired []string
+	}{
+		{"email", "mail me at jane.doe+nps@example.co.uk please", "mail me at [EMAIL] please", []string{RuleEmail}},
+		{"phone international", "call +358 40 123 4567", "call [PHONE]", []string{RulePhone}},
+		{"phone local", "call (040) 123-4567 today", "call [PHONE] today", []string{RulePhone}},
+		{"iban", "refund to FI21 1234 5600 0007 85", "refund to [IBAN]", []string{RuleIBAN}},
+		{"card passes luhn", "card 4111 1111 1111 1111 was charged", "card [CARD] was charged", []string{RuleCard}},
+		{"ipv4", "server 192.168.10.20 is down", "server [IP] is down", []string{RuleIP}},
+		{"ipv6", "from 2001:db8::1 again", "from [IP] again", []string{RuleIP}},
+		{"several", "a@b.io and 10.0.0.1", "[EMAIL] and [IP]", []string{RuleEmail, RuleIP}},
+		{"nothing", "Love the IDEF0 workflow in 1.2.3", "Love the IDEF0 workflow in 1.2.3", nil},
+		{"date is not a phone", "broke on 2025-06-15", "broke on 2025-06-15", nil},
+		{"time is not an ip", "at 14:23:00 it crashed", "at 14:23:00 it crashed", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fired := r.Redact(tt.in)
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if !slices.Equal(fired, tt.fired) {
+				t.Errorf("expected fired %v, got %v", tt.fired, fired)
+			}
+		})
+	}
+}
+
+func TestRedact_CardFailingLuhnKept(t *testing.T) {
+	r, _ := New([]string{RuleCard}, nil)
+	in := "order 4111 1111 1111 1112"
+	if got, fired := r.Redact(in); got != in || fired != nil {
+		t.Errorf("expected non-Luhn number to be kept, got %q %v", got, fired)
+	}
+}
+
+func TestRedact_InvalidIBANKept(t *testing.T) {
+	r, _ := New([]string{RuleIBAN}, nil)
+	in := "ref FI21 1234 5600 0007 86"
+	if got, _ := r.Redact(in); got != in {
+		t.Errorf("expected IBAN with bad checksum to be kept, got %q", got)
+	}
+}
+
+func TestRedact_CustomRules(t *testing.T) {
+	r, err := New(nil, map[string]string{"license": `IDF-[A-Z0-9]{4}-[A-Z0-9]{4}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, fired := r.Redact("my key IDF-AB12-CD34 stopped working")
+	if got != "my key [LICENSE] stopped working" {
+		t.Errorf("unexpected redaction %q", got)
+	}
+	if !slices.Equal(fired, []string{"license"}) {
+		t.Errorf("expected license to fire, got %v", fired)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := New(nil, map[string]string{"bad": "("}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+	if _, err := New(nil, map[string]string{RuleEmail: "x"}); err == nil {
+		t.Error("expected error when custom rule shadows a built-in")
+	}
+}
+
+func TestParseBuiltins(t *testing.T) {
+	got, err := ParseBuiltins([]string{"Email", " card "})
+	if err != nil || !slices.Equal(got, []string{"email", "card"}) {
+		t.Errorf("unexpected result %v, %v", got, err)
+	}
+	if got, err := ParseBuiltins([]string{"none"}); err != nil || got != nil {
+		t.Errorf("expected none to select nothing, got %v, %v", got, err)
+	}
+	if _, err := ParseBuiltins([]string{"ssn"}); err == nil {
+		t.Error("expected error for unknown rule")
+	}
+}
@@ -0,0 +1,226 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// metrics are published under "retention" on the expvar endpoint.
+var metrics = expvar.NewMap("retention")
+
+// ttlIndexName names the TTL index managed by EnsureTTL.
+const ttlIndexName = "retention_ttl"
+
+// RuleResult reports what one rule matched in a run.
+type RuleResult struct {
+	App     string    `json:"app"`
+	Target  string    `json:"target"`
+	MaxAge  string    `json:"max_age"`
+	Cutoff  time.Time `json:"cutoff"`
+	Matched int64     `json:"matched"`
+	// ByTTL is set when the rule is enforced by a TTL index instead of the
+	// job; Matched then counts what is currently waiting for expiry.
+	ByTTL bool `json:"by_ttl,omitempty"`
+}
+
+// Report summarizes a purge run.
+type Report struct {
+	DryRun    bool         `json:"dry_run"`
+	StartedAt time.Time    `json:"started_at"`
+	Rules     []RuleResult `json:"rules"`
+}
+
+// Purger applies retention rules to the feedback collection.
+type Purger struct {
+	coll   *mongo.Collection
+	rules  []Rule
+	useTTL bool
+}
+
+// New creates a Purger. With useTTL set, a wildcard document rule is left to
+// a TTL index (see EnsureTTL) whenever no app has a document rule of its own;
+// otherwise the job deletes documents itself.
+func New(coll *mongo.Collection, rules []Rule, useTTL bool) *Purger {
+	return &Purger{coll: coll, rules: rules, useTTL: useTTL}
+}
+
+// Rules returns the configured rules.
+func (p *Purger) Rules() []Rule {
+	return p.rules
+}
+
+// ttlRule returns the rule a TTL index can enforce, if any. TTL indexes apply
+// to the whole collection, so this is only the wildcard document rule and
+// only when no app overrides it.
+func (p *Purger) ttlRule() (Rule, bool) {
+	if !p.useTTL || len(appsWithOwnRule(p.rules, TargetDocument)) > 0 {
+		return Rule{}, false
+	}
+	for _, r := range p.rules {
+		if r.App == AnyApp && r.Target == TargetDocument {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// EnsureTTL creates, updates or drops the retention TTL index on
+// received_at to match the rules.
+func (p *Purger) EnsureTTL(ctx context.Context) error {
+	rule, ok := p.ttlRule()
+	indexes := p.coll.Indexes()
+
+	if !ok {
+		err := indexes.DropOne(ctx, ttlIndexName)
+		if err != nil && !isIndexNotFound(err) {
+			return fmt.Errorf("failed to drop retention TTL index: %w", err)
+		}
+		return nil
+	}
+
+	seconds := int32(rule.MaxAge.Approx().Seconds())
+	_, err := indexes.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "received_at", Value: 1}},
+		Options: options.Index().SetName(ttlIndexName).SetExpireAfterSeconds(seconds),
+	})
+	if err == nil {
+		return nil
+	}
+	// The index exists with a different expiry: update it in place.
+	res := p.coll.Database().RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: p.coll.Name()},
+		{Key: "index", Value: bson.D{
+			{Key: "name", Value: ttlIndexName},
+			{Key: "expireAfterSeconds", Value: seconds},
+		}},
+	})
+	if res.Err() != nil {
+		return fmt.Errorf("failed to update retention TTL index: %w (create: %v)", res.Err(), err)
+	}
+	return nil
+}
+
+// Run applies every rule once. With dryRun set nothing is modified and the
+// report shows how many documents each rule would affect.
+func (p *Purger) Run(ctx context.Context, now time.Time, dryRun bool) (Report, error) {
+	report := Report{DryRun: dryRun, StartedAt: now}
+	ttl, hasTTL := p.ttlRule()
+
+	for _, rule := range p.rules {
+		filter := p.filter(rule, now)
+		res := RuleResult{
+			App:    rule.App,
+			Target: rule.Target,
+			MaxAge: rule.MaxAge.String(),
+			Cutoff: rule.MaxAge.Cutoff(now),
+			ByTTL:  hasTTL && rule == ttl,
+		}
+
+		var err error
+		switch {
+		case dryRun || res.ByTTL:
+			res.Matched, err = p.coll.CountDocuments(ctx, filter)
+		case rule.Target == TargetDocument:
+			// The daily rollup keeps the purged documents' counts on
+			// purpose, as the TTL index does; see stats.Forget.
+			var dr *mongo.DeleteResult
+			if dr, err = p.coll.DeleteMany(ctx, filter); err == nil {
+				res.Matched = dr.DeletedCount
+				metrics.Add("documents_deleted", dr.DeletedCount)
+			}
+		default:
+			var ur *mongo.UpdateResult
+			if ur, err = p.coll.UpdateMany(ctx, filter, stripComment); err == nil {
+				res.Matched = ur.ModifiedCount
+				metrics.Add("comments_removed", ur.ModifiedCount)
+			}
+		}
+		if err != nil {
+			return report, fmt.Errorf("retention rule %s:%s failed: %w", rule.App, rule.Target, err)
+		}
+		report.Rules = append(report.Rules, res)
+	}
+
+	if !dryRun {
+		metrics.Add("runs", 1)
+		lastRun := new(expvar.Int)
+		lastRun.Set(now.Unix())
+		metrics.Set("last_run_unix", lastRun)
+	}
+	return report, nil
+}
+
+// Start runs the purge every interval until ctx is cancelled.
+func (p *Purger) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := p.Run(ctx, time.Now().UTC(), false)
+		if err != nil {
+			slog.Error("retention purge failed", "error", err)
+			metrics.Add("errors", 1)
+		} else {
+			for _, r := range report.Rules {
+				if r.Matched > 0 && !r.ByTTL {
+					slog.Info("retention purge", "app", r.App, "target", r.Target, "affected", r.Matched)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stripComment is a pipeline update: its $unset stage removes a field from
+// every element of the answers array and ignores documents without one.
+var stripComment = mongo.Pipeline{
+	{{Key: "$unset", Value: bson.A{
+		"comment", "comment_enc", "comment_original", "redactions",
+		"answers.text", "answers.text_enc",
+	}}},
+}
+
+// filter selects the documents a rule applies to at time now.
+func (p *Purger) filter(rule Rule, now time.Time) bson.D {
+	f := bson.D{}
+	if rule.App == AnyApp {
+		if own := appsWithOwnRule(p.rules, rule.Target); len(own) > 0 {
+			f = append(f, bson.E{Key: "app", Value: bson.D{{Key: "$nin", Value: own}}})
+		}
+	} else {
+		f = append(f, bson.E{Key: "app", Value: rule.App})
+	}
+	f = append(f, bson.E{Key: "received_at", Value: bson.D{{Key: "$lt", Value: rule.MaxAge.Cutoff(now)}}})
+
+	if rule.Target == TargetComment {
+		f = append(f, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "comment", Value: bson.D{{Key: "$exists", Value: true}}}},
+			bson.D{{Key: "comment_enc", Value: bson.D{{Key: "$exists", Value: true}}}},
+			bson.D{{Key: "comment_original", Value: bson.D{{Key: "$exists", Value: true}}}},
+			bson.D{{Key: "answers.text", Value: bson.D{{Key: "$exists", Value: true}}}},
+			bson.D{{Key: "answers.text_enc", Value: bson.D{{Key: "$exists", Value: true}}}},
+		}})
+	}
+	return f
+}
+
+func isIndexNotFound(err error) bool {
+	var ce mongo.CommandError
+	if errors.As(err, &ce) {
+		// 27: IndexNotFound, 26: NamespaceNotFound (collection not created yet).
+		return ce.Code == 27 || ce.Code == 26
+	}
+	return false
+}
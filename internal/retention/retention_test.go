@@ -0,0 +1,130 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var now = time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"90d", time.Date(2025, 12, 31, 12, 0, 0, 0, time.UTC)},
+		{"2w", time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)},
+		{"18mo", time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)}, // Sep 31 normalizes to Oct 1
+		{"5y", time.Date(2021, 3, 31, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			a, err := ParseAge(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.Cutoff(now); !got.Equal(tt.want) {
+				t.Errorf("expected cutoff %s, got %s", tt.want, got)
+			}
+			if a.String() != tt.in {
+				t.Errorf("expected String %q, got %q", tt.in, a.String())
+			}
+		})
+	}
+
+	for _, bad := range []string{"", "18", "0d", "-3y", "5 years", "1h"} {
+		if _, err := ParseAge(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(" idefinity:comment=18mo ; idefinity:document=5y;*:document=5y; ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 rules, got %d", len(rules))
+	}
+	if rules[0].App != "idefinity" || rules[0].Target != TargetComment || rules[0].MaxAge.Months != 18 {
+		t.Errorf("unexpected first rule %+v", rules[0])
+	}
+
+	for _, bad := range []string{
+		"idefinity=5y",
+		"idefinity:ratings=5y",
+		":comment=5y",
+		"a:comment=5y;a:comment=1y",
+		"a:comment=forever",
+	} {
+		if _, err := ParseRules(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	if rules, err := ParseRules(""); err != nil || len(rules) != 0 {
+		t.Errorf("expected no rules for empty config, got %v, %v", rules, err)
+	}
+}
+
+func TestPurger_FilterWildcardExcludesOwnRules(t *testing.T) {
+	rules, _ := ParseRules("idefinity:document=5y;*:document=2y;*:comment=1y")
+	p := New(nil, rules, false)
+
+	f := p.filter(rules[1], now)
+	want := bson.D{
+		{Key: "app", Value: bson.D{{Key: "$nin", Value: []string{"idefinity"}}}},
+		{Key: "received_at", Value: bson.D{{Key: "$lt", Value: time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)}}},
+	}
+	if !bsonEqual(t, f, want) {
+		t.Errorf("unexpected wildcard filter %v", f)
+	}
+
+	f = p.filter(rules[2], now)
+	if f[0].Key != "received_at" || f[1].Key != "$or" {
+		t.Errorf("expected comment wildcard without app clause, got %v", f)
+	}
+
+	f = p.filter(rules[0], now)
+	if f[0].Key != "app" || f[0].Value != "idefinity" {
+		t.Errorf("expected app-specific filter, got %v", f)
+	}
+}
+
+func TestPurger_TTLRule(t *testing.T) {
+	global, _ := ParseRules("*:document=5y;idefinity:comment=18mo")
+	if r, ok := New(nil, global, true).ttlRule(); !ok || r.App != AnyApp {
+		t.Errorf("expected wildcard document rule to use TTL, got %+v %v", r, ok)
+	}
+	if _, ok := New(nil, global, false).ttlRule(); ok {
+		t.Error("expected no TTL when disabled")
+	}
+
+	overridden, _ := ParseRules("*:document=5y;idefinity:document=2y")
+	if _, ok := New(nil, overridden, true).ttlRule(); ok {
+		t.Error("expected no TTL when an app overrides the wildcard document rule")
+	}
+}
+
+func TestAge_Approx(t *testing.T) {
+	a, _ := ParseAge("1y")
+	if a.Approx() != 365*24*time.Hour {
+		t.Errorf("unexpected approx %s", a.Approx())
+	}
+}
+
+func bsonEqual(t *testing.T, a, b bson.D) bool {
+	t.Helper()
+	ab, err := bson.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb, err := bson.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ab) == string(bb)
+}
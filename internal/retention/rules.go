@@ -0,0 +1,130 @@
+// Package retention enforces per-app data retention rules on the feedback
+// collection: comments are stripped or whole documents deleted once they are
+// older than the configured age.
+package retention
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule targets.
+const (
+	// TargetComment removes the comment (plaintext, encrypted and original)
+	// and free-text survey answers but keeps the rating and other answers.
+	TargetComment = "comment"
+	// TargetDocument deletes the whole document.
+	TargetDocument = "document"
+)
+
+// AnyApp in a rule applies it to every app without a rule of its own for the
+// same target.
+const AnyApp = "*"
+
+// Age is a retention period. Years, months and days use calendar arithmetic
+// so that "18mo" means the same date 18 months back, not 18 * 30 days.
+type Age struct {
+	Years, Months, Days int
+	raw                 string
+}
+
+// ParseAge parses ages such as "90d", "6w", "18mo" or "5y".
+func ParseAge(s string) (Age, error) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		apply  func(*Age, int)
+	}{
+		{"mo", func(a *Age, n int) { a.Months = n }},
+		{"y", func(a *Age, n int) { a.Years = n }},
+		{"w", func(a *Age, n int) { a.Days = 7 * n }},
+		{"d", func(a *Age, n int) { a.Days = n }},
+	}
+	for _, u := range units {
+		num, ok := strings.CutSuffix(s, u.suffix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil || n <= 0 {
+			return Age{}, fmt.Errorf("invalid retention age %q", s)
+		}
+		a := Age{raw: s}
+		u.apply(&a, n)
+		return a, nil
+	}
+	return Age{}, fmt.Errorf("invalid retention age %q: use a number followed by d, w, mo or y", s)
+}
+
+// Cutoff returns the instant before which data is older than the age.
+func (a Age) Cutoff(now time.Time) time.Time {
+	return now.AddDate(-a.Years, -a.Months, -a.Days)
+}
+
+// Approx returns the age as a fixed duration, using 365-day years and
+// 30-day months. It is only used for TTL indexes, which need seconds.
+func (a Age) Approx() time.Duration {
+	days := a.Years*365 + a.Months*30 + a.Days
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (a Age) String() string {
+	return a.raw
+}
+
+// Rule keeps one kind of data for one app for at most MaxAge.
+type Rule struct {
+	App    string
+	Target string
+	MaxAge Age
+}
+
+// ParseRules parses a semicolon-separated list of "app:target=age" entries,
+// e.g. "idefinity:comment=18mo; idefinity:document=5y; *:document=5y".
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		scope, age, ok := strings.Cut(entry, "=")
+		app, target, ok2 := strings.Cut(scope, ":")
+		app, target = strings.TrimSpace(app), strings.TrimSpace(target)
+		if !ok || !ok2 || app == "" {
+			return nil, fmt.Errorf("invalid retention rule %q: expected app:target=age", entry)
+		}
+		if target != TargetComment && target != TargetDocument {
+			return nil, fmt.Errorf("invalid retention rule %q: target must be %s or %s", entry, TargetComment, TargetDocument)
+		}
+		key := app + ":" + target
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate retention rule for %s", key)
+		}
+		seen[key] = true
+
+		a, err := ParseAge(age)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention rule %q: %w", entry, err)
+		}
+		rules = append(rules, Rule{App: app, Target: target, MaxAge: a})
+	}
+	return rules, nil
+}
+
+// appsWithOwnRule returns the specific apps that have a rule for target, so
+// that a wildcard rule for the same target can exclude them.
+func appsWithOwnRule(rules []Rule, target string) []string {
+	var apps []string
+	for _, r := range rules {
+		if r.Target == target && r.App != AnyApp {
+			apps = append(apps, r.App)
+		}
+	}
+	slices.Sort(apps)
+	return apps
+}
@@ -0,0 +1,279 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// metrics are published under "slack" on the expvar endpoint.
+var metrics = expvar.NewMap("slack")
+
+// Defaults for Config fields left zero.
+const (
+	DefaultBatchWindow = 20 * time.Second
+	DefaultTimeout     = 10 * time.Second
+)
+
+// maxAttempts is how often a message is posted before it is dropped.
+const maxAttempts = 3
+
+// RouteAll is the route app that catches apps without their own route.
+const RouteAll = "*"
+
+// routeOff as a route URL mutes an app.
+const routeOff = "off"
+
+// Config configures an Alerter.
+type Config struct {
+	// Routes maps an app to the incoming-webhook URL its alerts go to.
+	// RouteAll catches the other apps; "off" mutes an app.
+	Routes map[string]string
+	// QuietHours holds alerts until the quiet period ends.
+	QuietHours QuietHours
+	// BatchWindow is how long an alert waits for others to join it in a
+	// digest.
+	BatchWindow time.Duration
+	// Client posts the messages; it defaults to one with DefaultTimeout.
+	Client *http.Client
+}
+
+// ValidateRoutes checks that every route has an app and an absolute http or
+// https URL, or "off".
+func ValidateRoutes(routes map[string]string) error {
+	for app, u := range routes {
+		if app == "" {
+			return errors.New("route without app")
+		}
+		if u == routeOff {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return fmt.Errorf("route %s: url must be an absolute http or https URL", app)
+		}
+	}
+	return nil
+}
+
+// batch is the alerts collected for one webhook URL.
+type batch struct {
+	alerts   []Alert
+	total    int
+	due      time.Time
+	attempts int
+}
+
+// Alerter collects detractor alerts and posts them from Flush.
+type Alerter struct {
+	cfg Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	batches map[string]*batch
+}
+
+// New creates an Alerter. Routes must have passed ValidateRoutes.
+func New(cfg Config) *Alerter {
+	if cfg.BatchWindow <= 0 {
+		cfg.BatchWindow = DefaultBatchWindow
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Alerter{cfg: cfg, now: time.Now, batches: map[string]*batch{}}
+}
+
+// route returns the URL for app's alerts, or "" when there is none.
+func (a *Alerter) route(app string) string {
+	u, ok := a.cfg.Routes[app]
+	if !ok {
+		u = a.cfg.Routes[RouteAll]
+	}
+	if u == routeOff {
+		return ""
+	}
+	return u
+}
+
+// Notify queues an alert for fb when it is a detractor and not
+// quarantined. fb's comment must be the redacted plaintext.
+func (a *Alerter) Notify(fb *model.Feedback) {
+	if fb.NPSCategory != "detractor" || fb.Quarantine {
+		return
+	}
+	u := a.route(fb.App)
+	if u == "" {
+		return
+	}
+	now := a.now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.batches[u]
+	if !ok {
+		b = &batch{due: now.Add(a.cfg.BatchWindow)}
+		a.batches[u] = b
+	}
+	b.total++
+	if len(b.alerts) < maxDigestItems {
+		b.alerts = append(b.alerts, NewAlert(fb))
+	}
+	metrics.Add("queued", 1)
+}
+
+// Start flushes due batches every interval until ctx is cancelled. It then
+// posts what is left without waiting for the batch windows; alerts held for
+// quiet hours are dropped rather than sent in the middle of the night.
+func (a *Alerter) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), a.cfg.Client.Timeout+time.Second)
+			a.flush(flushCtx, true)
+			cancel()
+			if n := a.pending(); n > 0 {
+				slog.Warn("dropping slack alerts held for quiet hours", "alerts", n)
+				metrics.Add("dropped", int64(n))
+			}
+			return
+		case <-ticker.C:
+			a.Flush(ctx)
+		}
+	}
+}
+
+// Flush posts every batch whose window has closed, unless it is quiet
+// hours. A failed post is retried on the next flush.
+func (a *Alerter) Flush(ctx context.Context) {
+	a.flush(ctx, false)
+}
+
+// flush posts the due batches, or with final set every batch, as a last
+// attempt.
+func (a *Alerter) flush(ctx context.Context, final bool) {
+	now := a.now()
+	if a.cfg.QuietHours.Contains(now) {
+		return
+	}
+
+	a.mu.Lock()
+	due := map[string]*batch{}
+	for u, b := range a.batches {
+		if final || !now.Before(b.due) {
+			due[u] = b
+			delete(a.batches, u)
+		}
+	}
+	a.mu.Unlock()
+
+	for u, b := range due {
+		err := Post(ctx, a.cfg.Client, u, FormatDigest(b.alerts, b.total))
+		if err == nil {
+			metrics.Add("sent", 1)
+			continue
+		}
+		b.attempts++
+		if b.attempts >= maxAttempts || final {
+			slog.Error("dropping slack alert", "alerts", b.total, "error", err)
+			metrics.Add("dropped", int64(b.total))
+			continue
+		}
+		slog.Warn("failed to post slack alert, will retry", "alerts", b.total, "error", err)
+		a.requeue(u, b)
+	}
+}
+
+// pending returns how many alerts are waiting.
+func (a *Alerter) pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for _, b := range a.batches {
+		n += b.total
+	}
+	return n
+}
+
+// requeue merges a failed batch back in front of alerts that arrived
+// meanwhile.
+func (a *Alerter) requeue(u string, b *batch) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if newer, ok := a.batches[u]; ok {
+		b.total += newer.total
+		b.alerts = append(b.alerts, newer.alerts...)[:min(len(b.alerts)+len(newer.alerts), maxDigestItems)]
+	}
+	a.batches[u] = b
+}
+
+// QuietHours is a daily period, such as 22:00-07:00, during which alerts
+// are held. The zero value has no quiet period.
+type QuietHours struct {
+	// Start and End are minutes after midnight in Location; End may be
+	// before Start for a period spanning midnight.
+	Start, End int
+	Location   *time.Location
+}
+
+// ParseQuietHours parses "HH:MM-HH:MM" in loc. An empty string means no
+// quiet hours.
+func ParseQuietHours(s string, loc *time.Location) (QuietHours, error) {
+	if s == "" {
+		return QuietHours{}, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return QuietHours{}, fmt.Errorf("quiet hours %q: expected HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return QuietHours{}, fmt.Errorf("quiet hours %q: %w", s, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return QuietHours{}, fmt.Errorf("quiet hours %q: %w", s, err)
+	}
+	if start == end {
+		return QuietHours{}, fmt.Errorf("quiet hours %q: start and end are equal", s)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return QuietHours{Start: start, End: end, Location: loc}, nil
+}
+
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hour, herr := strconv.Atoi(h)
+	minute, merr := strconv.Atoi(m)
+	if !ok || herr != nil || merr != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// Contains reports whether t falls in the quiet period.
+func (q QuietHours) Contains(t time.Time) bool {
+	if q.Location == nil {
+		return false
+	}
+	local := t.In(q.Location)
+	m := local.Hour()*60 + local.Minute()
+	if q.Start < q.End {
+		return m >= q.Start && m < q.End
+	}
+	return m >= q.Start || m < q.End
+}
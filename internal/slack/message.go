@@ -0,0 +1,173 @@
+// Package slack posts detractor alerts to Slack incoming webhooks. The
+// Alerter routes each alert by app, holds alerts during quiet hours and
+// folds bursts into one digest message; messages use Block Kit, so any
+// endpoint that accepts Slack's incoming-webhook format works.
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Excerpt lengths, in characters, for a single alert and a digest entry.
+const (
+	ExcerptLength       = 500
+	DigestExcerptLength = 150
+)
+
+// maxDigestItems is how many alerts a digest lists; the rest are counted.
+const maxDigestItems = 10
+
+// Alert is the part of a submission an alert shows. The comment is the
+// redacted plaintext.
+type Alert struct {
+	FeedbackID bson.ObjectID
+	App        string
+	AppVersion string
+	Platform   string
+	Rating     int
+	Comment    string
+	ReceivedAt time.Time
+}
+
+// NewAlert returns the alert for fb, whose comment must not be encrypted.
+func NewAlert(fb *model.Feedback) Alert {
+	return Alert{
+		FeedbackID: fb.ID,
+		App:        fb.App,
+		AppVersion: fb.AppVersion,
+		Platform:   fb.Platform,
+		Rating:     fb.NPSRating,
+		Comment:    fb.Comment,
+		ReceivedAt: fb.ReceivedAt,
+	}
+}
+
+// Message is an incoming-webhook payload. Text is the notification
+// fallback shown where blocks are not rendered.
+type Message struct {
+	Text   string  `json:"text"`
+	Blocks []Block `json:"blocks"`
+}
+
+// Block is a Block Kit layout block. Only the fields of the header, section
+// and context types are modelled.
+type Block struct {
+	Type     string `json:"type"`
+	Text     *Text  `json:"text,omitempty"`
+	Fields   []Text `json:"fields,omitempty"`
+	Elements []Text `json:"elements,omitempty"`
+}
+
+// Text is a Block Kit text object of type plain_text or mrkdwn.
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func plain(s string) *Text { return &Text{Type: "plain_text", Text: s} }
+
+func mrkdwn(s string) Text { return Text{Type: "mrkdwn", Text: s} }
+
+// FormatAlert renders one alert with its details and comment excerpt.
+func FormatAlert(a Alert) Message {
+	summary := fmt.Sprintf("Detractor %d/10 for %s %s on %s", a.Rating, Escape(a.App), Escape(a.AppVersion), Escape(a.Platform))
+	blocks := []Block{
+		{Type: "header", Text: plain(fmt.Sprintf("New detractor: %d/10", a.Rating))},
+		{Type: "section", Fields: []Text{
+			mrkdwn("*App*\n" + Escape(a.App)),
+			mrkdwn("*Version*\n" + Escape(a.AppVersion)),
+			mrkdwn("*Platform*\n" + Escape(a.Platform)),
+			mrkdwn(fmt.Sprintf("*Rating*\n%d/10", a.Rating)),
+		}},
+	}
+	if a.Comment != "" {
+		blocks = append(blocks, Block{Type: "section", Text: ptr(mrkdwn(quote(Excerpt(a.Comment, ExcerptLength))))})
+	} else {
+		blocks = append(blocks, Block{Type: "section", Text: ptr(mrkdwn("_No comment_"))})
+	}
+	blocks = append(blocks, Block{Type: "context", Elements: []Text{
+		mrkdwn(fmt.Sprintf("Feedback %s · received %s", a.FeedbackID.Hex(), a.ReceivedAt.UTC().Format(time.RFC3339))),
+	}})
+	return Message{Text: summary, Blocks: blocks}
+}
+
+// FormatDigest renders a burst of alerts as one message. total counts all
+// alerts in the burst, of which alerts lists the first ones.
+func FormatDigest(alerts []Alert, total int) Message {
+	if total == 1 && len(alerts) == 1 {
+		return FormatAlert(alerts[0])
+	}
+	title := fmt.Sprintf("%d new detractors", total)
+	blocks := []Block{{Type: "header", Text: plain(title)}}
+	for _, a := range alerts {
+		line := fmt.Sprintf("*%d/10* · %s %s · %s", a.Rating, Escape(a.App), Escape(a.AppVersion), Escape(a.Platform))
+		if a.Comment != "" {
+			line += "\n" + quote(Excerpt(a.Comment, DigestExcerptLength))
+		}
+		blocks = append(blocks, Block{Type: "section", Text: ptr(mrkdwn(line))})
+	}
+	if more := total - len(alerts); more > 0 {
+		blocks = append(blocks, Block{Type: "context", Elements: []Text{mrkdwn(fmt.Sprintf("…and %d more", more))}})
+	}
+	return Message{Text: title, Blocks: blocks}
+}
+
+func ptr(t Text) *Text { return &t }
+
+// Escape escapes the characters Slack treats as control sequences in
+// mrkdwn, so that comments cannot ping channels or inject links.
+func Escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// Excerpt escapes s and shortens it to at most n characters, ending it with
+// an ellipsis when cut.
+func Excerpt(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) > n {
+		runes := []rune(s)
+		s = strings.TrimSpace(string(runes[:n-1])) + "…"
+	}
+	return Escape(s)
+}
+
+// quote formats s as a mrkdwn block quote.
+func quote(s string) string {
+	return "> " + strings.ReplaceAll(s, "\n", "\n> ")
+}
+
+// Post sends msg to an incoming-webhook URL. Slack answers 200 with the
+// body "ok"; any other status is an error.
+func Post(ctx context.Context, client *http.Client, url string, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("slack returned %d: %s", resp.StatusCode, bytes.TrimSpace(excerpt))
+	}
+	return nil
+}
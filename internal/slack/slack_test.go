@@ -0,0 +1,200 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// standIn is a local incoming webhook that records the messages it gets
+// and fails the first failures requests.
+type standIn struct {
+	mu       sync.Mutex
+	failures int
+	messages []Message
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		http.Error(w, "invalid_token", http.StatusForbidden)
+		return
+	}
+	var m Message
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, "invalid_payload", http.StatusBadRequest)
+		return
+	}
+	s.messages = append(s.messages, m)
+	w.Write([]byte("ok"))
+}
+
+func detractor(app string, rating int, comment string) *model.Feedback {
+	return &model.Feedback{
+		ID: bson.NewObjectID(), App: app, AppVersion: "1.4.0", Platform: "macOS",
+		NPSRating: rating, NPSCategory: "detractor", Comment: comment,
+		ReceivedAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestFormatAlert(t *testing.T) {
+	m := FormatAlert(NewAlert(detractor("idefinity", 3, "Sync <!channel> is slow & flaky")))
+	body, _ := json.Marshal(m)
+	for _, want := range []string{`"type":"header"`, `New detractor: 3/10`, `*Version*\n1.4.0`, `*Platform*\nmacOS`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %s in %s", want, body)
+		}
+	}
+	if got := m.Blocks[2].Text.Text; got != "> Sync &lt;!channel&gt; is slow &amp; flaky" {
+		t.Errorf("expected an escaped quote, got %q", got)
+	}
+	if m.Text != "Detractor 3/10 for idefinity 1.4.0 on macOS" {
+		t.Errorf("unexpected fallback text %q", m.Text)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	if got := Excerpt("  short  ", 10); got != "short" {
+		t.Errorf("got %q", got)
+	}
+	if got := Excerpt("äöåäöåäöåäöå", 5); got != "äöåä…" {
+		t.Errorf("expected a rune-safe cut, got %q", got)
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	q, err := ParseQuietHours("22:00-07:00", helsinki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		utc  string
+		want bool
+	}{
+		{"2026-03-01T19:59:00Z", false}, // 21:59 local
+		{"2026-03-01T20:00:00Z", true},  // 22:00
+		{"2026-03-02T04:59:00Z", true},  // 06:59
+		{"2026-03-02T05:00:00Z", false}, // 07:00
+	}
+	for _, tt := range tests {
+		ts, _ := time.Parse(time.RFC3339, tt.utc)
+		if got := q.Contains(ts); got != tt.want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.utc, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"22-07", "25:00-07:00", "08:00-08:00", "22:00"} {
+		if _, err := ParseQuietHours(bad, nil); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+	if (QuietHours{}).Contains(time.Now()) {
+		t.Error("expected the zero value to never be quiet")
+	}
+}
+
+func newTestAlerter(cfg Config, now *time.Time) *Alerter {
+	a := New(cfg)
+	a.now = func() time.Time { return *now }
+	return a
+}
+
+func TestAlerter_RoutesAndBatches(t *testing.T) {
+	general, other := &standIn{}, &standIn{}
+	generalSrv, otherSrv := httptest.NewServer(general), httptest.NewServer(other)
+	defer generalSrv.Close()
+	defer otherSrv.Close()
+	if err := ValidateRoutes(map[string]string{"*": generalSrv.URL, "muted": "off", "bad": "hooks"}); err == nil {
+		t.Error("expected a relative route URL to be rejected")
+	}
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := newTestAlerter(Config{
+		Routes:      map[string]string{RouteAll: generalSrv.URL, "devtool": otherSrv.URL, "muted": "off"},
+		BatchWindow: 30 * time.Second,
+	}, &now)
+	ctx := context.Background()
+
+	a.Notify(detractor("idefinity", 2, "Crashes"))
+	a.Notify(detractor("muted", 1, "Ignored"))
+	promoter := detractor("idefinity", 10, "")
+	promoter.NPSCategory = "promoter"
+	a.Notify(promoter)
+	quarantined := detractor("idefinity", 0, "spam")
+	quarantined.Quarantine = true
+	a.Notify(quarantined)
+	a.Notify(detractor("devtool", 4, ""))
+
+	a.Flush(ctx)
+	if len(general.messages)+len(other.messages) != 0 {
+		t.Fatal("expected nothing before the batch window closes")
+	}
+
+	now = now.Add(10 * time.Second)
+	for range 12 {
+		a.Notify(detractor("idefinity", 5, "Too expensive"))
+	}
+	now = now.Add(20 * time.Second)
+	a.Flush(ctx)
+
+	if len(other.messages) != 1 || other.messages[0].Blocks[0].Text.Text != "New detractor: 4/10" {
+		t.Fatalf("expected one single alert on the devtool route, got %+v", other.messages)
+	}
+	if len(general.messages) != 1 {
+		t.Fatalf("expected the burst as one digest, got %d messages", len(general.messages))
+	}
+	digest := general.messages[0]
+	if digest.Text != "13 new detractors" || len(digest.Blocks) != 1+maxDigestItems+1 {
+		t.Errorf("unexpected digest %q with %d blocks", digest.Text, len(digest.Blocks))
+	}
+	if last := digest.Blocks[len(digest.Blocks)-1]; last.Elements[0].Text != "…and 3 more" {
+		t.Errorf("expected the overflow count, got %+v", last)
+	}
+}
+
+func TestAlerter_QuietHoursAndRetry(t *testing.T) {
+	stand := &standIn{failures: 1}
+	srv := httptest.NewServer(stand)
+	defer srv.Close()
+
+	quiet, _ := ParseQuietHours("22:00-07:00", time.UTC)
+	now := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	a := newTestAlerter(Config{Routes: map[string]string{RouteAll: srv.URL}, QuietHours: quiet}, &now)
+	ctx := context.Background()
+
+	a.Notify(detractor("idefinity", 1, "Night owl"))
+	now = now.Add(time.Hour)
+	a.Notify(detractor("idefinity", 2, ""))
+	a.Flush(ctx)
+	if len(stand.messages) != 0 {
+		t.Fatal("expected alerts to be held during quiet hours")
+	}
+
+	now = time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+	a.Flush(ctx) // rejected by the stand-in, kept for a retry
+	if len(stand.messages) != 0 || a.pending() != 2 {
+		t.Fatalf("expected the failed digest to be kept, pending %d", a.pending())
+	}
+	a.Flush(ctx)
+	if len(stand.messages) != 1 || stand.messages[0].Text != "2 new detractors" {
+		t.Fatalf("expected one digest after quiet hours, got %+v", stand.messages)
+	}
+	if a.pending() != 0 {
+		t.Errorf("expected nothing pending, got %d", a.pending())
+	}
+}
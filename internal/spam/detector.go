@@ -0,0 +1,289 @@
+// Package spam scores feedback submissions for signs of flooding and abuse.
+//
+// The Detector keeps all of its state in memory: per-IP and per-install
+// submission rates, and a bounded ring of recent comments for duplicate
+// detection. That is enough for a single replica; with several replicas each
+// one sees only its own share of traffic, which still catches the common
+// single-source flood.
+package spam
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Reasons reported in Verdict.Reasons and stored on quarantined documents.
+const (
+	ReasonBurstIP          = "burst_ip"
+	ReasonBurstInstall     = "burst_install"
+	ReasonDuplicate        = "duplicate_comment"
+	ReasonNearDuplicate    = "near_duplicate_comment"
+	ReasonURLHeavy         = "url_heavy"
+	ReasonKeywordHeavy     = "keyword_heavy"
+	ReasonTimestampSkew    = "timestamp_skew"
+	ReasonTimestampInvalid = "timestamp_invalid"
+)
+
+var reasonWeights = map[string]int{
+	ReasonBurstIP:          50,
+	ReasonBurstInstall:     50,
+	ReasonDuplicate:        60,
+	ReasonNearDuplicate:    40,
+	ReasonURLHeavy:         40,
+	ReasonKeywordHeavy:     30,
+	ReasonTimestampSkew:    20,
+	ReasonTimestampInvalid: 20,
+}
+
+// DefaultKeywords is used when Config.Keywords is nil.
+var DefaultKeywords = []string{
+	"casino", "viagra", "cialis", "loan", "crypto", "bitcoin", "forex",
+	"porn", "escort", "seo services", "buy now", "click here", "free money",
+}
+
+// Config tunes the detector. Zero values are replaced by the defaults noted
+// on each field.
+type Config struct {
+	// BurstWindow is the sliding window for rate checks. Default 10m.
+	BurstWindow time.Duration
+	// MaxPerIP is the number of submissions allowed per client IP within
+	// BurstWindow before the burst_ip rule fires. Default 10.
+	MaxPerIP int
+	// MaxPerInstall is the same limit per install ID. Default 3.
+	MaxPerInstall int
+
+	// RecentComments is how many recent comments are kept for duplicate
+	// checks. Default 500.
+	RecentComments int
+	// MinDuplicateLength is the shortest normalized comment that is checked
+	// for duplicates, so that "great app" from many users is not flagged.
+	// Default 20.
+	MinDuplicateLength int
+	// NearDuplicateThreshold is the Jaccard similarity of comment shingles
+	// above which two comments count as near-duplicates. Default 0.8.
+	NearDuplicateThreshold float64
+
+	// MaxURLs is the number of links a comment may hold before url_heavy
+	// fires. Default 2.
+	MaxURLs int
+	// Keywords are case-insensitive spam phrases. Default DefaultKeywords.
+	Keywords []string
+	// MaxKeywordHits is the number of keyword matches that trigger
+	// keyword_heavy. Default 2.
+	MaxKeywordHits int
+
+	// MaxFutureSkew and MaxPastSkew bound how far the client timestamp may be
+	// from server time. Defaults 24h and 30 days.
+	MaxFutureSkew time.Duration
+	MaxPastSkew   time.Duration
+
+	// QuarantineScore is the score at or above which a submission is
+	// quarantined. Default 50.
+	QuarantineScore int
+}
+
+func (c *Config) applyDefaults() {
+	if c.BurstWindow <= 0 {
+		c.BurstWindow = 10 * time.Minute
+	}
+	if c.MaxPerIP <= 0 {
+		c.MaxPerIP = 10
+	}
+	if c.MaxPerInstall <= 0 {
+		c.MaxPerInstall = 3
+	}
+	if c.RecentComments <= 0 {
+		c.RecentComments = 500
+	}
+	if c.MinDuplicateLength <= 0 {
+		c.MinDuplicateLength = 20
+	}
+	if c.NearDuplicateThreshold <= 0 || c.NearDuplicateThreshold > 1 {
+		c.NearDuplicateThreshold = 0.8
+	}
+	if c.MaxURLs <= 0 {
+		c.MaxURLs = 2
+	}
+	if c.Keywords == nil {
+		c.Keywords = DefaultKeywords
+	}
+	if c.MaxKeywordHits <= 0 {
+		c.MaxKeywordHits = 2
+	}
+	if c.MaxFutureSkew <= 0 {
+		c.MaxFutureSkew = 24 * time.Hour
+	}
+	if c.MaxPastSkew <= 0 {
+		c.MaxPastSkew = 30 * 24 * time.Hour
+	}
+	if c.QuarantineScore <= 0 {
+		c.QuarantineScore = 50
+	}
+}
+
+// Source identifies where a submission came from.
+type Source struct {
+	IP        string
+	InstallID string
+}
+
+// Verdict is the outcome of scoring one submission.
+type Verdict struct {
+	Score      int
+	Reasons    []string
+	Quarantine bool
+}
+
+// Detector scores submissions. It is safe for concurrent use.
+type Detector struct {
+	cfg      Config
+	keywords []string
+
+	mu       sync.Mutex
+	ipRate   *rateWindow
+	instRate *rateWindow
+	recent   *commentRing
+}
+
+// New creates a Detector from cfg.
+func New(cfg Config) *Detector {
+	cfg.applyDefaults()
+	kw := make([]string, 0, len(cfg.Keywords))
+	for _, k := range cfg.Keywords {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			kw = append(kw, k)
+		}
+	}
+	return &Detector{
+		cfg:      cfg,
+		keywords: kw,
+		ipRate:   newRateWindow(cfg.BurstWindow),
+		instRate: newRateWindow(cfg.BurstWindow),
+		recent:   newCommentRing(cfg.RecentComments),
+	}
+}
+
+// Check scores fb, which must already have passed Validate, and records it in
+// the detector's rate and duplicate state.
+func (d *Detector) Check(fb *model.Feedback, src Source, now time.Time) Verdict {
+	var reasons []string
+
+	d.mu.Lock()
+	if src.IP != "" && d.ipRate.add(src.IP, now) > d.cfg.MaxPerIP {
+		reasons = append(reasons, ReasonBurstIP)
+	}
+	if src.InstallID != "" && d.instRate.add(src.InstallID, now) > d.cfg.MaxPerInstall {
+		reasons = append(reasons, ReasonBurstInstall)
+	}
+	if norm := normalize(fb.Comment); len(norm) >= d.cfg.MinDuplicateLength {
+		sh := shingles(norm)
+		switch d.recent.match(norm, sh, d.cfg.NearDuplicateThreshold) {
+		case matchExact:
+			reasons = append(reasons, ReasonDuplicate)
+		case matchNear:
+			reasons = append(reasons, ReasonNearDuplicate)
+		}
+		d.recent.add(norm, sh)
+	}
+	d.mu.Unlock()
+
+	if countURLs(fb.Comment) > d.cfg.MaxURLs {
+		reasons = append(reasons, ReasonURLHeavy)
+	}
+	if d.keywordHits(fb.Comment) >= d.cfg.MaxKeywordHits {
+		reasons = append(reasons, ReasonKeywordHeavy)
+	}
+	if r := d.checkTimestamp(fb.Timestamp, now); r != "" {
+		reasons = append(reasons, r)
+	}
+
+	v := Verdict{Reasons: reasons}
+	for _, r := range reasons {
+		v.Score += reasonWeights[r]
+	}
+	v.Quarantine = v.Score >= d.cfg.QuarantineScore
+	return v
+}
+
+func (d *Detector) keywordHits(comment string) int {
+	if comment == "" {
+		return 0
+	}
+	lower := strings.ToLower(comment)
+	hits := 0
+	for _, k := range d.keywords {
+		hits += strings.Count(lower, k)
+	}
+	return hits
+}
+
+var timestampLayouts = []string{time.RFC3339, "2006-01-02T15:04:05"}
+
+func (d *Detector) checkTimestamp(ts string, now time.Time) string {
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, ts)
+		if err != nil {
+			continue
+		}
+		if t.After(now.Add(d.cfg.MaxFutureSkew)) || t.Before(now.Add(-d.cfg.MaxPastSkew)) {
+			return ReasonTimestampSkew
+		}
+		return ""
+	}
+	return ReasonTimestampInvalid
+}
+
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+func countURLs(comment string) int {
+	n := 0
+	for _, m := range urlPattern.FindAllString(comment, -1) {
+		if strings.HasPrefix(strings.ToLower(m), "www.") {
+			n++
+			continue
+		}
+		if u, err := url.Parse(m); err == nil && u.Host != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// rateWindow counts events per key over a sliding window.
+type rateWindow struct {
+	window    time.Duration
+	events    map[string][]time.Time
+	lastSweep time.Time
+}
+
+func newRateWindow(window time.Duration) *rateWindow {
+	return &rateWindow{window: window, events: make(map[string][]time.Time)}
+}
+
+// add records an event for key and returns the number of events for key
+// inside the window, including this one.
+func (w *rateWindow) add(key string, now time.Time) int {
+	cutoff := now.Add(-w.window)
+	if now.Sub(w.lastSweep) >= w.window {
+		for k, ts := range w.events {
+			if len(ts) == 0 || !ts[len(ts)-1].After(cutoff) {
+				delete(w.events, k)
+			}
+		}
+		w.lastSweep = now
+	}
+
+	ts := w.events[key]
+	i := 0
+	for i < len(ts) && !ts[i].After(cutoff) {
+		i++
+	}
+	ts = append(ts[i:], now)
+	w.events[key] = ts
+	return len(ts)
+}
@@ -0,0 +1,162 @@
+package spam
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+var now = time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+func feedback(comment string) *model.Feedback {
+	return &model.Feedback{
+		SchemaVersion: "1.0",
+		App:           "idefinity",
+		AppVersion:    "0.1.0",
+		Platform:      "macOS",
+		Timestamp:     now.Add(-time.Minute).Format(time.RFC3339),
+		NPSRating:     9,
+		NPSCategory:   "promoter",
+		Comment:       comment,
+	}
+}
+
+func TestCheck_CleanSubmission(t *testing.T) {
+	d := New(Config{})
+	v := d.Check(feedback("Love the IDEF0 modeling workflow."), Source{IP: "10.0.0.1"}, now)
+	if v.Score != 0 || v.Quarantine || len(v.Reasons) != 0 {
+		t.Errorf("expected clean verdict, got %+v", v)
+	}
+}
+
+func TestCheck_BurstPerIP(t *testing.T) {
+	d := New(Config{MaxPerIP: 3, BurstWindow: time.Minute})
+	src := Source{IP: "10.0.0.1"}
+
+	var v Verdict
+	for i := 0; i < 4; i++ {
+		v = d.Check(feedback(""), src, now.Add(time.Duration(i)*time.Second))
+	}
+	if !slices.Contains(v.Reasons, ReasonBurstIP) || !v.Quarantine {
+		t.Errorf("expected 4th submission in window to be quarantined for burst, got %+v", v)
+	}
+
+	v = d.Check(feedback(""), src, now.Add(5*time.Minute))
+	if slices.Contains(v.Reasons, ReasonBurstIP) {
+		t.Errorf("expected burst to clear after the window, got %+v", v)
+	}
+
+	v = d.Check(feedback(""), Source{IP: "10.0.0.2"}, now.Add(4*time.Second))
+	if slices.Contains(v.Reasons, ReasonBurstIP) {
+		t.Errorf("expected other IPs to be unaffected, got %+v", v)
+	}
+}
+
+func TestCheck_BurstPerInstall(t *testing.T) {
+	d := New(Config{MaxPerInstall: 1})
+
+	d.Check(feedback(""), Source{IP: "10.0.0.1", InstallID: "abc"}, now)
+	v := d.Check(feedback(""), Source{IP: "10.0.0.2", InstallID: "abc"}, now)
+	if !slices.Contains(v.Reasons, ReasonBurstInstall) {
+		t.Errorf("expected burst_install across IPs, got %+v", v)
+	}
+}
+
+func TestCheck_DuplicateComments(t *testing.T) {
+	d := New(Config{})
+	base := "The export to PDF is broken since the last update, please fix it soon"
+
+	d.Check(feedback(base), Source{IP: "1.1.1.1"}, now)
+
+	v := d.Check(feedback(strings.ToUpper(base)+"!!!"), Source{IP: "2.2.2.2"}, now)
+	if !slices.Contains(v.Reasons, ReasonDuplicate) {
+		t.Errorf("expected exact duplicate after normalization, got %+v", v)
+	}
+
+	v = d.Check(feedback(base+" thanks"), Source{IP: "3.3.3.3"}, now)
+	if !slices.Contains(v.Reasons, ReasonNearDuplicate) {
+		t.Errorf("expected near duplicate, got %+v", v)
+	}
+
+	v = d.Check(feedback("Completely different text about diagram layout options"), Source{IP: "4.4.4.4"}, now)
+	if len(v.Reasons) != 0 {
+		t.Errorf("expected unrelated comment to pass, got %+v", v)
+	}
+}
+
+func TestCheck_ShortCommentsNotDuplicateChecked(t *testing.T) {
+	d := New(Config{})
+	d.Check(feedback("Great app"), Source{}, now)
+	v := d.Check(feedback("Great app"), Source{}, now)
+	if len(v.Reasons) != 0 {
+		t.Errorf("expected short common comments to pass, got %+v", v)
+	}
+}
+
+func TestCheck_URLAndKeywordHeavy(t *testing.T) {
+	d := New(Config{})
+
+	v := d.Check(feedback("see https://a.example http://b.example www.c.example"), Source{}, now)
+	if !slices.Contains(v.Reasons, ReasonURLHeavy) {
+		t.Errorf("expected url_heavy, got %+v", v)
+	}
+
+	v = d.Check(feedback("Best CASINO bonus, click here"), Source{}, now)
+	if !slices.Contains(v.Reasons, ReasonKeywordHeavy) {
+		t.Errorf("expected keyword_heavy, got %+v", v)
+	}
+}
+
+func TestCheck_TimestampSkew(t *testing.T) {
+	d := New(Config{})
+
+	tests := []struct {
+		name string
+		ts   string
+		want string
+	}{
+		{"recent with offset", "2025-06-15T14:00:00+03:00", ""},
+		{"recent without offset", "2025-06-15T11:00:00", ""},
+		{"far future", "2025-06-20T10:00:00Z", ReasonTimestampSkew},
+		{"far past", "2024-01-01T00:00:00Z", ReasonTimestampSkew},
+		{"garbage", "yesterday", ReasonTimestampInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fb := feedback("")
+			fb.Timestamp = tt.ts
+			v := d.Check(fb, Source{}, now)
+			if tt.want == "" && len(v.Reasons) != 0 {
+				t.Errorf("expected no reasons, got %v", v.Reasons)
+			}
+			if tt.want != "" && !slices.Contains(v.Reasons, tt.want) {
+				t.Errorf("expected %s, got %v", tt.want, v.Reasons)
+			}
+		})
+	}
+}
+
+func TestCheck_ScoreBelowThresholdNotQuarantined(t *testing.T) {
+	d := New(Config{})
+	fb := feedback("")
+	fb.Timestamp = "2024-01-01T00:00:00Z"
+
+	v := d.Check(fb, Source{}, now)
+	if v.Score == 0 || v.Quarantine {
+		t.Errorf("expected a scored but not quarantined verdict, got %+v", v)
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	a := shingles(normalize("one two three four"))
+	b := shingles(normalize("one two three five"))
+	if got := jaccard(a, b); got <= 0 || got >= 1 {
+		t.Errorf("expected partial overlap, got %f", got)
+	}
+	if got := jaccard(a, a); got != 1 {
+		t.Errorf("expected identical sets to score 1, got %f", got)
+	}
+}
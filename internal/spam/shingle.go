@@ -0,0 +1,120 @@
+package spam
+
+import (
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// shingleSize is the number of consecutive words per shingle. Comments shorter
+// than this fall back to character shingles of the same width.
+const shingleSize = 3
+
+type matchKind int
+
+const (
+	matchNone matchKind = iota
+	matchNear
+	matchExact
+)
+
+// normalize lowercases s and collapses every run of non-alphanumeric runes to
+// a single space, so that punctuation and spacing tricks do not defeat the
+// duplicate checks.
+func normalize(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := true
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), " ")
+}
+
+// shingles returns the set of hashed w-shingles of a normalized comment.
+func shingles(norm string) map[uint64]struct{} {
+	words := strings.Fields(norm)
+	set := make(map[uint64]struct{})
+	if len(words) < shingleSize {
+		runes := []rune(norm)
+		for i := 0; i+shingleSize <= len(runes); i++ {
+			set[hashString(string(runes[i:i+shingleSize]))] = struct{}{}
+		}
+		return set
+	}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		set[hashString(strings.Join(words[i:i+shingleSize], " "))] = struct{}{}
+	}
+	return set
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// jaccard returns |a ∩ b| / |a ∪ b|.
+func jaccard(a, b map[uint64]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	inter := 0
+	for k := range a {
+		if _, ok := b[k]; ok {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+type recentComment struct {
+	hash     uint64
+	shingles map[uint64]struct{}
+}
+
+// commentRing holds the most recent comments for duplicate checks, evicting
+// the oldest once full.
+type commentRing struct {
+	items []recentComment
+	next  int
+}
+
+func newCommentRing(size int) *commentRing {
+	return &commentRing{items: make([]recentComment, 0, size)}
+}
+
+func (c *commentRing) add(norm string, sh map[uint64]struct{}) {
+	rc := recentComment{hash: hashString(norm), shingles: sh}
+	if len(c.items) < cap(c.items) {
+		c.items = append(c.items, rc)
+		return
+	}
+	c.items[c.next] = rc
+	c.next = (c.next + 1) % len(c.items)
+}
+
+func (c *commentRing) match(norm string, sh map[uint64]struct{}, threshold float64) matchKind {
+	h := hashString(norm)
+	best := matchNone
+	for _, rc := range c.items {
+		if rc.hash == h {
+			return matchExact
+		}
+		if best == matchNone && jaccard(sh, rc.shingles) >= threshold {
+			best = matchNear
+		}
+	}
+	return best
+}
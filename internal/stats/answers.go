@@ -0,0 +1,112 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// AnswerSummary tallies the choice answers to one survey. It is computed
+// from raw feedback, not the daily rollup.
+type AnswerSummary struct {
+	SurveyID string `json:"survey_id"`
+	// SurveyVersion is zero when the tally spans every version.
+	SurveyVersion int `json:"survey_version,omitempty"`
+	// Responses counts the submissions that referenced the survey.
+	Responses int64           `json:"responses"`
+	Questions []QuestionTally `json:"questions"`
+}
+
+// QuestionTally counts the choices picked for one choice question.
+// Answered counts the responses that answered it; with multiple choices the
+// choice counts can add up to more.
+type QuestionTally struct {
+	QuestionID string           `json:"question_id"`
+	Answered   int64            `json:"answered"`
+	Choices    map[string]int64 `json:"choices"`
+}
+
+// answerGroup is one row of the tally aggregation: how often a choice was
+// picked for a question, and how often it was the answer's first choice.
+type answerGroup struct {
+	ID struct {
+		QuestionID string `bson:"question_id"`
+		Choice     string `bson:"choice"`
+	} `bson:"_id"`
+	Count int64 `bson:"count"`
+	First int64 `bson:"first"`
+}
+
+// Answers tallies the choice answers to survey surveyID within f, for one
+// version or, when version is zero, all of them. Rating and free-text
+// answers are not tallied.
+func (r *Reader) Answers(ctx context.Context, f Filter, surveyID string, version int) (AnswerSummary, error) {
+	res := AnswerSummary{SurveyID: surveyID, SurveyVersion: version, Questions: []QuestionTally{}}
+	match := append(f.FeedbackFilter(), bson.E{Key: "survey_id", Value: surveyID})
+	if version > 0 {
+		match = append(match, bson.E{Key: "survey_version", Value: version})
+	}
+
+	var err error
+	if res.Responses, err = r.feedback.CountDocuments(ctx, match); err != nil {
+		return res, fmt.Errorf("failed to count survey responses: %w", err)
+	}
+	if res.Responses == 0 {
+		return res, nil
+	}
+
+	cur, err := r.feedback.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: "$answers"}},
+		// Answers without choices drop out here.
+		{{Key: "$unwind", Value: bson.D{
+			{Key: "path", Value: "$answers.choices"},
+			{Key: "includeArrayIndex", Value: "choice_index"},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "question_id", Value: "$answers.question_id"},
+				{Key: "choice", Value: "$answers.choices"},
+			}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "first", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$eq", Value: bson.A{"$choice_index", 0}}}, 1, 0,
+			}}}}}},
+		}}},
+	})
+	if err != nil {
+		return res, fmt.Errorf("failed to aggregate survey answers: %w", err)
+	}
+	var groups []answerGroup
+	if err := cur.All(ctx, &groups); err != nil {
+		return res, fmt.Errorf("failed to aggregate survey answers: %w", err)
+	}
+	res.Questions = tallyAnswers(groups)
+	return res, nil
+}
+
+// tallyAnswers folds the aggregation rows into one tally per question,
+// ordered by question ID. Every answer has exactly one first choice, so
+// summing those counts the answers.
+func tallyAnswers(groups []answerGroup) []QuestionTally {
+	byQuestion := map[string]*QuestionTally{}
+	for _, g := range groups {
+		t, ok := byQuestion[g.ID.QuestionID]
+		if !ok {
+			t = &QuestionTally{QuestionID: g.ID.QuestionID, Choices: map[string]int64{}}
+			byQuestion[g.ID.QuestionID] = t
+		}
+		t.Choices[g.ID.Choice] += g.Count
+		t.Answered += g.First
+	}
+	out := make([]QuestionTally, 0, len(byQuestion))
+	for _, t := range byQuestion {
+		out = append(out, *t)
+	}
+	slices.SortFunc(out, func(a, b QuestionTally) int { return strings.Compare(a.QuestionID, b.QuestionID) })
+	return out
+}
@@ -0,0 +1,74 @@
+package stats
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Breakdown dimensions.
+const (
+	ByApp        = "app"
+	ByAppVersion = "app_version"
+	ByPlatform   = "platform"
+)
+
+// Group is the summary for one value of a breakdown dimension.
+type Group struct {
+	Value string `json:"value"`
+	Summary
+}
+
+// Breakdown returns one summary per app, app version or platform, largest
+// first, from the daily rollup. The filter must be day-aligned and cannot
+// select a locale.
+func (r *Reader) Breakdown(ctx context.Context, f Filter, by string) ([]Group, error) {
+	if by != ByApp && by != ByAppVersion && by != ByPlatform {
+		return nil, fmt.Errorf("breakdown must be by %s, %s or %s", ByApp, ByAppVersion, ByPlatform)
+	}
+	if !f.dayAligned() {
+		return nil, fmt.Errorf("breakdown bounds must fall on UTC day boundaries")
+	}
+	if f.Locale != "" {
+		return nil, fmt.Errorf("breakdown cannot filter by locale")
+	}
+
+	cur, err := r.daily.Find(ctx, f.timeRange("day", f.dimensions()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read daily rollup: %w", err)
+	}
+	var docs []Daily
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to read daily rollup: %w", err)
+	}
+	return breakdown(docs, by), nil
+}
+
+func breakdown(docs []Daily, by string) []Group {
+	sums := map[string]*Daily{}
+	for _, d := range docs {
+		value := d.App
+		switch by {
+		case ByAppVersion:
+			value = d.AppVersion
+		case ByPlatform:
+			value = d.Platform
+		}
+		s, ok := sums[value]
+		if !ok {
+			s = &Daily{}
+			sums[value] = s
+		}
+		s.merge(d)
+	}
+
+	groups := make([]Group, 0, len(sums))
+	for value, s := range sums {
+		groups = append(groups, Group{Value: value, Summary: newSummary(*s, SourceRollup)})
+	}
+	slices.SortFunc(groups, func(a, b Group) int {
+		return cmp.Or(cmp.Compare(b.Total, a.Total), cmp.Compare(a.Value, b.Value))
+	})
+	return groups
+}
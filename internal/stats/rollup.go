@@ -0,0 +1,284 @@
+// Package stats computes NPS summaries. Counts are kept in a daily rollup
+// collection updated on every accepted submission, so dashboards do not have
+// to aggregate the raw feedback collection on each load.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/db"
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Collection is the name of the daily rollup collection.
+const Collection = "feedback_daily"
+
+// Key identifies one rollup document: a UTC day and the dimensions dashboards
+// filter on.
+type Key struct {
+	Day        time.Time `bson:"day"`
+	App        string    `bson:"app"`
+	AppVersion string    `bson:"app_version"`
+	Platform   string    `bson:"platform"`
+}
+
+// Daily is a rollup document: counts per category and a rating histogram for
+// one Key. Ratings is keyed by the rating as a string, "0" to "10"; only the
+// website widget submits 0.
+type Daily struct {
+	Key       `bson:",inline"`
+	Total     int64            `bson:"total"`
+	Promoter  int64            `bson:"promoter"`
+	Passive   int64            `bson:"passive"`
+	Detractor int64            `bson:"detractor"`
+	Ratings   map[string]int64 `bson:"ratings"`
+}
+
+// Day truncates t to the start of its UTC day.
+func Day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// KeyOf returns the rollup key a feedback document counts towards.
+func KeyOf(fb *model.Feedback) Key {
+	return Key{
+		Day:        Day(fb.ReceivedAt),
+		App:        fb.App,
+		AppVersion: fb.AppVersion,
+		Platform:   fb.Platform,
+	}
+}
+
+func (k Key) filter() bson.D {
+	return bson.D{
+		{Key: "day", Value: k.Day},
+		{Key: "app", Value: k.App},
+		{Key: "app_version", Value: k.AppVersion},
+		{Key: "platform", Value: k.Platform},
+	}
+}
+
+// add counts n submissions with the given rating and category.
+func (d *Daily) add(rating int, category string, n int64) {
+	d.Total += n
+	switch category {
+	case "promoter":
+		d.Promoter += n
+	case "passive":
+		d.Passive += n
+	case "detractor":
+		d.Detractor += n
+	}
+	if d.Ratings == nil {
+		d.Ratings = make(map[string]int64)
+	}
+	d.Ratings[strconv.Itoa(rating)] += n
+}
+
+// merge adds another rollup's counts to d.
+func (d *Daily) merge(o Daily) {
+	d.Total += o.Total
+	d.Promoter += o.Promoter
+	d.Passive += o.Passive
+	d.Detractor += o.Detractor
+	for rating, n := range o.Ratings {
+		if d.Ratings == nil {
+			d.Ratings = make(map[string]int64)
+		}
+		d.Ratings[rating] += n
+	}
+}
+
+// Record counts fb in its rollup document, creating the document on the
+// first submission of the day. Quarantined feedback must not be recorded;
+// it is counted when an admin releases it.
+func Record(ctx context.Context, coll *mongo.Collection, fb *model.Feedback) error {
+	key := KeyOf(fb)
+	var d Daily
+	d.add(fb.NPSRating, fb.NPSCategory, 1)
+	update := d.inc()
+
+	_, err := coll.UpdateOne(ctx, key.filter(), update, options.UpdateOne().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Two first-of-the-day submissions raced to insert the document;
+		// the loser's retry finds it and increments.
+		_, err = coll.UpdateOne(ctx, key.filter(), update)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update daily rollup: %w", err)
+	}
+	return nil
+}
+
+// Forget removes a counted document from its rollup, for when a stored
+// document is deleted outright. Retention purges deliberately do not call
+// it: the rollup holds no personal data and keeps the counts of purged
+// documents, so long-term trends survive short retention periods.
+func Forget(ctx context.Context, coll *mongo.Collection, fb *model.Feedback) error {
+	var d Daily
+	d.add(fb.NPSRating, fb.NPSCategory, -1)
+	if _, err := coll.UpdateOne(ctx, KeyOf(fb).filter(), d.inc()); err != nil {
+		return fmt.Errorf("failed to update daily rollup: %w", err)
+	}
+	return nil
+}
+
+// RecordMany counts several documents with one upsert per rollup key, for
+// bulk writers such as the importer.
+func RecordMany(ctx context.Context, coll *mongo.Collection, fbs []*model.Feedback) error {
+	return applyMany(ctx, coll, deltas(fbs, 1), true)
+}
+
+// ForgetMany is Forget for several documents, with one update per rollup
+// key. Quarantined documents were never counted and must not be passed.
+func ForgetMany(ctx context.Context, coll *mongo.Collection, fbs []*model.Feedback) error {
+	return applyMany(ctx, coll, deltas(fbs, -1), false)
+}
+
+// deltas folds n counts of each document into one Daily per rollup key.
+func deltas(fbs []*model.Feedback, n int64) []*Daily {
+	var groups []group
+	for _, fb := range fbs {
+		var g group
+		g.ID.Key = KeyOf(fb)
+		g.ID.Rating, g.ID.Category, g.Count = fb.NPSRating, fb.NPSCategory, n
+		groups = append(groups, g)
+	}
+	return foldDaily(groups)
+}
+
+func applyMany(ctx context.Context, coll *mongo.Collection, rollups []*Daily, upsert bool) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(rollups))
+	for _, d := range rollups {
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(d.filter()).SetUpdate(d.inc()).SetUpsert(upsert))
+	}
+	if _, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("failed to update daily rollup: %w", err)
+	}
+	return nil
+}
+
+// inc returns the $inc update that adds d's counts to a rollup document.
+func (d *Daily) inc() bson.D {
+	fields := bson.D{
+		{Key: "total", Value: d.Total},
+		{Key: "promoter", Value: d.Promoter},
+		{Key: "passive", Value: d.Passive},
+		{Key: "detractor", Value: d.Detractor},
+	}
+	for r := 0; r <= 10; r++ {
+		if n := d.Ratings[strconv.Itoa(r)]; n != 0 {
+			fields = append(fields, bson.E{Key: "ratings." + strconv.Itoa(r), Value: n})
+		}
+	}
+	return bson.D{{Key: "$inc", Value: fields}}
+}
+
+// RebuildResult reports what Rebuild wrote.
+type RebuildResult struct {
+	From      *time.Time `json:"from,omitempty"`
+	Documents int64      `json:"documents"`
+	Rollups   int        `json:"rollups"`
+}
+
+// Rebuild regenerates the rollup from raw feedback received on or after the
+// start of from's day, or all of it when from is zero. Existing rollups in
+// that range are replaced. Submissions arriving while it runs may be counted
+// twice or not at all for the affected day, so run it when traffic is low.
+func Rebuild(ctx context.Context, feedback, daily *mongo.Collection, from time.Time) (RebuildResult, error) {
+	var res RebuildResult
+	match := db.ExcludeQuarantined(bson.D{})
+	dayFilter := bson.D{}
+	if !from.IsZero() {
+		start := Day(from)
+		res.From = &start
+		match = append(match, bson.E{Key: "received_at", Value: bson.D{{Key: "$gte", Value: start}}})
+		dayFilter = bson.D{{Key: "day", Value: bson.D{{Key: "$gte", Value: start}}}}
+	}
+
+	cur, err := feedback.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "day", Value: bson.D{{Key: "$dateTrunc", Value: bson.D{
+					{Key: "date", Value: "$received_at"},
+					{Key: "unit", Value: "day"},
+				}}}},
+				{Key: "app", Value: "$app"},
+				{Key: "app_version", Value: "$app_version"},
+				{Key: "platform", Value: "$platform"},
+				{Key: "rating", Value: "$nps_rating"},
+				{Key: "category", Value: "$nps_category"},
+			}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	})
+	if err != nil {
+		return res, fmt.Errorf("failed to aggregate feedback: %w", err)
+	}
+	var groups []group
+	if err := cur.All(ctx, &groups); err != nil {
+		return res, fmt.Errorf("failed to aggregate feedback: %w", err)
+	}
+
+	rollups := foldDaily(groups)
+	for _, d := range rollups {
+		res.Documents += d.Total
+	}
+	res.Rollups = len(rollups)
+
+	if _, err := daily.DeleteMany(ctx, dayFilter); err != nil {
+		return res, fmt.Errorf("failed to clear daily rollup: %w", err)
+	}
+	if len(rollups) == 0 {
+		return res, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(rollups))
+	for _, d := range rollups {
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(d.filter()).SetReplacement(d).SetUpsert(true))
+	}
+	if _, err := daily.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return res, fmt.Errorf("failed to write daily rollup: %w", err)
+	}
+	return res, nil
+}
+
+// group is one row of the rebuild and raw-summary aggregations.
+type group struct {
+	ID struct {
+		Key      `bson:",inline"`
+		Rating   int    `bson:"rating"`
+		Category string `bson:"category"`
+	} `bson:"_id"`
+	Count int64 `bson:"count"`
+}
+
+// foldDaily merges per-rating groups into one Daily per Key.
+func foldDaily(groups []group) []*Daily {
+	byKey := make(map[Key]*Daily)
+	var out []*Daily
+	for _, g := range groups {
+		k := g.ID.Key
+		k.Day = k.Day.UTC()
+		d, ok := byKey[k]
+		if !ok {
+			d = &Daily{Key: k}
+			byKey[k] = d
+			out = append(out, d)
+		}
+		d.add(g.ID.Rating, g.ID.Category, g.Count)
+	}
+	return out
+}
@@ -0,0 +1,194 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+func TestKeyOf_TruncatesToUTCDay(t *testing.T) {
+	helsinki := time.FixedZone("EET", 2*60*60)
+	fb := &model.Feedback{
+		App:        "idefinity",
+		AppVersion: "2.1.0",
+		Platform:   "macOS",
+		ReceivedAt: time.Date(2026, 3, 31, 1, 30, 0, 0, helsinki),
+	}
+	k := KeyOf(fb)
+	if want := time.Date(2026, 3, 30, 0, 0, 0, 0, time.UTC); !k.Day.Equal(want) {
+		t.Errorf("expected day %s, got %s", want, k.Day)
+	}
+}
+
+func TestFoldDaily(t *testing.T) {
+	day := time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	row := func(app string, rating int, category string, n int64) group {
+		var g group
+		g.ID.Key = Key{Day: day, App: app, AppVersion: "1.0", Platform: "macOS"}
+		g.ID.Rating, g.ID.Category, g.Count = rating, category, n
+		return g
+	}
+
+	out := foldDaily([]group{
+		row("a", 10, "promoter", 3),
+		row("a", 3, "detractor", 1),
+		row("b", 8, "passive", 2),
+	})
+	if len(out) != 2 {
+		t.Fatalf("expected 2 rollups, got %d", len(out))
+	}
+	a := out[0]
+	if a.Total != 4 || a.Promoter != 3 || a.Detractor != 1 || a.Ratings["10"] != 3 {
+		t.Errorf("unexpected rollup for a: %+v", a)
+	}
+}
+
+func TestDeltas_Forget(t *testing.T) {
+	at := time.Date(2026, 3, 31, 15, 0, 0, 0, time.UTC)
+	fb := func(rating int) *model.Feedback {
+		return &model.Feedback{App: "a", AppVersion: "1.0", Platform: "macOS", ReceivedAt: at,
+			NPSRating: rating, NPSCategory: model.CategoryForRating(rating)}
+	}
+
+	out := deltas([]*model.Feedback{fb(10), fb(10), fb(2)}, -1)
+	if len(out) != 1 {
+		t.Fatalf("expected 1 rollup, got %d", len(out))
+	}
+	d := out[0]
+	if d.Day != Day(at) || d.Total != -3 || d.Promoter != -2 || d.Detractor != -1 || d.Ratings["10"] != -2 || d.Ratings["2"] != -1 {
+		t.Errorf("unexpected deltas: %+v", d)
+	}
+}
+
+func TestNewSummary(t *testing.T) {
+	var d Daily
+	d.add(10, "promoter", 5)
+	d.add(7, "passive", 2)
+	d.add(2, "detractor", 2)
+
+	s := newSummary(d, SourceRollup)
+	if s.Total != 9 || s.NPS != 33.3 {
+		t.Errorf("expected 9 responses with NPS 33.3, got %d / %v", s.Total, s.NPS)
+	}
+	if len(s.Ratings) != 11 || s.Ratings["0"] != 0 || s.Ratings["7"] != 2 {
+		t.Errorf("expected full 0-10 histogram, got %v", s.Ratings)
+	}
+
+	if empty := newSummary(Daily{}, SourceRaw); empty.NPS != 0 || empty.Total != 0 {
+		t.Errorf("expected zero summary, got %+v", empty)
+	}
+}
+
+func TestFilter_DayAligned(t *testing.T) {
+	midnight := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		f    Filter
+		want bool
+	}{
+		{Filter{}, true},
+		{Filter{App: "a", From: midnight, To: midnight.AddDate(0, 1, 0)}, true},
+		{Filter{From: midnight.Add(time.Hour)}, false},
+		{Filter{To: midnight.Add(-time.Second)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.f.dayAligned(); got != tt.want {
+			t.Errorf("dayAligned(%+v) = %v, want %v", tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestDaily_Inc(t *testing.T) {
+	var d Daily
+	d.add(9, "promoter", 2)
+	d.add(3, "detractor", 1)
+
+	inc := d.inc()[0].Value.(bson.D)
+	got := map[string]any{}
+	for _, e := range inc {
+		got[e.Key] = e.Value
+	}
+	if got["total"] != int64(3) || got["promoter"] != int64(2) || got["ratings.9"] != int64(2) || got["ratings.3"] != int64(1) {
+		t.Errorf("unexpected $inc %v", inc)
+	}
+	if _, ok := got["ratings.5"]; ok {
+		t.Error("expected zero ratings to be left out")
+	}
+}
+
+func TestTrend_BucketsByPeriod(t *testing.T) {
+	day := func(y int, m time.Month, d int, rating int, category string) Daily {
+		var out Daily
+		out.Day = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		out.add(rating, category, 1)
+		return out
+	}
+	docs := []Daily{
+		day(2026, 3, 31, 10, "promoter"), // Tuesday
+		day(2026, 3, 30, 2, "detractor"), // Monday, same week
+		day(2026, 4, 6, 8, "passive"),    // next Monday
+	}
+
+	weeks := trend(docs, PeriodWeek)
+	if len(weeks) != 2 || !weeks[0].Start.Equal(time.Date(2026, 3, 30, 0, 0, 0, 0, time.UTC)) || weeks[0].Total != 2 {
+		t.Errorf("unexpected weekly trend %+v", weeks)
+	}
+
+	months := trend(docs, PeriodMonth)
+	if len(months) != 2 || months[0].NPS != 0 || months[1].Passives != 1 {
+		t.Errorf("unexpected monthly trend %+v", months)
+	}
+}
+
+func TestTallyAnswers(t *testing.T) {
+	row := func(question, choice string, count, first int64) answerGroup {
+		var g answerGroup
+		g.ID.QuestionID, g.ID.Choice, g.Count, g.First = question, choice, count, first
+		return g
+	}
+	got := tallyAnswers([]answerGroup{
+		row("reason", "price", 3, 3),
+		row("features", "scan", 4, 3),
+		row("reason", "speed", 2, 2),
+		row("features", "export", 2, 1),
+	})
+
+	if len(got) != 2 || got[0].QuestionID != "features" || got[1].QuestionID != "reason" {
+		t.Fatalf("expected tallies ordered by question, got %+v", got)
+	}
+	// Four answers picked six choices between them.
+	if got[0].Answered != 4 || got[0].Choices["scan"] != 4 || got[0].Choices["export"] != 2 {
+		t.Errorf("unexpected multi-choice tally %+v", got[0])
+	}
+	if got[1].Answered != 5 || got[1].Choices["price"] != 3 {
+		t.Errorf("unexpected single-choice tally %+v", got[1])
+	}
+}
+
+func TestBreakdown_ByVersion(t *testing.T) {
+	doc := func(version string, rating int, category string) Daily {
+		var out Daily
+		out.App, out.AppVersion = "idefinity", version
+		out.add(rating, category, 1)
+		return out
+	}
+	docs := []Daily{
+		doc("1.4.0", 10, "promoter"),
+		doc("1.3.2", 2, "detractor"),
+		doc("1.4.0", 3, "detractor"),
+		doc("1.4.0", 9, "promoter"),
+	}
+
+	groups := breakdown(docs, ByAppVersion)
+	if len(groups) != 2 || groups[0].Value != "1.4.0" || groups[0].Total != 3 || groups[0].NPS != 33.3 {
+		t.Fatalf("unexpected breakdown %+v", groups)
+	}
+	if groups[1].Value != "1.3.2" || groups[1].NPS != -100 {
+		t.Errorf("unexpected second group %+v", groups[1])
+	}
+	if apps := breakdown(docs, ByApp); len(apps) != 1 || apps[0].Total != 4 {
+		t.Errorf("unexpected app breakdown %+v", apps)
+	}
+}
@@ -0,0 +1,182 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/idefinity/nps-api/internal/db"
+)
+
+// Summary sources.
+const (
+	SourceRollup = "rollup"
+	SourceRaw    = "raw"
+)
+
+// Filter narrows a summary. Empty fields match everything; From is
+// inclusive and To exclusive.
+type Filter struct {
+	App        string
+	AppVersion string
+	Platform   string
+	// Locale matches the submission language and its regional variants, so
+	// sv matches sv and sv-FI. The rollup has no locale, so a locale filter
+	// is always answered from raw feedback.
+	Locale string
+	From   time.Time
+	To     time.Time
+}
+
+// dayAligned reports whether the time bounds fall on UTC day boundaries, so
+// the rollup can answer the query exactly.
+func (f Filter) dayAligned() bool {
+	aligned := func(t time.Time) bool { return t.IsZero() || t.Equal(Day(t)) }
+	return aligned(f.From) && aligned(f.To)
+}
+
+// fromRollup reports whether the rollup can answer f.
+func (f Filter) fromRollup() bool {
+	return f.dayAligned() && f.Locale == ""
+}
+
+func (f Filter) dimensions() bson.D {
+	d := bson.D{}
+	if f.App != "" {
+		d = append(d, bson.E{Key: "app", Value: f.App})
+	}
+	if f.AppVersion != "" {
+		d = append(d, bson.E{Key: "app_version", Value: f.AppVersion})
+	}
+	if f.Platform != "" {
+		d = append(d, bson.E{Key: "platform", Value: f.Platform})
+	}
+	return d
+}
+
+func (f Filter) timeRange(field string, d bson.D) bson.D {
+	r := bson.D{}
+	if !f.From.IsZero() {
+		r = append(r, bson.E{Key: "$gte", Value: f.From})
+	}
+	if !f.To.IsZero() {
+		r = append(r, bson.E{Key: "$lt", Value: f.To})
+	}
+	if len(r) > 0 {
+		d = append(d, bson.E{Key: field, Value: r})
+	}
+	return d
+}
+
+// FeedbackFilter returns the raw feedback collection filter for f,
+// excluding quarantined documents.
+func (f Filter) FeedbackFilter() bson.D {
+	d := f.dimensions()
+	if f.Locale != "" {
+		// Match the tag itself and its regional variants: sv, sv-FI.
+		d = append(d, bson.E{Key: "locale", Value: bson.Regex{Pattern: "^" + regexp.QuoteMeta(f.Locale) + "(-|$)"}})
+	}
+	return db.ExcludeQuarantined(f.timeRange("received_at", d))
+}
+
+// Summary is the NPS breakdown for a filter. NPS is the share of promoters
+// minus the share of detractors, from -100 to 100, rounded to one decimal.
+type Summary struct {
+	Total      int64            `json:"total"`
+	Promoters  int64            `json:"promoters"`
+	Passives   int64            `json:"passives"`
+	Detractors int64            `json:"detractors"`
+	NPS        float64          `json:"nps"`
+	Ratings    map[string]int64 `json:"ratings"`
+	Source     string           `json:"source"`
+}
+
+func newSummary(d Daily, source string) Summary {
+	s := Summary{
+		Total:      d.Total,
+		Promoters:  d.Promoter,
+		Passives:   d.Passive,
+		Detractors: d.Detractor,
+		Ratings:    make(map[string]int64, 11),
+		Source:     source,
+	}
+	for r := 0; r <= 10; r++ {
+		s.Ratings[strconv.Itoa(r)] = d.Ratings[strconv.Itoa(r)]
+	}
+	if s.Total > 0 {
+		nps := float64(s.Promoters-s.Detractors) / float64(s.Total) * 100
+		s.NPS = math.Round(nps*10) / 10
+	}
+	return s
+}
+
+// Reader answers summary queries, from the daily rollup when the filter is
+// day-aligned and has no locale, and from raw feedback otherwise.
+// Quarantined feedback is never counted.
+type Reader struct {
+	feedback *mongo.Collection
+	daily    *mongo.Collection
+}
+
+// NewReader creates a Reader over the raw and rollup collections.
+func NewReader(feedback, daily *mongo.Collection) *Reader {
+	return &Reader{feedback: feedback, daily: daily}
+}
+
+// Summary computes the NPS summary for f.
+func (r *Reader) Summary(ctx context.Context, f Filter) (Summary, error) {
+	if f.fromRollup() {
+		return r.fromRollup(ctx, f)
+	}
+	return r.fromRaw(ctx, f)
+}
+
+func (r *Reader) fromRollup(ctx context.Context, f Filter) (Summary, error) {
+	cur, err := r.daily.Find(ctx, f.timeRange("day", f.dimensions()))
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to read daily rollup: %w", err)
+	}
+	var docs []Daily
+	if err := cur.All(ctx, &docs); err != nil {
+		return Summary{}, fmt.Errorf("failed to read daily rollup: %w", err)
+	}
+
+	var sum Daily
+	for _, d := range docs {
+		sum.merge(d)
+	}
+	return newSummary(sum, SourceRollup), nil
+}
+
+func (r *Reader) fromRaw(ctx context.Context, f Filter) (Summary, error) {
+	match := f.FeedbackFilter()
+	cur, err := r.feedback.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "rating", Value: "$nps_rating"},
+				{Key: "category", Value: "$nps_category"},
+			}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	})
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to aggregate feedback: %w", err)
+	}
+	var groups []group
+	if err := cur.All(ctx, &groups); err != nil {
+		return Summary{}, fmt.Errorf("failed to aggregate feedback: %w", err)
+	}
+
+	var sum Daily
+	for _, g := range groups {
+		sum.add(g.ID.Rating, g.ID.Category, g.Count)
+	}
+	return newSummary(sum, SourceRaw), nil
+}
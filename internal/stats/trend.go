@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Trend periods.
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// TrendPoint is the summary for one period, starting at Start.
+type TrendPoint struct {
+	Start time.Time `json:"start"`
+	Summary
+}
+
+// periodStart returns the start of the period containing day. Weeks start on
+// Monday.
+func periodStart(day time.Time, period string) time.Time {
+	switch period {
+	case PeriodWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case PeriodMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// Trend returns one summary per day, week or month, oldest first, from the
+// daily rollup. Periods without feedback are left out. The filter must be
+// day-aligned and cannot select a locale.
+func (r *Reader) Trend(ctx context.Context, f Filter, period string) ([]TrendPoint, error) {
+	if period != PeriodDay && period != PeriodWeek && period != PeriodMonth {
+		return nil, fmt.Errorf("period must be %s, %s or %s", PeriodDay, PeriodWeek, PeriodMonth)
+	}
+	if !f.dayAligned() {
+		return nil, fmt.Errorf("trend bounds must fall on UTC day boundaries")
+	}
+	if f.Locale != "" {
+		return nil, fmt.Errorf("trend cannot filter by locale")
+	}
+
+	cur, err := r.daily.Find(ctx, f.timeRange("day", f.dimensions()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read daily rollup: %w", err)
+	}
+	var docs []Daily
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to read daily rollup: %w", err)
+	}
+	return trend(docs, period), nil
+}
+
+func trend(docs []Daily, period string) []TrendPoint {
+	buckets := map[time.Time]*Daily{}
+	for _, d := range docs {
+		start := periodStart(d.Day.UTC(), period)
+		b, ok := buckets[start]
+		if !ok {
+			b = &Daily{}
+			buckets[start] = b
+		}
+		b.merge(d)
+	}
+
+	points := make([]TrendPoint, 0, len(buckets))
+	for start, b := range buckets {
+		points = append(points, TrendPoint{Start: start, Summary: newSummary(*b, SourceRollup)})
+	}
+	slices.SortFunc(points, func(a, b TrendPoint) int { return a.Start.Compare(b.Start) })
+	return points
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Memory is an in-memory FeedbackStore for tests. It is safe for concurrent
+// use.
+type Memory struct {
+	mu   sync.Mutex
+	docs []model.Feedback
+	keys map[string]string
+}
+
+// NewMemory creates an empty store.
+func NewMemory() *Memory {
+	return &Memory{keys: map[string]string{}}
+}
+
+// Insert implements FeedbackStore.
+func (m *Memory) Insert(_ context.Context, fb *model.Feedback) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fb.IdempotencyKey != "" {
+		if hash, ok := m.keys[fb.IdempotencyKey]; ok {
+			if hash != fb.IdempotencyHash {
+				return ErrKeyReused
+			}
+			return ErrDuplicate
+		}
+		m.keys[fb.IdempotencyKey] = fb.IdempotencyHash
+	}
+	m.docs = append(m.docs, *fb)
+	return nil
+}
+
+// Feedback returns a copy of the stored documents in insertion order.
+func (m *Memory) Feedback() []model.Feedback {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.docs)
+}
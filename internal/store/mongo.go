@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/db"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// Mongo stores feedback in the feedback collection.
+type Mongo struct {
+	feedback *mongo.Collection
+	daily    *mongo.Collection
+}
+
+// NewMongo creates a store over the given database.
+func NewMongo(d *db.Database) *Mongo {
+	return &Mongo{feedback: d.Collection("feedback"), daily: d.Collection(stats.Collection)}
+}
+
+// Insert implements FeedbackStore. Idempotency relies on the unique
+// idempotency_key index created by the schema migrations.
+func (m *Mongo) Insert(ctx context.Context, fb *model.Feedback) error {
+	if _, err := m.feedback.InsertOne(ctx, fb); err != nil {
+		if fb.IdempotencyKey != "" && mongo.IsDuplicateKeyError(err) {
+			return m.replayed(ctx, fb)
+		}
+		return fmt.Errorf("failed to insert feedback: %w", err)
+	}
+
+	// The rollup can be rebuilt from raw data, so a failed update is logged
+	// rather than failing a submission that is already stored.
+	if !fb.Quarantine {
+		if err := stats.Record(ctx, m.daily, fb); err != nil {
+			slog.Error("failed to update stats rollup", "id", fb.ID.Hex(), "error", err)
+		}
+	}
+	return nil
+}
+
+// replayed compares fb with the stored document holding its idempotency key.
+// Documents stored before request hashes were kept have none and match any
+// request.
+func (m *Mongo) replayed(ctx context.Context, fb *model.Feedback) error {
+	var stored model.Feedback
+	opts := options.FindOne().SetProjection(bson.D{{Key: "idempotency_hash", Value: 1}})
+	err := m.feedback.FindOne(ctx, bson.D{{Key: "idempotency_key", Value: fb.IdempotencyKey}}, opts).Decode(&stored)
+	if err != nil {
+		return fmt.Errorf("failed to look up idempotency key: %w", err)
+	}
+	if stored.IdempotencyHash != "" && stored.IdempotencyHash != fb.IdempotencyHash {
+		return ErrKeyReused
+	}
+	return ErrDuplicate
+}
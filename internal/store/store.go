@@ -0,0 +1,29 @@
+// Package store persists accepted feedback submissions. The HTTP handlers
+// write through the FeedbackStore interface so they can run against MongoDB
+// in production and against an in-memory store in tests.
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// ErrDuplicate is returned by Insert when a document with the same
+// idempotency key and request hash is already stored.
+var ErrDuplicate = errors.New("duplicate idempotency key")
+
+// ErrKeyReused is returned by Insert when the idempotency key is already
+// stored for a request with a different hash.
+var ErrKeyReused = errors.New("idempotency key reused for a different request")
+
+// FeedbackStore stores submissions that passed validation, spam scoring and
+// protection.
+type FeedbackStore interface {
+	// Insert stores fb and counts it in the stats rollup unless it is
+	// quarantined. When fb.IdempotencyKey was already used it stores nothing
+	// and returns ErrDuplicate, or ErrKeyReused if fb.IdempotencyHash
+	// differs from the stored one.
+	Insert(ctx context.Context, fb *model.Feedback) error
+}
@@ -0,0 +1,215 @@
+// Package stream fans newly accepted feedback out to live subscribers, such
+// as the Server-Sent Events endpoint. A Hub is fed either by the submit path
+// of this process or, with several replicas, by a MongoDB change stream on
+// the feedback collection, so that every replica sees every submission.
+package stream
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/stats"
+)
+
+// metrics are published under "stream" on the expvar endpoint.
+var metrics = expvar.NewMap("stream")
+
+// Defaults for NewHub arguments left zero.
+const (
+	DefaultMaxSubscribers = 100
+	DefaultBuffer         = 64
+)
+
+// ErrTooManySubscribers is returned by Subscribe when the hub is full.
+var ErrTooManySubscribers = errors.New("too many stream subscribers")
+
+// ErrClosed is returned by Subscribe after Close.
+var ErrClosed = errors.New("stream closed")
+
+// Filter selects the feedback a subscriber gets. Empty fields match
+// everything; Locale also matches its regional variants.
+type Filter struct {
+	App        string
+	AppVersion string
+	Platform   string
+	Locale     string
+	Category   string
+}
+
+// Matches reports whether fb passes the filter.
+func (f Filter) Matches(fb *model.Feedback) bool {
+	return (f.App == "" || fb.App == f.App) &&
+		(f.AppVersion == "" || fb.AppVersion == f.AppVersion) &&
+		(f.Platform == "" || fb.Platform == f.Platform) &&
+		(f.Category == "" || fb.NPSCategory == f.Category) &&
+		(f.Locale == "" || fb.Locale == f.Locale || strings.HasPrefix(fb.Locale, f.Locale+"-"))
+}
+
+// query returns the feedback collection filter for documents after id.
+func (f Filter) query(after bson.ObjectID) bson.D {
+	q := stats.Filter{App: f.App, AppVersion: f.AppVersion, Platform: f.Platform, Locale: f.Locale}.FeedbackFilter()
+	if f.Category != "" {
+		q = append(q, bson.E{Key: "nps_category", Value: f.Category})
+	}
+	return append(q, bson.E{Key: "_id", Value: bson.D{{Key: "$gt", Value: after}}})
+}
+
+// Subscription receives the feedback matching its filter on C. C is closed
+// when the subscriber falls behind by more than the hub's buffer or the hub
+// closes; the client should then reconnect and resume.
+type Subscription struct {
+	C      <-chan *model.Feedback
+	c      chan *model.Feedback
+	filter Filter
+	hub    *Hub
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Hub broadcasts feedback to subscriptions.
+type Hub struct {
+	max    int
+	buffer int
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub creates a Hub that accepts up to maxSubscribers, each buffering up
+// to buffer events.
+func NewHub(maxSubscribers, buffer int) *Hub {
+	if maxSubscribers <= 0 {
+		maxSubscribers = DefaultMaxSubscribers
+	}
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	return &Hub{max: maxSubscribers, buffer: buffer, subs: map[*Subscription]struct{}{}}
+}
+
+// Subscribe adds a subscription for f.
+func (h *Hub) Subscribe(f Filter) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrClosed
+	}
+	if len(h.subs) >= h.max {
+		metrics.Add("rejected", 1)
+		return nil, ErrTooManySubscribers
+	}
+	c := make(chan *model.Feedback, h.buffer)
+	s := &Subscription{C: c, c: c, filter: f, hub: h}
+	h.subs[s] = struct{}{}
+	return s, nil
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
+
+// Publish sends fb to the matching subscriptions without blocking.
+// Quarantined feedback is never published. fb's comment and answers must not
+// be encrypted, and fb must not be modified afterwards.
+func (h *Hub) Publish(fb *model.Feedback) {
+	if fb.Quarantine {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if !s.filter.Matches(fb) {
+			continue
+		}
+		select {
+		case s.c <- fb:
+		default:
+			// A subscriber this far behind is dropped rather than slowing
+			// everyone down; it resumes from its last event ID.
+			delete(h.subs, s)
+			close(s.c)
+			metrics.Add("dropped", 1)
+		}
+	}
+	metrics.Add("published", 1)
+}
+
+// Close ends every subscription and rejects new ones, so that open streams
+// do not hold up a graceful shutdown.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subs {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
+
+// Replayer loads the feedback stored after an event ID, for resuming a
+// stream.
+type Replayer interface {
+	// After returns up to limit non-quarantined documents matching f with
+	// an ID greater than after, in ID order, decrypted.
+	After(ctx context.Context, after bson.ObjectID, f Filter, limit int) ([]*model.Feedback, error)
+}
+
+// MongoReplayer implements Replayer on the feedback collection.
+type MongoReplayer struct {
+	coll    *mongo.Collection
+	keyring *fieldcrypt.Keyring
+}
+
+// NewMongoReplayer creates a MongoReplayer; keyring may be nil.
+func NewMongoReplayer(coll *mongo.Collection, keyring *fieldcrypt.Keyring) *MongoReplayer {
+	return &MongoReplayer{coll: coll, keyring: keyring}
+}
+
+// After implements Replayer.
+func (m *MongoReplayer) After(ctx context.Context, after bson.ObjectID, f Filter, limit int) ([]*model.Feedback, error) {
+	cur, err := m.coll.Find(ctx, f.query(after), options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feedback: %w", err)
+	}
+	var docs []*model.Feedback
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to query feedback: %w", err)
+	}
+	for _, fb := range docs {
+		if err := decrypt(m.keyring, fb); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+func decrypt(keyring *fieldcrypt.Keyring, fb *model.Feedback) error {
+	if keyring == nil {
+		return nil
+	}
+	if err := fieldcrypt.DecryptFeedback(keyring, fb); err != nil {
+		return fmt.Errorf("failed to decrypt feedback %s: %w", fb.ID.Hex(), err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+func TestFilter_Matches(t *testing.T) {
+	fb := &model.Feedback{App: "idefinity", AppVersion: "2.0", Platform: "iOS", Locale: "sv-FI", NPSCategory: "detractor"}
+	cases := []struct {
+		f    Filter
+		want bool
+	}{
+		{Filter{}, true},
+		{Filter{App: "idefinity", Category: "detractor"}, true},
+		{Filter{Locale: "sv"}, true},
+		{Filter{Locale: "sv-FI"}, true},
+		{Filter{Locale: "s"}, false},
+		{Filter{Platform: "Android"}, false},
+		{Filter{Category: "promoter"}, false},
+	}
+	for _, c := range cases {
+		if got := c.f.Matches(fb); got != c.want {
+			t.Errorf("%+v: got %v, want %v", c.f, got, c.want)
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub(2, 1)
+	all, err := hub.Subscribe(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	promoters, err := hub.Subscribe(Filter{Category: "promoter"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hub.Subscribe(Filter{}); !errors.Is(err, ErrTooManySubscribers) {
+		t.Fatalf("expected ErrTooManySubscribers, got %v", err)
+	}
+
+	hub.Publish(&model.Feedback{ID: bson.NewObjectID(), NPSCategory: "detractor", Quarantine: true})
+	detractor := &model.Feedback{ID: bson.NewObjectID(), NPSCategory: "detractor"}
+	hub.Publish(detractor)
+	if got := <-all.C; got != detractor {
+		t.Errorf("expected the detractor, not quarantined feedback, got %+v", got)
+	}
+	if len(promoters.C) != 0 {
+		t.Error("expected the promoter subscription to skip the detractor")
+	}
+
+	// Subscribers with a full buffer are dropped, freeing their slots.
+	hub.Publish(&model.Feedback{ID: bson.NewObjectID(), NPSCategory: "promoter"})
+	hub.Publish(&model.Feedback{ID: bson.NewObjectID(), NPSCategory: "promoter"})
+	for _, s := range []*Subscription{all, promoters} {
+		<-s.C
+		if _, ok := <-s.C; ok {
+			t.Error("expected a slow subscriber's channel to be closed")
+		}
+	}
+	promoters.Close()
+	var subs []*Subscription
+	for range 2 {
+		s, err := hub.Subscribe(Filter{})
+		if err != nil {
+			t.Fatalf("expected the dropped subscribers' slots to be free: %v", err)
+		}
+		subs = append(subs, s)
+	}
+
+	hub.Close()
+	for _, s := range subs {
+		if _, ok := <-s.C; ok {
+			t.Error("expected Close to close every subscription")
+		}
+	}
+	if _, err := hub.Subscribe(Filter{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// RetryDelay is how long Watch waits before reopening a failed change
+// stream.
+const RetryDelay = 5 * time.Second
+
+// Watch publishes every feedback document inserted into coll to hub until
+// ctx is cancelled. It needs a replica set or sharded cluster. After an error
+// the change stream is reopened from the last event seen, so no insert is
+// missed as long as it is still in the oplog.
+func Watch(ctx context.Context, coll *mongo.Collection, keyring *fieldcrypt.Keyring, hub *Hub) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{
+		{Key: "operationType", Value: "insert"},
+		{Key: "fullDocument.quarantine", Value: bson.D{{Key: "$ne", Value: true}}},
+	}}}}
+	var token bson.Raw
+	for {
+		opts := options.ChangeStream()
+		if token != nil {
+			opts.SetResumeAfter(token)
+		}
+		cs, err := coll.Watch(ctx, pipeline, opts)
+		if err == nil {
+			token = follow(ctx, cs, keyring, hub, token)
+			err = cs.Err()
+			cs.Close(context.Background())
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("feedback change stream failed", "error", err)
+			metrics.Add("watch_errors", 1)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(RetryDelay):
+		}
+	}
+}
+
+// follow publishes the events of cs until it fails and returns the resume
+// token of the last one.
+func follow(ctx context.Context, cs *mongo.ChangeStream, keyring *fieldcrypt.Keyring, hub *Hub, token bson.Raw) bson.Raw {
+	for cs.Next(ctx) {
+		token = cs.ResumeToken()
+		var ev struct {
+			FullDocument model.Feedback `bson:"fullDocument"`
+		}
+		if err := cs.Decode(&ev); err != nil {
+			slog.Error("failed to decode feedback change", "error", err)
+			metrics.Add("watch_errors", 1)
+			continue
+		}
+		fb := &ev.FullDocument
+		if err := decrypt(keyring, fb); err != nil {
+			slog.Error("failed to decrypt streamed feedback", "error", err)
+			metrics.Add("watch_errors", 1)
+			continue
+		}
+		hub.Publish(fb)
+	}
+	return token
+}
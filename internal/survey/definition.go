@@ -0,0 +1,285 @@
+package survey
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Question types.
+const (
+	QuestionRating       = "rating"
+	QuestionSingleChoice = "single_choice"
+	QuestionMultiChoice  = "multi_choice"
+	QuestionFreeText     = "free_text"
+)
+
+// DefaultLocale is the locale every prompt and choice label must have, used
+// when none of the client's locales has a text.
+const DefaultLocale = i18n.Default
+
+// Limits on survey definitions.
+const (
+	MaxQuestions    = 20
+	MaxChoices      = 20
+	MaxPromptLength = 500
+	MaxLabelLength  = 200
+	DefaultScale    = 5
+	MaxScale        = 10
+)
+
+// idPattern restricts survey, question and choice IDs to short slugs, which
+// also keeps them safe as aggregation keys.
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Definition is one version of a survey: the follow-up questions shown after
+// the NPS rating. Published versions are immutable, so stored answers always
+// refer to the questions they responded to; changing a survey publishes a
+// new version.
+type Definition struct {
+	ID        string     `bson:"survey_id"  json:"id"`
+	Version   int        `bson:"version"    json:"version"`
+	Questions []Question `bson:"questions"  json:"questions"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+}
+
+// Question is one survey question. Prompt and choice labels are keyed by
+// locale.
+type Question struct {
+	ID       string            `bson:"id"       json:"id"`
+	Type     string            `bson:"type"     json:"type"`
+	Prompt   map[string]string `bson:"prompt"   json:"prompt"`
+	Required bool              `bson:"required" json:"required"`
+	// Choices lists the options of a choice question.
+	Choices []Choice `bson:"choices,omitempty" json:"choices,omitempty"`
+	// Scale is the highest value of a rating question, which runs from 1;
+	// zero means DefaultScale.
+	Scale int `bson:"scale,omitempty" json:"scale,omitempty"`
+}
+
+// Choice is one option of a choice question.
+type Choice struct {
+	ID    string            `bson:"id"    json:"id"`
+	Label map[string]string `bson:"label" json:"label"`
+}
+
+// LocalizedDefinition is a Definition with every text resolved to a single
+// locale, for clients that render one language.
+type LocalizedDefinition struct {
+	ID        string              `json:"id"`
+	Version   int                 `json:"version"`
+	Questions []LocalizedQuestion `json:"questions"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+// LocalizedQuestion is a Question with its prompt and choice labels in one
+// locale. Locale is the locale of the prompt; a label missing in it falls
+// back on its own.
+type LocalizedQuestion struct {
+	ID       string            `json:"id"`
+	Type     string            `json:"type"`
+	Prompt   string            `json:"prompt"`
+	Locale   string            `json:"locale"`
+	Required bool              `json:"required"`
+	Choices  []LocalizedChoice `json:"choices,omitempty"`
+	Scale    int               `json:"scale,omitempty"`
+}
+
+// LocalizedChoice is a Choice with its label in one locale.
+type LocalizedChoice struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+// Localize resolves the definition's texts for the preferred locales, best
+// first. Each text falls back through parent tags to DefaultLocale.
+func (d *Definition) Localize(prefs []string) LocalizedDefinition {
+	ld := LocalizedDefinition{ID: d.ID, Version: d.Version, CreatedAt: d.CreatedAt}
+	for _, q := range d.Questions {
+		lq := LocalizedQuestion{ID: q.ID, Type: q.Type, Required: q.Required, Scale: q.Scale}
+		lq.Prompt, lq.Locale = i18n.Pick(q.Prompt, prefs)
+		for _, c := range q.Choices {
+			label, _ := i18n.Pick(c.Label, prefs)
+			lq.Choices = append(lq.Choices, LocalizedChoice{ID: c.ID, Label: label})
+		}
+		ld.Questions = append(ld.Questions, lq)
+	}
+	return ld
+}
+
+// MaxRating returns the highest rating a rating question accepts.
+func (q *Question) MaxRating() int {
+	if q.Scale == 0 {
+		return DefaultScale
+	}
+	return q.Scale
+}
+
+func (q *Question) isChoice() bool {
+	return q.Type == QuestionSingleChoice || q.Type == QuestionMultiChoice
+}
+
+// Validate checks a definition before it is published. Version and
+// CreatedAt are assigned on publishing and not checked.
+func (d *Definition) Validate() error {
+	if !idPattern.MatchString(d.ID) {
+		return errors.New("id must be 1-64 lowercase letters, digits, dashes or underscores")
+	}
+	if len(d.Questions) == 0 {
+		return errors.New("at least one question is required")
+	}
+	if len(d.Questions) > MaxQuestions {
+		return fmt.Errorf("questions exceed %d entries", MaxQuestions)
+	}
+	seen := map[string]bool{}
+	for i := range d.Questions {
+		q := &d.Questions[i]
+		if err := q.validate(); err != nil {
+			return fmt.Errorf("question %d: %w", i+1, err)
+		}
+		if seen[q.ID] {
+			return fmt.Errorf("duplicate question id %q", q.ID)
+		}
+		seen[q.ID] = true
+	}
+	return nil
+}
+
+func (q *Question) validate() error {
+	if !idPattern.MatchString(q.ID) {
+		return errors.New("id must be 1-64 lowercase letters, digits, dashes or underscores")
+	}
+	switch q.Type {
+	case QuestionRating, QuestionSingleChoice, QuestionMultiChoice, QuestionFreeText:
+	default:
+		return fmt.Errorf("invalid type %q", q.Type)
+	}
+	if err := validateTexts("prompt", q.Prompt, MaxPromptLength); err != nil {
+		return err
+	}
+
+	if q.Type == QuestionRating {
+		if q.Scale != 0 && (q.Scale < 2 || q.Scale > MaxScale) {
+			return fmt.Errorf("scale must be between 2 and %d", MaxScale)
+		}
+	} else if q.Scale != 0 {
+		return errors.New("scale is only allowed on rating questions")
+	}
+
+	if !q.isChoice() {
+		if len(q.Choices) > 0 {
+			return errors.New("choices are only allowed on choice questions")
+		}
+		return nil
+	}
+	if len(q.Choices) < 2 || len(q.Choices) > MaxChoices {
+		return fmt.Errorf("choice questions need 2 to %d choices", MaxChoices)
+	}
+	seen := map[string]bool{}
+	for _, c := range q.Choices {
+		if !idPattern.MatchString(c.ID) {
+			return fmt.Errorf("invalid choice id %q", c.ID)
+		}
+		if seen[c.ID] {
+			return fmt.Errorf("duplicate choice id %q", c.ID)
+		}
+		seen[c.ID] = true
+		if err := validateTexts("choice "+c.ID+" label", c.Label, MaxLabelLength); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateTexts checks a localized text: DefaultLocale is required, and
+// every entry needs a valid locale and a non-blank text within limit.
+func validateTexts(name string, texts map[string]string, limit int) error {
+	if strings.TrimSpace(texts[DefaultLocale]) == "" {
+		return fmt.Errorf("%s needs a %q text", name, DefaultLocale)
+	}
+	for locale, text := range texts {
+		if !i18n.ValidTag(locale) || i18n.Normalize(locale) != locale {
+			return fmt.Errorf("%s has invalid locale %q", name, locale)
+		}
+		if strings.TrimSpace(text) == "" {
+			return fmt.Errorf("%s is empty for locale %q", name, locale)
+		}
+		if len(text) > limit {
+			return fmt.Errorf("%s exceeds %d characters for locale %q", name, limit, locale)
+		}
+	}
+	return nil
+}
+
+// ValidateAnswers checks answers against the definition: every answer must
+// refer to one of its questions, at most once, with a value of the right
+// type, and every required question must be answered. It returns a
+// *model.ValidationError.
+func (d *Definition) ValidateAnswers(answers []model.Answer) error {
+	answered := map[string]bool{}
+	for _, a := range answers {
+		i := slices.IndexFunc(d.Questions, func(q Question) bool { return q.ID == a.QuestionID })
+		if i < 0 {
+			return answerError(i18n.CodeUnknownQuestion, a.QuestionID)
+		}
+		if answered[a.QuestionID] {
+			return answerError(i18n.CodeDuplicateAnswer, a.QuestionID)
+		}
+		answered[a.QuestionID] = true
+		if err := d.Questions[i].check(a); err != nil {
+			return err
+		}
+	}
+	for _, q := range d.Questions {
+		if q.Required && !answered[q.ID] {
+			return answerError(i18n.CodeQuestionRequired, q.ID)
+		}
+	}
+	return nil
+}
+
+func answerError(code string, args ...any) error {
+	return model.NewValidationError("answers", code, args...)
+}
+
+// check verifies that a carries exactly the value q's type calls for.
+func (q *Question) check(a model.Answer) error {
+	hasRating, hasChoices, hasText := a.Rating != nil, len(a.Choices) > 0, a.Text != ""
+	switch q.Type {
+	case QuestionRating:
+		if !hasRating || hasChoices || hasText {
+			return answerError(i18n.CodeAnswerNeedsRating, q.ID)
+		}
+		if *a.Rating < 1 || *a.Rating > q.MaxRating() {
+			return answerError(i18n.CodeRatingRange, q.ID, q.MaxRating())
+		}
+	case QuestionFreeText:
+		if !hasText || hasRating || hasChoices {
+			return answerError(i18n.CodeAnswerNeedsText, q.ID)
+		}
+	default:
+		if !hasChoices || hasRating || hasText {
+			return answerError(i18n.CodeAnswerNeedsChoices, q.ID)
+		}
+		if q.Type == QuestionSingleChoice && len(a.Choices) != 1 {
+			return answerError(i18n.CodeSingleChoice, q.ID)
+		}
+		seen := map[string]bool{}
+		for _, c := range a.Choices {
+			if !slices.ContainsFunc(q.Choices, func(o Choice) bool { return o.ID == c }) {
+				return answerError(i18n.CodeUnknownChoice, q.ID, c)
+			}
+			if seen[c] {
+				return answerError(i18n.CodeDuplicateChoice, q.ID, c)
+			}
+			seen[c] = true
+		}
+	}
+	return nil
+}
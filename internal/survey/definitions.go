@@ -0,0 +1,258 @@
+package survey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// DefinitionCollection is the MongoDB collection holding survey definitions.
+const DefinitionCollection = "survey_definitions"
+
+// ErrDefinitionNotFound is returned when a survey or survey version does not
+// exist.
+var ErrDefinitionNotFound = errors.New("survey definition not found")
+
+// Definitions stores survey definitions. Versions are only ever added.
+type Definitions interface {
+	// Get returns the given version of survey id, or its latest version when
+	// version is zero.
+	Get(ctx context.Context, id string, version int) (*Definition, error)
+	// List returns the latest version of every survey, ordered by ID.
+	List(ctx context.Context) ([]Definition, error)
+	// Publish stores d as the next version of its survey, setting Version
+	// and CreatedAt.
+	Publish(ctx context.Context, d *Definition) error
+}
+
+// publishAttempts bounds retries when concurrent publishes of the same
+// survey race for a version number.
+const publishAttempts = 3
+
+// MongoDefinitions stores definitions in the survey_definitions collection,
+// one document per version.
+type MongoDefinitions struct {
+	coll *mongo.Collection
+}
+
+// NewMongoDefinitions creates a definition store over coll.
+func NewMongoDefinitions(coll *mongo.Collection) *MongoDefinitions {
+	return &MongoDefinitions{coll: coll}
+}
+
+// Get implements Definitions.
+func (m *MongoDefinitions) Get(ctx context.Context, id string, version int) (*Definition, error) {
+	filter := bson.D{{Key: "survey_id", Value: id}}
+	if version > 0 {
+		filter = append(filter, bson.E{Key: "version", Value: version})
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	var d Definition
+	err := m.coll.FindOne(ctx, filter, opts).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrDefinitionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load survey definition: %w", err)
+	}
+	return &d, nil
+}
+
+// List implements Definitions.
+func (m *MongoDefinitions) List(ctx context.Context) ([]Definition, error) {
+	cur, err := m.coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "survey_id", Value: 1}, {Key: "version", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$survey_id"},
+			{Key: "latest", Value: bson.D{{Key: "$first", Value: "$$ROOT"}}},
+		}}},
+		{{Key: "$replaceWith", Value: "$latest"}},
+		{{Key: "$sort", Value: bson.D{{Key: "survey_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list survey definitions: %w", err)
+	}
+	defs := []Definition{}
+	if err := cur.All(ctx, &defs); err != nil {
+		return nil, fmt.Errorf("failed to list survey definitions: %w", err)
+	}
+	return defs, nil
+}
+
+// Publish implements Definitions. The unique index on survey_id and
+// version turns a concurrent publish into a retry with the next number.
+func (m *MongoDefinitions) Publish(ctx context.Context, d *Definition) error {
+	for range publishAttempts {
+		latest, err := m.Get(ctx, d.ID, 0)
+		switch {
+		case errors.Is(err, ErrDefinitionNotFound):
+			d.Version = 1
+		case err != nil:
+			return err
+		default:
+			d.Version = latest.Version + 1
+		}
+		d.CreatedAt = time.Now().UTC()
+
+		_, err = m.coll.InsertOne(ctx, d)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to insert survey definition: %w", err)
+		}
+	}
+	return fmt.Errorf("failed to publish survey %s: too many concurrent publishes", d.ID)
+}
+
+// MemoryDefinitions is an in-memory Definitions implementation for tests.
+type MemoryDefinitions struct {
+	mu   sync.Mutex
+	defs []Definition
+}
+
+// NewMemoryDefinitions creates an empty definition store.
+func NewMemoryDefinitions() *MemoryDefinitions {
+	return &MemoryDefinitions{}
+}
+
+// Get implements Definitions.
+func (m *MemoryDefinitions) Get(_ context.Context, id string, version int) (*Definition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found *Definition
+	for i := range m.defs {
+		d := &m.defs[i]
+		if d.ID != id || (version > 0 && d.Version != version) {
+			continue
+		}
+		if found == nil || d.Version > found.Version {
+			found = d
+		}
+	}
+	if found == nil {
+		return nil, ErrDefinitionNotFound
+	}
+	d := *found
+	return &d, nil
+}
+
+// List implements Definitions.
+func (m *MemoryDefinitions) List(_ context.Context) ([]Definition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	latest := map[string]Definition{}
+	for _, d := range m.defs {
+		if d.Version > latest[d.ID].Version {
+			latest[d.ID] = d
+		}
+	}
+	defs := []Definition{}
+	for _, d := range latest {
+		defs = append(defs, d)
+	}
+	slices.SortFunc(defs, func(a, b Definition) int { return strings.Compare(a.ID, b.ID) })
+	return defs, nil
+}
+
+// Publish implements Definitions.
+func (m *MemoryDefinitions) Publish(_ context.Context, d *Definition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d.Version = 1
+	for _, s := range m.defs {
+		if s.ID == d.ID && s.Version >= d.Version {
+			d.Version = s.Version + 1
+		}
+	}
+	d.CreatedAt = time.Now().UTC()
+	m.defs = append(m.defs, *d)
+	return nil
+}
+
+// Catalog validates submissions against survey definitions. Published
+// versions never change, so each one is loaded once and then served from
+// memory.
+type Catalog struct {
+	defs Definitions
+
+	mu    sync.Mutex
+	cache map[definitionKey]*Definition
+}
+
+// maxCachedDefinitions bounds the definition cache.
+const maxCachedDefinitions = 1000
+
+type definitionKey struct {
+	id      string
+	version int
+}
+
+// NewCatalog creates a Catalog over defs.
+func NewCatalog(defs Definitions) *Catalog {
+	return &Catalog{defs: defs, cache: map[definitionKey]*Definition{}}
+}
+
+// Definitions returns the underlying definition store.
+func (c *Catalog) Definitions() Definitions {
+	return c.defs
+}
+
+// Get returns a definition like Definitions.Get. Exact versions are cached;
+// the latest version is always looked up.
+func (c *Catalog) Get(ctx context.Context, id string, version int) (*Definition, error) {
+	key := definitionKey{id, version}
+	if version > 0 {
+		c.mu.Lock()
+		d, ok := c.cache[key]
+		c.mu.Unlock()
+		if ok {
+			return d, nil
+		}
+	}
+
+	d, err := c.defs.Get(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	key.version = d.Version
+	c.mu.Lock()
+	if len(c.cache) >= maxCachedDefinitions {
+		clear(c.cache)
+	}
+	c.cache[key] = d
+	c.mu.Unlock()
+	return d, nil
+}
+
+// ValidateAnswers checks fb's answers against the definition it refers to.
+// Feedback without a survey is always valid, even on a nil Catalog. Invalid
+// answers, or an unknown survey or version, yield a *model.ValidationError;
+// other errors mean the definition could not be loaded.
+func (c *Catalog) ValidateAnswers(ctx context.Context, fb *model.Feedback) error {
+	if fb.SurveyID == "" {
+		return nil
+	}
+	if c == nil {
+		return model.NewValidationError("survey_id", i18n.CodeUnknownSurvey, fb.SurveyID, fb.SurveyVersion)
+	}
+	d, err := c.Get(ctx, fb.SurveyID, fb.SurveyVersion)
+	if errors.Is(err, ErrDefinitionNotFound) {
+		return model.NewValidationError("survey_id", i18n.CodeUnknownSurvey, fb.SurveyID, fb.SurveyVersion)
+	}
+	if err != nil {
+		return err
+	}
+	return d.ValidateAnswers(fb.Answers)
+}
@@ -0,0 +1,285 @@
+// Package survey decides when clients should show the NPS prompt. Rules are
+// stored per app and target platforms and app version ranges; the matching
+// rule with the highest priority supplies the prompt settings, and a stable
+// hash of the install ID places each installation in a sampling bucket.
+//
+// The package also keeps survey definitions: versioned sets of follow-up
+// questions that schema 1.2 submissions answer.
+//
+// Prompt, question and choice texts are stored per locale; the client's
+// preferred locales pick among them, falling back to DefaultLocale.
+package survey
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+)
+
+// Length limits for rule texts.
+const (
+	MaxQuestionLength = 500
+	MaxFollowUpLength = 500
+)
+
+// Rule configures the prompt for one app, optionally limited to some
+// platforms and an app version range.
+type Rule struct {
+	ID  bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	App string        `bson:"app"           json:"app"`
+	// Platforms limits the rule to these platforms; empty matches any.
+	Platforms []string `bson:"platforms,omitempty" json:"platforms,omitempty"`
+	// MinVersion and MaxVersion bound app_version, inclusive. Empty means
+	// unbounded.
+	MinVersion string `bson:"min_version,omitempty" json:"min_version,omitempty"`
+	MaxVersion string `bson:"max_version,omitempty" json:"max_version,omitempty"`
+	// Priority picks between several matching rules; highest wins.
+	Priority int  `bson:"priority" json:"priority"`
+	Enabled  bool `bson:"enabled"  json:"enabled"`
+
+	SamplePercent         int    `bson:"sample_percent"           json:"sample_percent"`
+	MinDaysBetweenPrompts int    `bson:"min_days_between_prompts" json:"min_days_between_prompts"`
+	Question              string `bson:"question"                 json:"question"`
+	FollowUp              string `bson:"follow_up,omitempty"      json:"follow_up,omitempty"`
+	// Translations holds Question and FollowUp in other locales, keyed by
+	// language tag. Question and FollowUp themselves are the DefaultLocale
+	// texts.
+	Translations map[string]RuleText `bson:"translations,omitempty" json:"translations,omitempty"`
+
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// RuleText is a rule's prompt texts in one locale.
+type RuleText struct {
+	Question string `bson:"question"            json:"question"`
+	FollowUp string `bson:"follow_up,omitempty" json:"follow_up,omitempty"`
+}
+
+// Validate checks a rule before it is stored.
+func (r *Rule) Validate() error {
+	if r.App == "" {
+		return errors.New("app is required")
+	}
+	if slices.Contains(r.Platforms, "") {
+		return errors.New("platforms must not contain empty values")
+	}
+	for _, v := range []string{r.MinVersion, r.MaxVersion} {
+		if v != "" && !validVersion(v) {
+			return fmt.Errorf("invalid version %q: use dotted numbers such as 1.4 or 2.0.1", v)
+		}
+	}
+	if r.MinVersion != "" && r.MaxVersion != "" && CompareVersions(r.MinVersion, r.MaxVersion) > 0 {
+		return errors.New("min_version must not be greater than max_version")
+	}
+	if r.SamplePercent < 0 || r.SamplePercent > 100 {
+		return errors.New("sample_percent must be between 0 and 100")
+	}
+	if r.MinDaysBetweenPrompts < 0 {
+		return errors.New("min_days_between_prompts must not be negative")
+	}
+	if strings.TrimSpace(r.Question) == "" {
+		return errors.New("question is required")
+	}
+	if len(r.Question) > MaxQuestionLength {
+		return fmt.Errorf("question exceeds %d characters", MaxQuestionLength)
+	}
+	if len(r.FollowUp) > MaxFollowUpLength {
+		return fmt.Errorf("follow_up exceeds %d characters", MaxFollowUpLength)
+	}
+	for locale, t := range r.Translations {
+		if !i18n.ValidTag(locale) || i18n.Normalize(locale) != locale {
+			return fmt.Errorf("translations has invalid locale %q", locale)
+		}
+		if locale == DefaultLocale {
+			return fmt.Errorf("translations must not contain %q: use question and follow_up", DefaultLocale)
+		}
+		if strings.TrimSpace(t.Question) == "" {
+			return fmt.Errorf("translations[%s]: question is required", locale)
+		}
+		if len(t.Question) > MaxQuestionLength {
+			return fmt.Errorf("translations[%s]: question exceeds %d characters", locale, MaxQuestionLength)
+		}
+		// A follow-up shown in one language must be shown in all of them.
+		if (t.FollowUp == "") != (r.FollowUp == "") {
+			return fmt.Errorf("translations[%s]: follow_up must be set exactly when the rule has one", locale)
+		}
+		if len(t.FollowUp) > MaxFollowUpLength {
+			return fmt.Errorf("translations[%s]: follow_up exceeds %d characters", locale, MaxFollowUpLength)
+		}
+	}
+	return nil
+}
+
+// Text returns the rule's texts for the first of the preferred locales it
+// has, following parent tags and ending with DefaultLocale, and the locale
+// they are in.
+func (r *Rule) Text(prefs []string) (RuleText, string) {
+	locale := i18n.Match(prefs, func(tag string) bool {
+		_, ok := r.Translations[tag]
+		return ok || tag == DefaultLocale
+	})
+	if t, ok := r.Translations[locale]; ok {
+		return t, locale
+	}
+	return RuleText{Question: r.Question, FollowUp: r.FollowUp}, DefaultLocale
+}
+
+// Matches reports whether the rule applies to a client on platform running
+// version. A rule with platform or version limits never matches a client
+// that did not say which platform or version it has.
+func (r *Rule) Matches(platform, version string) bool {
+	if !r.Enabled {
+		return false
+	}
+	if len(r.Platforms) > 0 && !slices.Contains(r.Platforms, platform) {
+		return false
+	}
+	if r.MinVersion != "" && (version == "" || CompareVersions(version, r.MinVersion) < 0) {
+		return false
+	}
+	if r.MaxVersion != "" && (version == "" || CompareVersions(version, r.MaxVersion) > 0) {
+		return false
+	}
+	return true
+}
+
+// Request describes the client asking whether to prompt.
+type Request struct {
+	App        string
+	Platform   string
+	AppVersion string
+	InstallID  string
+	// Locales lists the client's preferred languages, best first.
+	Locales []string
+}
+
+// Config is the answer sent to the client.
+type Config struct {
+	Prompt                bool   `json:"prompt"`
+	MinDaysBetweenPrompts int    `json:"min_days_between_prompts"`
+	SamplePercent         int    `json:"sample_percent"`
+	Question              string `json:"question,omitempty"`
+	FollowUp              string `json:"follow_up,omitempty"`
+	// Locale is the language of Question and FollowUp.
+	Locale string `json:"locale,omitempty"`
+	// RuleID identifies the rule that matched, for support.
+	RuleID string `json:"rule_id,omitempty"`
+}
+
+// Select returns the matching rule with the highest priority, preferring
+// the most recently updated on a tie, or nil when none matches.
+func Select(rules []Rule, req Request) *Rule {
+	var best *Rule
+	for i := range rules {
+		r := &rules[i]
+		if r.App != req.App || !r.Matches(req.Platform, req.AppVersion) {
+			continue
+		}
+		if best == nil || r.Priority > best.Priority ||
+			(r.Priority == best.Priority && r.UpdatedAt.After(best.UpdatedAt)) {
+			best = r
+		}
+	}
+	return best
+}
+
+// Decide builds the client's config from rules. Without a matching rule the
+// client is told not to prompt. Without an install ID there is no stable
+// bucket, so only a 100% sample prompts.
+func Decide(rules []Rule, req Request) Config {
+	r := Select(rules, req)
+	if r == nil {
+		return Config{}
+	}
+	text, locale := r.Text(req.Locales)
+	cfg := Config{
+		MinDaysBetweenPrompts: r.MinDaysBetweenPrompts,
+		SamplePercent:         r.SamplePercent,
+		Question:              text.Question,
+		FollowUp:              text.FollowUp,
+		Locale:                locale,
+		RuleID:                r.ID.Hex(),
+	}
+	if req.InstallID == "" {
+		cfg.Prompt = r.SamplePercent >= 100
+	} else {
+		cfg.Prompt = Bucket(req.App, req.InstallID) < r.SamplePercent
+	}
+	return cfg
+}
+
+// Bucket places an installation in one of 100 buckets, 0-99. It depends
+// only on the app and install ID, so raising a rule's sample percentage
+// keeps every installation that was already sampled.
+func Bucket(app, installID string) int {
+	sum := sha256.Sum256([]byte(app + "\n" + installID))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+// CompareVersions compares dotted version strings numerically, so 1.10 is
+// greater than 1.9 and 1.2 equals 1.2.0. A leading "v" is ignored, and a
+// pre-release suffix after "-" sorts before the release.
+func CompareVersions(a, b string) int {
+	aMain, aPre := splitVersion(a)
+	bMain, bPre := splitVersion(b)
+	for i := range max(len(aMain), len(bMain)) {
+		var x, y int
+		if i < len(aMain) {
+			x = aMain[i]
+		}
+		if i < len(bMain) {
+			y = bMain[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	default:
+		return strings.Compare(aPre, bPre)
+	}
+}
+
+// splitVersion parses "v1.2.3-beta+build" into [1 2 3] and "beta". Parts
+// that are not numbers count as 0.
+func splitVersion(v string) ([]int, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "+")
+	main, pre, _ := strings.Cut(v, "-")
+	var parts []int
+	for _, p := range strings.Split(main, ".") {
+		n, _ := strconv.Atoi(p)
+		parts = append(parts, n)
+	}
+	return parts, pre
+}
+
+func validVersion(v string) bool {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "+")
+	main, _, _ := strings.Cut(v, "-")
+	for _, p := range strings.Split(main, ".") {
+		if _, err := strconv.Atoi(p); err != nil || p == "" || strings.HasPrefix(p, "-") || strings.HasPrefix(p, "+") {
+			return false
+		}
+	}
+	return true
+}
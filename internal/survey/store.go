@@ -0,0 +1,222 @@
+package survey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Collection is the MongoDB collection holding survey rules.
+const Collection = "survey_rules"
+
+// ErrNotFound is returned when a rule ID does not exist.
+var ErrNotFound = errors.New("survey rule not found")
+
+// Rules stores survey rules.
+type Rules interface {
+	// List returns the rules for app, or all rules when app is empty,
+	// ordered by app and descending priority.
+	List(ctx context.Context, app string) ([]Rule, error)
+	// Put inserts r when its ID is zero, assigning one, and replaces the
+	// stored rule otherwise. It sets UpdatedAt.
+	Put(ctx context.Context, r *Rule) error
+	Delete(ctx context.Context, id bson.ObjectID) error
+}
+
+// Mongo stores rules in the survey_rules collection.
+type Mongo struct {
+	coll *mongo.Collection
+}
+
+// NewMongo creates a rule store over coll.
+func NewMongo(coll *mongo.Collection) *Mongo {
+	return &Mongo{coll: coll}
+}
+
+// List implements Rules.
+func (m *Mongo) List(ctx context.Context, app string) ([]Rule, error) {
+	filter := bson.D{}
+	if app != "" {
+		filter = bson.D{{Key: "app", Value: app}}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "app", Value: 1}, {Key: "priority", Value: -1}})
+	cur, err := m.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list survey rules: %w", err)
+	}
+	rules := []Rule{}
+	if err := cur.All(ctx, &rules); err != nil {
+		return nil, fmt.Errorf("failed to list survey rules: %w", err)
+	}
+	return rules, nil
+}
+
+// Put implements Rules.
+func (m *Mongo) Put(ctx context.Context, r *Rule) error {
+	r.UpdatedAt = time.Now().UTC()
+	if r.ID.IsZero() {
+		r.ID = bson.NewObjectID()
+		if _, err := m.coll.InsertOne(ctx, r); err != nil {
+			return fmt.Errorf("failed to insert survey rule: %w", err)
+		}
+		return nil
+	}
+	res, err := m.coll.ReplaceOne(ctx, bson.D{{Key: "_id", Value: r.ID}}, r)
+	if err != nil {
+		return fmt.Errorf("failed to replace survey rule: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete implements Rules.
+func (m *Mongo) Delete(ctx context.Context, id bson.ObjectID) error {
+	res, err := m.coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return fmt.Errorf("failed to delete survey rule: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Memory is an in-memory Rules implementation for tests.
+type Memory struct {
+	mu    sync.Mutex
+	rules []Rule
+}
+
+// NewMemory creates an empty rule store.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// List implements Rules.
+func (m *Memory) List(_ context.Context, app string) ([]Rule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := []Rule{}
+	for _, r := range m.rules {
+		if app == "" || r.App == app {
+			rules = append(rules, r)
+		}
+	}
+	slices.SortStableFunc(rules, func(a, b Rule) int {
+		if c := strings.Compare(a.App, b.App); c != 0 {
+			return c
+		}
+		return b.Priority - a.Priority
+	})
+	return rules, nil
+}
+
+// Put implements Rules.
+func (m *Memory) Put(_ context.Context, r *Rule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.UpdatedAt = time.Now().UTC()
+	if r.ID.IsZero() {
+		r.ID = bson.NewObjectID()
+		m.rules = append(m.rules, *r)
+		return nil
+	}
+	i := slices.IndexFunc(m.rules, func(s Rule) bool { return s.ID == r.ID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.rules[i] = *r
+	return nil
+}
+
+// Delete implements Rules.
+func (m *Memory) Delete(_ context.Context, id bson.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.rules, func(s Rule) bool { return s.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.rules = slices.Delete(m.rules, i, i+1)
+	return nil
+}
+
+// Service answers survey config requests from cached rules, so client
+// start-ups do not each hit the database. Changes made through another
+// replica take effect within the cache TTL.
+type Service struct {
+	rules Rules
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedRules
+}
+
+// maxCachedApps bounds the rule cache.
+const maxCachedApps = 1000
+
+type cachedRules struct {
+	rules   []Rule
+	fetched time.Time
+}
+
+// NewService creates a Service that caches each app's rules for ttl.
+func NewService(rules Rules, ttl time.Duration) *Service {
+	return &Service{rules: rules, ttl: ttl, now: time.Now, cache: map[string]cachedRules{}}
+}
+
+// Rules returns the underlying rule store.
+func (s *Service) Rules() Rules {
+	return s.rules
+}
+
+// Config decides whether the client in req should prompt.
+func (s *Service) Config(ctx context.Context, req Request) (Config, error) {
+	rules, err := s.appRules(ctx, req.App)
+	if err != nil {
+		return Config{}, err
+	}
+	return Decide(rules, req), nil
+}
+
+// InvalidateAll drops the cached rules after a change made through this
+// replica. An update can move a rule to another app, so every app is
+// dropped.
+func (s *Service) InvalidateAll() {
+	s.mu.Lock()
+	clear(s.cache)
+	s.mu.Unlock()
+}
+
+func (s *Service) appRules(ctx context.Context, app string) ([]Rule, error) {
+	s.mu.Lock()
+	c, ok := s.cache[app]
+	s.mu.Unlock()
+	if ok && s.now().Sub(c.fetched) < s.ttl {
+		return c.rules, nil
+	}
+
+	rules, err := s.rules.List(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if len(s.cache) >= maxCachedApps {
+		// Unknown app names are cached too; don't let them pile up.
+		clear(s.cache)
+	}
+	s.cache[app] = cachedRules{rules: rules, fetched: s.now()}
+	s.mu.Unlock()
+	return rules, nil
+}
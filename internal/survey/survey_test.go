@@ -0,0 +1,325 @@
+package survey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10", "1.9", 1},
+		{"1.2", "1.2.0", 0},
+		{"v2.0", "2.0", 0},
+		{"2.0.0-beta", "2.0.0", -1},
+		{"2.0.0-alpha", "2.0.0-beta", -1},
+		{"0.9.9", "1.0", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRule_Matches(t *testing.T) {
+	r := Rule{Enabled: true, Platforms: []string{"macOS"}, MinVersion: "1.4", MaxVersion: "1.9"}
+	tests := []struct {
+		platform, version string
+		want              bool
+	}{
+		{"macOS", "1.4.0", true},
+		{"macOS", "1.9", true},
+		{"macOS", "1.10", false},
+		{"macOS", "1.3.9", false},
+		{"Windows", "1.5", false},
+		{"macOS", "", false},
+	}
+	for _, tt := range tests {
+		if got := r.Matches(tt.platform, tt.version); got != tt.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", tt.platform, tt.version, got, tt.want)
+		}
+	}
+	r.Enabled = false
+	if r.Matches("macOS", "1.5") {
+		t.Error("disabled rule matched")
+	}
+}
+
+func TestRule_Validate(t *testing.T) {
+	valid := Rule{App: "idefinity", SamplePercent: 10, MinDaysBetweenPrompts: 90, Question: "How likely...?"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid rule, got %v", err)
+	}
+	for name, mutate := range map[string]func(*Rule){
+		"no app":         func(r *Rule) { r.App = "" },
+		"sample > 100":   func(r *Rule) { r.SamplePercent = 101 },
+		"negative days":  func(r *Rule) { r.MinDaysBetweenPrompts = -1 },
+		"no question":    func(r *Rule) { r.Question = " " },
+		"bad version":    func(r *Rule) { r.MinVersion = "latest" },
+		"inverted range": func(r *Rule) { r.MinVersion, r.MaxVersion = "2.0", "1.0" },
+		"empty platform": func(r *Rule) { r.Platforms = []string{""} },
+	} {
+		r := valid
+		mutate(&r)
+		if err := r.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRule_Translations(t *testing.T) {
+	r := Rule{App: "idefinity", Enabled: true, SamplePercent: 100, Question: "How likely?", FollowUp: "Why?",
+		Translations: map[string]RuleText{
+			"fi": {Question: "Kuinka todennäköisesti?", FollowUp: "Miksi?"},
+			"sv": {Question: "Hur troligt?", FollowUp: "Varför?"},
+		}}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("expected valid translations, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		locales        []string
+		question, from string
+	}{
+		{[]string{"sv-FI"}, "Hur troligt?", "sv"},
+		{[]string{"de", "fi"}, "Kuinka todennäköisesti?", "fi"},
+		{[]string{"de"}, "How likely?", "en"},
+		{nil, "How likely?", "en"},
+	} {
+		cfg := Decide([]Rule{r}, Request{App: "idefinity", Locales: tc.locales})
+		if cfg.Question != tc.question || cfg.Locale != tc.from {
+			t.Errorf("%v: got %q in %q", tc.locales, cfg.Question, cfg.Locale)
+		}
+	}
+
+	for name, tr := range map[string]map[string]RuleText{
+		"default locale":    {"en": {Question: "q", FollowUp: "f"}},
+		"invalid locale":    {"sv_FI": {Question: "q", FollowUp: "f"}},
+		"missing question":  {"fi": {FollowUp: "f"}},
+		"missing follow-up": {"fi": {Question: "q"}},
+	} {
+		bad := r
+		bad.Translations = tr
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSelect_PriorityAndTargeting(t *testing.T) {
+	now := time.Now()
+	rules := []Rule{
+		{App: "idefinity", Enabled: true, Priority: 0, Question: "default"},
+		{App: "idefinity", Enabled: true, Priority: 10, Platforms: []string{"Windows"}, Question: "windows"},
+		{App: "idefinity", Enabled: true, Priority: 5, MinVersion: "2.0", Question: "v2", UpdatedAt: now},
+		{App: "idefinity", Enabled: true, Priority: 5, MinVersion: "2.0", Question: "v2 older", UpdatedAt: now.Add(-time.Hour)},
+		{App: "other", Enabled: true, Priority: 100, Question: "other app"},
+	}
+	tests := []struct {
+		req  Request
+		want string
+	}{
+		{Request{App: "idefinity", Platform: "macOS", AppVersion: "1.0"}, "default"},
+		{Request{App: "idefinity", Platform: "Windows", AppVersion: "2.1"}, "windows"},
+		{Request{App: "idefinity", Platform: "macOS", AppVersion: "2.1"}, "v2"},
+	}
+	for _, tt := range tests {
+		r := Select(rules, tt.req)
+		if r == nil || r.Question != tt.want {
+			t.Errorf("%+v: got %+v, want %q", tt.req, r, tt.want)
+		}
+	}
+	if r := Select(rules, Request{App: "unknown"}); r != nil {
+		t.Errorf("expected no rule for an unknown app, got %+v", r)
+	}
+}
+
+func TestDecide_BucketingIsStableAndMonotonic(t *testing.T) {
+	rules := []Rule{{App: "idefinity", Enabled: true, SamplePercent: 20, Question: "q"}}
+	sampled := map[string]bool{}
+	for i := range 1000 {
+		id := fmt.Sprintf("install-%d", i)
+		req := Request{App: "idefinity", InstallID: id}
+		first := Decide(rules, req).Prompt
+		if Decide(rules, req).Prompt != first {
+			t.Fatalf("%s: decision is not deterministic", id)
+		}
+		sampled[id] = first
+	}
+	n := 0
+	for _, s := range sampled {
+		if s {
+			n++
+		}
+	}
+	if n < 150 || n > 250 {
+		t.Errorf("expected about 20%% sampled, got %d of 1000", n)
+	}
+
+	rules[0].SamplePercent = 50
+	for id, was := range sampled {
+		if was && !Decide(rules, Request{App: "idefinity", InstallID: id}).Prompt {
+			t.Fatalf("%s dropped out of the sample when it grew", id)
+		}
+	}
+
+	if Decide(rules, Request{App: "idefinity"}).Prompt {
+		t.Error("expected no prompt without an install ID below 100%")
+	}
+	rules[0].SamplePercent = 100
+	if !Decide(rules, Request{App: "idefinity"}).Prompt {
+		t.Error("expected a prompt without an install ID at 100%")
+	}
+}
+
+func TestService_CachesUntilInvalidated(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemory()
+	svc := NewService(mem, time.Minute)
+	mem.Put(ctx, &Rule{App: "idefinity", Enabled: true, SamplePercent: 100, Question: "first"})
+
+	if cfg, _ := svc.Config(ctx, Request{App: "idefinity"}); cfg.Question != "first" {
+		t.Fatalf("got %+v", cfg)
+	}
+	rules, _ := mem.List(ctx, "idefinity")
+	rules[0].Question = "second"
+	mem.Put(ctx, &rules[0])
+
+	if cfg, _ := svc.Config(ctx, Request{App: "idefinity"}); cfg.Question != "first" {
+		t.Errorf("expected the cached rule, got %+v", cfg)
+	}
+	svc.InvalidateAll()
+	if cfg, _ := svc.Config(ctx, Request{App: "idefinity"}); cfg.Question != "second" {
+		t.Errorf("expected the updated rule, got %+v", cfg)
+	}
+}
+
+func testDefinition() Definition {
+	en := func(s string) map[string]string { return map[string]string{"en": s} }
+	return Definition{ID: "onboarding", Questions: []Question{
+		{ID: "ease", Type: QuestionRating, Prompt: en("How easy?"), Required: true},
+		{ID: "features", Type: QuestionMultiChoice, Prompt: en("What do you use?"), Choices: []Choice{
+			{ID: "scan", Label: en("Scanning")},
+			{ID: "export", Label: en("Export")},
+		}},
+		{ID: "why", Type: QuestionFreeText, Prompt: map[string]string{"en": "Why?", "fi": "Miksi?"}},
+	}}
+}
+
+func TestDefinition_Validate(t *testing.T) {
+	d := testDefinition()
+	if err := d.Validate(); err != nil {
+		t.Fatalf("expected valid definition, got %v", err)
+	}
+
+	for name, mutate := range map[string]func(d *Definition){
+		"bad id":             func(d *Definition) { d.ID = "On Boarding" },
+		"no questions":       func(d *Definition) { d.Questions = nil },
+		"duplicate question": func(d *Definition) { d.Questions[1].ID = "ease" },
+		"unknown type":       func(d *Definition) { d.Questions[0].Type = "slider" },
+		"missing en prompt":  func(d *Definition) { d.Questions[2].Prompt = map[string]string{"fi": "Miksi?"} },
+		"bad locale":         func(d *Definition) { d.Questions[2].Prompt["Finnish"] = "Miksi?" },
+		"one choice":         func(d *Definition) { d.Questions[1].Choices = d.Questions[1].Choices[:1] },
+		"choices on text":    func(d *Definition) { d.Questions[2].Choices = d.Questions[1].Choices },
+		"scale too large":    func(d *Definition) { d.Questions[0].Scale = 11 },
+	} {
+		d := testDefinition()
+		mutate(&d)
+		if err := d.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDefinition_ValidateAnswers(t *testing.T) {
+	d := testDefinition()
+	rating := func(n int) *int { return &n }
+	tests := []struct {
+		name    string
+		answers []model.Answer
+		ok      bool
+	}{
+		{"all answered", []model.Answer{
+			{QuestionID: "ease", Rating: rating(5)},
+			{QuestionID: "features", Choices: []string{"scan", "export"}},
+			{QuestionID: "why", Text: "fast"},
+		}, true},
+		{"optional skipped", []model.Answer{{QuestionID: "ease", Rating: rating(1)}}, true},
+		{"required missing", []model.Answer{{QuestionID: "why", Text: "fast"}}, false},
+		{"rating above scale", []model.Answer{{QuestionID: "ease", Rating: rating(6)}}, false},
+		{"wrong value type", []model.Answer{{QuestionID: "ease", Text: "5"}}, false},
+		{"unknown question", []model.Answer{{QuestionID: "ease", Rating: rating(3)}, {QuestionID: "colour", Text: "red"}}, false},
+		{"answered twice", []model.Answer{{QuestionID: "ease", Rating: rating(3)}, {QuestionID: "ease", Rating: rating(4)}}, false},
+		{"repeated choice", []model.Answer{{QuestionID: "ease", Rating: rating(3)}, {QuestionID: "features", Choices: []string{"scan", "scan"}}}, false},
+	}
+	for _, tt := range tests {
+		if err := d.ValidateAnswers(tt.answers); (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestDefinition_Localize(t *testing.T) {
+	d := Definition{ID: "onboarding", Version: 1, Questions: []Question{{
+		ID: "reason", Type: QuestionSingleChoice,
+		Prompt: map[string]string{"en": "Main reason?", "fi": "Tärkein syy?"},
+		Choices: []Choice{
+			{ID: "price", Label: map[string]string{"en": "Price", "fi": "Hinta"}},
+			{ID: "speed", Label: map[string]string{"en": "Speed"}},
+		},
+	}}}
+	if err := d.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	q := d.Localize([]string{"fi-FI"}).Questions[0]
+	if q.Prompt != "Tärkein syy?" || q.Locale != "fi" || q.Choices[0].Label != "Hinta" || q.Choices[1].Label != "Speed" {
+		t.Errorf("unexpected localized question %+v", q)
+	}
+
+	d.Questions[0].Prompt["sv_FI"] = "Varför?"
+	if err := d.Validate(); err == nil {
+		t.Error("expected an error for a non-canonical locale")
+	}
+}
+
+func TestMemoryDefinitions_Versions(t *testing.T) {
+	ctx := context.Background()
+	defs := NewMemoryDefinitions()
+	for range 2 {
+		d := testDefinition()
+		if err := defs.Publish(ctx, &d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := defs.Get(ctx, "onboarding", 0)
+	if err != nil || latest.Version != 2 {
+		t.Fatalf("expected latest version 2, got %+v, %v", latest, err)
+	}
+	if _, err := defs.Get(ctx, "onboarding", 3); err != ErrDefinitionNotFound {
+		t.Errorf("expected ErrDefinitionNotFound, got %v", err)
+	}
+	if list, _ := defs.List(ctx); len(list) != 1 || list[0].Version != 2 {
+		t.Errorf("expected only the latest version listed, got %+v", list)
+	}
+
+	c := NewCatalog(defs)
+	fb := &model.Feedback{SurveyID: "onboarding", SurveyVersion: 1}
+	var verr *model.ValidationError
+	if err := c.ValidateAnswers(ctx, fb); !errors.As(err, &verr) || verr.Code != i18n.CodeQuestionRequired {
+		t.Errorf("expected a question_required error for the missing answer, got %v", err)
+	}
+	fb.SurveyID = "missing"
+	if err := c.ValidateAnswers(ctx, fb); !errors.As(err, &verr) || verr.Code != i18n.CodeUnknownSurvey {
+		t.Errorf("expected an unknown_survey error, got %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/idefinity/nps-api/internal/fieldcrypt"
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// metrics are published under "webhooks" on the expvar endpoint.
+var metrics = expvar.NewMap("webhooks")
+
+// ErrFeedbackNotFound is returned by a FeedbackLoader for feedback that no
+// longer exists, such as after an erasure request.
+var ErrFeedbackNotFound = errors.New("feedback not found")
+
+// FeedbackLoader loads stored feedback for a delivery, with comment and
+// answers decrypted.
+type FeedbackLoader func(ctx context.Context, id bson.ObjectID) (*model.Feedback, error)
+
+// MongoFeedback returns a FeedbackLoader over the feedback collection that
+// decrypts with keyring, which may be nil when encryption is off.
+func MongoFeedback(coll *mongo.Collection, keyring *fieldcrypt.Keyring) FeedbackLoader {
+	return func(ctx context.Context, id bson.ObjectID) (*model.Feedback, error) {
+		var fb model.Feedback
+		err := coll.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&fb)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrFeedbackNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load feedback: %w", err)
+		}
+		if keyring != nil {
+			if err := fieldcrypt.DecryptFeedback(keyring, &fb); err != nil {
+				return nil, fmt.Errorf("failed to decrypt feedback: %w", err)
+			}
+		}
+		return &fb, nil
+	}
+}
+
+// Defaults for DispatcherConfig fields left zero.
+const (
+	DefaultMaxAttempts = 10
+	DefaultMinBackoff  = 30 * time.Second
+	DefaultMaxBackoff  = time.Hour
+	DefaultTimeout     = 10 * time.Second
+)
+
+// maxResponseError bounds how much of a failed response body is logged.
+const maxResponseError = 200
+
+// DispatcherConfig tunes delivery.
+type DispatcherConfig struct {
+	// Client sends the deliveries; it defaults to one with Timeout that
+	// does not follow redirects.
+	Client *http.Client
+	// Timeout bounds each attempt of the default client; it defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+	// MaxAttempts is how often a delivery is tried before it is
+	// dead-lettered.
+	MaxAttempts int
+	// MinBackoff is the delay after the first failure; it doubles with
+	// each further failure up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Dispatcher sends queued deliveries. Several replicas can run one each:
+// claiming a delivery leases it to one dispatcher.
+type Dispatcher struct {
+	subs       Subscriptions
+	deliveries Deliveries
+	feedback   FeedbackLoader
+	cfg        DispatcherConfig
+	lease      time.Duration
+	now        func() time.Time
+}
+
+// NewDispatcher creates a Dispatcher.
+func NewDispatcher(subs Subscriptions, deliveries Deliveries, feedback FeedbackLoader, cfg DispatcherConfig) *Dispatcher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect would resend the signed payload to a URL nobody
+			// configured; treat it as a failure instead.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(DefaultMaxBackoff, cfg.MinBackoff)
+	}
+	// The lease outlasts an attempt, so a delivery is only claimed again
+	// when its dispatcher died mid-attempt.
+	lease := 2 * cfg.Timeout
+	if cfg.Client.Timeout > 0 {
+		lease = 2 * cfg.Client.Timeout
+	}
+	return &Dispatcher{subs: subs, deliveries: deliveries, feedback: feedback, cfg: cfg, lease: lease, now: time.Now}
+}
+
+// Start sends due deliveries every interval and whenever wake fires, until
+// ctx is cancelled. wake may be nil.
+func (d *Dispatcher) Start(ctx context.Context, interval time.Duration, wake <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("webhook dispatch failed", "error", err)
+			metrics.Add("errors", 1)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// RunOnce attempts every delivery that is due and returns how many it
+// attempted.
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	n := 0
+	for ctx.Err() == nil {
+		now := d.now().UTC()
+		del, err := d.deliveries.Claim(ctx, now, d.lease)
+		if err != nil {
+			return n, err
+		}
+		if del == nil {
+			return n, nil
+		}
+		d.attempt(ctx, del, now)
+		if err := d.deliveries.Update(ctx, del); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, ctx.Err()
+}
+
+// attempt sends del once and records the outcome on it. Deliveries that
+// can never succeed, because the subscription or the feedback is gone, are
+// dead-lettered at once.
+func (d *Dispatcher) attempt(ctx context.Context, del *Delivery, now time.Time) {
+	del.Attempts++
+	del.UpdatedAt = now
+
+	sub, err := d.subs.Get(ctx, del.SubscriptionID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		d.giveUp(del, "subscription deleted")
+		return
+	case err != nil:
+		d.retry(del, 0, err.Error(), now)
+		return
+	case !sub.Enabled:
+		d.giveUp(del, "subscription disabled")
+		return
+	}
+
+	fb, err := d.feedback(ctx, del.FeedbackID)
+	switch {
+	case errors.Is(err, ErrFeedbackNotFound):
+		d.giveUp(del, "feedback no longer exists")
+		return
+	case err != nil:
+		d.retry(del, 0, err.Error(), now)
+		return
+	}
+
+	status, err := d.send(ctx, sub, del, fb, now)
+	if err != nil {
+		d.retry(del, status, err.Error(), now)
+		return
+	}
+	delivered := now
+	del.Status, del.DeliveredAt = StatusDelivered, &delivered
+	del.LastStatusCode, del.LastError = status, ""
+	metrics.Add("delivered", 1)
+}
+
+func (d *Dispatcher) send(ctx context.Context, sub *Subscription, del *Delivery, fb *model.Feedback, now time.Time) (int, error) {
+	body, err := json.Marshal(Payload{
+		Event:      del.Event,
+		DeliveryID: del.ID.Hex(),
+		Feedback:   NewFeedbackPayload(fb),
+	})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nps-api-webhooks")
+	req.Header.Set(HeaderEvent, del.Event)
+	req.Header.Set(HeaderDelivery, del.ID.Hex())
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, ts, body))
+
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return resp.StatusCode, nil
+	}
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseError))
+	return resp.StatusCode, fmt.Errorf("endpoint returned %d: %s", resp.StatusCode, bytes.TrimSpace(excerpt))
+}
+
+// retry schedules the next attempt with exponential backoff, or
+// dead-letters del when it is out of attempts.
+func (d *Dispatcher) retry(del *Delivery, status int, reason string, now time.Time) {
+	del.LastStatusCode, del.LastError = status, reason
+	if del.Attempts >= d.cfg.MaxAttempts {
+		d.giveUp(del, reason)
+		return
+	}
+	del.NextAttemptAt = now.Add(d.backoff(del.Attempts))
+	metrics.Add("retried", 1)
+}
+
+func (d *Dispatcher) giveUp(del *Delivery, reason string) {
+	del.Status, del.LastError = StatusDead, reason
+	metrics.Add("dead", 1)
+	slog.Warn("webhook delivery dead-lettered", "id", del.ID.Hex(), "subscription", del.SubscriptionID.Hex(),
+		"attempts", del.Attempts, "reason", reason)
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.MinBackoff
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= d.cfg.MaxBackoff {
+			return d.cfg.MaxBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Notifier queues deliveries for new feedback. Subscriptions are cached so
+// submissions do not each hit the database; changes made through another
+// replica take effect within the cache TTL.
+type Notifier struct {
+	subs       Subscriptions
+	deliveries Deliveries
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	cached  []Subscription
+	fetched time.Time
+
+	wake chan struct{}
+}
+
+// NewNotifier creates a Notifier that caches subscriptions for ttl.
+func NewNotifier(subs Subscriptions, deliveries Deliveries, ttl time.Duration) *Notifier {
+	return &Notifier{subs: subs, deliveries: deliveries, ttl: ttl, now: time.Now, wake: make(chan struct{}, 1)}
+}
+
+// Subscriptions returns the underlying subscription store.
+func (n *Notifier) Subscriptions() Subscriptions {
+	return n.subs
+}
+
+// Deliveries returns the underlying delivery store.
+func (n *Notifier) Deliveries() Deliveries {
+	return n.deliveries
+}
+
+// Wake fires after deliveries were queued, so a Dispatcher in the same
+// process can send them without waiting for its next poll.
+func (n *Notifier) Wake() <-chan struct{} {
+	return n.wake
+}
+
+// Poke signals Wake without blocking.
+func (n *Notifier) Poke() {
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// InvalidateAll drops the cached subscriptions after a change made through
+// this replica.
+func (n *Notifier) InvalidateAll() {
+	n.mu.Lock()
+	n.cached = nil
+	n.mu.Unlock()
+}
+
+// Notify queues a delivery of fb, which must already be stored, to every
+// enabled subscription whose filter matches it. Quarantined feedback is
+// never sent.
+func (n *Notifier) Notify(ctx context.Context, fb *model.Feedback) error {
+	if fb.Quarantine {
+		return nil
+	}
+	subs, err := n.subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	now := n.now().UTC()
+	var ds []Delivery
+	for _, s := range subs {
+		if !s.Enabled || !s.Filter.Matches(fb) {
+			continue
+		}
+		ds = append(ds, Delivery{
+			ID:             bson.NewObjectID(),
+			SubscriptionID: s.ID,
+			Event:          EventFeedbackCreated,
+			FeedbackID:     fb.ID,
+			Status:         StatusPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+	}
+	if len(ds) == 0 {
+		return nil
+	}
+	if err := n.deliveries.Enqueue(ctx, ds); err != nil {
+		return err
+	}
+	metrics.Add("queued", int64(len(ds)))
+	n.Poke()
+	return nil
+}
+
+func (n *Notifier) subscriptions(ctx context.Context) ([]Subscription, error) {
+	n.mu.Lock()
+	subs, fetched := n.cached, n.fetched
+	n.mu.Unlock()
+	if subs != nil && n.now().Sub(fetched) < n.ttl {
+		return subs, nil
+	}
+
+	subs, err := n.subs.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	n.cached, n.fetched = subs, n.now()
+	n.mu.Unlock()
+	return subs, nil
+}
@@ -0,0 +1,422 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MongoDB collections.
+const (
+	SubscriptionCollection = "webhook_subscriptions"
+	DeliveryCollection     = "webhook_deliveries"
+)
+
+// Errors returned by the stores.
+var (
+	ErrNotFound         = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// Delivery states. Pending deliveries are attempted when NextAttemptAt is
+// due; dead ones gave up and wait for a manual redelivery.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Delivery is one queued notification of one subscription, and its log
+// entry once attempted.
+type Delivery struct {
+	ID             bson.ObjectID `bson:"_id"             json:"id"`
+	SubscriptionID bson.ObjectID `bson:"subscription_id" json:"subscription_id"`
+	Event          string        `bson:"event"           json:"event"`
+	FeedbackID     bson.ObjectID `bson:"feedback_id"     json:"feedback_id"`
+	Status         string        `bson:"status"          json:"status"`
+	Attempts       int           `bson:"attempts"        json:"attempts"`
+	NextAttemptAt  time.Time     `bson:"next_attempt_at" json:"next_attempt_at"`
+	// LastStatusCode and LastError describe the latest failed attempt.
+	LastStatusCode int        `bson:"last_status_code,omitempty" json:"last_status_code,omitempty"`
+	LastError      string     `bson:"last_error,omitempty"       json:"last_error,omitempty"`
+	CreatedAt      time.Time  `bson:"created_at"                 json:"created_at"`
+	UpdatedAt      time.Time  `bson:"updated_at"                 json:"updated_at"`
+	DeliveredAt    *time.Time `bson:"delivered_at,omitempty"     json:"delivered_at,omitempty"`
+}
+
+// DeliveryQuery selects deliveries for the log. Zero fields match
+// everything.
+type DeliveryQuery struct {
+	SubscriptionID bson.ObjectID
+	Status         string
+	Limit          int64
+}
+
+// Subscriptions stores webhook subscriptions.
+type Subscriptions interface {
+	// List returns every subscription, oldest first.
+	List(ctx context.Context) ([]Subscription, error)
+	Get(ctx context.Context, id bson.ObjectID) (*Subscription, error)
+	// Put inserts s when its ID is zero, assigning one and CreatedAt, and
+	// replaces the stored subscription otherwise. It sets UpdatedAt.
+	Put(ctx context.Context, s *Subscription) error
+	Delete(ctx context.Context, id bson.ObjectID) error
+}
+
+// Deliveries is the durable delivery queue and log.
+type Deliveries interface {
+	Enqueue(ctx context.Context, ds []Delivery) error
+	// Claim returns the pending delivery that has been due longest and
+	// pushes its NextAttemptAt lease into the future, so that no other
+	// dispatcher picks it up meanwhile. It returns nil when none is due.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (*Delivery, error)
+	// Update stores the outcome of an attempt.
+	Update(ctx context.Context, d *Delivery) error
+	Get(ctx context.Context, id bson.ObjectID) (*Delivery, error)
+	// List returns the matching deliveries, newest first.
+	List(ctx context.Context, q DeliveryQuery) ([]Delivery, error)
+	// Redeliver makes a delivery pending again with a fresh set of
+	// attempts, due at now.
+	Redeliver(ctx context.Context, id bson.ObjectID, now time.Time) (*Delivery, error)
+}
+
+// MongoSubscriptions stores subscriptions in the webhook_subscriptions
+// collection.
+type MongoSubscriptions struct {
+	coll *mongo.Collection
+}
+
+// NewMongoSubscriptions creates a subscription store over coll.
+func NewMongoSubscriptions(coll *mongo.Collection) *MongoSubscriptions {
+	return &MongoSubscriptions{coll: coll}
+}
+
+// List implements Subscriptions.
+func (m *MongoSubscriptions) List(ctx context.Context) ([]Subscription, error) {
+	cur, err := m.coll.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	subs := []Subscription{}
+	if err := cur.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// Get implements Subscriptions.
+func (m *MongoSubscriptions) Get(ctx context.Context, id bson.ObjectID) (*Subscription, error) {
+	var s Subscription
+	err := m.coll.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook subscription: %w", err)
+	}
+	return &s, nil
+}
+
+// Put implements Subscriptions.
+func (m *MongoSubscriptions) Put(ctx context.Context, s *Subscription) error {
+	s.UpdatedAt = time.Now().UTC()
+	if s.ID.IsZero() {
+		s.ID, s.CreatedAt = bson.NewObjectID(), s.UpdatedAt
+		if _, err := m.coll.InsertOne(ctx, s); err != nil {
+			return fmt.Errorf("failed to insert webhook subscription: %w", err)
+		}
+		return nil
+	}
+	res, err := m.coll.ReplaceOne(ctx, bson.D{{Key: "_id", Value: s.ID}}, s)
+	if err != nil {
+		return fmt.Errorf("failed to replace webhook subscription: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete implements Subscriptions.
+func (m *MongoSubscriptions) Delete(ctx context.Context, id bson.ObjectID) error {
+	res, err := m.coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MongoDeliveries stores deliveries in the webhook_deliveries collection.
+type MongoDeliveries struct {
+	coll *mongo.Collection
+}
+
+// NewMongoDeliveries creates a delivery store over coll.
+func NewMongoDeliveries(coll *mongo.Collection) *MongoDeliveries {
+	return &MongoDeliveries{coll: coll}
+}
+
+// Enqueue implements Deliveries.
+func (m *MongoDeliveries) Enqueue(ctx context.Context, ds []Delivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	if _, err := m.coll.InsertMany(ctx, ds); err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// Claim implements Deliveries.
+func (m *MongoDeliveries) Claim(ctx context.Context, now time.Time, lease time.Duration) (*Delivery, error) {
+	filter := bson.D{
+		{Key: "status", Value: StatusPending},
+		{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "next_attempt_at", Value: now.Add(lease)}}}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}})
+	var d Delivery
+	err := m.coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+	return &d, nil
+}
+
+// Update implements Deliveries.
+func (m *MongoDeliveries) Update(ctx context.Context, d *Delivery) error {
+	_, err := m.coll.ReplaceOne(ctx, bson.D{{Key: "_id", Value: d.ID}}, d)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// Get implements Deliveries.
+func (m *MongoDeliveries) Get(ctx context.Context, id bson.ObjectID) (*Delivery, error) {
+	var d Delivery
+	err := m.coll.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook delivery: %w", err)
+	}
+	return &d, nil
+}
+
+// List implements Deliveries.
+func (m *MongoDeliveries) List(ctx context.Context, q DeliveryQuery) ([]Delivery, error) {
+	filter := bson.D{}
+	if !q.SubscriptionID.IsZero() {
+		filter = append(filter, bson.E{Key: "subscription_id", Value: q.SubscriptionID})
+	}
+	if q.Status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: q.Status})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+	cur, err := m.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	ds := []Delivery{}
+	if err := cur.All(ctx, &ds); err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return ds, nil
+}
+
+// Redeliver implements Deliveries.
+func (m *MongoDeliveries) Redeliver(ctx context.Context, id bson.ObjectID, now time.Time) (*Delivery, error) {
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: StatusPending},
+			{Key: "attempts", Value: 0},
+			{Key: "next_attempt_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}},
+		// The delivered_at TTL index must not expire a pending delivery.
+		{Key: "$unset", Value: bson.D{{Key: "delivered_at", Value: ""}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var d Delivery
+	err := m.coll.FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: id}}, update, opts).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeliver webhook delivery: %w", err)
+	}
+	return &d, nil
+}
+
+// MemorySubscriptions is an in-memory Subscriptions implementation for
+// tests.
+type MemorySubscriptions struct {
+	mu   sync.Mutex
+	subs []Subscription
+}
+
+// NewMemorySubscriptions creates an empty subscription store.
+func NewMemorySubscriptions() *MemorySubscriptions {
+	return &MemorySubscriptions{}
+}
+
+// List implements Subscriptions.
+func (m *MemorySubscriptions) List(_ context.Context) ([]Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Subscription{}, m.subs...), nil
+}
+
+// Get implements Subscriptions.
+func (m *MemorySubscriptions) Get(_ context.Context, id bson.ObjectID) (*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.subs, func(s Subscription) bool { return s.ID == id })
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	s := m.subs[i]
+	return &s, nil
+}
+
+// Put implements Subscriptions.
+func (m *MemorySubscriptions) Put(_ context.Context, s *Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.UpdatedAt = time.Now().UTC()
+	if s.ID.IsZero() {
+		s.ID, s.CreatedAt = bson.NewObjectID(), s.UpdatedAt
+		m.subs = append(m.subs, *s)
+		return nil
+	}
+	i := slices.IndexFunc(m.subs, func(o Subscription) bool { return o.ID == s.ID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.subs[i] = *s
+	return nil
+}
+
+// Delete implements Subscriptions.
+func (m *MemorySubscriptions) Delete(_ context.Context, id bson.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.subs, func(s Subscription) bool { return s.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.subs = slices.Delete(m.subs, i, i+1)
+	return nil
+}
+
+// MemoryDeliveries is an in-memory Deliveries implementation for tests.
+type MemoryDeliveries struct {
+	mu sync.Mutex
+	ds []Delivery
+}
+
+// NewMemoryDeliveries creates an empty delivery store.
+func NewMemoryDeliveries() *MemoryDeliveries {
+	return &MemoryDeliveries{}
+}
+
+// Enqueue implements Deliveries.
+func (m *MemoryDeliveries) Enqueue(_ context.Context, ds []Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ds = append(m.ds, ds...)
+	return nil
+}
+
+// Claim implements Deliveries.
+func (m *MemoryDeliveries) Claim(_ context.Context, now time.Time, lease time.Duration) (*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	best := -1
+	for i, d := range m.ds {
+		if d.Status != StatusPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+		if best < 0 || d.NextAttemptAt.Before(m.ds[best].NextAttemptAt) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, nil
+	}
+	d := m.ds[best]
+	m.ds[best].NextAttemptAt = now.Add(lease)
+	return &d, nil
+}
+
+// Update implements Deliveries.
+func (m *MemoryDeliveries) Update(_ context.Context, d *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := slices.IndexFunc(m.ds, func(o Delivery) bool { return o.ID == d.ID }); i >= 0 {
+		m.ds[i] = *d
+	}
+	return nil
+}
+
+// Get implements Deliveries.
+func (m *MemoryDeliveries) Get(_ context.Context, id bson.ObjectID) (*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.ds, func(d Delivery) bool { return d.ID == id })
+	if i < 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	d := m.ds[i]
+	return &d, nil
+}
+
+// List implements Deliveries.
+func (m *MemoryDeliveries) List(_ context.Context, q DeliveryQuery) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ds := []Delivery{}
+	for i := len(m.ds) - 1; i >= 0; i-- {
+		d := m.ds[i]
+		if (!q.SubscriptionID.IsZero() && d.SubscriptionID != q.SubscriptionID) || (q.Status != "" && d.Status != q.Status) {
+			continue
+		}
+		ds = append(ds, d)
+		if q.Limit > 0 && int64(len(ds)) == q.Limit {
+			break
+		}
+	}
+	return ds, nil
+}
+
+// Redeliver implements Deliveries.
+func (m *MemoryDeliveries) Redeliver(_ context.Context, id bson.ObjectID, now time.Time) (*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.ds, func(d Delivery) bool { return d.ID == id })
+	if i < 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	d := &m.ds[i]
+	d.Status, d.Attempts, d.NextAttemptAt, d.UpdatedAt, d.DeliveredAt = StatusPending, 0, now, now, nil
+	out := *d
+	return &out, nil
+}
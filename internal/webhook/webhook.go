@@ -0,0 +1,223 @@
+// Package webhook notifies downstream systems of new feedback. Subscriptions
+// name a URL, a signing secret and a filter; each accepted submission that
+// matches a subscription queues a delivery in MongoDB, and the Dispatcher
+// posts queued deliveries with HMAC-SHA256 signature headers, retrying with
+// exponential backoff until a delivery succeeds or is dead-lettered.
+//
+// Deliveries reference the feedback instead of copying it, so the queue
+// never holds comments in plaintext and erased feedback is never sent. The
+// payload is built when a delivery is attempted.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// EventFeedbackCreated is sent for every accepted, non-quarantined
+// submission that matches a subscription.
+const EventFeedbackCreated = "feedback.created"
+
+// Request headers set on every delivery.
+const (
+	HeaderEvent     = "X-NPS-Event"
+	HeaderDelivery  = "X-NPS-Delivery"
+	HeaderTimestamp = "X-NPS-Timestamp"
+	HeaderSignature = "X-NPS-Signature"
+)
+
+// Limits on subscriptions.
+const (
+	MaxURLLength    = 2048
+	MaxNameLength   = 200
+	MinSecretLength = 16
+)
+
+var validCategories = []string{"detractor", "passive", "promoter"}
+
+// Subscription is a downstream endpoint and the feedback it wants.
+type Subscription struct {
+	ID   bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name string        `bson:"name"          json:"name"`
+	URL  string        `bson:"url"           json:"url"`
+	// Secret keys the delivery signatures. It is generated when left empty
+	// on creation and only returned then.
+	Secret  string `bson:"secret"  json:"secret,omitempty"`
+	Filter  Filter `bson:"filter"  json:"filter"`
+	Enabled bool   `bson:"enabled" json:"enabled"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Filter selects the feedback a subscription receives. Empty fields match
+// everything; set fields must all match.
+type Filter struct {
+	Apps       []string `bson:"apps,omitempty"       json:"apps,omitempty"`
+	Categories []string `bson:"categories,omitempty" json:"categories,omitempty"`
+	// MinRating and MaxRating bound nps_rating, inclusive; zero is
+	// unbounded.
+	MinRating int `bson:"min_rating,omitempty" json:"min_rating,omitempty"`
+	MaxRating int `bson:"max_rating,omitempty" json:"max_rating,omitempty"`
+	// HasComment limits the subscription to feedback with a comment.
+	HasComment bool `bson:"has_comment,omitempty" json:"has_comment,omitempty"`
+}
+
+// Validate checks a subscription before it is stored. An empty secret is
+// accepted; the caller generates one for new subscriptions.
+func (s *Subscription) Validate() error {
+	if len(s.Name) > MaxNameLength {
+		return fmt.Errorf("name exceeds %d characters", MaxNameLength)
+	}
+	if len(s.URL) > MaxURLLength {
+		return fmt.Errorf("url exceeds %d characters", MaxURLLength)
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return errors.New("url must not contain credentials")
+	}
+	if s.Secret != "" && len(s.Secret) < MinSecretLength {
+		return fmt.Errorf("secret must be at least %d characters", MinSecretLength)
+	}
+	return s.Filter.validate()
+}
+
+func (f *Filter) validate() error {
+	if slices.Contains(f.Apps, "") {
+		return errors.New("filter.apps must not contain empty values")
+	}
+	for _, c := range f.Categories {
+		if !slices.Contains(validCategories, c) {
+			return fmt.Errorf("invalid filter category %q", c)
+		}
+	}
+	for _, r := range []int{f.MinRating, f.MaxRating} {
+		if r < 0 || r > 10 {
+			return errors.New("filter ratings must be between 1 and 10")
+		}
+	}
+	if f.MinRating > 0 && f.MaxRating > 0 && f.MinRating > f.MaxRating {
+		return errors.New("filter.min_rating must not be greater than filter.max_rating")
+	}
+	return nil
+}
+
+// Matches reports whether fb passes the filter. It works on stored
+// feedback, whose comment may be encrypted.
+func (f *Filter) Matches(fb *model.Feedback) bool {
+	if len(f.Apps) > 0 && !slices.Contains(f.Apps, fb.App) {
+		return false
+	}
+	if len(f.Categories) > 0 && !slices.Contains(f.Categories, fb.NPSCategory) {
+		return false
+	}
+	if f.MinRating > 0 && fb.NPSRating < f.MinRating {
+		return false
+	}
+	if f.MaxRating > 0 && fb.NPSRating > f.MaxRating {
+		return false
+	}
+	if f.HasComment && fb.Comment == "" && fb.CommentEnc == nil {
+		return false
+	}
+	return true
+}
+
+// Redacted returns a copy of s without its secret, for responses.
+func (s Subscription) Redacted() Subscription {
+	s.Secret = ""
+	return s
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// Sign returns the hex HMAC-SHA256 of timestamp, a dot and body under
+// secret, as sent in HeaderSignature.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery signature in constant time. Receivers should
+// also reject timestamps too far from their clock to stop replays.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	want, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return false
+	}
+	got, _ := hex.DecodeString(Sign(secret, timestamp, body))
+	return hmac.Equal(got, want)
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event      string          `json:"event"`
+	DeliveryID string          `json:"delivery_id"`
+	Feedback   FeedbackPayload `json:"feedback"`
+}
+
+// FeedbackPayload is the feedback as delivered: the submitted fields, with
+// comment and answers redacted and decrypted. The install ID and the spam
+// and import metadata are left out.
+type FeedbackPayload struct {
+	ID            string         `json:"id"`
+	SchemaVersion string         `json:"schema_version"`
+	App           string         `json:"app"`
+	AppVersion    string         `json:"app_version"`
+	Platform      string         `json:"platform"`
+	Timestamp     string         `json:"timestamp"`
+	NPSRating     int            `json:"nps_rating"`
+	NPSCategory   string         `json:"nps_category"`
+	Timezone      string         `json:"timezone,omitempty"`
+	Comment       string         `json:"comment,omitempty"`
+	Locale        string         `json:"locale,omitempty"`
+	SurveyID      string         `json:"survey_id,omitempty"`
+	SurveyVersion int            `json:"survey_version,omitempty"`
+	Answers       []model.Answer `json:"answers,omitempty"`
+	ReceivedAt    time.Time      `json:"received_at"`
+}
+
+// NewFeedbackPayload returns the payload for fb, whose comment and answers
+// must not be encrypted.
+func NewFeedbackPayload(fb *model.Feedback) FeedbackPayload {
+	return FeedbackPayload{
+		ID:            fb.ID.Hex(),
+		SchemaVersion: fb.SchemaVersion,
+		App:           fb.App,
+		AppVersion:    fb.AppVersion,
+		Platform:      fb.Platform,
+		Timestamp:     fb.Timestamp,
+		NPSRating:     fb.NPSRating,
+		NPSCategory:   fb.NPSCategory,
+		Timezone:      fb.Timezone,
+		Comment:       fb.Comment,
+		Locale:        fb.Locale,
+		SurveyID:      fb.SurveyID,
+		SurveyVersion: fb.SurveyVersion,
+		Answers:       fb.Answers,
+		ReceivedAt:    fb.ReceivedAt,
+	}
+}
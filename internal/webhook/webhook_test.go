@@ -0,0 +1,285 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+func TestFilter_Matches(t *testing.T) {
+	fb := &model.Feedback{App: "idefinity", NPSRating: 4, NPSCategory: "detractor", Comment: "Slow sync"}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"app", Filter{Apps: []string{"idefinity"}}, true},
+		{"other app", Filter{Apps: []string{"other"}}, false},
+		{"category", Filter{Categories: []string{"detractor", "passive"}}, true},
+		{"other category", Filter{Categories: []string{"promoter"}}, false},
+		{"rating range", Filter{MinRating: 1, MaxRating: 6}, true},
+		{"above max", Filter{MaxRating: 3}, false},
+		{"below min", Filter{MinRating: 5}, false},
+		{"has comment", Filter{HasComment: true}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(fb); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	silent := &model.Feedback{NPSRating: 4}
+	if (&Filter{HasComment: true}).Matches(silent) {
+		t.Error("expected has_comment to reject feedback without a comment")
+	}
+	encrypted := &model.Feedback{NPSRating: 4, CommentEnc: &model.Sealed{KeyID: "k1"}}
+	if !(&Filter{HasComment: true}).Matches(encrypted) {
+		t.Error("expected has_comment to accept an encrypted comment")
+	}
+}
+
+func TestSubscription_Validate(t *testing.T) {
+	valid := Subscription{URL: "https://hooks.example.com/nps"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid subscription, got %v", err)
+	}
+	tests := map[string]Subscription{
+		"relative url":    {URL: "/hook"},
+		"ftp url":         {URL: "ftp://example.com/hook"},
+		"credentials":     {URL: "https://user:pw@example.com/hook"},
+		"short secret":    {URL: "https://example.com", Secret: "short"},
+		"bad category":    {URL: "https://example.com", Filter: Filter{Categories: []string{"fan"}}},
+		"rating range":    {URL: "https://example.com", Filter: Filter{MinRating: 8, MaxRating: 3}},
+		"rating too high": {URL: "https://example.com", Filter: Filter{MaxRating: 11}},
+		"empty app":       {URL: "https://example.com", Filter: Filter{Apps: []string{""}}},
+	}
+	for name, s := range tests {
+		if err := s.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"feedback.created"}`)
+	sig := Sign("whsec_test", "1700000000", body)
+	if !Verify("whsec_test", "1700000000", body, sig) {
+		t.Error("expected signature to verify")
+	}
+	if Verify("whsec_test", "1700000001", body, sig) {
+		t.Error("expected another timestamp to fail")
+	}
+	if Verify("whsec_other", "1700000000", body, sig) {
+		t.Error("expected another secret to fail")
+	}
+	if Verify("whsec_test", "1700000000", body, "not-hex") {
+		t.Error("expected a malformed signature to fail")
+	}
+}
+
+// receiver is a webhook endpoint that answers with the queued statuses and
+// then 204, recording each request.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	status := http.StatusNoContent
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+type fixture struct {
+	subs       *MemorySubscriptions
+	deliveries *MemoryDeliveries
+	notifier   *Notifier
+	dispatcher *Dispatcher
+	feedback   map[bson.ObjectID]*model.Feedback
+	now        time.Time
+}
+
+func newFixture(t *testing.T, url string) *fixture {
+	t.Helper()
+	f := &fixture{
+		subs:       NewMemorySubscriptions(),
+		deliveries: NewMemoryDeliveries(),
+		feedback:   map[bson.ObjectID]*model.Feedback{},
+		now:        time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	f.notifier = NewNotifier(f.subs, f.deliveries, time.Minute)
+	f.notifier.now = func() time.Time { return f.now }
+	load := func(_ context.Context, id bson.ObjectID) (*model.Feedback, error) {
+		fb, ok := f.feedback[id]
+		if !ok {
+			return nil, ErrFeedbackNotFound
+		}
+		return fb, nil
+	}
+	f.dispatcher = NewDispatcher(f.subs, f.deliveries, load, DispatcherConfig{
+		MaxAttempts: 3,
+		MinBackoff:  time.Minute,
+		MaxBackoff:  10 * time.Minute,
+	})
+	f.dispatcher.now = func() time.Time { return f.now }
+
+	sub := &Subscription{Name: "crm", URL: url, Secret: "whsec_0123456789abcdef", Enabled: true,
+		Filter: Filter{Categories: []string{"detractor"}}}
+	if err := f.subs.Put(context.Background(), sub); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// submit stores fb and notifies, as FeedbackHandler.Submit does.
+func (f *fixture) submit(t *testing.T, fb *model.Feedback) {
+	t.Helper()
+	fb.ID = bson.NewObjectID()
+	f.feedback[fb.ID] = fb
+	if err := f.notifier.Notify(context.Background(), fb); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fixture) run(t *testing.T) int {
+	t.Helper()
+	n, err := f.dispatcher.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func (f *fixture) only(t *testing.T) Delivery {
+	t.Helper()
+	ds, _ := f.deliveries.List(context.Background(), DeliveryQuery{})
+	if len(ds) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(ds))
+	}
+	return ds[0]
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	f := newFixture(t, srv.URL)
+
+	f.submit(t, &model.Feedback{App: "idefinity", NPSRating: 9, NPSCategory: "promoter"})
+	f.submit(t, &model.Feedback{App: "idefinity", NPSRating: 2, NPSCategory: "detractor", Comment: "Crashes", InstallID: "hashed"})
+	f.submit(t, &model.Feedback{App: "idefinity", NPSRating: 1, NPSCategory: "detractor", Quarantine: true})
+
+	if n := f.run(t); n != 1 {
+		t.Fatalf("expected 1 attempt, got %d", n)
+	}
+	d := f.only(t)
+	if d.Status != StatusDelivered || d.Attempts != 1 || d.DeliveredAt == nil {
+		t.Errorf("expected delivered after 1 attempt, got %+v", d)
+	}
+
+	req, body := rc.requests[0], rc.bodies[0]
+	if req.Header.Get(HeaderEvent) != EventFeedbackCreated || req.Header.Get(HeaderDelivery) != d.ID.Hex() {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	if !Verify("whsec_0123456789abcdef", req.Header.Get(HeaderTimestamp), body, req.Header.Get(HeaderSignature)) {
+		t.Error("expected the signature to verify")
+	}
+	var p struct {
+		Payload
+		Feedback map[string]any `json:"feedback"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Event != EventFeedbackCreated || p.Feedback["comment"] != "Crashes" {
+		t.Errorf("unexpected payload %s", body)
+	}
+	if _, ok := p.Feedback["install_id"]; ok {
+		t.Error("expected the install ID to be left out")
+	}
+}
+
+func TestDispatcher_RetriesWithBackoffThenDeadLetters(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	f := newFixture(t, srv.URL)
+	f.submit(t, &model.Feedback{App: "idefinity", NPSRating: 3, NPSCategory: "detractor"})
+
+	f.run(t)
+	d := f.only(t)
+	if d.Status != StatusPending || d.LastStatusCode != 500 || !d.NextAttemptAt.Equal(f.now.Add(time.Minute)) {
+		t.Fatalf("expected a retry in 1m after a 500, got %+v", d)
+	}
+	if n := f.run(t); n != 0 {
+		t.Fatalf("expected nothing due before the backoff, got %d", n)
+	}
+
+	f.now = f.now.Add(time.Minute)
+	f.run(t)
+	if d = f.only(t); !d.NextAttemptAt.Equal(f.now.Add(2 * time.Minute)) {
+		t.Fatalf("expected the backoff to double, got %+v", d)
+	}
+
+	f.now = f.now.Add(2 * time.Minute)
+	f.run(t)
+	if d = f.only(t); d.Status != StatusDead || d.Attempts != 3 || d.LastStatusCode != 503 {
+		t.Fatalf("expected dead after 3 attempts, got %+v", d)
+	}
+
+	// Redelivery starts over and, with the endpoint fixed, succeeds.
+	if _, err := f.deliveries.Redeliver(context.Background(), d.ID, f.now); err != nil {
+		t.Fatal(err)
+	}
+	f.run(t)
+	if d = f.only(t); d.Status != StatusDelivered || d.Attempts != 1 {
+		t.Fatalf("expected delivered after redelivery, got %+v", d)
+	}
+}
+
+func TestDispatcher_DeadLettersWhenGone(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	f := newFixture(t, srv.URL)
+	fb := &model.Feedback{App: "idefinity", NPSRating: 0, NPSCategory: "detractor"}
+	f.submit(t, fb)
+	delete(f.feedback, fb.ID)
+
+	f.run(t)
+	if d := f.only(t); d.Status != StatusDead || d.LastError != "feedback no longer exists" {
+		t.Errorf("expected dead letter for erased feedback, got %+v", d)
+	}
+	if len(rc.requests) != 0 {
+		t.Error("expected no request for erased feedback")
+	}
+}
+
+func TestBackoff_Caps(t *testing.T) {
+	d := NewDispatcher(nil, nil, nil, DispatcherConfig{MinBackoff: time.Minute, MaxBackoff: 5 * time.Minute})
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, w := range want {
+		if got := d.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
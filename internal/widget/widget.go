@@ -0,0 +1,59 @@
+// Package widget holds the website feedback widget: a self-contained script
+// that renders the NPS prompt on any page and posts to the browser
+// submission endpoint, and the plain HTML form that is the fallback for
+// browsers without JavaScript. Both are embedded in the binary.
+package widget
+
+import (
+	"embed"
+	"html/template"
+	"io"
+)
+
+//go:embed widget.js
+var script []byte
+
+//go:embed templates
+var templates embed.FS
+
+var pages = template.Must(template.ParseFS(templates, "templates/*.html"))
+
+// Script returns the widget script.
+func Script() []byte {
+	return script
+}
+
+// Ratings are the scores the prompt offers: the full NPS scale, which the
+// browser submission endpoint accepts.
+var Ratings = []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+// Form is what the form page is rendered from. App and AppVersion are
+// carried in hidden fields; Rating and Comment refill the form after an
+// error.
+type Form struct {
+	Action     string
+	App        string
+	AppVersion string
+	Locale     string
+	Rating     *int
+	Comment    string
+	Error      string
+}
+
+// Checked reports whether rating was chosen before.
+func (f Form) Checked(rating int) bool {
+	return f.Rating != nil && *f.Rating == rating
+}
+
+// RenderForm writes the fallback form page.
+func RenderForm(w io.Writer, f Form) error {
+	return pages.ExecuteTemplate(w, "form.html", struct {
+		Form
+		Ratings []int
+	}{f, Ratings})
+}
+
+// RenderThanks writes the page shown after a form submission.
+func RenderThanks(w io.Writer) error {
+	return pages.ExecuteTemplate(w, "thanks.html", nil)
+}
@@ -0,0 +1,198 @@
+// NPS feedback widget. Include it with
+//
+//   <script src="https://api.example.com/nps/web/v1/widget.js" data-app="website" async></script>
+//
+// Attributes on the script tag:
+//   data-app          app name recorded with the feedback (required)
+//   data-app-version  app version, "web" by default
+//   data-target       CSS selector of an element to render into; without it
+//                     the prompt floats in the bottom right corner
+//   data-question     the question, overriding the default
+//   data-delay        seconds to wait before showing the floating prompt
+//   data-snooze-days  days to stay hidden after a submission or dismissal,
+//                     90 by default
+//
+// It posts to the feedback endpoint next to the script and depends on
+// nothing else, so it also works on pages with no network access beyond the
+// API.
+(function () {
+  "use strict";
+
+  var script = document.currentScript;
+  if (!script || !script.dataset.app) {
+    if (window.console) console.warn("nps widget: data-app is required");
+    return;
+  }
+  var opts = script.dataset;
+  var endpoint = new URL("feedback", script.src).href;
+  var snoozeKey = "nps-widget-snooze:" + opts.app;
+  var installKey = "nps-widget-install";
+  var snoozeDays = Number(opts.snoozeDays || 90);
+
+  function storage() {
+    try {
+      return window.localStorage;
+    } catch (e) {
+      return null;
+    }
+  }
+
+  function snoozed() {
+    var s = storage();
+    return !!s && Number(s.getItem(snoozeKey) || 0) > Date.now();
+  }
+
+  function snooze() {
+    var s = storage();
+    if (s) s.setItem(snoozeKey, String(Date.now() + snoozeDays * 864e5));
+  }
+
+  function randomID() {
+    if (window.crypto && crypto.randomUUID) return crypto.randomUUID();
+    return Date.now().toString(36) + Math.random().toString(36).slice(2);
+  }
+
+  // installID is a random per-browser ID, used by the server's spam scoring
+  // like the desktop app's install ID.
+  function installID() {
+    var s = storage();
+    if (!s) return "";
+    var id = s.getItem(installKey);
+    if (!id) {
+      id = randomID();
+      s.setItem(installKey, id);
+    }
+    return id;
+  }
+
+  var css =
+    ":host { all: initial; }" +
+    ".box { font: 14px/1.45 system-ui, -apple-system, 'Segoe UI', Roboto, sans-serif; color: #1d2330;" +
+    " background: #fff; border: 1px solid #d0d5dd; border-radius: 10px; padding: 16px; max-width: 420px;" +
+    " box-sizing: border-box; position: relative; }" +
+    ".floating { position: fixed; right: 16px; bottom: 16px; z-index: 2147483000;" +
+    " box-shadow: 0 6px 24px rgba(0,0,0,.15); }" +
+    ".question { font-weight: 600; margin: 0 24px 10px 0; }" +
+    ".scale { display: flex; gap: 4px; }" +
+    ".scale button { flex: 1; min-width: 0; padding: 6px 0; font: inherit; border: 1px solid #d0d5dd;" +
+    " border-radius: 6px; background: #fff; color: inherit; cursor: pointer; }" +
+    ".scale button[aria-pressed=true] { background: #3b6fd8; border-color: #3b6fd8; color: #fff; }" +
+    ".ends { display: flex; justify-content: space-between; font-size: 12px; color: #667085; margin-top: 4px; }" +
+    "textarea { width: 100%; box-sizing: border-box; margin-top: 10px; font: inherit; }" +
+    ".send { margin-top: 8px; padding: 6px 14px; font: inherit; border: 0; border-radius: 6px;" +
+    " background: #3b6fd8; color: #fff; cursor: pointer; }" +
+    ".send:disabled { opacity: .5; cursor: default; }" +
+    ".close { position: absolute; top: 8px; right: 10px; border: 0; background: none; font-size: 18px;" +
+    " color: #667085; cursor: pointer; }" +
+    ".error { color: #d64545; margin: 8px 0 0; }" +
+    "[hidden] { display: none !important; }";
+
+  function el(tag, attrs, text) {
+    var e = document.createElement(tag);
+    for (var k in attrs) e.setAttribute(k, attrs[k]);
+    if (text) e.textContent = text;
+    return e;
+  }
+
+  function render(host, floating) {
+    var root = host.attachShadow ? host.attachShadow({ mode: "open" }) : host;
+    var style = el("style");
+    style.textContent = css;
+    var box = el("div", { class: floating ? "box floating" : "box", role: "dialog", "aria-label": "Feedback" });
+    var question = el("p", { class: "question" },
+      opts.question || "How likely are you to recommend us to a friend or colleague?");
+    var scale = el("div", { class: "scale", role: "group", "aria-label": "Score from 0 to 10" });
+    var comment = el("textarea", { rows: "3", maxlength: "2000", placeholder: "Tell us more (optional)", hidden: "" });
+    var send = el("button", { class: "send", type: "button", disabled: "", hidden: "" }, "Send");
+    var error = el("p", { class: "error", role: "alert", hidden: "" });
+    var ends = el("div", { class: "ends" });
+    ends.append(el("span", {}, "Not likely"), el("span", {}, "Very likely"));
+    var rating = 0;
+
+    for (var i = 0; i <= 10; i++) {
+      (function (n) {
+        var b = el("button", { type: "button", "aria-pressed": "false" }, String(n));
+        b.addEventListener("click", function () {
+          rating = n;
+          scale.querySelectorAll("button").forEach(function (o) {
+            o.setAttribute("aria-pressed", String(o === b));
+          });
+          comment.hidden = send.hidden = false;
+          send.disabled = false;
+          comment.focus();
+        });
+        scale.append(b);
+      })(i);
+    }
+
+    if (floating) {
+      var close = el("button", { class: "close", type: "button", "aria-label": "Close" }, "×");
+      close.addEventListener("click", function () {
+        snooze();
+        host.remove();
+      });
+      box.append(close);
+    }
+
+    var idemKey = randomID();
+    send.addEventListener("click", function () {
+      send.disabled = true;
+      error.hidden = true;
+      var body = {
+        schema_version: "1.3",
+        app: opts.app,
+        app_version: opts.appVersion || "web",
+        timestamp: new Date().toISOString(),
+        nps_rating: rating,
+        comment: comment.value.trim(),
+        locale: navigator.language || "",
+        install_id: installID()
+      };
+      fetch(endpoint, {
+        method: "POST",
+        headers: { "Content-Type": "application/json", "Idempotency-Key": idemKey },
+        body: JSON.stringify(body)
+      }).then(function (resp) {
+        if (!resp.ok) {
+          return resp.json().catch(function () { return {}; }).then(function (b) {
+            throw new Error(b.error || "Sending failed (" + resp.status + ").");
+          });
+        }
+        snooze();
+        box.replaceChildren(el("p", { class: "question" }, "Thank you for your feedback!"));
+        if (floating) setTimeout(function () { host.remove(); }, 3000);
+      }).catch(function (err) {
+        error.textContent = err.message || "Sending failed.";
+        error.hidden = false;
+        send.disabled = false;
+      });
+    });
+
+    box.append(question, scale, ends, comment, send, error);
+    root.append(style, box);
+  }
+
+  function start() {
+    var target = opts.target && document.querySelector(opts.target);
+    if (target) {
+      render(target, false);
+      return;
+    }
+    if (opts.target) {
+      if (window.console) console.warn("nps widget: no element matches " + opts.target);
+      return;
+    }
+    if (snoozed()) return;
+    setTimeout(function () {
+      var host = el("div", { "data-nps-widget": "" });
+      document.body.append(host);
+      render(host, true);
+    }, Number(opts.delay || 0) * 1000);
+  }
+
+  if (document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", start);
+  } else {
+    start();
+  }
+})();
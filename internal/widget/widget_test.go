@@ -0,0 +1,33 @@
+package widget
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRenderForm(t *testing.T) {
+	var buf bytes.Buffer
+	rating := 0
+	err := RenderForm(&buf, Form{Action: "feedback", App: `<b>site</b>`, AppVersion: "web", Rating: &rating, Error: "nps_rating is required"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	if strings.Contains(page, "<b>site</b>") || !strings.Contains(page, "&lt;b&gt;site&lt;/b&gt;") {
+		t.Error("expected the app name to be escaped")
+	}
+	if strings.Count(page, `name="nps_rating"`) != len(Ratings) || !strings.Contains(page, `value="0" required checked`) ||
+		strings.Count(page, "checked") != 1 {
+		t.Error("expected one radio button per rating with the previous choice checked")
+	}
+	if !strings.Contains(page, "nps_rating is required") {
+		t.Error("expected the error message")
+	}
+}
+
+func TestScript(t *testing.T) {
+	if !bytes.Contains(Script(), []byte(`new URL("feedback", script.src)`)) {
+		t.Error("expected the widget to post next to where it was loaded from")
+	}
+}
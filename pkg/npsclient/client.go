@@ -0,0 +1,341 @@
+package npsclient
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/middleware"
+)
+
+// feedbackPath is the submission endpoint, relative to Config.BaseURL.
+const feedbackPath = "/nps/api/v1/feedback"
+
+// Defaults for Config fields left zero.
+const (
+	DefaultMaxAttempts = 5
+	DefaultMinBackoff  = 500 * time.Millisecond
+	DefaultMaxBackoff  = 30 * time.Second
+	DefaultTimeout     = 10 * time.Second
+)
+
+// ErrQueued is returned, wrapping the delivery error, when a submission
+// could not be delivered and was saved to the queue instead. The caller can
+// treat it as success: Flush or Run delivers it later.
+var ErrQueued = errors.New("npsclient: submission queued for later delivery")
+
+// Config configures a Client.
+type Config struct {
+	// BaseURL is the service root, such as https://api.ruohomaki.fi.
+	BaseURL string
+	// APIKey is sent in X-API-Key when set.
+	APIKey string
+	// SigningKeyID and SigningSecret sign every request with the X-NPS-*
+	// headers when both are set.
+	SigningKeyID  string
+	SigningSecret string
+	// Language is sent as Accept-Language, so that validation errors come
+	// back in it (APIError.Message). The service knows en, fi and sv.
+	Language string
+
+	// HTTPClient defaults to a client with a DefaultTimeout timeout.
+	HTTPClient *http.Client
+	// MaxAttempts is how many times a submission is sent before Submit gives
+	// up on it, counting the first attempt.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the randomized delay between
+	// attempts, which doubles after every failure.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Queue keeps submissions that could not be delivered. Without one,
+	// Submit returns the delivery error.
+	Queue *Queue
+}
+
+// Client submits feedback. It is safe for concurrent use.
+type Client struct {
+	cfg      Config
+	endpoint string
+	wake     chan struct{}
+	flushing chan struct{}
+}
+
+// New creates a Client.
+func New(cfg Config) (*Client, error) {
+	if cfg.BaseURL == "" {
+		return nil, errors.New("npsclient: BaseURL is required")
+	}
+	if (cfg.SigningKeyID == "") != (cfg.SigningSecret == "") {
+		return nil, errors.New("npsclient: SigningKeyID and SigningSecret must be set together")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(DefaultMaxBackoff, cfg.MinBackoff)
+	}
+	return &Client{
+		cfg:      cfg,
+		endpoint: strings.TrimRight(cfg.BaseURL, "/") + feedbackPath,
+		wake:     make(chan struct{}, 1),
+		flushing: make(chan struct{}, 1),
+	}, nil
+}
+
+// APIError is a non-2xx response from the service.
+type APIError struct {
+	StatusCode int
+	// Message is the "error" field of the response body, if any, in
+	// Config.Language when the service has it.
+	Message string
+	// Code and Field identify a validation error independently of the
+	// message language, such as "required" and "app".
+	Code  string
+	Field string
+	// RetryAfter is the delay requested by a Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("npsclient: server returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("npsclient: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed if retried: server
+// errors and rate limiting. Other client errors, such as a rejected API key
+// or an invalid submission, are permanent.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// isPermanent reports whether err means the submission will never be
+// accepted, so retrying or queueing it is pointless.
+func isPermanent(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && !apiErr.Temporary()
+}
+
+// Submit validates fb and sends it, retrying transient failures with
+// exponential backoff. Every attempt carries the same Idempotency-Key, so a
+// retry after a lost response is not stored twice. When all attempts fail
+// and a Queue is configured, fb is queued and an error wrapping ErrQueued
+// is returned.
+func (c *Client) Submit(ctx context.Context, fb Feedback) error {
+	if err := fb.Validate(); err != nil {
+		return fmt.Errorf("npsclient: %w", err)
+	}
+	sub := submission{Key: newIdempotencyKey(), Feedback: fb}
+
+	err := c.send(ctx, sub)
+	if err == nil {
+		c.wakeFlusher()
+		return nil
+	}
+	if c.cfg.Queue == nil || isPermanent(err) {
+		return err
+	}
+	sub.QueuedAt = time.Now().UTC()
+	if qerr := c.cfg.Queue.add(sub); qerr != nil {
+		return errors.Join(err, qerr)
+	}
+	return fmt.Errorf("%w: %w", ErrQueued, err)
+}
+
+// send delivers sub, retrying until it succeeds, fails permanently, runs
+// out of attempts or ctx is done.
+func (c *Client) send(ctx context.Context, sub submission) error {
+	body, err := json.Marshal(sub.Feedback)
+	if err != nil {
+		return fmt.Errorf("npsclient: %w", err)
+	}
+	for attempt := 1; ; attempt++ {
+		err := c.post(ctx, sub.Key, body)
+		if err == nil || isPermanent(err) || attempt == c.cfg.MaxAttempts {
+			return err
+		}
+
+		delay := c.backoff(attempt)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > delay {
+			delay = min(apiErr.RetryAfter, c.cfg.MaxBackoff)
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// backoff returns the delay after the given failed attempt: a random value
+// between half and all of MinBackoff doubled per attempt, capped at
+// MaxBackoff.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.cfg.MaxBackoff
+	if attempt < 32 {
+		d = min(c.cfg.MinBackoff<<(attempt-1), c.cfg.MaxBackoff)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// post makes one delivery attempt.
+func (c *Client) post(ctx context.Context, key string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("npsclient: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	if c.cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", c.cfg.APIKey)
+	}
+	if c.cfg.Language != "" {
+		req.Header.Set("Accept-Language", c.cfg.Language)
+	}
+	if c.cfg.SigningKeyID != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := newIdempotencyKey()
+		sig := middleware.SignRequest([]byte(c.cfg.SigningSecret), req.Method, req.URL.RequestURI(), ts, nonce, body)
+		req.Header.Set(middleware.HeaderKeyID, c.cfg.SigningKeyID)
+		req.Header.Set(middleware.HeaderTimestamp, ts)
+		req.Header.Set(middleware.HeaderNonce, nonce)
+		req.Header.Set(middleware.HeaderSignature, hex.EncodeToString(sig))
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("npsclient: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil
+	}
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var payload struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+		Field string `json:"field"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&payload) == nil {
+		apiErr.Message, apiErr.Code, apiErr.Field = payload.Error, payload.Code, payload.Field
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+		apiErr.RetryAfter = time.Duration(s) * time.Second
+	}
+	return apiErr
+}
+
+// FlushResult reports what a Flush delivered.
+type FlushResult struct {
+	Sent int `json:"sent"`
+	// Rejected counts queued submissions the service refused permanently;
+	// they are removed from the queue.
+	Rejected int `json:"rejected"`
+	// Remaining is what is still queued.
+	Remaining int `json:"remaining"`
+}
+
+// Flush delivers queued submissions, oldest first, one attempt each. It
+// stops at the first transient failure and returns that error; the rest
+// stay queued. Only one Flush runs at a time; a concurrent call returns
+// immediately with the current queue length.
+func (c *Client) Flush(ctx context.Context) (FlushResult, error) {
+	var res FlushResult
+	q := c.cfg.Queue
+	if q == nil {
+		return res, nil
+	}
+	select {
+	case c.flushing <- struct{}{}:
+		defer func() { <-c.flushing }()
+	default:
+		res.Remaining, _ = q.Len()
+		return res, nil
+	}
+
+	names, err := q.list()
+	if err != nil {
+		return res, err
+	}
+	for i, name := range names {
+		sub, err := q.load(name)
+		if err != nil {
+			// An unreadable entry would block the queue forever.
+			res.Rejected++
+			q.remove(name)
+			continue
+		}
+		body, _ := json.Marshal(sub.Feedback)
+		err = c.post(ctx, sub.Key, body)
+		switch {
+		case err == nil:
+			res.Sent++
+		case isPermanent(err):
+			res.Rejected++
+		default:
+			res.Remaining = len(names) - i
+			return res, err
+		}
+		if err := q.remove(name); err != nil {
+			res.Remaining = len(names) - i - 1
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// Run flushes the queue every interval, and right after any Submit
+// succeeds, until ctx is done. Start it in its own goroutine.
+func (c *Client) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-c.wake:
+		}
+		c.Flush(ctx)
+	}
+}
+
+// wakeFlusher tells Run that the service is reachable again.
+func (c *Client) wakeFlusher() {
+	if c.cfg.Queue == nil {
+		return
+	}
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// newIdempotencyKey returns a random 128-bit key, also used as the signing
+// nonce.
+func newIdempotencyKey() string {
+	return crand.Text()
+}
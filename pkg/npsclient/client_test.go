@@ -0,0 +1,243 @@
+package npsclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/idefinity/nps-api/internal/handler"
+	"github.com/idefinity/nps-api/internal/middleware"
+	"github.com/idefinity/nps-api/internal/store"
+)
+
+const testAPIKey = "test-key"
+
+// newServer runs the real routes and API key middleware over a memory
+// store. wrap, if set, sits in front of them to inject failures.
+func newServer(t *testing.T, wrap func(http.Handler) http.Handler) (*httptest.Server, *store.Memory) {
+	t.Helper()
+	mem := store.NewMemory()
+	var h http.Handler = handler.RegisterRoutes(handler.Deps{Store: mem})
+	h = middleware.APIKey([]string{testAPIKey}, []string{"/nps/api/"})(h)
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv, mem
+}
+
+func newTestClient(t *testing.T, cfg Config) *Client {
+	t.Helper()
+	cfg.MinBackoff, cfg.MaxBackoff = time.Millisecond, 5*time.Millisecond
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSubmit_StoresFeedback(t *testing.T) {
+	srv, mem := newServer(t, nil)
+	c := newTestClient(t, Config{BaseURL: srv.URL, APIKey: testAPIKey})
+
+	fb := NewFeedback("idefinity", "1.4.0", "macOS", 6)
+	fb.Comment = "Too slow"
+	if err := c.Submit(context.Background(), fb); err != nil {
+		t.Fatal(err)
+	}
+
+	docs := mem.Feedback()
+	if len(docs) != 1 {
+		t.Fatalf("expected 1 stored document, got %d", len(docs))
+	}
+	if docs[0].NPSCategory != "detractor" || docs[0].Comment != "Too slow" || docs[0].IdempotencyKey == "" {
+		t.Errorf("unexpected stored document %+v", docs[0])
+	}
+}
+
+func TestSubmit_ValidatesLocally(t *testing.T) {
+	var calls atomic.Int32
+	srv, _ := newServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			next.ServeHTTP(w, r)
+		})
+	})
+	c := newTestClient(t, Config{BaseURL: srv.URL, APIKey: testAPIKey})
+
+	fb := NewFeedback("idefinity", "1.4.0", "macOS", 11)
+	if err := c.Submit(context.Background(), fb); err == nil {
+		t.Error("expected a validation error for rating 11")
+	}
+	if calls.Load() != 0 {
+		t.Errorf("invalid feedback was sent to the server")
+	}
+}
+
+func TestFeedback_WithMethodsOnlyRaiseSchema(t *testing.T) {
+	fb := NewFeedback("idefinity", "1.4.0", "macOS", 9).WithLocale("sv_fi").WithInstallID("install-1")
+	if fb.SchemaVersion != SchemaV1_3 || fb.Locale != "sv-FI" {
+		t.Errorf("expected schema 1.3 and locale sv-FI, got %q %q", fb.SchemaVersion, fb.Locale)
+	}
+	if err := fb.Validate(); err != nil {
+		t.Errorf("expected a valid submission, got %v", err)
+	}
+}
+
+func TestSubmit_LocalizedAPIError(t *testing.T) {
+	srv, _ := newServer(t, nil)
+	c := newTestClient(t, Config{BaseURL: srv.URL, APIKey: testAPIKey, Language: "fi"})
+
+	// Validate allows any platform; the server's allowlist does not.
+	err := c.Submit(context.Background(), NewFeedback("idefinity", "1.4.0", "Plan9", 9))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "invalid_value" || apiErr.Field != "platform" ||
+		apiErr.Message != `virheellinen platform: "Plan9"` {
+		t.Errorf("expected a Finnish validation error, got %v", err)
+	}
+}
+
+func TestSubmit_RetryAfterLostResponseStoresOnce(t *testing.T) {
+	var calls atomic.Int32
+	srv, mem := newServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= 2 {
+				// The submission is stored but the response is lost.
+				next.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	c := newTestClient(t, Config{BaseURL: srv.URL, APIKey: testAPIKey})
+
+	if err := c.Submit(context.Background(), NewFeedback("idefinity", "1.4.0", "macOS", 9)); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+	if n := len(mem.Feedback()); n != 1 {
+		t.Errorf("expected the retries to store 1 document, got %d", n)
+	}
+}
+
+func TestSubmit_DoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv, _ := newServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			next.ServeHTTP(w, r)
+		})
+	})
+	queue, _ := OpenQueue(t.TempDir(), 0)
+	c := newTestClient(t, Config{BaseURL: srv.URL, APIKey: "wrong", Queue: queue})
+
+	err := c.Submit(context.Background(), NewFeedback("idefinity", "1.4.0", "macOS", 9))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a 401 APIError, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 attempt, got %d", calls.Load())
+	}
+	if n, _ := queue.Len(); n != 0 {
+		t.Errorf("rejected submission was queued")
+	}
+}
+
+func TestQueue_FlushesWhenServiceReturns(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	srv, mem := newServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	dir := t.TempDir()
+	queue, err := OpenQueue(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, Config{BaseURL: srv.URL, APIKey: testAPIKey, MaxAttempts: 2, Queue: queue})
+
+	for _, rating := range []int{3, 10} {
+		if err := c.Submit(context.Background(), NewFeedback("idefinity", "1.4.0", "macOS", rating)); !errors.Is(err, ErrQueued) {
+			t.Fatalf("expected ErrQueued, got %v", err)
+		}
+	}
+	if res, err := c.Flush(context.Background()); err == nil || res.Remaining != 2 {
+		t.Fatalf("flush while down: got %+v, %v", res, err)
+	}
+
+	// A new client over the same directory, as after an app restart.
+	down.Store(false)
+	reopened, _ := OpenQueue(dir, 0)
+	c = newTestClient(t, Config{BaseURL: srv.URL, APIKey: testAPIKey, Queue: reopened})
+	res, err := c.Flush(context.Background())
+	if err != nil || res.Sent != 2 || res.Remaining != 0 {
+		t.Fatalf("flush: got %+v, %v", res, err)
+	}
+	docs := mem.Feedback()
+	if len(docs) != 2 || docs[0].NPSRating != 3 || docs[1].NPSRating != 10 {
+		t.Errorf("expected both submissions in order, got %+v", docs)
+	}
+	if n, _ := reopened.Len(); n != 0 {
+		t.Errorf("expected an empty queue, got %d", n)
+	}
+}
+
+func TestQueue_Full(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	queue, _ := OpenQueue(t.TempDir(), 1)
+	c := newTestClient(t, Config{BaseURL: srv.URL, MaxAttempts: 1, Queue: queue})
+
+	fb := NewFeedback("idefinity", "1.4.0", "macOS", 8)
+	if err := c.Submit(context.Background(), fb); !errors.Is(err, ErrQueued) {
+		t.Fatalf("expected ErrQueued, got %v", err)
+	}
+	if err := c.Submit(context.Background(), fb); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestSubmit_SignsRequests(t *testing.T) {
+	signed := middleware.Signature(middleware.SignatureConfig{
+		Secrets:         map[string]string{"ios": "s3cret"},
+		Mode:            middleware.SignatureRequired,
+		RequirePrefixes: []string{"/nps/api/"},
+	})
+	srv, mem := newServer(t, signed)
+	c := newTestClient(t, Config{BaseURL: srv.URL, APIKey: testAPIKey, SigningKeyID: "ios", SigningSecret: "s3cret"})
+
+	if err := c.Submit(context.Background(), NewFeedback("idefinity", "1.4.0", "macOS", 9).WithInstallID("install-1")); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(mem.Feedback()); n != 1 {
+		t.Errorf("expected 1 stored document, got %d", n)
+	}
+}
+
+func TestBackoff_Bounds(t *testing.T) {
+	c, _ := New(Config{BaseURL: "http://localhost", MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second, 40: time.Second} {
+		for range 20 {
+			if d := c.backoff(attempt); d < max/2 || d > max {
+				t.Errorf("attempt %d: delay %v outside [%v, %v]", attempt, d, max/2, max)
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package npsclient submits NPS feedback to the nps-api service. It
+// validates submissions with the same rules as the server, retries
+// transient failures with exponential backoff under a per-submission
+// idempotency key, and can park submissions in an on-disk queue while the
+// service is unreachable.
+//
+//	c, err := npsclient.New(npsclient.Config{
+//		BaseURL: "https://api.ruohomaki.fi",
+//		APIKey:  os.Getenv("NPS_API_KEY"),
+//	})
+//	fb := npsclient.NewFeedback("idefinity", "1.4.0", "macOS", 9)
+//	fb.Comment = "Great tool"
+//	err = c.Submit(ctx, fb)
+package npsclient
+
+import (
+	"time"
+
+	"github.com/idefinity/nps-api/internal/i18n"
+	"github.com/idefinity/nps-api/internal/model"
+)
+
+// Schema versions. 1.1 adds InstallID; 1.2 adds the survey fields; 1.3
+// adds Locale.
+const (
+	SchemaV1_0 = model.SchemaV1_0
+	SchemaV1_1 = model.SchemaV1_1
+	SchemaV1_2 = model.SchemaV1_2
+	SchemaV1_3 = model.SchemaV1_3
+)
+
+// Feedback is one NPS submission as sent to POST /nps/api/v1/feedback.
+type Feedback struct {
+	SchemaVersion string `json:"schema_version"`
+	App           string `json:"app"`
+	AppVersion    string `json:"app_version"`
+	Platform      string `json:"platform"`
+	Timestamp     string `json:"timestamp"`
+	NPSRating     int    `json:"nps_rating"`
+	NPSCategory   string `json:"nps_category"`
+	Timezone      string `json:"timezone,omitempty"`
+	Comment       string `json:"comment,omitempty"`
+	// InstallID is a random ID generated once per installation; it requires
+	// schema 1.1. The server stores only a salted hash of it.
+	InstallID string `json:"install_id,omitempty"`
+	// SurveyID, SurveyVersion and Answers respond to a survey definition;
+	// they require schema 1.2, which WithSurvey takes care of.
+	SurveyID      string   `json:"survey_id,omitempty"`
+	SurveyVersion int      `json:"survey_version,omitempty"`
+	Answers       []Answer `json:"answers,omitempty"`
+	// Locale is the language the prompt was shown in, such as fi or sv-FI;
+	// it requires schema 1.3, which WithLocale takes care of.
+	Locale string `json:"locale,omitempty"`
+}
+
+// Answer responds to one survey question: set Rating, Choices or Text to
+// match the question type.
+type Answer struct {
+	QuestionID string   `json:"question_id"`
+	Rating     *int     `json:"rating,omitempty"`
+	Choices    []string `json:"choices,omitempty"`
+	Text       string   `json:"text,omitempty"`
+}
+
+// NewFeedback returns a submission for rating with the category derived
+// from the rating and the timestamp set to now. Set Timezone, Comment and
+// InstallID as needed; setting InstallID also requires SchemaVersion 1.1,
+// which WithInstallID takes care of.
+func NewFeedback(app, appVersion, platform string, rating int) Feedback {
+	return Feedback{
+		SchemaVersion: SchemaV1_0,
+		App:           app,
+		AppVersion:    appVersion,
+		Platform:      platform,
+		Timestamp:     time.Now().Format(time.RFC3339),
+		NPSRating:     rating,
+		NPSCategory:   model.CategoryForRating(rating),
+	}
+}
+
+// WithInstallID returns a copy of f carrying installID under schema 1.1 or
+// later.
+func (f Feedback) WithInstallID(installID string) Feedback {
+	f.InstallID = installID
+	return f.atLeast(SchemaV1_1)
+}
+
+// WithSurvey returns a copy of f answering version of survey surveyID under
+// schema 1.2 or later. The server checks the answers against the definition.
+func (f Feedback) WithSurvey(surveyID string, version int, answers ...Answer) Feedback {
+	f.SurveyID, f.SurveyVersion, f.Answers = surveyID, version, answers
+	return f.atLeast(SchemaV1_2)
+}
+
+// WithLocale returns a copy of f in locale under schema 1.3. The locale is
+// normalized, so sv_fi becomes sv-FI.
+func (f Feedback) WithLocale(locale string) Feedback {
+	f.Locale = i18n.Normalize(locale)
+	return f.atLeast(SchemaV1_3)
+}
+
+// atLeast raises f's schema version to v, so the With methods can be
+// combined in any order.
+func (f Feedback) atLeast(v string) Feedback {
+	if !model.SchemaAtLeast(f.SchemaVersion, v) {
+		f.SchemaVersion = v
+	}
+	return f
+}
+
+// Validate applies the server's validation rules, except the platform
+// allowlist, which is server configuration: the platform only has to be set.
+// Answers are only checked for shape; the survey definition lives on the
+// server.
+func (f Feedback) Validate() error {
+	m := f.model()
+	return m.ValidateFields()
+}
+
+func (f Feedback) model() model.Feedback {
+	var answers []model.Answer
+	for _, a := range f.Answers {
+		answers = append(answers, model.Answer{QuestionID: a.QuestionID, Rating: a.Rating, Choices: a.Choices, Text: a.Text})
+	}
+	return model.Feedback{
+		SchemaVersion: f.SchemaVersion,
+		App:           f.App,
+		AppVersion:    f.AppVersion,
+		Platform:      f.Platform,
+		Timestamp:     f.Timestamp,
+		NPSRating:     f.NPSRating,
+		NPSCategory:   f.NPSCategory,
+		Timezone:      f.Timezone,
+		Comment:       f.Comment,
+		InstallID:     f.InstallID,
+		SurveyID:      f.SurveyID,
+		SurveyVersion: f.SurveyVersion,
+		Answers:       answers,
+		Locale:        f.Locale,
+	}
+}
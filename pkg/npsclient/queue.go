@@ -0,0 +1,129 @@
+package npsclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultQueueSize is the number of submissions a queue holds when
+// OpenQueue is given no limit.
+const DefaultQueueSize = 1000
+
+// ErrQueueFull is returned when a submission cannot be queued because the
+// queue is at its limit.
+var ErrQueueFull = errors.New("npsclient: queue is full")
+
+// submission is one delivery unit; queued ones are stored as JSON.
+type submission struct {
+	Key      string    `json:"idempotency_key"`
+	QueuedAt time.Time `json:"queued_at"`
+	Feedback Feedback  `json:"feedback"`
+}
+
+// Queue is an on-disk queue of submissions waiting for delivery, one JSON
+// file per submission in a directory. Entries survive restarts and keep
+// their idempotency key, so delivering one that had in fact reached the
+// service stores nothing twice. A directory must be used by one process at
+// a time.
+type Queue struct {
+	dir string
+	max int
+	mu  sync.Mutex
+	seq uint64
+}
+
+// OpenQueue opens or creates a queue in dir holding at most maxItems
+// submissions; zero or less means DefaultQueueSize.
+func OpenQueue(dir string, maxItems int) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("npsclient: failed to create queue directory: %w", err)
+	}
+	if maxItems <= 0 {
+		maxItems = DefaultQueueSize
+	}
+	return &Queue{dir: dir, max: maxItems}, nil
+}
+
+// Len returns the number of queued submissions.
+func (q *Queue) Len() (int, error) {
+	names, err := q.list()
+	return len(names), err
+}
+
+func (q *Queue) add(sub submission) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	names, err := q.list()
+	if err != nil {
+		return err
+	}
+	if len(names) >= q.max {
+		return ErrQueueFull
+	}
+
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return fmt.Errorf("npsclient: %w", err)
+	}
+	// Names sort by queue time; the sequence number keeps submissions queued
+	// within the same clock tick in order.
+	q.seq++
+	name := fmt.Sprintf("%020d-%06d-%s.json", sub.QueuedAt.UnixNano(), q.seq%1000000, sub.Key)
+
+	// Write then rename so a crash never leaves a half-written entry.
+	tmp := filepath.Join(q.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("npsclient: failed to queue submission: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("npsclient: failed to queue submission: %w", err)
+	}
+	return nil
+}
+
+// list returns the entry file names, oldest first.
+func (q *Queue) list() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("npsclient: failed to read queue: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (q *Queue) load(name string) (submission, error) {
+	var sub submission
+	data, err := os.ReadFile(filepath.Join(q.dir, name))
+	if err != nil {
+		return sub, err
+	}
+	if err := json.Unmarshal(data, &sub); err != nil {
+		return sub, err
+	}
+	if sub.Key == "" {
+		return sub, errors.New("queued submission has no idempotency key")
+	}
+	return sub, nil
+}
+
+func (q *Queue) remove(name string) error {
+	if err := os.Remove(filepath.Join(q.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("npsclient: failed to remove queued submission: %w", err)
+	}
+	return nil
+}
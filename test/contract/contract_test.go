@@ -0,0 +1,470 @@
+package contract
+
+// Contract tests for the feedback schemas in docs/.
+//
+// Every documented example (the schema files, the OpenAPI description and the
+// README) and a set of boundary cases generated from the schemas are posted
+// through the real routes, backed by in-memory stores, so the published
+// contract and the server cannot drift apart. They need no database:
+//
+//   go test ./test/contract/ -v
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/idefinity/nps-api/docs"
+	"github.com/idefinity/nps-api/internal/handler"
+	"github.com/idefinity/nps-api/internal/model"
+	"github.com/idefinity/nps-api/internal/privacy"
+	"github.com/idefinity/nps-api/internal/store"
+	"github.com/idefinity/nps-api/internal/survey"
+)
+
+const submitPath = "/nps/api/v1/feedback"
+
+// onboarding is the survey the schema examples answer. It is published
+// twice so that both version 1 and version 2 exist.
+const onboarding = `{"id":"onboarding","questions":[
+	{"id":"ease","type":"rating","scale":10,"prompt":{"en":"How easy was it to get started?"}},
+	{"id":"reason","type":"single_choice","prompt":{"en":"What held you back?"},
+	 "choices":[{"id":"performance","label":{"en":"Performance"}},{"id":"price","label":{"en":"Price"}}]},
+	{"id":"features","type":"multi_choice","prompt":{"en":"Which features do you use?"},
+	 "choices":[{"id":"export","label":{"en":"Export"}},{"id":"diagram","label":{"en":"Diagrams"}}]},
+	{"id":"details","type":"free_text","prompt":{"en":"Anything else?"}}]}`
+
+// schema is the subset of JSON Schema the feedback schemas use.
+type schema struct {
+	Ref         string             `json:"$ref"`
+	Type        string             `json:"type"`
+	Required    []string           `json:"required"`
+	Properties  map[string]*schema `json:"properties"`
+	Items       *schema            `json:"items"`
+	Definitions map[string]*schema `json:"definitions"`
+	Const       any                `json:"const"`
+	Enum        []any              `json:"enum"`
+	Minimum     *int               `json:"minimum"`
+	Maximum     *int               `json:"maximum"`
+	MinLength   *int               `json:"minLength"`
+	MaxLength   *int               `json:"maxLength"`
+	Pattern     string             `json:"pattern"`
+	Examples    []any              `json:"examples"`
+}
+
+// testCase is one submission and the response the contract calls for. A
+// rejection must name field, or an element of it when field is an array.
+type testCase struct {
+	name  string
+	body  map[string]any
+	want  int
+	field string
+}
+
+type server struct {
+	mux        http.Handler
+	store      *store.Memory
+	installIDs *privacy.InstallIDHasher
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+	installIDs, err := privacy.NewInstallIDHasher("contract-test-salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{store: store.NewMemory(), installIDs: installIDs}
+	s.mux = handler.RegisterRoutes(handler.Deps{
+		Store:             s.store,
+		SurveyDefinitions: survey.NewMemoryDefinitions(),
+		InstallIDs:        installIDs,
+	})
+	for range 2 {
+		if w := s.post("/nps/admin/v1/surveys", []byte(onboarding)); w.Code != http.StatusCreated {
+			t.Fatalf("publishing the onboarding survey: got %d %s", w.Code, w.Body)
+		}
+	}
+	return s
+}
+
+func (s *server) post(target string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	return w
+}
+
+// check submits tc and verifies the response and what was stored.
+func (s *server) check(t *testing.T, tc testCase) {
+	t.Helper()
+	body, err := json.Marshal(tc.body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(s.store.Feedback())
+	w := s.post(submitPath, body)
+	if w.Code != tc.want {
+		t.Fatalf("expected %d, got %d %s\nbody: %s", tc.want, w.Code, w.Body, body)
+	}
+	stored := s.store.Feedback()
+
+	if tc.want != http.StatusCreated {
+		if len(stored) != before {
+			t.Error("a rejected submission was stored")
+		}
+		var resp struct{ Field string }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Field != tc.field && !strings.HasPrefix(resp.Field, tc.field+"[") {
+			t.Errorf("expected the error on %q, got %s", tc.field, w.Body)
+		}
+		return
+	}
+
+	if len(stored) != before+1 {
+		t.Fatalf("expected one stored document, store has %d (was %d)", len(stored), before)
+	}
+	fb := stored[len(stored)-1]
+	if fb.ID.IsZero() || fb.ReceivedAt.IsZero() {
+		t.Errorf("stored document lacks id or received_at: %+v", fb)
+	}
+	s.checkStored(t, tc.body, fb)
+}
+
+// checkStored compares the stored document field by field with the
+// submission: every field must come back unchanged, except install_id,
+// which is stored hashed, and the server sets nothing else a client sent.
+func (s *server) checkStored(t *testing.T, sent map[string]any, fb model.Feedback) {
+	t.Helper()
+	want := roundTrip(t, sent)
+	if raw, ok := want["install_id"].(string); ok {
+		want["install_id"] = s.installIDs.Hash(raw)
+	}
+	got := roundTrip(t, fb)
+	delete(got, "id")
+	delete(got, "received_at")
+	for _, k := range sortedKeys(want, got) {
+		if !reflect.DeepEqual(want[k], got[k]) {
+			t.Errorf("%s: sent %v, stored %v", k, want[k], got[k])
+		}
+	}
+}
+
+func roundTrip(t *testing.T, v any) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func sortedKeys(maps ...map[string]any) []string {
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !slices.Contains(keys, k) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// loadSchemas returns the feedback schemas in docs/, keyed by file name.
+func loadSchemas(t *testing.T) map[string]*schema {
+	t.Helper()
+	names, err := fs.Glob(docs.FS, "feedback-v*.json")
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no feedback schemas found: %v", err)
+	}
+	schemas := map[string]*schema{}
+	for _, name := range names {
+		data, err := fs.ReadFile(docs.FS, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s schema
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(s.Examples) == 0 || len(s.documents()) != len(s.Examples) {
+			t.Errorf("%s has no examples, or examples that are not objects", name)
+		}
+		schemas[name] = &s
+	}
+	return schemas
+}
+
+// readmeExamples returns the bodies of the README's curl calls to the
+// submission endpoint.
+func readmeExamples(t *testing.T) []map[string]any {
+	t.Helper()
+	data, err := os.ReadFile("../../README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := regexp.MustCompile(`(?s)curl -X POST \S+` + regexp.QuoteMeta(submitPath) + `\s.*?-d '(\{.*?\})'`)
+	var examples []map[string]any
+	for _, m := range call.FindAllSubmatch(data, -1) {
+		var body map[string]any
+		if err := json.Unmarshal(m[1], &body); err != nil {
+			t.Fatalf("README example is not valid JSON: %v\n%s", err, m[1])
+		}
+		examples = append(examples, body)
+	}
+	if len(examples) == 0 {
+		t.Fatal("no submission example found in the README")
+	}
+	return examples
+}
+
+// openAPIExamples returns the request examples of the submission operation.
+func openAPIExamples(t *testing.T) map[string]map[string]any {
+	t.Helper()
+	data, err := fs.ReadFile(docs.FS, "openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			RequestBody struct {
+				Content map[string]struct {
+					Examples map[string]struct {
+						Value map[string]any `json:"value"`
+					} `json:"examples"`
+				} `json:"content"`
+			} `json:"requestBody"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	examples := map[string]map[string]any{}
+	for name, ex := range doc.Paths[submitPath]["post"].RequestBody.Content["application/json"].Examples {
+		examples[name] = ex.Value
+	}
+	if len(examples) == 0 {
+		t.Fatal("the submission operation has no examples")
+	}
+	return examples
+}
+
+func TestDocumentedExamples(t *testing.T) {
+	s := newServer(t)
+	var cases []testCase
+	schemas := loadSchemas(t)
+	for _, name := range sortedKeys(toAny(schemas)) {
+		for i, ex := range schemas[name].documents() {
+			cases = append(cases, testCase{name: fmt.Sprintf("%s/example-%d", name, i+1), body: ex, want: http.StatusCreated})
+		}
+	}
+	for i, ex := range readmeExamples(t) {
+		cases = append(cases, testCase{name: fmt.Sprintf("README/example-%d", i+1), body: ex, want: http.StatusCreated})
+	}
+	oas := openAPIExamples(t)
+	for _, name := range sortedKeys(toAny(oas)) {
+		cases = append(cases, testCase{name: "openapi/" + name, body: oas[name], want: http.StatusCreated})
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) { s.check(t, tc) })
+	}
+}
+
+func TestSchemaBoundaries(t *testing.T) {
+	s := newServer(t)
+	schemas := loadSchemas(t)
+	for _, name := range sortedKeys(toAny(schemas)) {
+		sc := schemas[name]
+		for _, tc := range boundaryCases(sc, sc.documents()[0]) {
+			t.Run(name+"/"+tc.name, func(t *testing.T) { s.check(t, tc) })
+		}
+	}
+}
+
+func toAny[V any](m map[string]V) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// boundaryCases derives submissions from base, a valid example of root: each
+// bound of an integer, a string of exactly its maxLength, each enum value,
+// and one step past each bound, a value outside the enum, a const violation
+// and each required field left out.
+//
+// Top-level properties are generated whether or not base sets them; in the
+// answers only the fields the example's answers use, since their type
+// depends on the question. Patterns, minLength and the const on app are not
+// enforced by the server and get no rejection cases: app_version and
+// timestamp are kept as sent, an empty install_id counts as absent, and one
+// deployment accepts feedback for several apps.
+func boundaryCases(root *schema, base map[string]any) []testCase {
+	var cases []testCase
+	add := func(name string, path []any, value any, want int, field string) {
+		body := deepCopy(base)
+		set(body, path, value)
+		// nps_category must match nps_rating, so the two move together.
+		if len(path) == 1 && path[0] == "nps_rating" {
+			if r, ok := value.(int); ok && r >= 1 && r <= 10 {
+				body["nps_category"] = model.CategoryForRating(r)
+			}
+		}
+		cases = append(cases, testCase{name: name, body: body, want: want, field: field})
+	}
+
+	var visit func(path []any, field string, s *schema)
+	visit = func(path []any, field string, s *schema) {
+		name := pathName(path)
+		if s.Minimum != nil {
+			add(name+"=min", path, *s.Minimum, http.StatusCreated, "")
+			add(name+"<min", path, *s.Minimum-1, http.StatusUnprocessableEntity, field)
+		}
+		if s.Maximum != nil {
+			add(name+"=max", path, *s.Maximum, http.StatusCreated, "")
+			add(name+">max", path, *s.Maximum+1, http.StatusUnprocessableEntity, field)
+		}
+		if s.MaxLength != nil && s.Pattern == "" {
+			// A two-byte character checks that the limit counts characters.
+			add(name+"=maxLength", path, strings.Repeat("ä", *s.MaxLength), http.StatusCreated, "")
+			add(name+">maxLength", path, strings.Repeat("ä", *s.MaxLength+1), http.StatusUnprocessableEntity, field)
+		}
+		for _, v := range s.Enum {
+			body := deepCopy(base)
+			set(body, path, v)
+			if name == "nps_category" {
+				body["nps_rating"] = ratingFor(v.(string))
+			}
+			cases = append(cases, testCase{name: fmt.Sprintf("%s=%v", name, v), body: body, want: http.StatusCreated})
+		}
+		if s.Enum != nil {
+			add(name+"=unknown", path, "unknown", http.StatusUnprocessableEntity, field)
+		}
+		if s.Const != nil && name != "app" {
+			add(name+"!=const", path, "0.0", http.StatusUnprocessableEntity, field)
+		}
+	}
+
+	for _, prop := range sortedKeys(toAny(root.Properties)) {
+		ps := root.resolve(root.Properties[prop])
+		if prop == "answers" {
+			answers, _ := base["answers"].([]any)
+			item := root.resolve(ps.Items)
+			for i, a := range answers {
+				a := a.(map[string]any)
+				for _, ap := range sortedKeys(toAny(item.Properties)) {
+					if _, ok := a[ap]; ok {
+						visit([]any{"answers", i, ap}, "answers", root.resolve(item.Properties[ap]))
+					}
+				}
+				for _, req := range item.Required {
+					body := deepCopy(base)
+					delete(body["answers"].([]any)[i].(map[string]any), req)
+					cases = append(cases, testCase{name: fmt.Sprintf("answers[%d] without %s", i, req), body: body,
+						want: http.StatusUnprocessableEntity, field: "answers"})
+				}
+			}
+			continue
+		}
+		visit([]any{prop}, prop, ps)
+	}
+	for _, req := range root.Required {
+		body := deepCopy(base)
+		delete(body, req)
+		cases = append(cases, testCase{name: "without " + req, body: body, want: http.StatusUnprocessableEntity, field: req})
+	}
+	return cases
+}
+
+// documents returns the examples that are objects, which for a top-level
+// schema are complete submissions.
+func (s *schema) documents() []map[string]any {
+	var docs []map[string]any
+	for _, ex := range s.Examples {
+		if m, ok := ex.(map[string]any); ok {
+			docs = append(docs, m)
+		}
+	}
+	return docs
+}
+
+// resolve follows a reference into root's definitions.
+func (root *schema) resolve(s *schema) *schema {
+	if name, ok := strings.CutPrefix(s.Ref, "#/definitions/"); ok {
+		return root.Definitions[name]
+	}
+	return s
+}
+
+// ratingFor returns a rating in category.
+func ratingFor(category string) int {
+	for r := 1; r <= 10; r++ {
+		if model.CategoryForRating(r) == category {
+			return r
+		}
+	}
+	return 0
+}
+
+func pathName(path []any) string {
+	var b strings.Builder
+	for _, p := range path {
+		switch p := p.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", p)
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, p)
+		}
+	}
+	return b.String()
+}
+
+// set stores value at path, a sequence of object keys and array indexes.
+func set(body map[string]any, path []any, value any) {
+	var cur any = body
+	for i, p := range path {
+		last := i == len(path)-1
+		switch p := p.(type) {
+		case string:
+			m := cur.(map[string]any)
+			if last {
+				m[p] = value
+				return
+			}
+			cur = m[p]
+		case int:
+			a := cur.([]any)
+			if last {
+				a[p] = value
+				return
+			}
+			cur = a[p]
+		}
+	}
+}
+
+func deepCopy(m map[string]any) map[string]any {
+	data, _ := json.Marshal(m)
+	var out map[string]any
+	json.Unmarshal(data, &out)
+	return out
+}
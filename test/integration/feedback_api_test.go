@@ -10,8 +10,21 @@ package integration
 // Tests are skipped automatically if MONGODB_URI is not set.
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/idefinity/nps-api/internal/db"
+	"github.com/idefinity/nps-api/internal/handler"
+	"github.com/idefinity/nps-api/internal/privacy"
+	"github.com/idefinity/nps-api/internal/stats"
 )
 
 func TestMain(m *testing.M) {
@@ -21,3 +34,95 @@ func TestMain(m *testing.M) {
 	}
 	os.Exit(m.Run())
 }
+
+// connect opens a fresh database for one test and drops it afterwards.
+func connect(t *testing.T) *db.Database {
+	t.Helper()
+	ctx := context.Background()
+	name := "nps_integration_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	database, err := db.Connect(ctx, os.Getenv("MONGODB_URI"), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		database.Collection("feedback").Database().Drop(ctx)
+		database.Close(ctx)
+	})
+	return database
+}
+
+func TestEraseInstall_UpdatesRollup(t *testing.T) {
+	database := connect(t)
+	hasher, err := privacy.NewInstallIDHasher("integration-salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := handler.RegisterRoutes(handler.Deps{DB: database, InstallIDs: hasher})
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	for _, installID := range []string{"erase-me", "erase-me", "keep-me"} {
+		body := `{"schema_version":"1.1","app":"idefinity","app_version":"1.0","platform":"macOS",` +
+			`"timestamp":"2026-03-01T10:00:00Z","nps_rating":9,"nps_category":"promoter","install_id":"` + installID + `"}`
+		if w := do(http.MethodPost, "/nps/api/v1/feedback", body); w.Code != http.StatusCreated {
+			t.Fatalf("submit: got %d %s", w.Code, w.Body)
+		}
+	}
+	if w := do(http.MethodDelete, "/nps/admin/v1/installs/erase-me/feedback", ""); w.Code != http.StatusOK {
+		t.Fatalf("erase: got %d %s", w.Code, w.Body)
+	}
+
+	ctx := context.Background()
+	if n, _ := database.Collection("feedback").CountDocuments(ctx, bson.D{}); n != 1 {
+		t.Errorf("expected 1 document left, got %d", n)
+	}
+	cur, err := database.Collection(stats.Collection).Find(ctx, bson.D{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rollups []stats.Daily
+	if err := cur.All(ctx, &rollups); err != nil {
+		t.Fatal(err)
+	}
+	var total, promoters int64
+	for _, d := range rollups {
+		total += d.Total
+		promoters += d.Promoter
+	}
+	if total != 1 || promoters != 1 {
+		t.Errorf("expected the rollup to count 1 promoter after erasure, got total %d, promoters %d", total, promoters)
+	}
+}
+
+func TestSubmit_IdempotencyKeyReused(t *testing.T) {
+	database := connect(t)
+	if _, err := db.NewMigrator(database).Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mux := handler.RegisterRoutes(handler.Deps{DB: database})
+	submit := func(rating int) *httptest.ResponseRecorder {
+		body := `{"schema_version":"1.0","app":"idefinity","app_version":"1.0","platform":"macOS",` +
+			`"timestamp":"2026-03-01T10:00:00Z","nps_rating":` + strconv.Itoa(rating) + `,"nps_category":"detractor"}`
+		req := httptest.NewRequest(http.MethodPost, "/nps/api/v1/feedback", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "same-key")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := submit(3); w.Code != http.StatusCreated {
+		t.Fatalf("first submit: got %d %s", w.Code, w.Body)
+	}
+	if w := submit(3); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry: got %d, replayed=%q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if w := submit(4); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("other request under the same key: expected 422, got %d %s", w.Code, w.Body)
+	}
+	if n, _ := database.Collection("feedback").CountDocuments(context.Background(), bson.D{}); n != 1 {
+		t.Errorf("expected 1 stored document, got %d", n)
+	}
+}